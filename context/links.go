@@ -10,6 +10,11 @@ package context
 
 import "github.com/omec-project/openapi/v2/models"
 
+// Links holds the HAL-style _links of a UriList. Next and Prev are only set
+// when the collection is paged.
 type Links struct {
-	Item []models.Link `json:"item" bson:"item"`
+	Self *models.Link  `json:"self,omitempty"`
+	Item []models.Link `json:"item"`
+	Next *models.Link  `json:"next,omitempty"`
+	Prev *models.Link  `json:"prev,omitempty"`
 }
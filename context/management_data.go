@@ -8,7 +8,7 @@
 package context
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -24,21 +24,15 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// NnrfNFManagementDataModel builds the profile stored for a registering NF.
+// The whole profile provided by the NF is kept so that every TS 29.510
+// attribute survives the register -> GET round trip; only the attributes the
+// NRF owns (heartBeatTimer, default plmnList) and the storage encoding of the
+// BSF address ranges are rewritten.
 func NnrfNFManagementDataModel(nf *models.NFProfile, nfprofile models.NFProfile) error {
-	if nfprofile.GetNfInstanceId() == "" {
-		return fmt.Errorf("NfInstanceId field is required")
-	}
-	nf.SetNfInstanceId(nfprofile.GetNfInstanceId())
-
-	if nfprofile.GetNfType() == "" {
-		return fmt.Errorf("NfType field is required")
-	}
-	nf.SetNfType(nfprofile.GetNfType())
-
-	if nfprofile.GetNfStatus() == "" {
-		return fmt.Errorf("NfStatus field is required")
+	if err := ValidateNFProfile(nfprofile); err != nil {
+		return err
 	}
-	nf.SetNfStatus(nfprofile.GetNfStatus())
 
 	plmnList, hasPlmnList := nfprofile.GetPlmnListOk()
 	nfPlmnList, err := buildNfProfilePlmnList(plmnList, hasPlmnList)
@@ -46,9 +40,10 @@ func NnrfNFManagementDataModel(nf *models.NFProfile, nfprofile models.NFProfile)
 		return err
 	}
 
-	nnrfNFManagementCondition(nf, nfprofile)
+	*nf = nfprofile
+	nnrfNFManagementCondition(nf)
 	nf.SetPlmnList(nfPlmnList)
-	nnrfNFManagementOption(nf, nfprofile)
+	EncodeBsfInfoRanges(nf)
 
 	return nil
 }
@@ -81,7 +76,7 @@ func SetsubscriptionId() string {
 	return id.String()
 }
 
-func nnrfNFManagementCondition(nf *models.NFProfile, nfprofile models.NFProfile) {
+func nnrfNFManagementCondition(nf *models.NFProfile) {
 	// HeartBeatTimer
 	if !factory.NrfConfig.Configuration.NfProfileExpiryEnable {
 		// setting 1day keepAliveTimer value
@@ -92,444 +87,44 @@ func nnrfNFManagementCondition(nf *models.NFProfile, nfprofile models.NFProfile)
 	}
 	nf.SetHeartBeatTimer(factory.NrfConfig.Configuration.NfKeepAliveTime)
 	logger.ManagementLog.Infof("heartbeat timer value: %d sec", nf.GetHeartBeatTimer())
-
-	// fqdn
-	if fqdn, ok := nfprofile.GetFqdnOk(); ok {
-		nf.SetFqdn(*fqdn)
-	}
-	// interPlmnFqdn
-	interPlmnFqdn, ok := nfprofile.GetInterPlmnFqdnOk()
-	if ok {
-		nf.SetInterPlmnFqdn(*interPlmnFqdn)
-	}
-	// ipv4Addresses
-	if ipv4Addresses, ok := nfprofile.GetIpv4AddressesOk(); ok {
-		a := make([]string, len(ipv4Addresses))
-		copy(a, ipv4Addresses)
-		nf.SetIpv4Addresses(a)
-	}
-	// ipv6Addresses
-	if ipv6Addresses, ok := nfprofile.GetIpv6AddressesOk(); ok {
-		a := make([]string, len(ipv6Addresses))
-		copy(a, ipv6Addresses)
-		nf.SetIpv6Addresses(a)
-	}
-}
-
-func nnrfNFManagementOption(nf *models.NFProfile, nfprofile models.NFProfile) {
-	copyBasicLists(nf, nfprofile)
-	copyPriorityCapacityLoad(nf, nfprofile)
-	copyLocality(nf, nfprofile)
-
-	copyUdrInfo(nf, nfprofile)
-	copyUdmInfo(nf, nfprofile)
-	copyAusfInfo(nf, nfprofile)
-	copyAmfInfo(nf, nfprofile)
-	copySmfInfo(nf, nfprofile)
-	copyUpfInfo(nf, nfprofile)
-	copyPcfInfo(nf, nfprofile)
-	copyBsfInfo(nf, nfprofile)
-	copyChfInfo(nf, nfprofile)
-
-	copyNrfInfo(nf, nfprofile)
-	copyRecoveryTime(nf, nfprofile)
-	copyNfServicePersistence(nf, nfprofile)
-	copyNfServices(nf, nfprofile)
-}
-
-func copyBasicLists(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// sNssais
-	if sNssais, ok := nfprofile.GetSNssaisOk(); ok {
-		a := make([]models.Snssai, len(sNssais))
-		copy(a, sNssais)
-		nf.SetSNssais(a)
-	}
-
-	// nsiList
-	if nsiList, ok := nfprofile.GetNsiListOk(); ok {
-		a := make([]string, len(nsiList))
-		copy(a, nsiList)
-		nf.SetNsiList(a)
-	}
-
-	// allowedPlmns
-	if allowedPlmns, ok := nfprofile.GetAllowedPlmnsOk(); ok {
-		a := make([]models.PlmnId, len(allowedPlmns))
-		copy(a, allowedPlmns)
-		nf.SetAllowedPlmns(a)
-	}
-
-	// allowedNfTypes
-	if allowedNfTypes, ok := nfprofile.GetAllowedNfTypesOk(); ok {
-		a := make([]models.NFType, len(allowedNfTypes))
-		copy(a, allowedNfTypes)
-		nf.SetAllowedNfTypes(a)
-	}
-	// allowedNfDomains
-	if allowedNfDomains, ok := nfprofile.GetAllowedNfDomainsOk(); ok {
-		a := make([]string, len(allowedNfDomains))
-		copy(a, allowedNfDomains)
-		nf.SetAllowedNfDomains(a)
-	}
-
-	// allowedNssais
-	if allowedNssais, ok := nfprofile.GetAllowedNssaisOk(); ok {
-		a := make([]models.Snssai, len(allowedNssais))
-		copy(a, allowedNssais)
-		nf.SetAllowedNssais(a)
-	}
-}
-
-func copyPriorityCapacityLoad(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// Priority: range [0, 65535] per TS 29.510 clause 6.1.6.2.2
-	// Use GetPriorityOk so that an explicitly set priority of 0 (highest
-	// priority) is not silently dropped.
-	if priority, ok := nfprofile.GetPriorityOk(); ok && *priority >= 0 && *priority <= 65535 {
-		nf.SetPriority(*priority)
-	}
-	// Capacity: range [0, 65535] per TS 29.510 clause 6.1.6.2.2
-	if capacity, ok := nfprofile.GetCapacityOk(); ok && *capacity >= 0 && *capacity <= 65535 {
-		nf.SetCapacity(*capacity)
-	}
-	// Load: range [0, 100] per TS 29.510 clause 6.1.6.2.2
-	if load, ok := nfprofile.GetLoadOk(); ok && *load >= 0 && *load <= 100 {
-		nf.SetLoad(*load)
-	}
-}
-
-func copyLocality(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// Locality
-	if nfprofile.GetLocality() != "" {
-		nf.SetLocality(nfprofile.GetLocality())
-	}
-}
-
-func copyUdrInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// udrInfo
-	if nfprofile.UdrInfo != nil {
-		a := models.NewUdrInfo()
-
-		if groupId, ok := nfprofile.UdrInfo.GetGroupIdOk(); ok {
-			a.SetGroupId(*groupId)
-		}
-
-		if supiRanges, ok := nfprofile.UdrInfo.GetSupiRangesOk(); ok {
-			a.SetSupiRanges(supiRanges)
-		}
-
-		if gpsiRanges, ok := nfprofile.UdrInfo.GetGpsiRangesOk(); ok {
-			a.SetGpsiRanges(gpsiRanges)
-		}
-
-		if externalGroupIdentifiersRanges, ok := nfprofile.UdrInfo.GetExternalGroupIdentifiersRangesOk(); ok {
-			a.SetExternalGroupIdentifiersRanges(externalGroupIdentifiersRanges)
-		}
-
-		if supportedDataSets, ok := nfprofile.UdrInfo.GetSupportedDataSetsOk(); ok {
-			a.SetSupportedDataSets(supportedDataSets)
-		}
-
-		nf.SetUdrInfo(*a)
-	}
-}
-
-func copyUdmInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// udmInfo
-	if nfprofile.UdmInfo != nil {
-		a := models.NewUdmInfo()
-
-		if groupId, ok := nfprofile.UdmInfo.GetGroupIdOk(); ok {
-			a.SetGroupId(*groupId)
-		}
-
-		if supiRanges, ok := nfprofile.UdmInfo.GetSupiRangesOk(); ok {
-			a.SetSupiRanges(supiRanges)
-		}
-
-		if gpsiRanges, ok := nfprofile.UdmInfo.GetGpsiRangesOk(); ok {
-			a.SetGpsiRanges(gpsiRanges)
-		}
-
-		if externalGroupIdentifiersRanges, ok := nfprofile.UdmInfo.GetExternalGroupIdentifiersRangesOk(); ok {
-			a.SetExternalGroupIdentifiersRanges(externalGroupIdentifiersRanges)
-		}
-
-		if routingIndicators, ok := nfprofile.UdmInfo.GetRoutingIndicatorsOk(); ok {
-			a.SetRoutingIndicators(routingIndicators)
-		}
-
-		nf.SetUdmInfo(*a)
-	}
-}
-
-func copyAusfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// ausfInfo
-	if nfprofile.AusfInfo != nil {
-		a := models.NewAusfInfo()
-
-		if groupId, ok := nfprofile.AusfInfo.GetGroupIdOk(); ok {
-			a.SetGroupId(*groupId)
-		}
-
-		if supiRanges, ok := nfprofile.AusfInfo.GetSupiRangesOk(); ok {
-			a.SetSupiRanges(supiRanges)
-		}
-
-		if routingIndicators, ok := nfprofile.AusfInfo.GetRoutingIndicatorsOk(); ok {
-			a.SetRoutingIndicators(routingIndicators)
-		}
-
-		nf.SetAusfInfo(*a)
-	}
-}
-
-func copyAmfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// amfInfo
-	if nfprofile.AmfInfo != nil {
-		a := models.NewAmfInfoWithDefaults()
-
-		if amfSetId, ok := nfprofile.AmfInfo.GetAmfSetIdOk(); ok {
-			a.SetAmfSetId(*amfSetId)
-		}
-
-		if amfRegionId, ok := nfprofile.AmfInfo.GetAmfRegionIdOk(); ok {
-			a.SetAmfRegionId(*amfRegionId)
-		}
-
-		if guamiList, ok := nfprofile.AmfInfo.GetGuamiListOk(); ok {
-			a.SetGuamiList(guamiList)
-		}
-
-		if taiList, ok := nfprofile.AmfInfo.GetTaiListOk(); ok {
-			a.SetTaiList(taiList)
-		}
-
-		if taiRangeList, ok := nfprofile.AmfInfo.GetTaiRangeListOk(); ok {
-			a.SetTaiRangeList(taiRangeList)
-		}
-
-		if backupInfoAmfFailure, ok := nfprofile.AmfInfo.GetBackupInfoAmfFailureOk(); ok {
-			a.SetBackupInfoAmfFailure(backupInfoAmfFailure)
-		}
-
-		if backupInfoAmfRemoval, ok := nfprofile.AmfInfo.GetBackupInfoAmfRemovalOk(); ok {
-			a.SetBackupInfoAmfRemoval(backupInfoAmfRemoval)
-		}
-
-		if nfprofile.AmfInfo.N2InterfaceAmfInfo.IsSet() {
-			a.N2InterfaceAmfInfo = nfprofile.AmfInfo.N2InterfaceAmfInfo
-		}
-		nf.SetAmfInfo(*a)
-	}
-}
-
-func copySmfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// smfInfo
-	if nfprofile.SmfInfo != nil {
-		a := models.NewSmfInfoWithDefaults()
-
-		if sNssaiSmfInfoList, ok := nfprofile.SmfInfo.GetSNssaiSmfInfoListOk(); ok {
-			a.SetSNssaiSmfInfoList(sNssaiSmfInfoList)
-		}
-
-		if taiList, ok := nfprofile.SmfInfo.GetTaiListOk(); ok {
-			a.SetTaiList(taiList)
-		}
-
-		if taiRangeList, ok := nfprofile.SmfInfo.GetTaiRangeListOk(); ok {
-			a.SetTaiRangeList(taiRangeList)
-		}
-
-		if pgwFqdn, ok := nfprofile.SmfInfo.GetPgwFqdnOk(); ok {
-			a.SetPgwFqdn(*pgwFqdn)
-		}
-
-		if accessType, ok := nfprofile.SmfInfo.GetAccessTypeOk(); ok {
-			a.SetAccessType(accessType)
-		}
-		nf.SetSmfInfo(*a)
-	}
-}
-
-func copyUpfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// upfInfo
-	if nfprofile.UpfInfo != nil {
-		a := models.NewUpfInfoWithDefaults()
-
-		if sNssaiUpfInfoList, ok := nfprofile.UpfInfo.GetSNssaiUpfInfoListOk(); ok {
-			a.SetSNssaiUpfInfoList(sNssaiUpfInfoList)
-		}
-
-		if smfServingArea, ok := nfprofile.UpfInfo.GetSmfServingAreaOk(); ok {
-			a.SetSmfServingArea(smfServingArea)
-		}
-
-		if interfaceUpfInfoList, ok := nfprofile.UpfInfo.GetInterfaceUpfInfoListOk(); ok {
-			a.SetInterfaceUpfInfoList(interfaceUpfInfoList)
-		}
-
-		a.SetIwkEpsInd(nfprofile.UpfInfo.GetIwkEpsInd())
-
-		nf.SetUpfInfo(*a)
-	}
 }
 
-func copyPcfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// pcfInfo
-	if nfprofile.PcfInfo != nil {
-		a := models.NewPcfInfo()
-
-		if dnnList, ok := nfprofile.PcfInfo.GetDnnListOk(); ok {
-			a.SetDnnList(dnnList)
-		}
-
-		if supiRanges, ok := nfprofile.PcfInfo.GetSupiRangesOk(); ok {
-			a.SetSupiRanges(supiRanges)
-		}
-
-		if rxDiamHost, ok := nfprofile.PcfInfo.GetRxDiamHostOk(); ok {
-			a.SetRxDiamHost(*rxDiamHost)
-		}
-
-		if rxDiamRealm, ok := nfprofile.PcfInfo.GetRxDiamRealmOk(); ok {
-			a.SetRxDiamRealm(*rxDiamRealm)
-		}
-		nf.SetPcfInfo(*a)
+// EncodeBsfInfoRanges stores the BSF IPv4/IPv6 range boundaries as decimal
+// integers so that discovery can compare them numerically. The BsfInfo and
+// its range slices are copied first to avoid mutating the caller's profile.
+func EncodeBsfInfoRanges(nf *models.NFProfile) {
+	if nf.BsfInfo == nil {
+		return
 	}
-}
-
-func copyBsfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// bsfInfo
-	if nfprofile.BsfInfo != nil {
-		a := models.NewBsfInfo()
+	bsfInfo := *nf.BsfInfo
 
-		if dnnList, ok := nfprofile.BsfInfo.GetDnnListOk(); ok {
-			a.SetDnnList(dnnList)
+	if ipv4AddressRanges, ok := bsfInfo.GetIpv4AddressRangesOk(); ok {
+		b := make([]models.Ipv4AddressRange, len(ipv4AddressRanges))
+		for i, rang := range ipv4AddressRanges {
+			b[i].SetStart(strconv.FormatInt(Ipv4ToInt(rang.GetStart()), 10))
+			b[i].SetEnd(strconv.FormatInt(Ipv4ToInt(rang.GetEnd()), 10))
 		}
-
-		if ipDomainList, ok := nfprofile.BsfInfo.GetIpDomainListOk(); ok {
-			a.SetIpDomainList(ipDomainList)
-		}
-
-		if ipv4AddressRanges, ok := nfprofile.BsfInfo.GetIpv4AddressRangesOk(); ok {
-			b := make([]models.Ipv4AddressRange, len(ipv4AddressRanges))
-			for i, rang := range ipv4AddressRanges {
-				b[i].SetStart(strconv.FormatInt(Ipv4ToInt(rang.GetStart()), 10))
-				b[i].SetEnd(strconv.FormatInt(Ipv4ToInt(rang.GetEnd()), 10))
-			}
-			a.SetIpv4AddressRanges(b)
-		}
-
-		if ipv6PrefixRanges, ok := nfprofile.BsfInfo.GetIpv6PrefixRangesOk(); ok {
-			b := make([]models.Ipv6PrefixRange, len(ipv6PrefixRanges))
-			for i, rang := range ipv6PrefixRanges {
-				b[i].SetStart(Ipv6ToInt(rang.GetStart()).String())
-				b[i].SetEnd(Ipv6ToInt(rang.GetEnd()).String())
-			}
-			a.SetIpv6PrefixRanges(b)
-		}
-		nf.SetBsfInfo(*a)
+		bsfInfo.SetIpv4AddressRanges(b)
 	}
-}
-
-func copyChfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// chfInfo
-	if chfInfo, ok := nfprofile.GetChfInfoOk(); ok {
-		a := models.NewChfInfo()
-
-		if supiRangeList, ok := chfInfo.GetSupiRangeListOk(); ok {
-			a.SetSupiRangeList(supiRangeList)
-		}
 
-		if gpsiRangeList, ok := chfInfo.GetGpsiRangeListOk(); ok {
-			a.SetGpsiRangeList(gpsiRangeList)
+	if ipv6PrefixRanges, ok := bsfInfo.GetIpv6PrefixRangesOk(); ok {
+		b := make([]models.Ipv6PrefixRange, len(ipv6PrefixRanges))
+		for i, rang := range ipv6PrefixRanges {
+			b[i].SetStart(Ipv6ToInt(rang.GetStart()).String())
+			b[i].SetEnd(Ipv6ToInt(rang.GetEnd()).String())
 		}
-
-		if plmnRangeList, ok := chfInfo.GetPlmnRangeListOk(); ok {
-			a.SetPlmnRangeList(plmnRangeList)
-		}
-		nf.SetChfInfo(*a)
-	}
-}
-
-func copyNrfInfo(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// nrfInfo
-	if nrfInfo, ok := nfprofile.GetNrfInfoOk(); ok {
-		nf.SetNrfInfo(*nrfInfo)
-	}
-}
-
-func copyRecoveryTime(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// recoveryTime
-	if recoveryTime, ok := nfprofile.GetRecoveryTimeOk(); ok {
-		// Update when restart (Setting by NF itself)
-		nf.SetRecoveryTime(*recoveryTime)
-	}
-}
-
-func copyNfServicePersistence(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// nfServicePersistence
-	nf.SetNfServicePersistence(nfprofile.GetNfServicePersistence())
-}
-
-func copyNfServices(nf *models.NFProfile, nfprofile models.NFProfile) {
-	// nfServices
-	if nfServices, ok := nfprofile.GetNfServicesOk(); ok {
-		a := make([]models.NFService, len(nfServices))
-		copy(a, nfServices)
-		nf.SetNfServices(a)
+		bsfInfo.SetIpv6PrefixRanges(b)
 	}
+	nf.SetBsfInfo(bsfInfo)
 }
 
 func GetNfInstanceURI(nfInstID string) string {
 	return factory.NrfConfig.GetSbiUri() + "/nnrf-nfm/v1/nf-instances/" + nfInstID
 }
 
-func SetLocationHeader(nfprofile models.NFProfile) string {
-	var modifyUL UriList
-	var locationHeader []string
-
-	// set nfprofile location
-	locationHeader = append(locationHeader, GetNfInstanceURI(nfprofile.GetNfInstanceId()))
-
-	collName := "urilist"
-	nfType := nfprofile.GetNfType()
-	filter := bson.M{"nfType": nfType}
-
-	ul, _ := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
-
-	var originalUL UriList
-	err := mapstructure.Decode(ul, &originalUL)
-	if err != nil {
-		panic(err)
-	}
-
-	// obtain location header = NF URI
-	nnrfUriList(&originalUL, &modifyUL, locationHeader)
-	modifyUL.NfType = nfprofile.GetNfType()
-
-	tmp, err := json.Marshal(modifyUL)
-	if err != nil {
-		logger.ManagementLog.Error(err)
-	}
-	putData := bson.M{}
-	err = json.Unmarshal(tmp, &putData)
-	if err != nil {
-		logger.ManagementLog.Error(err)
-	}
-
-	if ok, _ := dbadapter.DBClient.RestfulAPIPutOne(collName, filter, putData); ok {
-		logger.ManagementLog.Info("urilist update")
-	} else {
-		logger.ManagementLog.Info("urilist create")
-	}
-
-	return locationHeader[0]
-}
-
-func setUriListByFilter(filter bson.M, uriList *[]string) {
-	filterNfTypeResultsRaw, _ := dbadapter.DBClient.RestfulAPIGetMany("Subscriptions", filter)
-	var filterNfTypeResults []models.SubscriptionData
+// decodeSubscriptionData converts a stored subscription to SubscriptionData.
+func decodeSubscriptionData(doc map[string]interface{}) (models.SubscriptionData, error) {
+	var subscription models.SubscriptionData
 	stringToDateTimeHook := func(
 		f reflect.Type,
 		t reflect.Type,
@@ -543,241 +138,85 @@ func setUriListByFilter(filter bson.M, uriList *[]string) {
 
 	config := mapstructure.DecoderConfig{
 		DecodeHook: stringToDateTimeHook,
-		Result:     &filterNfTypeResults,
+		Result:     &subscription,
 	}
 
 	decoder, err := mapstructure.NewDecoder(&config)
 	if err != nil {
-		logger.ManagementLog.Errorf("converter setup failed: %v", err)
-		return
-	}
-
-	err = decoder.Decode(filterNfTypeResultsRaw)
-	if err != nil {
-		logger.ManagementLog.Error(err)
-	}
-
-	for _, subscr := range filterNfTypeResults {
-		*uriList = append(*uriList, subscr.GetNfStatusNotificationUri())
+		return subscription, fmt.Errorf("converter setup failed: %w", err)
 	}
+	err = decoder.Decode(doc)
+	return subscription, err
 }
 
-func nnrfUriList(originalUL *UriList, UL *UriList, location []string) {
-	var b *Links
-	var flag bool
-	var c []models.Link
-	flag = true
-	b = new(Links)
-	items := originalUL.Link.Item
-	size := len(location) + len(items)
-
-	// check duplicate
-	for _, item := range items {
-		if item.GetHref() == location[0] {
-			flag = false
-			break
-		}
-	}
-
-	if flag {
-		c = make([]models.Link, size)
-		copy(c, items)
-		for i, loc := range location {
-			c[len(items)+i].SetHref(loc)
-		}
-	} else {
-		c = make([]models.Link, size-1)
-		copy(c, items)
-	}
-
-	b.Item = c
-	UL.Link = *b
-}
-
-func GetNotificationUri(nfProfile models.NFProfile) []string {
-	var uriList []string
-
-	addNfTypeCond(nfProfile, &uriList)
-	addNfInstanceIDCond(nfProfile, &uriList)
-	addServiceNameCond(nfProfile, &uriList)
-	addAmfCond(nfProfile, &uriList)
-	addGuamiListCond(nfProfile, &uriList)
-	addNetworkSliceCond(nfProfile, &uriList)
-	addNfGroupCond(nfProfile, &uriList)
-
-	return uriList
-}
-
-func addNfTypeCond(nfProfile models.NFProfile, uriList *[]string) {
-	// nfTypeCond
-	nfTypeCond := bson.M{
-		"subscrCond": bson.M{
-			"nfType": nfProfile.GetNfType(),
-		},
-	}
-	setUriListByFilter(nfTypeCond, uriList)
-}
-
-func addNfInstanceIDCond(nfProfile models.NFProfile, uriList *[]string) {
-	// NfInstanceIdCond
-	nfInstanceIDCond := bson.M{
-		"subscrCond": bson.M{
-			"nfInstanceId": nfProfile.GetNfInstanceId(),
-		},
-	}
-	setUriListByFilter(nfInstanceIDCond, uriList)
-}
-
-func addServiceNameCond(nfProfile models.NFProfile, uriList *[]string) {
-	// ServiceNameCond
-	if nfServices, ok := nfProfile.GetNfServicesOk(); ok && len(nfServices) > 0 {
-		var ServiceNameCond bson.M
-		var serviceNames bson.A
-		for _, nfService := range nfServices {
-			serviceNames = append(serviceNames, string(nfService.ServiceName))
-		}
-		ServiceNameCond = bson.M{
-			"subscrCond.serviceName": bson.M{
-				"$in": serviceNames,
-			},
-		}
-		setUriListByFilter(ServiceNameCond, uriList)
-	}
-}
-
-func addAmfCond(nfProfile models.NFProfile, uriList *[]string) {
-	// AmfCond
-	if amfInfo, ok := nfProfile.GetAmfInfoOk(); ok {
-		amfCond := bson.M{
-			"subscrCond": bson.M{
-				"amfSetId":    amfInfo.GetAmfSetId(),
-				"amfRegionId": amfInfo.GetAmfRegionId(),
-			},
-		}
-		setUriListByFilter(amfCond, uriList)
-	}
-}
-
-func addGuamiListCond(nfProfile models.NFProfile, uriList *[]string) {
-	if amfInfo, ok := nfProfile.GetAmfInfoOk(); ok {
-		var guamiListFilter bson.M
-		if guamiList, ok := amfInfo.GetGuamiListOk(); ok && len(guamiList) > 0 {
-			var guamiListBsonArray bson.A
-			for _, guami := range guamiList {
-				tmp, err := json.Marshal(guami)
-				if err != nil {
-					logger.ManagementLog.Error(err)
-				}
-				guamiMarshal := bson.M{}
-				err = json.Unmarshal(tmp, &guamiMarshal)
-				if err != nil {
-					logger.ManagementLog.Error(err)
-				}
-
-				guamiListBsonArray = append(guamiListBsonArray, bson.M{"subscrCond": bson.M{"$elemMatch": guamiMarshal}})
-			}
-			guamiListFilter = bson.M{
-				"$or": guamiListBsonArray,
-			}
-			setUriListByFilter(guamiListFilter, uriList)
-		}
+// GetNotificationSubscriptions returns the subscriptions to notify of event
+// about the given NF profile: those whose subscrCond matches the profile,
+// that requested the event and that are allowed to discover the NF instance.
+// Every subscription is returned once, even when several of its conditions
+// match.
+func GetNotificationSubscriptions(ctx context.Context, nfProfile models.NFProfile,
+	event models.NotificationEventType,
+) []models.SubscriptionData {
+	subscriptionsRaw, err := dbadapter.GetMany(ctx, "Subscriptions", notificationSubscriptionsFilter(nfProfile, event))
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to fetch subscriptions: %v", err)
+		return nil
 	}
-}
-
-func addNetworkSliceCond(nfProfile models.NFProfile, uriList *[]string) {
-	// NetworkSliceCond
-	if sNssais, ok := nfProfile.GetSNssaisOk(); ok && len(sNssais) > 0 {
-		var networkSliceFilter bson.M
-		var snssaisBsonArray bson.A
-		for _, snssai := range sNssais {
-			tmp, err := json.Marshal(snssai)
-			if err != nil {
-				logger.ManagementLog.Error(err)
-			}
-			snssaiMarshal := bson.M{}
-			err = json.Unmarshal(tmp, &snssaiMarshal)
-			if err != nil {
-				logger.ManagementLog.Error(err)
-			}
-
-			snssaisBsonArray = append(snssaisBsonArray, bson.M{"subscrCond": bson.M{"$elemMatch": snssaiMarshal}})
-		}
-
-		var nsiListBsonArray bson.A
-		if nsiList, ok := nfProfile.GetNsiListOk(); ok {
-			for _, nsi := range nsiList {
-				nsiListBsonArray = append(nsiListBsonArray, nsi)
-			}
-		}
-
-		if nsiListBsonArray != nil {
-			networkSliceFilter = bson.M{
-				"$and": bson.A{
-					bson.M{
-						"subscrCond.nsiList": bson.M{
-							"$in": nsiListBsonArray,
-						},
-					},
-					bson.M{
-						"$or": snssaisBsonArray,
-					},
-				},
-			}
-		} else {
-			networkSliceFilter = bson.M{
-				"$and": bson.A{
-					bson.M{
-						"$or": snssaisBsonArray,
-					},
+	profile, err := jsonDocument(nfProfile)
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to encode nf profile [%s]: %v", nfProfile.GetNfInstanceId(), err)
+		return nil
+	}
+
+	var subscriptions []models.SubscriptionData
+	now := time.Now()
+	for _, subscriptionRaw := range subscriptionsRaw {
+		doc, err := jsonDocument(subscriptionRaw)
+		if err != nil {
+			logger.ManagementLog.Errorf("failed to read subscription: %v", err)
+			continue
+		}
+		if !subscriptionMatches(doc, profile, event, now) {
+			continue
+		}
+		delete(doc, "_id")
+		delete(doc, "expireAt")
+		delete(doc, dbadapter.SchemaVersionField)
+		subscription, err := decodeSubscriptionData(doc)
+		if err != nil {
+			logger.ManagementLog.Errorf("failed to decode subscription %v: %v", doc["subscriptionId"], err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions
+}
+
+// notificationSubscriptionsFilter narrows the subscriptions fetched to those
+// which may be notified of event about nfProfile: those requesting the event,
+// and those whose condition names the NF instance, its NF type or neither.
+// subscriptionMatches decides on the ones it returns.
+func notificationSubscriptionsFilter(nfProfile models.NFProfile, event models.NotificationEventType) bson.M {
+	absent := bson.M{"$exists": false}
+	return bson.M{"$and": []bson.M{
+		{"$or": []bson.M{
+			{"reqNotifEvents.0": absent},
+			{"reqNotifEvents": string(event)},
+		}},
+		{"$or": []bson.M{
+			{"subscrCond": absent},
+			{"subscrCond.nfInstanceId": nfProfile.GetNfInstanceId()},
+			{"subscrCond.nfInstanceIdList": nfProfile.GetNfInstanceId()},
+			{
+				"subscrCond.nfInstanceId":     absent,
+				"subscrCond.nfInstanceIdList": absent,
+				"$or": []bson.M{
+					{"subscrCond.nfType": absent},
+					{"subscrCond.nfType": string(nfProfile.GetNfType())},
+					// an ScpDomainCond is told by its scpDomains first
+					{"subscrCond.scpDomains": bson.M{"$exists": true}},
 				},
-			}
-		}
-		setUriListByFilter(networkSliceFilter, uriList)
-	}
-}
-
-func addNfGroupCond(nfProfile models.NFProfile, uriList *[]string) {
-	// NfGroupCond
-	nfType := nfProfile.GetNfType()
-	udrInfo, okUdr := nfProfile.GetUdrInfoOk()
-	udmInfo, okUdm := nfProfile.GetUdmInfoOk()
-	ausfInfo, okAusf := nfProfile.GetAusfInfoOk()
-	switch {
-	case okUdr:
-		nfGroupCond := bson.M{
-			"subscrCond": bson.M{
-				"nfType":    nfType,
-				"nfGroupId": udrInfo.GetGroupId(),
-			},
-		}
-		setUriListByFilter(nfGroupCond, uriList)
-	case okUdm:
-		nfGroupCond := bson.M{
-			"subscrCond": bson.M{
-				"nfType":    nfType,
-				"nfGroupId": udmInfo.GetGroupId(),
-			},
-		}
-		setUriListByFilter(nfGroupCond, uriList)
-	case okAusf:
-		nfGroupCond := bson.M{
-			"subscrCond": bson.M{
-				"nfType":    nfType,
-				"nfGroupId": ausfInfo.GetGroupId(),
 			},
-		}
-		setUriListByFilter(nfGroupCond, uriList)
-	}
-}
-
-func NnrfUriListLimit(originalUL *UriList, limit int) {
-	// response limit
-
-	if limit < len(originalUL.Link.Item) {
-		b := new(Links)
-		c := make([]models.Link, limit)
-		copy(c, originalUL.Link.Item[:limit])
-		b.Item = c
-		originalUL.Link = *b
-	}
+		}},
+	}}
 }
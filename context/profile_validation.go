@@ -0,0 +1,513 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// Notification types and classes of the defaultNotificationSubscriptions of
+// a profile, TS 29.510 clause 6.1.6.2.4 and TS 29.518 clause 6.1.6.3.
+const (
+	NotificationTypeN1Messages    = "N1_MESSAGES"
+	NotificationTypeN2Information = "N2_INFORMATION"
+)
+
+var (
+	N1MessageClasses     = []string{"5GMM", "SM", "LPP", "SMS", "UPDP", "LCS"}
+	N2InformationClasses = []string{"SM", "NRPPA", "PWS", "PWS_BCAL", "PWS_RF", "RAN", "V2X", "PROSE"}
+)
+
+var (
+	mccRegex    = regexp.MustCompile(`^[0-9]{3}$`)
+	mncRegex    = regexp.MustCompile(`^[0-9]{2,3}$`)
+	sdRegex     = regexp.MustCompile(`^[A-Fa-f0-9]{6}$`)
+	tacRegex    = regexp.MustCompile(`^([A-Fa-f0-9]{4}|[A-Fa-f0-9]{6})$`)
+	digitsRegex = regexp.MustCompile(`^[0-9]+$`)
+	fqdnLabel   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+)
+
+// ProfileValidationError lists the attributes of an NF profile that violate
+// the constraints of TS 29.510 clause 6.1.6, in the form returned to the NF
+// as ProblemDetails.invalidParams.
+type ProfileValidationError struct {
+	InvalidParams []models.InvalidParam
+}
+
+func (e *ProfileValidationError) Error() string {
+	reasons := make([]string, 0, len(e.InvalidParams))
+	for _, param := range e.InvalidParams {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", param.Param, param.GetReason()))
+	}
+	return "invalid NF profile: " + strings.Join(reasons, "; ")
+}
+
+type profileValidator struct {
+	invalidParams []models.InvalidParam
+}
+
+func (v *profileValidator) add(param, format string, args ...any) {
+	invalidParam := models.InvalidParam{Param: param}
+	invalidParam.SetReason(fmt.Sprintf(format, args...))
+	v.invalidParams = append(v.invalidParams, invalidParam)
+}
+
+// ValidateNFProfile checks a profile provided on NF register or update. It
+// returns a *ProfileValidationError naming every offending attribute, or nil.
+func ValidateNFProfile(nfprofile models.NFProfile) error {
+	v := &profileValidator{}
+
+	if nfprofile.GetNfInstanceId() == "" {
+		v.add("nfInstanceId", "NfInstanceId field is required")
+	}
+	if nfprofile.GetNfType() == "" {
+		v.add("nfType", "NfType field is required")
+	}
+	if nfprofile.GetNfStatus() == "" {
+		v.add("nfStatus", "NfStatus field is required")
+	}
+
+	if fqdn, ok := nfprofile.GetFqdnOk(); ok {
+		v.fqdn("fqdn", *fqdn)
+	}
+	if interPlmnFqdn, ok := nfprofile.GetInterPlmnFqdnOk(); ok {
+		v.fqdn("interPlmnFqdn", *interPlmnFqdn)
+	}
+	for i, addr := range nfprofile.GetIpv4Addresses() {
+		v.ipv4(fmt.Sprintf("ipv4Addresses[%d]", i), addr)
+	}
+	for i, addr := range nfprofile.GetIpv6Addresses() {
+		v.ipv6(fmt.Sprintf("ipv6Addresses[%d]", i), addr)
+	}
+
+	// Use the Ok getters so that an explicitly set value of 0 is still checked.
+	if priority, ok := nfprofile.GetPriorityOk(); ok {
+		v.intRange("priority", int64(*priority), 0, 65535)
+	}
+	if capacity, ok := nfprofile.GetCapacityOk(); ok {
+		v.intRange("capacity", int64(*capacity), 0, 65535)
+	}
+	if load, ok := nfprofile.GetLoadOk(); ok {
+		v.intRange("load", int64(*load), 0, 100)
+	}
+
+	for i, plmn := range nfprofile.GetPlmnList() {
+		v.plmnID(fmt.Sprintf("plmnList[%d]", i), plmn.GetMcc(), plmn.GetMnc())
+	}
+	for i, plmn := range nfprofile.GetAllowedPlmns() {
+		v.plmnID(fmt.Sprintf("allowedPlmns[%d]", i), plmn.GetMcc(), plmn.GetMnc())
+	}
+	sNssais := nfprofile.GetSNssais()
+	for i := range sNssais {
+		v.snssai(fmt.Sprintf("sNssais[%d]", i), &sNssais[i])
+	}
+	allowedNssais := nfprofile.GetAllowedNssais()
+	for i := range allowedNssais {
+		v.snssai(fmt.Sprintf("allowedNssais[%d]", i), &allowedNssais[i])
+	}
+
+	v.nfServices(nfprofile)
+	v.defaultNotificationSubscriptions("defaultNotificationSubscriptions", nfprofile.GetDefaultNotificationSubscriptions())
+
+	if nfprofile.UdrInfo != nil {
+		v.supiRanges("udrInfo.supiRanges", nfprofile.UdrInfo.GetSupiRanges())
+		v.identityRanges("udrInfo.gpsiRanges", nfprofile.UdrInfo.GetGpsiRanges())
+	}
+	if nfprofile.UdmInfo != nil {
+		v.supiRanges("udmInfo.supiRanges", nfprofile.UdmInfo.GetSupiRanges())
+		v.identityRanges("udmInfo.gpsiRanges", nfprofile.UdmInfo.GetGpsiRanges())
+	}
+	if nfprofile.AusfInfo != nil {
+		v.supiRanges("ausfInfo.supiRanges", nfprofile.AusfInfo.GetSupiRanges())
+	}
+	if nfprofile.PcfInfo != nil {
+		v.supiRanges("pcfInfo.supiRanges", nfprofile.PcfInfo.GetSupiRanges())
+	}
+	if nfprofile.ChfInfo != nil {
+		v.supiRanges("chfInfo.supiRangeList", nfprofile.ChfInfo.GetSupiRangeList())
+		v.identityRanges("chfInfo.gpsiRangeList", nfprofile.ChfInfo.GetGpsiRangeList())
+	}
+	if nfprofile.AmfInfo != nil {
+		v.taiRanges("amfInfo.taiRangeList", nfprofile.AmfInfo.GetTaiRangeList())
+	}
+	if nfprofile.SmfInfo != nil {
+		sNssaiSmfInfoList := nfprofile.SmfInfo.GetSNssaiSmfInfoList()
+		for i := range sNssaiSmfInfoList {
+			v.snssai(fmt.Sprintf("smfInfo.sNssaiSmfInfoList[%d].sNssai", i), &sNssaiSmfInfoList[i].SNssai)
+		}
+		v.taiRanges("smfInfo.taiRangeList", nfprofile.SmfInfo.GetTaiRangeList())
+		if pgwFqdn, ok := nfprofile.SmfInfo.GetPgwFqdnOk(); ok {
+			v.fqdn("smfInfo.pgwFqdn", *pgwFqdn)
+		}
+	}
+	if nfprofile.UpfInfo != nil {
+		sNssaiUpfInfoList := nfprofile.UpfInfo.GetSNssaiUpfInfoList()
+		for i := range sNssaiUpfInfoList {
+			v.snssai(fmt.Sprintf("upfInfo.sNssaiUpfInfoList[%d].sNssai", i), &sNssaiUpfInfoList[i].SNssai)
+		}
+	}
+	if nfprofile.BsfInfo != nil {
+		v.bsfRanges(*nfprofile.BsfInfo)
+	}
+
+	if len(v.invalidParams) == 0 {
+		return nil
+	}
+	return &ProfileValidationError{InvalidParams: v.invalidParams}
+}
+
+// nfServices checks nfServices and nfServiceList. The two attributes may
+// describe the same services (nfServices is deprecated in favour of
+// nfServiceList), so serviceInstanceId uniqueness is checked within each one.
+func (v *profileValidator) nfServices(nfprofile models.NFProfile) {
+	seen := make(map[string]string)
+	for i, service := range nfprofile.GetNfServices() {
+		prefix := fmt.Sprintf("nfServices[%d]", i)
+		v.serviceInstanceID(prefix+".serviceInstanceId", service.GetServiceInstanceId(), seen)
+		v.nfService(prefix, service)
+	}
+
+	nfServiceList := nfprofile.GetNfServiceList()
+	keys := make([]string, 0, len(nfServiceList))
+	for key := range nfServiceList {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		service := nfServiceList[key]
+		prefix := fmt.Sprintf("nfServiceList.%s", key)
+		if service.GetServiceInstanceId() != key {
+			v.add(prefix+".serviceInstanceId", "serviceInstanceId %q does not match map key %q", service.GetServiceInstanceId(), key)
+		}
+		v.nfService(prefix, service)
+	}
+}
+
+func (v *profileValidator) serviceInstanceID(param, id string, seen map[string]string) {
+	if id == "" {
+		v.add(param, "serviceInstanceId is required")
+		return
+	}
+	if first, ok := seen[id]; ok {
+		v.add(param, "duplicate serviceInstanceId %q, already used by %s", id, first)
+		return
+	}
+	seen[id] = param
+}
+
+func (v *profileValidator) nfService(prefix string, service models.NFService) {
+	if service.GetServiceName() == "" {
+		v.add(prefix+".serviceName", "serviceName is required")
+	}
+	if len(service.GetVersions()) == 0 {
+		v.add(prefix+".versions", "at least one version is required")
+	}
+	if fqdn, ok := service.GetFqdnOk(); ok {
+		v.fqdn(prefix+".fqdn", *fqdn)
+	}
+	if interPlmnFqdn, ok := service.GetInterPlmnFqdnOk(); ok {
+		v.fqdn(prefix+".interPlmnFqdn", *interPlmnFqdn)
+	}
+	for i, ipEndPoint := range service.GetIpEndPoints() {
+		param := fmt.Sprintf("%s.ipEndPoints[%d]", prefix, i)
+		if addr, ok := ipEndPoint.GetIpv4AddressOk(); ok {
+			v.ipv4(param+".ipv4Address", *addr)
+		}
+		if addr, ok := ipEndPoint.GetIpv6AddressOk(); ok {
+			v.ipv6(param+".ipv6Address", *addr)
+		}
+		if port, ok := ipEndPoint.GetPortOk(); ok {
+			v.intRange(param+".port", int64(*port), 0, 65535)
+		}
+	}
+	if priority, ok := service.GetPriorityOk(); ok {
+		v.intRange(prefix+".priority", int64(*priority), 0, 65535)
+	}
+	if capacity, ok := service.GetCapacityOk(); ok {
+		v.intRange(prefix+".capacity", int64(*capacity), 0, 65535)
+	}
+	if load, ok := service.GetLoadOk(); ok {
+		v.intRange(prefix+".load", int64(*load), 0, 100)
+	}
+	for i, plmn := range service.GetAllowedPlmns() {
+		v.plmnID(fmt.Sprintf("%s.allowedPlmns[%d]", prefix, i), plmn.GetMcc(), plmn.GetMnc())
+	}
+	allowedNssais := service.GetAllowedNssais()
+	for i := range allowedNssais {
+		v.snssai(fmt.Sprintf("%s.allowedNssais[%d]", prefix, i), &allowedNssais[i])
+	}
+	v.defaultNotificationSubscriptions(prefix+".defaultNotificationSubscriptions", service.GetDefaultNotificationSubscriptions())
+}
+
+// defaultNotificationSubscriptions checks the default callbacks of an NF or
+// NF service. The message class is mandatory for N1_MESSAGES and the
+// information class for N2_INFORMATION, and neither applies to other types.
+func (v *profileValidator) defaultNotificationSubscriptions(prefix string, subscriptions []models.DefaultNotificationSubscription) {
+	for i, subscription := range subscriptions {
+		param := fmt.Sprintf("%s[%d]", prefix, i)
+		notificationType := string(subscription.GetNotificationType())
+		if notificationType == "" {
+			v.add(param+".notificationType", "notificationType is required")
+		}
+		if uri, err := url.Parse(subscription.GetCallbackUri()); err != nil || !uri.IsAbs() || uri.Host == "" {
+			v.add(param+".callbackUri", "invalid callbackUri %q", subscription.GetCallbackUri())
+		}
+		switch n1MessageClass, ok := subscription.GetN1MessageClassOk(); {
+		case notificationType == NotificationTypeN1Messages && !ok:
+			v.add(param+".n1MessageClass", "n1MessageClass is required for %s", notificationType)
+		case notificationType != NotificationTypeN1Messages && ok:
+			v.add(param+".n1MessageClass", "n1MessageClass only applies to %s", NotificationTypeN1Messages)
+		case ok && !slices.Contains(N1MessageClasses, string(*n1MessageClass)):
+			v.add(param+".n1MessageClass", "unknown n1MessageClass %q", *n1MessageClass)
+		}
+		switch n2InformationClass, ok := subscription.GetN2InformationClassOk(); {
+		case notificationType == NotificationTypeN2Information && !ok:
+			v.add(param+".n2InformationClass", "n2InformationClass is required for %s", notificationType)
+		case notificationType != NotificationTypeN2Information && ok:
+			v.add(param+".n2InformationClass", "n2InformationClass only applies to %s", NotificationTypeN2Information)
+		case ok && !slices.Contains(N2InformationClasses, string(*n2InformationClass)):
+			v.add(param+".n2InformationClass", "unknown n2InformationClass %q", *n2InformationClass)
+		}
+	}
+}
+
+func (v *profileValidator) intRange(param string, value, lowest, highest int64) {
+	if value < lowest || value > highest {
+		v.add(param, "%d out of range [%d, %d]", value, lowest, highest)
+	}
+}
+
+// fqdn applies the RFC 1035 host name syntax: dot separated labels of at most
+// 63 letters, digits or hyphens, 253 characters in total.
+func (v *profileValidator) fqdn(param, fqdn string) {
+	name := strings.TrimSuffix(fqdn, ".")
+	if name == "" || len(name) > 253 {
+		v.add(param, "invalid FQDN %q", fqdn)
+		return
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !fqdnLabel.MatchString(label) {
+			v.add(param, "invalid FQDN %q", fqdn)
+			return
+		}
+	}
+}
+
+func (v *profileValidator) ipv4(param, addr string) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil || !ip.Is4() {
+		v.add(param, "invalid IPv4 address %q", addr)
+	}
+}
+
+func (v *profileValidator) ipv6(param, addr string) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil || !ip.Is6() {
+		v.add(param, "invalid IPv6 address %q", addr)
+	}
+}
+
+func (v *profileValidator) plmnID(param, mcc, mnc string) {
+	if !mccRegex.MatchString(mcc) {
+		v.add(param+".mcc", "invalid MCC %q, expected 3 digits", mcc)
+	}
+	if !mncRegex.MatchString(mnc) {
+		v.add(param+".mnc", "invalid MNC %q, expected 2 or 3 digits", mnc)
+	}
+}
+
+// snssai is satisfied by both models.Snssai and models.ExtSnssai.
+type snssai interface {
+	GetSst() int32
+	GetSdOk() (*string, bool)
+}
+
+func (v *profileValidator) snssai(param string, s snssai) {
+	v.intRange(param+".sst", int64(s.GetSst()), 0, 255)
+	if sd, ok := s.GetSdOk(); ok && !sdRegex.MatchString(*sd) {
+		v.add(param+".sd", "invalid SD %q, expected 6 hexadecimal digits", *sd)
+	}
+}
+
+func (v *profileValidator) taiRanges(prefix string, taiRanges []models.TaiRange) {
+	for i, taiRange := range taiRanges {
+		param := fmt.Sprintf("%s[%d]", prefix, i)
+		v.plmnID(param+".plmnId", taiRange.PlmnId.GetMcc(), taiRange.PlmnId.GetMnc())
+		if len(taiRange.GetTacRangeList()) == 0 {
+			v.add(param+".tacRangeList", "at least one TAC range is required")
+		}
+		for j, tacRange := range taiRange.GetTacRangeList() {
+			v.tacRange(fmt.Sprintf("%s.tacRangeList[%d]", param, j), tacRange)
+		}
+	}
+}
+
+func (v *profileValidator) tacRange(param string, tacRange models.TacRange) {
+	if pattern, ok := tacRange.GetPatternOk(); ok {
+		v.pattern(param+".pattern", *pattern)
+		return
+	}
+	start, hasStart := tacRange.GetStartOk()
+	end, hasEnd := tacRange.GetEndOk()
+	if !hasStart || !hasEnd {
+		v.add(param, "either pattern or both start and end are required")
+		return
+	}
+	if !tacRegex.MatchString(*start) {
+		v.add(param+".start", "invalid TAC %q, expected 4 or 6 hexadecimal digits", *start)
+		return
+	}
+	if !tacRegex.MatchString(*end) {
+		v.add(param+".end", "invalid TAC %q, expected 4 or 6 hexadecimal digits", *end)
+		return
+	}
+	if len(*start) != len(*end) {
+		v.add(param, "start %q and end %q differ in length", *start, *end)
+		return
+	}
+	startValue, _ := strconv.ParseUint(*start, 16, 32)
+	endValue, _ := strconv.ParseUint(*end, 16, 32)
+	if startValue > endValue {
+		v.add(param, "start %q is greater than end %q", *start, *end)
+	}
+}
+
+func (v *profileValidator) supiRanges(prefix string, supiRanges []models.SupiRange) {
+	for i, supiRange := range supiRanges {
+		param := fmt.Sprintf("%s[%d]", prefix, i)
+		pattern, hasPattern := supiRange.GetPatternOk()
+		start, hasStart := supiRange.GetStartOk()
+		end, hasEnd := supiRange.GetEndOk()
+		v.numericRange(param, pattern, hasPattern, start, hasStart, end, hasEnd)
+	}
+}
+
+func (v *profileValidator) identityRanges(prefix string, identityRanges []models.IdentityRange) {
+	for i, identityRange := range identityRanges {
+		param := fmt.Sprintf("%s[%d]", prefix, i)
+		pattern, hasPattern := identityRange.GetPatternOk()
+		start, hasStart := identityRange.GetStartOk()
+		end, hasEnd := identityRange.GetEndOk()
+		v.numericRange(param, pattern, hasPattern, start, hasStart, end, hasEnd)
+	}
+}
+
+// numericRange checks a SupiRange or IdentityRange: either a compilable
+// pattern, or start and end digit strings of equal length with start <= end.
+func (v *profileValidator) numericRange(param string, pattern *string, hasPattern bool,
+	start *string, hasStart bool, end *string, hasEnd bool,
+) {
+	if hasPattern {
+		v.pattern(param+".pattern", *pattern)
+		return
+	}
+	if !hasStart || !hasEnd {
+		v.add(param, "either pattern or both start and end are required")
+		return
+	}
+	if !digitsRegex.MatchString(*start) {
+		v.add(param+".start", "invalid range start %q, expected digits", *start)
+		return
+	}
+	if !digitsRegex.MatchString(*end) {
+		v.add(param+".end", "invalid range end %q, expected digits", *end)
+		return
+	}
+	if len(*start) != len(*end) {
+		v.add(param, "start %q and end %q differ in length", *start, *end)
+		return
+	}
+	if *start > *end {
+		v.add(param, "start %q is greater than end %q", *start, *end)
+	}
+}
+
+func (v *profileValidator) pattern(param, pattern string) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		v.add(param, "invalid regular expression %q: %v", pattern, err)
+	}
+}
+
+func (v *profileValidator) bsfRanges(bsfInfo models.BsfInfo) {
+	for i, ipv4Range := range bsfInfo.GetIpv4AddressRanges() {
+		param := fmt.Sprintf("bsfInfo.ipv4AddressRanges[%d]", i)
+		start, startErr := netip.ParseAddr(ipv4Range.GetStart())
+		end, endErr := netip.ParseAddr(ipv4Range.GetEnd())
+		if startErr != nil || !start.Is4() {
+			v.add(param+".start", "invalid IPv4 address %q", ipv4Range.GetStart())
+		} else if endErr != nil || !end.Is4() {
+			v.add(param+".end", "invalid IPv4 address %q", ipv4Range.GetEnd())
+		} else if start.Compare(end) > 0 {
+			v.add(param, "start %s is greater than end %s", start, end)
+		}
+	}
+	for i, ipv6Range := range bsfInfo.GetIpv6PrefixRanges() {
+		param := fmt.Sprintf("bsfInfo.ipv6PrefixRanges[%d]", i)
+		start, startErr := netip.ParseAddr(ipv6Range.GetStart())
+		end, endErr := netip.ParseAddr(ipv6Range.GetEnd())
+		if startErr != nil || !start.Is6() {
+			v.add(param+".start", "invalid IPv6 address %q", ipv6Range.GetStart())
+		} else if endErr != nil || !end.Is6() {
+			v.add(param+".end", "invalid IPv6 address %q", ipv6Range.GetEnd())
+		} else if start.Compare(end) > 0 {
+			v.add(param, "start %s is greater than end %s", start, end)
+		}
+	}
+}
+
+// DecodeBsfInfoRanges reverses EncodeBsfInfoRanges on a profile read from the
+// database, turning the decimal range boundaries back into IP addresses.
+// Boundaries that are not decimal integers are left untouched.
+func DecodeBsfInfoRanges(nf *models.NFProfile) {
+	if nf.BsfInfo == nil {
+		return
+	}
+	bsfInfo := *nf.BsfInfo
+
+	if ipv4AddressRanges, ok := bsfInfo.GetIpv4AddressRangesOk(); ok {
+		b := make([]models.Ipv4AddressRange, len(ipv4AddressRanges))
+		for i, rang := range ipv4AddressRanges {
+			b[i].SetStart(decodeIpv4Boundary(rang.GetStart()))
+			b[i].SetEnd(decodeIpv4Boundary(rang.GetEnd()))
+		}
+		bsfInfo.SetIpv4AddressRanges(b)
+	}
+
+	if ipv6PrefixRanges, ok := bsfInfo.GetIpv6PrefixRangesOk(); ok {
+		b := make([]models.Ipv6PrefixRange, len(ipv6PrefixRanges))
+		for i, rang := range ipv6PrefixRanges {
+			b[i].SetStart(decodeIpv6Boundary(rang.GetStart()))
+			b[i].SetEnd(decodeIpv6Boundary(rang.GetEnd()))
+		}
+		bsfInfo.SetIpv6PrefixRanges(b)
+	}
+	nf.SetBsfInfo(bsfInfo)
+}
+
+func decodeIpv4Boundary(boundary string) string {
+	value, err := strconv.ParseInt(boundary, 10, 64)
+	if err != nil {
+		return boundary
+	}
+	return Ipv4IntToIpv4String(value)
+}
+
+func decodeIpv6Boundary(boundary string) string {
+	value, ok := new(big.Int).SetString(boundary, 10)
+	if !ok || value.Sign() < 0 || value.BitLen() > 128 {
+		return boundary
+	}
+	return netip.AddrFrom16([16]byte(value.FillBytes(make([]byte, 16)))).String()
+}
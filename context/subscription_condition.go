@@ -0,0 +1,376 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package context
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// Subscriptions and profiles are evaluated in their JSON form, as documents
+// decoded into maps, so that every TS 29.510 attribute can be looked up by
+// name whatever its Go representation.
+
+// jsonDocument converts v to a JSON object of plain maps and slices.
+func jsonDocument(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// subscriptionMatches reports whether the subscription is to be notified of
+// event about the NF instance profile.
+func subscriptionMatches(subscription, profile map[string]interface{}, event models.NotificationEventType, now time.Time) bool {
+	if validityTime, ok := subscription["validityTime"].(string); ok {
+		if expiry, err := time.Parse(time.RFC3339, validityTime); err == nil && !expiry.After(now) {
+			return false
+		}
+	}
+	if events := stringsOf(subscription["reqNotifEvents"]); len(events) != 0 && !slices.Contains(events, string(event)) {
+		return false
+	}
+	if !requesterAllowed(subscription, profile) {
+		return false
+	}
+	subscrCond, ok := subscription["subscrCond"].(map[string]interface{})
+	if !ok {
+		// Without condition, the subscription is to every NF instance
+		return true
+	}
+	return subscrCondMatches(subscrCond, profile)
+}
+
+// requesterAllowed applies the restrictions of the profile (allowedNfTypes,
+// allowedPlmns and allowedNssais) to the subscriber, as identified by the
+// reqNfType, plmnId, reqPlmnList and reqSnssais of its subscription.
+func requesterAllowed(subscription, profile map[string]interface{}) bool {
+	if reqNfType, ok := subscription["reqNfType"].(string); ok {
+		if allowed := stringsOf(profile["allowedNfTypes"]); len(allowed) != 0 && !slices.Contains(allowed, reqNfType) {
+			return false
+		}
+	}
+	reqPlmnList := objectsOf(subscription["reqPlmnList"])
+	if plmnID, ok := subscription["plmnId"].(map[string]interface{}); ok {
+		reqPlmnList = append(reqPlmnList, plmnID)
+	}
+	if len(reqPlmnList) != 0 {
+		if allowed := objectsOf(profile["allowedPlmns"]); len(allowed) != 0 && !intersects(reqPlmnList, allowed, samePlmn) {
+			return false
+		}
+	}
+	if reqSnssais := objectsOf(subscription["reqSnssais"]); len(reqSnssais) != 0 {
+		if allowed := objectsOf(profile["allowedNssais"]); len(allowed) != 0 && !intersects(reqSnssais, allowed, sameSnssai) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscriberAllowed reports whether the subscriber may be notified about the
+// NF instance nfProfile.
+func SubscriberAllowed(subscription models.SubscriptionData, nfProfile models.NFProfile) bool {
+	subscriptionDoc, err := jsonDocument(subscription)
+	if err != nil {
+		return false
+	}
+	profile, err := jsonDocument(nfProfile)
+	if err != nil {
+		return false
+	}
+	return requesterAllowed(subscriptionDoc, profile)
+}
+
+// SubscriptionNfInstanceIds returns the NF instances a subscription condition
+// names, if any.
+func SubscriptionNfInstanceIds(subscription models.SubscriptionData) ([]string, error) {
+	subscriptionDoc, err := jsonDocument(subscription)
+	if err != nil {
+		return nil, err
+	}
+	cond, _ := subscriptionDoc["subscrCond"].(map[string]interface{})
+	if nfInstanceID, ok := cond["nfInstanceId"].(string); ok {
+		return []string{nfInstanceID}, nil
+	}
+	return stringsOf(cond["nfInstanceIdList"]), nil
+}
+
+// SubscriptionConditionTypes are the variants of SubscrCond, TS 29.510.
+var SubscriptionConditionTypes = []string{
+	"NfInstanceIdCond", "NfInstanceIdListCond", "NfGroupCond", "ScpDomainCond", "NfTypeCond",
+	"ServiceNameCond", "ServiceNameListCond", "AmfCond", "GuamiListCond", "NetworkSliceCond",
+	"NfSetCond", "NfServiceSetCond", "TaiCond",
+}
+
+// subscrCondType tells which variant of SubscrCond, TS 29.510, cond is by
+// its mandatory attributes. It returns "" for an unknown condition.
+func subscrCondType(cond map[string]interface{}) string {
+	has := func(key string) bool {
+		_, ok := cond[key]
+		return ok
+	}
+	switch {
+	case has("nfInstanceId"):
+		return "NfInstanceIdCond"
+	case has("nfInstanceIdList"):
+		return "NfInstanceIdListCond"
+	case has("nfGroupId"):
+		return "NfGroupCond"
+	case has("scpDomains"):
+		return "ScpDomainCond"
+	case has("nfType"):
+		return "NfTypeCond"
+	case has("serviceName"):
+		return "ServiceNameCond"
+	case has("serviceNameList"):
+		return "ServiceNameListCond"
+	case has("amfSetId") || has("amfRegionId"):
+		return "AmfCond"
+	case has("guamiList"):
+		return "GuamiListCond"
+	case has("snssaiList"):
+		return "NetworkSliceCond"
+	case has("nfSetId"):
+		return "NfSetCond"
+	case has("nfServiceSetId"):
+		return "NfServiceSetCond"
+	case has("taiList"):
+		return "TaiCond"
+	}
+	return ""
+}
+
+// SubscriptionConditionType returns the variant of the subscrCond of a
+// subscription, such as NfTypeCond, or "" without condition.
+func SubscriptionConditionType(subscription models.SubscriptionData) string {
+	subscriptionDoc, err := jsonDocument(subscription)
+	if err != nil {
+		return ""
+	}
+	cond, ok := subscriptionDoc["subscrCond"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	return subscrCondType(cond)
+}
+
+// subscrCondMatches evaluates the SubscrCond of a subscription, TS 29.510.
+func subscrCondMatches(cond, profile map[string]interface{}) bool {
+	switch subscrCondType(cond) {
+	case "NfInstanceIdCond":
+		return cond["nfInstanceId"] == profile["nfInstanceId"]
+	case "NfInstanceIdListCond":
+		id, _ := profile["nfInstanceId"].(string)
+		return slices.Contains(stringsOf(cond["nfInstanceIdList"]), id)
+	case "NfGroupCond":
+		return cond["nfType"] == profile["nfType"] && slices.Contains(nfGroupIDs(profile), cond["nfGroupId"])
+	case "ScpDomainCond":
+		if nfTypes := stringsOf(cond["nfTypeList"]); len(nfTypes) != 0 {
+			nfType, _ := profile["nfType"].(string)
+			if !slices.Contains(nfTypes, nfType) {
+				return false
+			}
+		}
+		return intersects(stringsOf(cond["scpDomains"]), stringsOf(profile["scpDomains"]), equalFold)
+	case "NfTypeCond":
+		return cond["nfType"] == profile["nfType"]
+	case "ServiceNameCond":
+		serviceName, _ := cond["serviceName"].(string)
+		return slices.Contains(serviceNames(profile), serviceName)
+	case "ServiceNameListCond":
+		return intersects(stringsOf(cond["serviceNameList"]), serviceNames(profile), equal)
+	case "AmfCond":
+		_, hasSetID := cond["amfSetId"]
+		_, hasRegionID := cond["amfRegionId"]
+		for _, amfInfo := range nfInfos(profile, "amfInfo") {
+			if (!hasSetID || equalFold(cond["amfSetId"], amfInfo["amfSetId"])) &&
+				(!hasRegionID || equalFold(cond["amfRegionId"], amfInfo["amfRegionId"])) {
+				return true
+			}
+		}
+		return false
+	case "GuamiListCond":
+		for _, amfInfo := range nfInfos(profile, "amfInfo") {
+			if intersects(objectsOf(cond["guamiList"]), objectsOf(amfInfo["guamiList"]), sameGuami) {
+				return true
+			}
+		}
+		return false
+	case "NetworkSliceCond":
+		if nsiList := stringsOf(cond["nsiList"]); len(nsiList) != 0 &&
+			!intersects(nsiList, stringsOf(profile["nsiList"]), equal) {
+			return false
+		}
+		return intersects(objectsOf(cond["snssaiList"]), profileSnssais(profile), sameSnssai)
+	case "NfSetCond":
+		// SetIdCond
+		return intersects([]string{stringOf(cond["nfSetId"])}, stringsOf(profile["nfSetIdList"]), equalFold)
+	case "NfServiceSetCond":
+		// ServiceSetIdCond
+		nfServiceSetID := stringOf(cond["nfServiceSetId"])
+		for _, service := range nfServices(profile) {
+			if intersects([]string{nfServiceSetID}, stringsOf(service["nfServiceSetIdList"]), equalFold) {
+				return true
+			}
+		}
+		return false
+	case "TaiCond":
+		return intersects(objectsOf(cond["taiList"]), profileTais(profile), sameTai)
+	}
+	logger.ManagementLog.Debugf("unsupported subscription condition %v", cond)
+	return false
+}
+
+// nfInfos returns the given info of the profile, such as amfInfo, together
+// with the entries of the matching info list, such as amfInfoList.
+func nfInfos(profile map[string]interface{}, name string) []map[string]interface{} {
+	var infos []map[string]interface{}
+	if info, ok := profile[name].(map[string]interface{}); ok {
+		infos = append(infos, info)
+	}
+	if infoList, ok := profile[name+"List"].(map[string]interface{}); ok {
+		for _, info := range infoList {
+			if info, ok := info.(map[string]interface{}); ok {
+				infos = append(infos, info)
+			}
+		}
+	}
+	return infos
+}
+
+func nfGroupIDs(profile map[string]interface{}) []interface{} {
+	var groupIDs []interface{}
+	for _, name := range []string{"udrInfo", "udmInfo", "ausfInfo", "pcfInfo", "hssInfo", "chfInfo"} {
+		for _, info := range nfInfos(profile, name) {
+			if groupID, ok := info["groupId"]; ok {
+				groupIDs = append(groupIDs, groupID)
+			}
+		}
+	}
+	return groupIDs
+}
+
+func nfServices(profile map[string]interface{}) []map[string]interface{} {
+	services := objectsOf(profile["nfServices"])
+	if serviceList, ok := profile["nfServiceList"].(map[string]interface{}); ok {
+		for _, service := range serviceList {
+			if service, ok := service.(map[string]interface{}); ok {
+				services = append(services, service)
+			}
+		}
+	}
+	return services
+}
+
+func serviceNames(profile map[string]interface{}) []string {
+	var names []string
+	for _, service := range nfServices(profile) {
+		names = append(names, stringOf(service["serviceName"]))
+	}
+	return names
+}
+
+func profileSnssais(profile map[string]interface{}) []map[string]interface{} {
+	snssais := objectsOf(profile["sNssais"])
+	for _, plmnSnssai := range objectsOf(profile["perPlmnSnssaiList"]) {
+		snssais = append(snssais, objectsOf(plmnSnssai["sNssaiList"])...)
+	}
+	return snssais
+}
+
+func profileTais(profile map[string]interface{}) []map[string]interface{} {
+	var tais []map[string]interface{}
+	for _, name := range []string{"amfInfo", "smfInfo", "upfInfo"} {
+		for _, info := range nfInfos(profile, name) {
+			tais = append(tais, objectsOf(info["taiList"])...)
+		}
+	}
+	return tais
+}
+
+func stringOf(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func stringsOf(v interface{}) []string {
+	values, _ := v.([]interface{})
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+func objectsOf(v interface{}) []map[string]interface{} {
+	values, _ := v.([]interface{})
+	objects := make([]map[string]interface{}, 0, len(values))
+	for _, value := range values {
+		if object, ok := value.(map[string]interface{}); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+// intersects reports whether an element of a is the same as one of b.
+func intersects[T any](a, b []T, same func(T, T) bool) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if same(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equal(a, b string) bool {
+	return a == b
+}
+
+func equalFold[T any](a, b T) bool {
+	x, okX := any(a).(string)
+	y, okY := any(b).(string)
+	return okX && okY && strings.EqualFold(x, y)
+}
+
+func samePlmn(a, b map[string]interface{}) bool {
+	return a["mcc"] == b["mcc"] && a["mnc"] == b["mnc"]
+}
+
+// sameSnssai compares two S-NSSAIs, an absent sd matching any.
+func sameSnssai(a, b map[string]interface{}) bool {
+	if a["sst"] != b["sst"] {
+		return false
+	}
+	sdA, okA := a["sd"].(string)
+	sdB, okB := b["sd"].(string)
+	return !okA || !okB || strings.EqualFold(sdA, sdB)
+}
+
+func sameGuami(a, b map[string]interface{}) bool {
+	plmnA, _ := a["plmnId"].(map[string]interface{})
+	plmnB, _ := b["plmnId"].(map[string]interface{})
+	return plmnA != nil && plmnB != nil && samePlmn(plmnA, plmnB) && equalFold(a["amfId"], b["amfId"])
+}
+
+func sameTai(a, b map[string]interface{}) bool {
+	plmnA, _ := a["plmnId"].(map[string]interface{})
+	plmnB, _ := b["plmnId"].(map[string]interface{})
+	return plmnA != nil && plmnB != nil && samePlmn(plmnA, plmnB) && equalFold(a["tac"], b["tac"]) && a["nid"] == b["nid"]
+}
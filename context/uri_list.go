@@ -9,11 +9,9 @@
 
 package context
 
-import (
-	"github.com/omec-project/openapi/v2/models"
-)
-
+// UriList is the collection of NF instance URIs returned by
+// GET /nf-instances (3GPP TS 29.510 clause 6.1.6.2.14).
 type UriList struct {
-	NfType models.NFType `json:"nfType" bson:"nfType"`
-	Link   Links         `json:"_link" bson:"_link" mapstructure:"_link"`
+	Links          Links  `json:"_links"`
+	TotalItemCount *int32 `json:"totalItemCount,omitempty"`
 }
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ExportFormatVersion is the version of the layout of Export, to convert
+// older dumps when it changes.
+const ExportFormatVersion = 1
+
+// ExportedCollections are the collections holding the registry state, which
+// ExportData dumps and ImportData loads.
+var ExportedCollections = []string{"NfProfile", "Subscriptions", "SharedData"}
+
+// Export is a dump of the registry state. Documents are kept as MongoDB
+// Extended JSON, so that dates, such as those documents expire at, and
+// integer types are restored as they were stored.
+type Export struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// NfTypes are the NF types the dump was restricted to, if any.
+	NfTypes     []string                     `json:"nfTypes,omitempty"`
+	Collections map[string][]json.RawMessage `json:"collections"`
+}
+
+// ExportData dumps the documents of ExportedCollections. With nfTypes, only
+// the NF profiles of those types and the subscriptions they made are dumped,
+// along with all the shared data, which any profile may inherit from.
+func ExportData(db DBInterface, nfTypes []string) (*Export, error) {
+	export := &Export{
+		Version:     ExportFormatVersion,
+		ExportedAt:  time.Now().UTC(),
+		NfTypes:     nfTypes,
+		Collections: make(map[string][]json.RawMessage, len(ExportedCollections)),
+	}
+	for _, collName := range ExportedCollections {
+		docs, err := db.RestfulAPIGetMany(collName, exportFilter(collName, nfTypes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", collName, err)
+		}
+		encoded := make([]json.RawMessage, 0, len(docs))
+		for _, doc := range docs {
+			delete(doc, "_id")
+			b, err := bson.MarshalExtJSON(doc, false, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s %v: %w", collName, doc[StorageCollections[collName]], err)
+			}
+			encoded = append(encoded, b)
+		}
+		export.Collections[collName] = encoded
+	}
+	return export, nil
+}
+
+// exportFilter selects the documents of collName to dump for nfTypes.
+func exportFilter(collName string, nfTypes []string) bson.M {
+	if len(nfTypes) == 0 {
+		return bson.M{}
+	}
+	switch collName {
+	case "NfProfile":
+		return bson.M{"nftype": bson.M{"$in": nfTypes}}
+	case "Subscriptions":
+		return bson.M{"reqNfType": bson.M{"$in": nfTypes}}
+	default:
+		return bson.M{}
+	}
+}
+
+// ImportData stores the documents of export in db, replacing those with the
+// same key. Documents written with an older schema are upgraded by the
+// schema migration the NRF runs at startup. It returns the number of
+// documents stored.
+func ImportData(db DBInterface, export *Export) (int, error) {
+	if export.Version < 1 || export.Version > ExportFormatVersion {
+		return 0, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+	imported := 0
+	for _, collName := range ExportedCollections {
+		keyField := StorageCollections[collName]
+		for i, raw := range export.Collections[collName] {
+			doc := map[string]interface{}{}
+			if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+				return imported, fmt.Errorf("invalid %s document %d: %w", collName, i, err)
+			}
+			key, ok := doc[keyField]
+			if !ok {
+				return imported, fmt.Errorf("%s document %d has no %s", collName, i, keyField)
+			}
+			delete(doc, "_id")
+			if _, err := db.RestfulAPIPutOne(collName, bson.M{keyField: key}, doc); err != nil {
+				return imported, fmt.Errorf("failed to store %s %v: %w", collName, key, err)
+			}
+			imported++
+		}
+	}
+	return imported, nil
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestExportImport(t *testing.T) {
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	source := NewMemoryDBClient()
+	docs := map[string][]map[string]interface{}{
+		"NfProfile": {
+			{"nfinstanceid": "amf-1", "nftype": "AMF", "expireAt": expireAt, "profileVersion": int64(3)},
+			{"nfinstanceid": "smf-1", "nftype": "SMF"},
+		},
+		"Subscriptions": {
+			{"subscriptionId": "1", "reqNfType": "AMF", "subscrCond": map[string]interface{}{"nfType": "SMF"}},
+			{"subscriptionId": "2", "reqNfType": "SMF"},
+		},
+		"SharedData":              {{"sharedDataId": "plmn", "sharedProfileData": map[string]interface{}{"nfStatus": "REGISTERED"}}},
+		"NotificationDeadLetters": {{"id": "1"}},
+	}
+	for collName, collDocs := range docs {
+		for _, doc := range collDocs {
+			keyField := StorageCollections[collName]
+			if _, err := source.RestfulAPIPutOne(collName, bson.M{keyField: doc[keyField]}, doc); err != nil {
+				t.Fatalf("failed to store %s: %v", collName, err)
+			}
+		}
+	}
+
+	export, err := ExportData(source, []string{"AMF"})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(export.Collections["NfProfile"]) != 1 || len(export.Collections["Subscriptions"]) != 1 ||
+		len(export.Collections["SharedData"]) != 1 || export.Collections["NotificationDeadLetters"] != nil {
+		t.Fatalf("expected the AMF profile, its subscription and the shared data, got %v", export.Collections)
+	}
+	content, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("failed to encode export: %v", err)
+	}
+
+	var decoded Export
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	destination := NewMemoryDBClient()
+	imported, err := ImportData(destination, &decoded)
+	if err != nil || imported != 3 {
+		t.Fatalf("expected 3 documents to be imported, got %d: %v", imported, err)
+	}
+	profile, _ := destination.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"})
+	if at, ok := profile["expireAt"].(bson.DateTime); !ok || !at.Time().Equal(expireAt) {
+		t.Errorf("expected expireAt to be restored as a date, got %T %v", profile["expireAt"], profile["expireAt"])
+	}
+	if docs, _ := destination.RestfulAPIGetMany("NfProfile", bson.M{"profileVersion": 3}); len(docs) != 1 {
+		t.Error("expected profileVersion to be restored as a number")
+	}
+	if docs, _ := destination.RestfulAPIGetMany("Subscriptions", bson.M{"subscrCond.nfType": "SMF"}); len(docs) != 1 {
+		t.Error("expected subscrCond to be restored as a document")
+	}
+
+	decoded.Version = ExportFormatVersion + 1
+	if _, err := ImportData(destination, &decoded); err == nil {
+		t.Error("expected an export of a newer version to be refused")
+	}
+}
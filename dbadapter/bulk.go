@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Swap is one compare-and-swap of CompareAndSwapMany: the document matching
+// Filter is replaced by PutData, or deleted if PutData is nil, provided its
+// fields still have the values of Expected.
+type Swap struct {
+	Filter   bson.M
+	Expected bson.M
+	PutData  map[string]interface{}
+}
+
+// BulkDBInterface is implemented by the storages running many
+// compare-and-swaps in a single write.
+type BulkDBInterface interface {
+	RestfulAPICompareAndSwapMany(collName string, swaps []Swap) (int, error)
+}
+
+// CompareAndSwapMany runs swaps on collName, in a single write if the storage
+// allows it and one by one otherwise, and returns the number of documents
+// swapped. Swaps whose expected fields no longer match are skipped.
+func CompareAndSwapMany(ctx context.Context, collName string, swaps []Swap) (int, error) {
+	if len(swaps) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	switch db := DBClient.(type) {
+	case *MongoDBClient:
+		count, err := db.RestfulAPICompareAndSwapManyWithContext(ctx, collName, swaps)
+		return count, classified(err)
+	case BulkDBInterface:
+		if err := ctx.Err(); err != nil {
+			return 0, classified(err)
+		}
+		return db.RestfulAPICompareAndSwapMany(collName, swaps)
+	}
+	count := 0
+	for _, swap := range swaps {
+		swapped, err := contextDBClient().RestfulAPICompareAndSwapWithContext(ctx, collName, swap.Filter, swap.Expected, swap.PutData)
+		if err != nil {
+			return count, classified(err)
+		}
+		if swapped {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (c *MongoDBClient) RestfulAPICompareAndSwapMany(collName string, swaps []Swap) (int, error) {
+	return c.RestfulAPICompareAndSwapManyWithContext(context.TODO(), collName, swaps)
+}
+
+// RestfulAPICompareAndSwapManyWithContext sends the swaps as one unordered
+// bulk write, so that a swap whose document changed does not hold back the
+// others.
+func (c *MongoDBClient) RestfulAPICompareAndSwapManyWithContext(ctx context.Context, collName string, swaps []Swap) (int, error) {
+	client, err := c.connected()
+	if err != nil {
+		return 0, err
+	}
+	models := make([]mongo.WriteModel, 0, len(swaps))
+	for _, swap := range swaps {
+		condition := bson.M{}
+		for key, value := range swap.Filter {
+			condition[key] = value
+		}
+		for key, value := range swap.Expected {
+			condition[key] = value
+		}
+		if swap.PutData == nil {
+			models = append(models, mongo.NewDeleteOneModel().SetFilter(condition))
+			continue
+		}
+		// "_id" is immutable, ReplaceOne keeps the existing one
+		replacement := make(bson.M, len(swap.PutData))
+		for key, value := range swap.PutData {
+			if key != "_id" {
+				replacement[key] = value
+			}
+		}
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(condition).SetReplacement(replacement))
+	}
+	result, err := client.GetCollection(collName).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, c.checked(fmt.Errorf("RestfulAPICompareAndSwapManyWithContext BulkWrite err: %w", err))
+	}
+	return int(result.MatchedCount + result.DeletedCount), nil
+}
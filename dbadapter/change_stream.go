@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/util/mongoapi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Operations of a ChangeEvent.
+const (
+	ChangeInsert  = "insert"
+	ChangeUpdate  = "update"
+	ChangeReplace = "replace"
+	ChangeDelete  = "delete"
+	// ChangeReset tells that changes may have been missed, the stream having
+	// been restarted from the current state of the collection.
+	ChangeReset = "reset"
+)
+
+// NotificationClaimsCollection holds the claims of the notifications sent by
+// a single NRF on behalf of all those sharing the database, its documents
+// being removed once past their expireAt.
+const NotificationClaimsCollection = "NotificationClaims"
+
+// NfHistoryCollection holds the lifecycle events of the NF instances, its
+// documents being removed once past their expireAt.
+const NfHistoryCollection = "NfHistory"
+
+// MongoDB error codes of a change stream which cannot be resumed.
+const (
+	errCodeChangeStreamFatal       = 280
+	errCodeChangeStreamHistoryLost = 286
+)
+
+// ChangeEvent is a change to a document of a watched collection.
+type ChangeEvent struct {
+	Operation string
+	// Document is the document after an insert, update or replace; nil if
+	// it was deleted since.
+	Document map[string]interface{}
+	// Previous is the document before a delete, if the database keeps
+	// pre-images of the collection.
+	Previous map[string]interface{}
+}
+
+type changeStreamEvent struct {
+	OperationType            string                 `bson:"operationType"`
+	FullDocument             map[string]interface{} `bson:"fullDocument"`
+	FullDocumentBeforeChange map[string]interface{} `bson:"fullDocumentBeforeChange"`
+}
+
+// enablePreImages has the database keep the documents of collName as they
+// were before each change, so that delete events carry the deleted document.
+// This needs MongoDB 6.0 or later.
+func enablePreImages(db *mongoapi.MongoClient, collName string) {
+	database := db.Client.Database(db.GetCollection(collName).Database().Name())
+	err := database.RunCommand(context.TODO(), bson.D{
+		{Key: "collMod", Value: collName},
+		{Key: "changeStreamPreAndPostImages", Value: bson.M{"enabled": true}},
+	}).Err()
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(26) { // NamespaceNotFound
+		err = database.CreateCollection(context.TODO(), collName,
+			options.CreateCollection().SetChangeStreamPreAndPostImages(bson.M{"enabled": true}))
+	}
+	if err != nil {
+		logger.AppLog.Warnf("failed to enable pre-images of collection '%s', "+
+			"profiles removed by MongoDB will not be notified: %v", collName, err)
+	}
+}
+
+// watchChangeStream passes the changes to the collection to onChange,
+// reopening the stream whenever it fails until ctx is done. The stream is
+// resumed after the last change passed on; if that is no longer possible,
+// a fresh stream is opened and a ChangeReset passed on instead.
+func watchChangeStream(ctx context.Context, collection *mongo.Collection, maxBackoff time.Duration,
+	onChange func(event ChangeEvent),
+) {
+	logger.AppLog.Infoln("watching change stream of collection", collection.Name())
+	if onChange == nil {
+		onChange = func(event ChangeEvent) {
+			logger.AppLog.Debugf("%s change in collection %s", event.Operation, collection.Name())
+		}
+	}
+	backoff := connectInitialBackoff
+	var resumeToken bson.Raw
+	for ctx.Err() == nil {
+		opts := options.ChangeStream().
+			SetFullDocument(options.UpdateLookup).
+			SetFullDocumentBeforeChange(options.WhenAvailable)
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+		stream, err := collection.Watch(ctx, mongo.Pipeline{}, opts)
+		if err != nil {
+			if resumeToken != nil && !resumable(err) {
+				logger.AppLog.Warnf("failed to resume change stream, restarting it: %v", err)
+				resumeToken = nil
+				onChange(ChangeEvent{Operation: ChangeReset})
+				continue
+			}
+			logger.AppLog.Warnf("failed to open change stream, retrying in %v: %v", backoff, err)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = min(2*backoff, maxBackoff)
+			continue
+		}
+		backoff = connectInitialBackoff
+		for stream.Next(ctx) {
+			var event changeStreamEvent
+			if err := stream.Decode(&event); err != nil {
+				logger.AppLog.Warnf("failed to decode change stream event: %v", err)
+				resumeToken = stream.ResumeToken()
+				continue
+			}
+			switch event.OperationType {
+			case ChangeInsert, ChangeUpdate, ChangeReplace:
+				onChange(ChangeEvent{Operation: event.OperationType, Document: event.FullDocument})
+			case ChangeDelete:
+				onChange(ChangeEvent{Operation: ChangeDelete, Previous: event.FullDocumentBeforeChange})
+			case "invalidate":
+				// the collection was dropped or renamed: the stream cannot be
+				// resumed past this event
+				resumeToken = nil
+				onChange(ChangeEvent{Operation: ChangeReset})
+				continue
+			}
+			resumeToken = stream.ResumeToken()
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			logger.AppLog.Warnf("change stream failed: %v", err)
+			if !resumable(err) {
+				resumeToken = nil
+				onChange(ChangeEvent{Operation: ChangeReset})
+			}
+		}
+		if err := stream.Close(context.TODO()); err != nil {
+			logger.AppLog.Debugf("failed to close change stream: %v", err)
+		}
+	}
+}
+
+// resumable tells whether a change stream which failed with err can be
+// resumed from its last resume token.
+func resumable(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return true
+	}
+	return !serverErr.HasErrorCode(errCodeChangeStreamHistoryLost) &&
+		!serverErr.HasErrorCode(errCodeChangeStreamFatal)
+}
@@ -0,0 +1,324 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// DefaultOperationTimeout is the default of OperationTimeout.
+const DefaultOperationTimeout = 5 * time.Second
+
+// OperationTimeout bounds each operation run through the functions of this
+// file, such as GetOne, on top of the deadline of their context. Past it,
+// they fail with ErrTimeout.
+var OperationTimeout = DefaultOperationTimeout
+
+// ContextDBInterface is implemented by the storages whose operations give up
+// once their context is done. The others run them to completion, provided
+// the context is not done yet when they start.
+type ContextDBInterface interface {
+	RestfulAPIGetOneWithContext(ctx context.Context, collName string, filter bson.M) (map[string]interface{}, error)
+	RestfulAPIGetManyWithContext(ctx context.Context, collName string, filter bson.M) ([]map[string]interface{}, error)
+	RestfulAPIPutOneWithContext(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error)
+	RestfulAPIPutOneNotUpdateWithContext(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error)
+	RestfulAPIDeleteOneWithContext(ctx context.Context, collName string, filter bson.M) error
+	RestfulAPIDeleteManyWithContext(ctx context.Context, collName string, filter bson.M) error
+	RestfulAPIMergePatchWithContext(ctx context.Context, collName string, filter bson.M, patchData map[string]interface{}) error
+	RestfulAPIPostWithContext(ctx context.Context, collName string, filter bson.M, postData map[string]interface{}) (bool, error)
+	RestfulAPICompareAndSwapWithContext(ctx context.Context, collName string, filter bson.M, expected bson.M,
+		putData map[string]interface{}) (bool, error)
+}
+
+// GetOne returns the first document of collName matching filter, or
+// ErrNotFound if there is none.
+func GetOne(ctx context.Context, collName string, filter bson.M) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	doc, err := contextDBClient().RestfulAPIGetOneWithContext(ctx, collName, filter)
+	if err == nil && doc == nil {
+		err = fmt.Errorf("%w in %s", ErrNotFound, collName)
+	}
+	return doc, classified(err)
+}
+
+// GetMany returns the documents of collName matching filter.
+func GetMany(ctx context.Context, collName string, filter bson.M) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	docs, err := contextDBClient().RestfulAPIGetManyWithContext(ctx, collName, filter)
+	return docs, classified(err)
+}
+
+// PutOne sets the fields of putData in the document of collName matching
+// filter, inserting one if there is none, and reports whether one existed.
+func PutOne(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	existed, err := contextDBClient().RestfulAPIPutOneWithContext(ctx, collName, filter, putData)
+	return existed, classified(err)
+}
+
+// PutOneNotUpdate inserts putData in collName unless a document matches
+// filter, and reports whether one did.
+func PutOneNotUpdate(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	existed, err := contextDBClient().RestfulAPIPutOneNotUpdateWithContext(ctx, collName, filter, putData)
+	return existed, classified(err)
+}
+
+// Post stores postData as PutOne does.
+func Post(ctx context.Context, collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	existed, err := contextDBClient().RestfulAPIPostWithContext(ctx, collName, filter, postData)
+	return existed, classified(err)
+}
+
+// DeleteOne deletes the first document of collName matching filter, if any.
+func DeleteOne(ctx context.Context, collName string, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	return classified(contextDBClient().RestfulAPIDeleteOneWithContext(ctx, collName, filter))
+}
+
+// DeleteMany deletes the documents of collName matching filter.
+func DeleteMany(ctx context.Context, collName string, filter bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	return classified(contextDBClient().RestfulAPIDeleteManyWithContext(ctx, collName, filter))
+}
+
+// MergePatch applies the JSON merge patch patchData to the document of
+// collName matching filter.
+func MergePatch(ctx context.Context, collName string, filter bson.M, patchData map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	return classified(contextDBClient().RestfulAPIMergePatchWithContext(ctx, collName, filter, patchData))
+}
+
+// CompareAndSwap runs RestfulAPICompareAndSwap of DBInterface within ctx.
+func CompareAndSwap(ctx context.Context, collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	swapped, err := contextDBClient().RestfulAPICompareAndSwapWithContext(ctx, collName, filter, expected, putData)
+	return swapped, classified(err)
+}
+
+// classified returns err wrapped in ErrTimeout if its context deadline was
+// exceeded, as the storages not telling it themselves leave it.
+func classified(err error) error {
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrTimeout) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// contextDBClient returns DBClient, with the operations of
+// ContextDBInterface.
+func contextDBClient() ContextDBInterface {
+	if db, ok := DBClient.(ContextDBInterface); ok {
+		return db
+	}
+	return contextChecked{DBClient}
+}
+
+// contextChecked runs the operations of a storage ignoring contexts, such as
+// the in-memory one whose operations cannot block, unless their context is
+// already done.
+type contextChecked struct {
+	db DBInterface
+}
+
+func (c contextChecked) RestfulAPIGetOneWithContext(ctx context.Context, collName string, filter bson.M) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.db.RestfulAPIGetOne(collName, filter)
+}
+
+func (c contextChecked) RestfulAPIGetManyWithContext(ctx context.Context, collName string, filter bson.M) ([]map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.db.RestfulAPIGetMany(collName, filter)
+}
+
+func (c contextChecked) RestfulAPIPutOneWithContext(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.db.RestfulAPIPutOne(collName, filter, putData)
+}
+
+func (c contextChecked) RestfulAPIPutOneNotUpdateWithContext(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.db.RestfulAPIPutOneNotUpdate(collName, filter, putData)
+}
+
+func (c contextChecked) RestfulAPIDeleteOneWithContext(ctx context.Context, collName string, filter bson.M) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.RestfulAPIDeleteOne(collName, filter)
+}
+
+func (c contextChecked) RestfulAPIDeleteManyWithContext(ctx context.Context, collName string, filter bson.M) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.RestfulAPIDeleteMany(collName, filter)
+}
+
+func (c contextChecked) RestfulAPIMergePatchWithContext(ctx context.Context, collName string, filter bson.M, patchData map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.db.RestfulAPIMergePatch(collName, filter, patchData)
+}
+
+func (c contextChecked) RestfulAPIPostWithContext(ctx context.Context, collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.db.RestfulAPIPost(collName, filter, postData)
+}
+
+func (c contextChecked) RestfulAPICompareAndSwapWithContext(ctx context.Context, collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.db.RestfulAPICompareAndSwap(collName, filter, expected, putData)
+}
+
+func (c *MongoDBClient) RestfulAPIGetOneWithContext(ctx context.Context, collName string, filter bson.M) (map[string]interface{}, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := client.GetCollection(collName).FindOne(ctx, filter).Decode(&result); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetOneWithContext err: %w", err))
+	}
+	delete(result, "_id")
+	return result, nil
+}
+
+func (c *MongoDBClient) RestfulAPIGetManyWithContext(ctx context.Context, collName string, filter bson.M) ([]map[string]interface{}, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := client.GetCollection(collName).Find(ctx, filter)
+	if err != nil {
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetManyWithContext err: %w", err))
+	}
+	var results []map[string]interface{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetManyWithContext err: %w", err))
+	}
+	for _, result := range results {
+		delete(result, "_id")
+	}
+	return results, nil
+}
+
+func (c *MongoDBClient) RestfulAPIPutOneWithContext(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	client, err := c.connected()
+	if err != nil {
+		return false, err
+	}
+	existed, err := client.RestfulAPIPutOneWithContext(ctx, collName, filter, putData)
+	return existed, c.checked(err)
+}
+
+func (c *MongoDBClient) RestfulAPIPutOneNotUpdateWithContext(ctx context.Context, collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	client, err := c.connected()
+	if err != nil {
+		return false, err
+	}
+	collection := client.GetCollection(collName)
+	if err := collection.FindOne(ctx, filter).Err(); err == nil {
+		return true, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, c.checked(fmt.Errorf("RestfulAPIPutOneNotUpdateWithContext err: %w", err))
+	}
+	if _, err := collection.InsertOne(ctx, putData); err != nil {
+		return false, c.checked(fmt.Errorf("RestfulAPIPutOneNotUpdateWithContext InsertOne err: %w", err))
+	}
+	return false, nil
+}
+
+func (c *MongoDBClient) RestfulAPIDeleteOneWithContext(ctx context.Context, collName string, filter bson.M) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIDeleteOneWithContext(ctx, collName, filter))
+}
+
+func (c *MongoDBClient) RestfulAPIDeleteManyWithContext(ctx context.Context, collName string, filter bson.M) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	if _, err := client.GetCollection(collName).DeleteMany(ctx, filter); err != nil {
+		return c.checked(fmt.Errorf("RestfulAPIDeleteManyWithContext err: %w", err))
+	}
+	return nil
+}
+
+func (c *MongoDBClient) RestfulAPIMergePatchWithContext(ctx context.Context, collName string, filter bson.M, patchData map[string]interface{}) error {
+	original, err := c.RestfulAPIGetOneWithContext(ctx, collName, filter)
+	if err != nil {
+		return err
+	}
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIMergePatchWithContext Marshal err: %w", err)
+	}
+	patch, err := json.Marshal(patchData)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIMergePatchWithContext Marshal err: %w", err)
+	}
+	modifiedJSON, err := jsonpatch.MergePatch(originalJSON, patch)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIMergePatchWithContext MergePatch err: %w", err)
+	}
+	var modified map[string]interface{}
+	if err := json.Unmarshal(modifiedJSON, &modified); err != nil {
+		return fmt.Errorf("RestfulAPIMergePatchWithContext Unmarshal err: %w", err)
+	}
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	if _, err := client.GetCollection(collName).UpdateOne(ctx, filter, bson.M{"$set": modified}); err != nil {
+		return c.checked(fmt.Errorf("RestfulAPIMergePatchWithContext UpdateOne err: %w", err))
+	}
+	return nil
+}
+
+func (c *MongoDBClient) RestfulAPIPostWithContext(ctx context.Context, collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	return c.RestfulAPIPutOneWithContext(ctx, collName, filter, postData)
+}
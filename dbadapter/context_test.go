@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestContextOperations(t *testing.T) {
+	originalDBClient := DBClient
+	defer func() { DBClient = originalDBClient }()
+	DBClient = NewMemoryDBClient()
+	ctx := context.Background()
+
+	if _, err := GetOne(ctx, "NfProfile", bson.M{"nfinstanceid": "amf-1"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if existed, err := PutOne(ctx, "NfProfile", bson.M{"nfinstanceid": "amf-1"}, bson.M{"nftype": "AMF"}); err != nil || existed {
+		t.Fatalf("expected the profile to be inserted, got %v, %v", existed, err)
+	}
+	doc, err := GetOne(ctx, "NfProfile", bson.M{"nfinstanceid": "amf-1"})
+	if err != nil || doc["nftype"] != "AMF" {
+		t.Errorf("expected the stored profile, got %v, %v", doc, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := GetMany(cancelled, "NfProfile", bson.M{}); !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected the cancellation to be returned, got %v", err)
+	}
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	if err := DeleteOne(expired, "NfProfile", bson.M{"nfinstanceid": "amf-1"}); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	originalTimeout := OperationTimeout
+	defer func() { OperationTimeout = originalTimeout }()
+	OperationTimeout = 0
+	if _, err := CompareAndSwap(ctx, "NfProfile", bson.M{"nfinstanceid": "amf-1"}, bson.M{}, nil); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout past OperationTimeout, got %v", err)
+	}
+	OperationTimeout = originalTimeout
+	if _, err := GetOne(ctx, "NfProfile", bson.M{"nfinstanceid": "amf-1"}); err != nil {
+		t.Errorf("expected the timed out operations to leave the profile, got %v", err)
+	}
+}
+
+func TestDuplicateKeyIsConflict(t *testing.T) {
+	if !errors.Is(ErrDuplicateKey, ErrConflict) {
+		t.Error("expected ErrDuplicateKey to be an ErrConflict")
+	}
+	c := NewMongoDBClient(nil)
+	if err := c.checked(context.DeadlineExceeded); !errors.Is(err, ErrTimeout) || errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("expected an exceeded deadline to be ErrTimeout, got %v", err)
+	}
+}
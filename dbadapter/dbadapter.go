@@ -5,6 +5,12 @@ package dbadapter
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/omec-project/nrf/logger"
 	"github.com/omec-project/util/mongoapi"
@@ -24,62 +30,445 @@ type DBInterface interface {
 	RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string) error
 	RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) (bool, error)
 	RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{}) error
+	// RestfulAPICompareAndSwap atomically replaces the document matching filter
+	// with putData, provided it still matches every condition in expected. A nil
+	// putData deletes the document instead. It reports whether the swap happened.
+	RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M, putData map[string]interface{}) (bool, error)
 }
 
 var DBClient DBInterface = nil
 
+// NfProfileExpiryGracePeriod is how long, in seconds, MongoDB keeps an NF
+// profile past its expireAt before removing it on its own.
+const NfProfileExpiryGracePeriod int32 = 60
+
+const (
+	// connectInitialBackoff is the delay before the first reconnection
+	// attempt, doubled on each consecutive failure up to the maximum backoff.
+	connectInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+	// healthCheckInterval is how often the MongoDB connection is checked.
+	healthCheckInterval = 10 * time.Second
+	// pingTimeout bounds each health check.
+	pingTimeout = 2 * time.Second
+)
+
+// Errors telling why a storage operation failed, to be checked with
+// errors.Is.
+var (
+	// ErrStorageUnavailable is returned while the storage cannot be reached.
+	ErrStorageUnavailable = errors.New("storage unavailable")
+	// ErrNotFound is returned when no document matches the filter of an
+	// operation which needs one.
+	ErrNotFound = errors.New("document not found")
+	// ErrConflict is returned when a write clashes with a document stored
+	// concurrently.
+	ErrConflict = errors.New("storage conflict")
+	// ErrTimeout is returned when an operation outlasts its deadline.
+	ErrTimeout = errors.New("storage timeout")
+)
+
+// ErrDuplicateKey is returned when a write would store a second document
+// with the key of an existing one. It is an ErrConflict.
+var ErrDuplicateKey = fmt.Errorf("duplicate key: %w", ErrConflict)
+
+var ready atomic.Bool
+
+// Ready reports whether the storage can be reached, so that requests needing
+// it can be served.
+func Ready() bool {
+	return ready.Load()
+}
+
+// MongoDBConfig tells how to reach the MongoDB database and what to set up
+// in it.
+type MongoDBConfig struct {
+	Name                  string
+	Url                   string
+	StreamEnable          bool
+	NfProfileExpiryEnable bool
+	// ConnectTimeout bounds each connection attempt.
+	ConnectTimeout time.Duration
+	// MaxBackoff is the longest delay between connection attempts.
+	MaxBackoff time.Duration
+	// OnConnected, if set, is called once the database is set up, before
+	// it is reported ready. It is called again with backoff as long as it
+	// fails, the database being reported not ready meanwhile.
+	OnConnected func(db DBInterface) error
+	// OnChange, if set, is called with each change to the NfProfile
+	// collection, made by this NRF or any other sharing the database, when
+	// StreamEnable is set.
+	OnChange func(event ChangeEvent)
+}
+
+// MongoDBClient is the DBInterface of a MongoDB database. Until connected,
+// and while the database cannot be reached, its operations fail with
+// ErrStorageUnavailable.
 type MongoDBClient struct {
-	mongoapi.MongoClient
+	client atomic.Pointer[mongoapi.MongoClient]
+	// checkNow asks the health monitor to check the connection at once
+	checkNow chan struct{}
+}
+
+// NewMongoDBClient returns the DBInterface of a connected MongoDB client,
+// without the set up and monitoring ConnectToDBClient does.
+func NewMongoDBClient(client *mongoapi.MongoClient) *MongoDBClient {
+	c := &MongoDBClient{checkNow: make(chan struct{}, 1)}
+	if client != nil {
+		c.client.Store(client)
+	}
+	return c
+}
+
+// connected returns the MongoDB client, or ErrStorageUnavailable if there is
+// no connection.
+func (c *MongoDBClient) connected() (*mongoapi.MongoClient, error) {
+	client := c.client.Load()
+	if client == nil {
+		return nil, ErrStorageUnavailable
+	}
+	return client, nil
 }
 
-func iterateChangeStream(routineCtx context.Context, stream *mongo.ChangeStream) {
-	logger.AppLog.Infoln("iterate change stream for timeout")
-	defer stream.Close(routineCtx)
-	for stream.Next(routineCtx) {
-		var data bson.M
-		if err := stream.Decode(&data); err != nil {
-			panic(err)
+// checked returns err wrapped in the error telling why the operation failed,
+// after asking for the connection to be checked if err tells the database
+// could not be reached in time.
+func (c *MongoDBClient) checked(err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		select {
+		case c.checkNow <- struct{}{}:
+		default:
+		}
+		// the deadline of the operation, rather than one of the driver
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
 		}
-		logger.AppLog.Infoln("iterate stream:", data)
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %w", ErrDuplicateKey, err)
 	}
+	return err
 }
 
-func ConnectToDBClient(dbName string, url string, enableStream bool, nfProfileExpiryEnable bool) DBInterface {
-	for {
-		MongoClient, _ := mongoapi.NewMongoClient(url, dbName)
-		if MongoClient != nil {
-			logger.AppLog.Infoln("MongoDB Connection Successful")
-			DBClient = MongoClient
-			break
-		} else {
-			logger.AppLog.Infoln("MongoDB Connection Failed")
+func (c *MongoDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.RestfulAPIGetOne(collName, filter)
+	return result, c.checked(err)
+}
+
+func (c *MongoDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.RestfulAPIGetMany(collName, filter)
+	return result, c.checked(err)
+}
+
+func (c *MongoDBClient) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	client, err := c.connected()
+	if err != nil {
+		return false, err
+	}
+	existed, err := client.RestfulAPIPutOne(collName, filter, putData)
+	return existed, c.checked(err)
+}
+
+func (c *MongoDBClient) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	client, err := c.connected()
+	if err != nil {
+		return false, err
+	}
+	existed, err := client.RestfulAPIPutOneNotUpdate(collName, filter, putData)
+	return existed, c.checked(err)
+}
+
+func (c *MongoDBClient) RestfulAPIDeleteOne(collName string, filter bson.M) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIDeleteOne(collName, filter))
+}
+
+func (c *MongoDBClient) RestfulAPIDeleteMany(collName string, filter bson.M) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIDeleteMany(collName, filter))
+}
+
+func (c *MongoDBClient) RestfulAPIMergePatch(collName string, filter bson.M, patchData map[string]interface{}) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIMergePatch(collName, filter, patchData))
+}
+
+func (c *MongoDBClient) RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIJSONPatch(collName, filter, patchJSON))
+}
+
+func (c *MongoDBClient) RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIJSONPatchExtend(collName, filter, patchJSON, dataName))
+}
+
+func (c *MongoDBClient) RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	client, err := c.connected()
+	if err != nil {
+		return false, err
+	}
+	existed, err := client.RestfulAPIPost(collName, filter, postData)
+	return existed, c.checked(err)
+}
+
+func (c *MongoDBClient) RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{}) error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(client.RestfulAPIPutMany(collName, filterArray, putDataArray))
+}
+
+func (c *MongoDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	return c.RestfulAPICompareAndSwapWithContext(context.TODO(), collName, filter, expected, putData)
+}
+
+func (c *MongoDBClient) RestfulAPICompareAndSwapWithContext(ctx context.Context, collName string, filter bson.M,
+	expected bson.M, putData map[string]interface{},
+) (bool, error) {
+	client, err := c.connected()
+	if err != nil {
+		return false, err
+	}
+	condition := bson.M{}
+	for key, value := range filter {
+		condition[key] = value
+	}
+	for key, value := range expected {
+		condition[key] = value
+	}
+	collection := client.GetCollection(collName)
+	if putData == nil {
+		result, err := collection.DeleteOne(ctx, condition)
+		if err != nil {
+			return false, c.checked(fmt.Errorf("RestfulAPICompareAndSwapWithContext DeleteOne err: %w", err))
+		}
+		return result.DeletedCount > 0, nil
+	}
+	// "_id" is immutable, ReplaceOne keeps the existing one
+	replacement := make(bson.M, len(putData))
+	for key, value := range putData {
+		if key != "_id" {
+			replacement[key] = value
+		}
+	}
+	result, err := collection.ReplaceOne(ctx, condition, replacement)
+	if err != nil {
+		return false, c.checked(fmt.Errorf("RestfulAPICompareAndSwapWithContext ReplaceOne err: %w", err))
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// ConnectToDBClient sets DBClient to a client of the MongoDB database and
+// returns it at once. The connection is made in the background, retried with
+// exponential backoff until it succeeds or ctx is done, and then monitored:
+// Ready tells whether the database can be reached in the meantime. The
+// MongoDB driver reconnects on its own once the database is back.
+func ConnectToDBClient(ctx context.Context, cfg MongoDBConfig) DBInterface {
+	ready.Store(false)
+	if cfg.MaxBackoff < connectInitialBackoff {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	c := NewMongoDBClient(nil)
+	DBClient = c
+	go c.run(ctx, cfg)
+	return DBClient
+}
+
+func (c *MongoDBClient) run(ctx context.Context, cfg MongoDBConfig) {
+	url := withConnectTimeout(cfg.Url, cfg.ConnectTimeout)
+	var db *mongoapi.MongoClient
+	connected := retryWithBackoff(ctx, connectInitialBackoff, cfg.MaxBackoff, "MongoDB Connection Failed", func() (err error) {
+		db, err = mongoapi.NewMongoClient(url, cfg.Name)
+		return err
+	})
+	if !connected {
+		logger.AppLog.Infoln("MongoDB connection abandoned")
+		return
+	}
+	logger.AppLog.Infoln("MongoDB Connection Successful")
+	defer func() {
+		c.client.Store(nil)
+		if err := db.Client.Disconnect(context.TODO()); err != nil {
+			logger.AppLog.Warnf("failed to disconnect from MongoDB: %v", err)
 		}
+	}()
+	setUpDatabase(ctx, db, cfg)
+	c.client.Store(db)
+	if cfg.OnConnected != nil {
+		setUp := retryWithBackoff(ctx, connectInitialBackoff, cfg.MaxBackoff, "MongoDB set up failed", func() error {
+			return cfg.OnConnected(c)
+		})
+		if !setUp {
+			logger.AppLog.Infoln("MongoDB set up abandoned")
+			return
+		}
+	}
+	ready.Store(true)
+	c.monitor(ctx, db, cfg.MaxBackoff)
+}
+
+// setUpDatabase prepares the database once connected.
+func setUpDatabase(ctx context.Context, db *mongoapi.MongoClient, cfg MongoDBConfig) {
+	// NF instance lists are served from NfProfile; drop the collection older
+	// releases kept them in
+	if err := db.Client.Database(cfg.Name).Collection("urilist").Drop(context.TODO()); err != nil {
+		logger.AppLog.Warnf("failed to drop legacy urilist collection: %v", err)
 	}
 
-	db := DBClient.(*mongoapi.MongoClient)
-	if enableStream {
+	if cfg.StreamEnable {
 		logger.AppLog.Infoln("MongoDB Change stream Enabled")
-		database := db.Client.Database(dbName)
-		NfProfileColl := database.Collection("NfProfile")
-		// create stream to monitor actions on the collection
-		NfProfStream, err := NfProfileColl.Watch(context.TODO(), mongo.Pipeline{})
-		if err != nil {
-			panic(err)
+		enablePreImages(db, "NfProfile")
+		// Claims of the notifications sent by one NRF on behalf of all
+		if !db.RestfulAPICreateTTLIndex(NotificationClaimsCollection, 0, "expireAt") {
+			logger.AppLog.Warnf("failed to create ttl Index for field 'expireAt' in collection '%s'", NotificationClaimsCollection)
 		}
-		routineCtx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		// run routine to get messages from stream
-		go iterateChangeStream(routineCtx, NfProfStream)
+		go watchChangeStream(ctx, db.GetCollection("NfProfile"), cfg.MaxBackoff, cfg.OnChange)
 	}
 
-	if nfProfileExpiryEnable {
+	if err := ensureIndexes(ctx, db, Indexes); err != nil {
+		logger.AppLog.Warnf("failed to set up indexes: %v", err)
+	}
+
+	// Subscriptions are removed once their validityTime is over
+	if !db.RestfulAPICreateTTLIndex("Subscriptions", 0, "expireAt") {
+		logger.AppLog.Warnln("failed to create ttl Index for field 'expireAt' in collection 'Subscriptions'")
+	}
+	// NF lifecycle events are removed once past their retention
+	if !db.RestfulAPICreateTTLIndex(NfHistoryCollection, 0, "expireAt") {
+		logger.AppLog.Warnf("failed to create ttl Index for field 'expireAt' in collection '%s'", NfHistoryCollection)
+	}
+
+	if cfg.NfProfileExpiryEnable {
 		logger.AppLog.Infoln("NfProfile document expiry enabled")
-		ttlIndexCreated := db.RestfulAPICreateTTLIndex("NfProfile", 0, "expireAt")
-		ttlIndexStatus := "exists"
-		if ttlIndexCreated {
-			ttlIndexStatus = "created"
+		// Expired profiles are deregistered, and their subscribers notified, by
+		// the NRF itself. The TTL index only removes those it failed to handle.
+		ttlIndexStatus := "ready"
+		if !db.RestfulAPICreateTTLIndex("NfProfile", NfProfileExpiryGracePeriod, "expireAt") {
+			// The index exists, possibly with another expiry: recreate it
+			ttlIndexStatus = "updated"
+			if !db.RestfulAPIPatchTTLIndex("NfProfile", NfProfileExpiryGracePeriod, "expireAt") {
+				ttlIndexStatus = "not updated"
+			}
 		}
 		logger.AppLog.Infof("ttl Index %s for field 'expireAt' in collection 'NfProfile'", ttlIndexStatus)
 	}
-	return DBClient
+}
+
+// monitor pings the database periodically, or at once when an operation
+// failed to reach it, to keep Ready up to date until ctx is done. While the
+// database cannot be reached, it is pinged with exponential backoff.
+func (c *MongoDBClient) monitor(ctx context.Context, db *mongoapi.MongoClient, maxBackoff time.Duration) {
+	backoff := connectInitialBackoff
+	timer := time.NewTimer(healthCheckInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ready.Store(false)
+			return
+		case <-c.checkNow:
+		case <-timer.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := db.Client.Ping(pingCtx, nil)
+		cancel()
+		next := healthCheckInterval
+		switch {
+		case err == nil && !ready.Load():
+			logger.AppLog.Infoln("MongoDB reachable again")
+			ready.Store(true)
+			backoff = connectInitialBackoff
+		case err != nil && ctx.Err() == nil:
+			if ready.Swap(false) {
+				logger.AppLog.Warnf("MongoDB unreachable: %v", err)
+			}
+			next = backoff
+			backoff = min(2*backoff, maxBackoff)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// withConnectTimeout bounds the connection to the servers of the MongoDB url
+// and their selection, unless the url sets them already.
+func withConnectTimeout(url string, timeout time.Duration) string {
+	if timeout <= 0 || strings.Contains(url, "connectTimeoutMS=") || strings.Contains(url, "serverSelectionTimeoutMS=") {
+		return url
+	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+	options := "connectTimeoutMS=" + ms + "&serverSelectionTimeoutMS=" + ms
+	_, hosts, _ := strings.Cut(url, "://")
+	switch {
+	case strings.Contains(hosts, "?"):
+		return url + "&" + options
+	case strings.Contains(hosts, "/"):
+		return url + "?" + options
+	}
+	return url + "/?" + options
+}
+
+// retryWithBackoff calls f until it succeeds, waiting backoff after the first
+// failure and doubling it after each further one up to maxBackoff. Failures are
+// logged prefixed with failure. It reports false if ctx is done first.
+func retryWithBackoff(ctx context.Context, backoff, maxBackoff time.Duration, failure string, f func() error) bool {
+	for {
+		err := f()
+		if err == nil {
+			return true
+		}
+		logger.AppLog.Warnf("%s, retrying in %v: %v", failure, backoff, err)
+		if !sleep(ctx, backoff) {
+			return false
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// sleep waits for d, reporting false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestWithConnectTimeout(t *testing.T) {
+	testCases := []struct {
+		url  string
+		want string
+	}{
+		{"mongodb://127.0.0.1:27017", "mongodb://127.0.0.1:27017/?connectTimeoutMS=1500&serverSelectionTimeoutMS=1500"},
+		{"mongodb://db/aether", "mongodb://db/aether?connectTimeoutMS=1500&serverSelectionTimeoutMS=1500"},
+		{"mongodb://a,b/?replicaSet=rs0", "mongodb://a,b/?replicaSet=rs0&connectTimeoutMS=1500&serverSelectionTimeoutMS=1500"},
+		{"mongodb://db/?connectTimeoutMS=100", "mongodb://db/?connectTimeoutMS=100"},
+	}
+	for _, tc := range testCases {
+		if got := withConnectTimeout(tc.url, 1500*time.Millisecond); got != tc.want {
+			t.Errorf("withConnectTimeout(%q) = %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestConnectToDBClientDoesNotBlock(t *testing.T) {
+	originalDBClient := DBClient
+	defer func() { DBClient = originalDBClient }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	db := ConnectToDBClient(ctx, MongoDBConfig{
+		Name:           "nrf",
+		Url:            "mongodb://127.0.0.1:1",
+		ConnectTimeout: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected ConnectToDBClient to return at once, took %v", elapsed)
+	}
+	if Ready() {
+		t.Error("expected the storage not to be ready")
+	}
+	if _, err := db.RestfulAPIGetOne("NfProfile", bson.M{}); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("expected ErrStorageUnavailable, got %v", err)
+	}
+	if _, err := db.RestfulAPICompareAndSwap("NfProfile", bson.M{}, bson.M{}, nil); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("expected ErrStorageUnavailable, got %v", err)
+	}
+}
+
+func TestSleepStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if sleep(ctx, time.Hour) {
+		t.Error("expected sleep to stop when the context is done")
+	}
+	if !sleep(context.Background(), time.Millisecond) {
+		t.Error("expected sleep to complete")
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	attempts := 0
+	ok := retryWithBackoff(context.Background(), time.Millisecond, 2*time.Millisecond, "set up failed", func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("migration failed")
+		}
+		return nil
+	})
+	if !ok || attempts != 3 {
+		t.Errorf("expected success after 3 attempts, got %v after %d", ok, attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if retryWithBackoff(ctx, time.Hour, time.Hour, "set up failed", func() error {
+		return errors.New("migration failed")
+	}) {
+		t.Error("expected the retries to stop when the context is done")
+	}
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/omec-project/nrf/logger"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// fileFormatVersion is the version of the layout of the storage file, to
+// convert older files when it changes.
+const fileFormatVersion = 1
+
+// fileSnapshot is the content of the storage file: every collection, with
+// its documents as stored in MongoDB.
+type fileSnapshot struct {
+	Version     int32                 `bson:"version"`
+	Collections map[string][]bson.Raw `bson:"collections"`
+}
+
+// OpenFileDBClient returns a client keeping the collections in memory and
+// saving them to the file at path after every change, for single node
+// deployments without MongoDB. The collections saved there before, if any,
+// are loaded; the file is created on the first change otherwise.
+//
+// The whole file is rewritten on each change, through a temporary file
+// renamed over it, so it is never left half written. This suits the few
+// hundred documents of an edge site, not a large deployment.
+func OpenFileDBClient(path string) (*MemoryDBClient, error) {
+	db := NewMemoryDBClient()
+	db.path = path
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %w", err)
+	}
+	var snapshot fileSnapshot
+	if err := bson.Unmarshal(content, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid storage file %s: %w", path, err)
+	}
+	if snapshot.Version != fileFormatVersion {
+		return nil, fmt.Errorf("unsupported storage file version %d in %s", snapshot.Version, path)
+	}
+	for collName, docs := range snapshot.Collections {
+		db.collections[collName] = docs
+	}
+	return db, nil
+}
+
+// ConnectToFileDBClient sets DBClient to a client backed by the file at path,
+// with the same document expiry ConnectToDBClient sets up in MongoDB.
+func ConnectToFileDBClient(path string, nfProfileExpiryEnable bool) (DBInterface, error) {
+	db, err := OpenFileDBClient(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.AppLog.Infof("using storage file %s", path)
+	db.RestfulAPICreateTTLIndex("Subscriptions", 0, "expireAt")
+	db.RestfulAPICreateTTLIndex(NfHistoryCollection, 0, "expireAt")
+	if nfProfileExpiryEnable {
+		db.RestfulAPICreateTTLIndex("NfProfile", NfProfileExpiryGracePeriod, "expireAt")
+	}
+	DBClient = db
+	ready.Store(true)
+	return DBClient, nil
+}
+
+// save writes the collections to the storage file, if the client has one and
+// they changed. On failure, the changes are kept in memory and saved with
+// the next ones. The caller holds c.mu.
+func (c *MemoryDBClient) save() error {
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+	content, err := bson.Marshal(fileSnapshot{Version: fileFormatVersion, Collections: c.collections})
+	if err != nil {
+		return fmt.Errorf("failed to encode storage file: %w", err)
+	}
+	if err := writeFileAtomic(c.path, content); err != nil {
+		return fmt.Errorf("failed to save storage file: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with content, which is synced
+// to disk before the file is renamed over the previous one.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
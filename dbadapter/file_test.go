@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestFileDBClientSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nrf", "nrf.db")
+	db, err := OpenFileDBClient(path)
+	if err != nil {
+		t.Fatalf("failed to open storage file: %v", err)
+	}
+	db.RestfulAPICreateTTLIndex("Subscriptions", 0, "expireAt")
+	if _, err := db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "amf-1"},
+		map[string]interface{}{"nftype": "AMF", "plmnlist": []map[string]interface{}{{"mcc": "001", "mnc": "01"}}}); err != nil {
+		t.Fatalf("failed to store profile: %v", err)
+	}
+	if _, err := db.RestfulAPIPutOne("urilist", bson.M{"nftype": "AMF"}, map[string]interface{}{"link": "amf-1"}); err != nil {
+		t.Fatalf("failed to store uri list: %v", err)
+	}
+	for id, expireAt := range map[string]time.Time{"short": time.Now().Add(100 * time.Millisecond), "long": time.Now().Add(time.Hour)} {
+		if _, err := db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": id},
+			map[string]interface{}{"expireAt": expireAt}); err != nil {
+			t.Fatalf("failed to store subscription: %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the storage file to be left, got %v", entries)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	db, err = OpenFileDBClient(path)
+	if err != nil {
+		t.Fatalf("failed to reopen storage file: %v", err)
+	}
+	db.RestfulAPICreateTTLIndex("Subscriptions", 0, "expireAt")
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{"plmnlist.mcc": "001"}); len(docs) != 1 || docs[0]["nftype"] != "AMF" {
+		t.Errorf("expected the profile to be restored, got %v", docs)
+	}
+	if doc, _ := db.RestfulAPIGetOne("urilist", bson.M{"nftype": "AMF"}); doc["link"] != "amf-1" {
+		t.Errorf("expected the uri list to be restored, got %v", doc)
+	}
+	if docs, _ := db.RestfulAPIGetMany("Subscriptions", bson.M{}); len(docs) != 1 || docs[0]["subscriptionId"] != "long" {
+		t.Errorf("expected the expired subscription to be removed, got %v", docs)
+	}
+
+	if err := db.RestfulAPIDeleteMany("NfProfile", bson.M{}); err != nil {
+		t.Fatalf("failed to delete profiles: %v", err)
+	}
+	db, _ = OpenFileDBClient(path)
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{}); len(docs) != 0 {
+		t.Errorf("expected the deletion to be saved, got %v", docs)
+	}
+}
+
+func TestOpenFileDBClientRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nrf.db")
+	if err := os.WriteFile(path, []byte("not bson"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileDBClient(path); err == nil {
+		t.Error("expected an invalid storage file to be rejected")
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	source, err := OpenFileDBClient(filepath.Join(t.TempDir(), "nrf.db"))
+	if err != nil {
+		t.Fatalf("failed to open storage file: %v", err)
+	}
+	source.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}, map[string]interface{}{"nftype": "AMF"})
+	source.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "smf-1"}, map[string]interface{}{"nftype": "SMF"})
+	source.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": "1"}, map[string]interface{}{"reqNfType": "SMF"})
+	source.RestfulAPIPutOne("SharedData", bson.M{"sharedDataId": "shared-1"}, map[string]interface{}{"sharedProfileData": map[string]interface{}{"priority": 1}})
+
+	destination := NewMemoryDBClient()
+	copied, err := MigrateStorage(source, destination)
+	if err != nil || copied != 4 {
+		t.Fatalf("expected 4 documents to be copied, got %d: %v", copied, err)
+	}
+	if doc, _ := destination.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "smf-1"}); doc["nftype"] != "SMF" {
+		t.Errorf("expected the SMF profile to be copied, got %v", doc)
+	}
+	if doc, _ := destination.RestfulAPIGetOne("SharedData", bson.M{"sharedProfileData.priority": 1}); doc == nil {
+		t.Error("expected the shared data to be copied")
+	}
+
+	source.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}, map[string]interface{}{"nftype": "AUSF"})
+	if copied, err = MigrateStorage(source, destination); err != nil || copied != 0 {
+		t.Errorf("expected no migration into a storage holding data, got %d: %v", copied, err)
+	}
+	if doc, _ := destination.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}); doc["nftype"] != "AMF" {
+		t.Errorf("expected the migrated profile to be kept, got %v", doc)
+	}
+}
+
+// failingPutDBClient fails the writes past the first puts.
+type failingPutDBClient struct {
+	*MemoryDBClient
+	puts int
+}
+
+func (c *failingPutDBClient) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	if collName != StorageMigrationCollection {
+		if c.puts == 0 {
+			return false, errors.New("storage unreachable")
+		}
+		c.puts--
+	}
+	return c.MemoryDBClient.RestfulAPIPutOne(collName, filter, putData)
+}
+
+func TestMigrateStorageResumesFailedMigration(t *testing.T) {
+	source := NewMemoryDBClient()
+	for _, nfInstanceID := range []string{"amf-1", "smf-1", "udm-1"} {
+		source.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID}, map[string]interface{}{"nftype": "AMF"})
+	}
+
+	destination := &failingPutDBClient{MemoryDBClient: NewMemoryDBClient(), puts: 1}
+	if _, err := MigrateStorage(source, destination); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	destination.puts = 3
+	copied, err := MigrateStorage(source, destination)
+	if err != nil || copied != 3 {
+		t.Fatalf("expected the failed migration to be resumed, got %d: %v", copied, err)
+	}
+	if docs, _ := destination.RestfulAPIGetMany("NfProfile", bson.M{}); len(docs) != 3 {
+		t.Errorf("expected every profile to be copied, got %v", docs)
+	}
+	if copied, err := MigrateStorage(source, destination); err != nil || copied != 0 {
+		t.Errorf("expected a completed migration not to run again, got %d: %v", copied, err)
+	}
+}
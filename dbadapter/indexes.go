@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/util/mongoapi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// managedIndexPrefix starts the names of the indexes the NRF manages, so
+// that those it no longer declares are dropped while others are left alone.
+const managedIndexPrefix = "nrf_"
+
+// IndexSpec is an index the NRF keeps on one of its collections.
+type IndexSpec struct {
+	Collection string
+	Name       string
+	// Keys are the indexed fields, all in ascending order.
+	Keys   []string
+	Unique bool
+}
+
+// Indexes are the indexes of the fields NF profiles, subscriptions and NF
+// lifecycle events are looked up by, discovery queries in particular. The TTL
+// indexes removing expired documents are set up on their own.
+var Indexes = []IndexSpec{
+	{Collection: "NfProfile", Name: "nrf_nfinstanceid", Keys: []string{"nfinstanceid"}, Unique: true},
+	{Collection: "NfProfile", Name: "nrf_nftype", Keys: []string{"nftype"}},
+	{Collection: "NfProfile", Name: "nrf_nfservices_servicename", Keys: []string{"nfservices.servicename"}},
+	{Collection: "NfProfile", Name: "nrf_snssais", Keys: []string{"snssais.sst", "snssais.sd"}},
+	{Collection: "NfProfile", Name: "nrf_smfinfo_dnn", Keys: []string{"smfinfo.snssaismfinfolist.dnnsmfinfolist.dnn"}},
+	{Collection: "NfProfile", Name: "nrf_smfinfo_tailist", Keys: []string{"smfinfo.tailist.tac"}},
+	{Collection: "NfProfile", Name: "nrf_amfinfo_tailist", Keys: []string{"amfinfo.tailist.tac"}},
+	{Collection: "NfProfile", Name: "nrf_amfinfo_amfsetid", Keys: []string{"amfinfo.amfsetid"}},
+	{Collection: "NfProfile", Name: "nrf_udminfo_supiranges", Keys: []string{"udminfo.supiranges.start", "udminfo.supiranges.end"}},
+	{Collection: "NfProfile", Name: "nrf_sharedprofiledataid", Keys: []string{"sharedprofiledataid"}},
+	{Collection: "NfProfile", Name: "nrf_sharedservicedataids", Keys: []string{"sharedServiceDataIds"}},
+	{Collection: "Subscriptions", Name: "nrf_subscriptionid", Keys: []string{"subscriptionId"}, Unique: true},
+	{Collection: "Subscriptions", Name: "nrf_subscrcond_nfinstanceid", Keys: []string{"subscrCond.nfInstanceId"}},
+	{Collection: "Subscriptions", Name: "nrf_reqnftype", Keys: []string{"reqNfType"}},
+	{Collection: NfHistoryCollection, Name: "nrf_history_nfinstanceid", Keys: []string{"nfInstanceId", "time"}},
+}
+
+// IndexUsage tells how often an index was used since the database started
+// counting, at Since.
+type IndexUsage struct {
+	Collection string    `json:"collection"`
+	Name       string    `json:"name"`
+	Keys       []string  `json:"keys"`
+	Ops        int64     `json:"ops"`
+	Since      time.Time `json:"since"`
+	// Managed tells whether the index is one of Indexes.
+	Managed bool `json:"managed"`
+}
+
+// IndexReporter is implemented by the storages keeping indexes.
+type IndexReporter interface {
+	IndexUsage() ([]IndexUsage, error)
+}
+
+// EnsureIndexes makes the indexes of the collections match Indexes.
+func (c *MongoDBClient) EnsureIndexes() error {
+	client, err := c.connected()
+	if err != nil {
+		return err
+	}
+	return c.checked(ensureIndexes(context.TODO(), client, Indexes))
+}
+
+// IndexUsage reports the usage of the indexes of the NRF collections.
+func (c *MongoDBClient) IndexUsage() ([]IndexUsage, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	var usage []IndexUsage
+	for _, collName := range indexedCollections(Indexes) {
+		collUsage, err := indexUsage(context.TODO(), client.GetCollection(collName))
+		if err != nil {
+			return nil, c.checked(fmt.Errorf("failed to read index usage of %s: %w", collName, err))
+		}
+		usage = append(usage, collUsage...)
+	}
+	return usage, nil
+}
+
+// existingIndex is an index as listed by MongoDB.
+type existingIndex struct {
+	Name   string `bson:"name"`
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique"`
+}
+
+// ensureIndexes creates the indexes of specs which are missing, recreates
+// those whose definition changed and drops the managed ones no longer in
+// specs. On failure, the other indexes are set up regardless.
+func ensureIndexes(ctx context.Context, db *mongoapi.MongoClient, specs []IndexSpec) error {
+	var errs []error
+	for _, collName := range indexedCollections(specs) {
+		indexes := db.GetCollection(collName).Indexes()
+		existing, err := listIndexes(ctx, indexes)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list indexes of %s: %w", collName, err))
+			continue
+		}
+		declared := map[string]bool{}
+		for _, spec := range specs {
+			if spec.Collection != collName {
+				continue
+			}
+			declared[spec.Name] = true
+			if index, ok := existing[spec.Name]; ok {
+				if index.Unique == spec.Unique && ascendingKeys(index.Key, spec.Keys) {
+					continue
+				}
+				logger.AppLog.Infof("recreating index %s of collection %s", spec.Name, collName)
+				if err := indexes.DropOne(ctx, spec.Name); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drop index %s of %s: %w", spec.Name, collName, err))
+					continue
+				}
+			}
+			if err := createIndex(ctx, indexes, spec); err != nil {
+				errs = append(errs, fmt.Errorf("failed to create index %s of %s: %w", spec.Name, collName, err))
+			}
+		}
+		for name := range existing {
+			if strings.HasPrefix(name, managedIndexPrefix) && !declared[name] {
+				logger.AppLog.Infof("dropping index %s of collection %s", name, collName)
+				if err := indexes.DropOne(ctx, name); err != nil {
+					errs = append(errs, fmt.Errorf("failed to drop index %s of %s: %w", name, collName, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func listIndexes(ctx context.Context, indexes mongo.IndexView) (map[string]existingIndex, error) {
+	cursor, err := indexes.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []existingIndex
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	existing := make(map[string]existingIndex, len(list))
+	for _, index := range list {
+		existing[index.Name] = index
+	}
+	return existing, nil
+}
+
+func createIndex(ctx context.Context, indexes mongo.IndexView, spec IndexSpec) error {
+	keys := make(bson.D, 0, len(spec.Keys))
+	for _, key := range spec.Keys {
+		keys = append(keys, bson.E{Key: key, Value: 1})
+	}
+	_, err := indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName(spec.Name).SetUnique(spec.Unique),
+	})
+	if err == nil {
+		logger.AppLog.Infof("created index %s of collection %s", spec.Name, spec.Collection)
+	}
+	return err
+}
+
+func indexUsage(ctx context.Context, collection *mongo.Collection) ([]IndexUsage, error) {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{{{Key: "$indexStats", Value: bson.D{}}}})
+	if err != nil {
+		return nil, err
+	}
+	var stats []struct {
+		Name     string `bson:"name"`
+		Key      bson.D `bson:"key"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	usage := make([]IndexUsage, 0, len(stats))
+	for _, stat := range stats {
+		usage = append(usage, IndexUsage{
+			Collection: collection.Name(),
+			Name:       stat.Name,
+			Keys:       indexKeys(stat.Key),
+			Ops:        stat.Accesses.Ops,
+			Since:      stat.Accesses.Since,
+			Managed:    strings.HasPrefix(stat.Name, managedIndexPrefix),
+		})
+	}
+	return usage, nil
+}
+
+// indexedCollections returns the collections specs are declared for.
+func indexedCollections(specs []IndexSpec) []string {
+	var collections []string
+	for _, spec := range specs {
+		if !slices.Contains(collections, spec.Collection) {
+			collections = append(collections, spec.Collection)
+		}
+	}
+	return collections
+}
+
+// ascendingKeys tells whether key indexes the given fields, in ascending
+// order.
+func ascendingKeys(key bson.D, fields []string) bool {
+	if len(key) != len(fields) {
+		return false
+	}
+	for i, e := range key {
+		if e.Key != fields[i] {
+			return false
+		}
+		switch order := e.Value.(type) {
+		case int32:
+			if order != 1 {
+				return false
+			}
+		case int64:
+			if order != 1 {
+				return false
+			}
+		case float64:
+			if order != 1 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func indexKeys(key bson.D) []string {
+	keys := make([]string, 0, len(key))
+	for _, e := range key {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestIndexesAreManaged(t *testing.T) {
+	names := map[string]bool{}
+	for _, spec := range Indexes {
+		if !strings.HasPrefix(spec.Name, managedIndexPrefix) {
+			t.Errorf("index %s is not named as managed by the NRF", spec.Name)
+		}
+		if names[spec.Name] {
+			t.Errorf("index %s is declared twice", spec.Name)
+		}
+		names[spec.Name] = true
+		if len(spec.Keys) == 0 {
+			t.Errorf("index %s has no keys", spec.Name)
+		}
+	}
+	if got := indexedCollections(Indexes); !reflect.DeepEqual(got, []string{"NfProfile", "Subscriptions", NfHistoryCollection}) {
+		t.Errorf("unexpected indexed collections %v", got)
+	}
+}
+
+func TestAscendingKeys(t *testing.T) {
+	testCases := []struct {
+		name string
+		key  bson.D
+		want bool
+	}{
+		{"same keys", bson.D{{Key: "snssais.sst", Value: int32(1)}, {Key: "snssais.sd", Value: float64(1)}}, true},
+		{"other order", bson.D{{Key: "snssais.sd", Value: int32(1)}, {Key: "snssais.sst", Value: int32(1)}}, false},
+		{"descending", bson.D{{Key: "snssais.sst", Value: int32(1)}, {Key: "snssais.sd", Value: int32(-1)}}, false},
+		{"text index", bson.D{{Key: "snssais.sst", Value: "text"}, {Key: "snssais.sd", Value: int32(1)}}, false},
+		{"fewer keys", bson.D{{Key: "snssais.sst", Value: int64(1)}}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ascendingKeys(tc.key, []string{"snssais.sst", "snssais.sd"}); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/omec-project/nrf/logger"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MemoryDBClient keeps the NRF collections in memory, for labs and tests
+// run without MongoDB, or for single node deployments when backed by a file
+// (see OpenFileDBClient). It behaves as the mongoapi client does, for the
+// query operators the producers use: documents are stored as BSON, get an
+// "_id" and come back decoded the way MongoDB returns them.
+type MemoryDBClient struct {
+	mu          sync.Mutex
+	collections map[string][]bson.Raw
+	ttlIndexes  map[string]memoryTTLIndex
+	// path is the file the collections are saved to after every change,
+	// if any. dirty tells a change is not saved yet.
+	path  string
+	dirty bool
+}
+
+// memoryTTLIndex removes the documents of a collection once the date in
+// field is expireAfter in the past.
+type memoryTTLIndex struct {
+	field       string
+	expireAfter time.Duration
+}
+
+func NewMemoryDBClient() *MemoryDBClient {
+	return &MemoryDBClient{
+		collections: make(map[string][]bson.Raw),
+		ttlIndexes:  make(map[string]memoryTTLIndex),
+	}
+}
+
+// ConnectToMemoryDBClient sets DBClient to an empty in-memory client, with
+// the same document expiry ConnectToDBClient sets up in MongoDB.
+func ConnectToMemoryDBClient(nfProfileExpiryEnable bool) DBInterface {
+	logger.AppLog.Warnln("using in-memory storage: NRF data is lost on restart")
+	db := NewMemoryDBClient()
+	db.RestfulAPICreateTTLIndex("Subscriptions", 0, "expireAt")
+	db.RestfulAPICreateTTLIndex(NfHistoryCollection, 0, "expireAt")
+	if nfProfileExpiryEnable {
+		db.RestfulAPICreateTTLIndex("NfProfile", NfProfileExpiryGracePeriod, "expireAt")
+	}
+	DBClient = db
+	ready.Store(true)
+	return DBClient
+}
+
+// RestfulAPICreateTTLIndex removes the documents of collName timeout seconds
+// after the date in timeField. Expired documents are dropped on the next
+// access to the collection rather than by a background task.
+func (c *MemoryDBClient) RestfulAPICreateTTLIndex(collName string, timeout int32, timeField string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttlIndexes[collName] = memoryTTLIndex{field: timeField, expireAfter: time.Duration(timeout) * time.Second}
+	return true
+}
+
+func (c *MemoryDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	docs, _, err := c.find(collName, filter, true)
+	if err != nil {
+		return nil, fmt.Errorf("RestfulAPIGetOne err: %w", err)
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	delete(docs[0], "_id")
+	return docs[0], nil
+}
+
+func (c *MemoryDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	docs, _, err := c.find(collName, filter, false)
+	if err != nil {
+		return nil, fmt.Errorf("RestfulAPIGetMany err: %w", err)
+	}
+	for _, doc := range docs {
+		delete(doc, "_id")
+	}
+	return docs, nil
+}
+
+func (c *MemoryDBClient) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	existed, err := c.upsert(collName, filter, putData)
+	if err == nil {
+		err = c.save()
+	}
+	if err != nil {
+		return false, fmt.Errorf("RestfulAPIPutOne err: %w", err)
+	}
+	return existed, nil
+}
+
+func (c *MemoryDBClient) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	docs, _, err := c.find(collName, filter, true)
+	if err != nil {
+		return false, fmt.Errorf("RestfulAPIPutOneNotUpdate err: %w", err)
+	}
+	if len(docs) != 0 {
+		return true, nil
+	}
+	if err := c.insert(collName, putData); err != nil {
+		return false, fmt.Errorf("RestfulAPIPutOneNotUpdate err: %w", err)
+	}
+	if err := c.save(); err != nil {
+		return false, fmt.Errorf("RestfulAPIPutOneNotUpdate err: %w", err)
+	}
+	return false, nil
+}
+
+func (c *MemoryDBClient) RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, putData := range putDataArray {
+		docs, positions, err := c.find(collName, filterArray[i], true)
+		if err != nil {
+			return fmt.Errorf("RestfulAPIPutMany err: %w", err)
+		}
+		if len(docs) == 0 {
+			err = c.insert(collName, putData)
+		} else {
+			err = c.set(collName, positions[0], docs[0], putData)
+		}
+		if err != nil {
+			return fmt.Errorf("RestfulAPIPutMany err: %w", err)
+		}
+	}
+	if err := c.save(); err != nil {
+		return fmt.Errorf("RestfulAPIPutMany err: %w", err)
+	}
+	return nil
+}
+
+func (c *MemoryDBClient) RestfulAPIDeleteOne(collName string, filter bson.M) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, positions, err := c.find(collName, filter, true)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIDeleteOne err: %w", err)
+	}
+	c.remove(collName, positions)
+	if err := c.save(); err != nil {
+		return fmt.Errorf("RestfulAPIDeleteOne err: %w", err)
+	}
+	return nil
+}
+
+func (c *MemoryDBClient) RestfulAPIDeleteMany(collName string, filter bson.M) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, positions, err := c.find(collName, filter, false)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIDeleteMany err: %w", err)
+	}
+	c.remove(collName, positions)
+	if err := c.save(); err != nil {
+		return fmt.Errorf("RestfulAPIDeleteMany err: %w", err)
+	}
+	return nil
+}
+
+func (c *MemoryDBClient) RestfulAPIMergePatch(collName string, filter bson.M, patchData map[string]interface{}) error {
+	patch, err := json.Marshal(patchData)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIMergePatch Marshal err: %w", err)
+	}
+	if err := c.patch(collName, filter, "", func(original []byte) ([]byte, error) {
+		return jsonpatch.MergePatch(original, patch)
+	}); err != nil {
+		return fmt.Errorf("RestfulAPIMergePatch err: %w", err)
+	}
+	return nil
+}
+
+func (c *MemoryDBClient) RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte) error {
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIJSONPatch DecodePatch err: %w", err)
+	}
+	if err := c.patch(collName, filter, "", patch.Apply); err != nil {
+		return fmt.Errorf("RestfulAPIJSONPatch err: %w", err)
+	}
+	return nil
+}
+
+func (c *MemoryDBClient) RestfulAPIJSONPatchExtend(collName string, filter bson.M, patchJSON []byte, dataName string) error {
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return fmt.Errorf("RestfulAPIJSONPatchExtend DecodePatch err: %w", err)
+	}
+	if err := c.patch(collName, filter, dataName, patch.Apply); err != nil {
+		return fmt.Errorf("RestfulAPIJSONPatchExtend err: %w", err)
+	}
+	return nil
+}
+
+func (c *MemoryDBClient) RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	return c.RestfulAPIPutOne(collName, filter, postData)
+}
+
+func (c *MemoryDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	swapped, err := c.compareAndSwap(collName, Swap{Filter: filter, Expected: expected, PutData: putData})
+	if err == nil {
+		err = c.save()
+	}
+	if err != nil {
+		return false, fmt.Errorf("RestfulAPICompareAndSwap err: %w", err)
+	}
+	return swapped, nil
+}
+
+// RestfulAPICompareAndSwapMany runs the swaps under a single lock and saves
+// the collections once.
+func (c *MemoryDBClient) RestfulAPICompareAndSwapMany(collName string, swaps []Swap) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	var err error
+	for _, swap := range swaps {
+		var swapped bool
+		if swapped, err = c.compareAndSwap(collName, swap); err != nil {
+			break
+		}
+		if swapped {
+			count++
+		}
+	}
+	if saveErr := c.save(); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return count, fmt.Errorf("RestfulAPICompareAndSwapMany err: %w", err)
+	}
+	return count, nil
+}
+
+// compareAndSwap replaces, or deletes if PutData is nil, the document of
+// collName matching both the filter and the expected fields of swap, and
+// reports whether there was one. The caller holds c.mu and saves.
+func (c *MemoryDBClient) compareAndSwap(collName string, swap Swap) (bool, error) {
+	condition := bson.M{}
+	for key, value := range swap.Filter {
+		condition[key] = value
+	}
+	for key, value := range swap.Expected {
+		condition[key] = value
+	}
+	docs, positions, err := c.find(collName, condition, true)
+	if err != nil || len(docs) == 0 {
+		return false, err
+	}
+	if swap.PutData == nil {
+		c.remove(collName, positions)
+		return true, nil
+	}
+	replacement := make(map[string]interface{}, len(swap.PutData)+1)
+	for key, value := range swap.PutData {
+		replacement[key] = value
+	}
+	replacement["_id"] = docs[0]["_id"]
+	if err := c.store(collName, positions[0], replacement); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// find returns the decoded documents of collName matching filter, and their
+// positions in the collection, stopping at the first one if asked to. The
+// caller holds c.mu.
+func (c *MemoryDBClient) find(collName string, filter bson.M, first bool) ([]map[string]interface{}, []int, error) {
+	query, err := newMemoryFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.expire(collName)
+	var docs []map[string]interface{}
+	var positions []int
+	for i, raw := range c.collections[collName] {
+		doc, err := decodeDocument(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		matched, err := query.matches(canonicalValue(doc).(map[string]any))
+		if err != nil {
+			return nil, nil, err
+		}
+		if matched {
+			docs = append(docs, doc)
+			positions = append(positions, i)
+			if first {
+				break
+			}
+		}
+	}
+	return docs, positions, nil
+}
+
+// upsert sets the fields of putData in the first document matching filter,
+// or inserts one made of the equality conditions of filter and putData. It
+// reports whether a document matched.
+func (c *MemoryDBClient) upsert(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	docs, positions, err := c.find(collName, filter, true)
+	if err != nil {
+		return false, err
+	}
+	if len(docs) != 0 {
+		return true, c.set(collName, positions[0], docs[0], putData)
+	}
+	doc := make(map[string]interface{}, len(filter)+len(putData))
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") || strings.Contains(key, ".") {
+			continue
+		}
+		if _, isOperator := operatorDocument(canonicalValue(value)); !isOperator {
+			doc[key] = value
+		}
+	}
+	for key, value := range putData {
+		doc[key] = value
+	}
+	return false, c.insert(collName, doc)
+}
+
+// set applies a $set of the top level fields of putData to the document at
+// position.
+func (c *MemoryDBClient) set(collName string, position int, doc, putData map[string]interface{}) error {
+	for key, value := range putData {
+		if key != "_id" {
+			doc[key] = value
+		}
+	}
+	return c.store(collName, position, doc)
+}
+
+// patch applies modify to the JSON of the first document matching filter,
+// or to its dataName field if set, and $sets the result. As with MongoDB,
+// fields the patch removes are kept, and nothing is stored when no document
+// matches.
+func (c *MemoryDBClient) patch(collName string, filter bson.M, dataName string, modify func([]byte) ([]byte, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	docs, positions, err := c.find(collName, filter, true)
+	if err != nil {
+		return err
+	}
+	var original interface{}
+	if len(docs) != 0 {
+		fields := make(map[string]interface{}, len(docs[0]))
+		for key, value := range docs[0] {
+			if key != "_id" {
+				fields[key] = value
+			}
+		}
+		original = fields
+		if dataName != "" {
+			original = docs[0][dataName]
+		}
+	}
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	modifiedJSON, err := modify(originalJSON)
+	if err != nil {
+		return err
+	}
+	var modified map[string]interface{}
+	if err := json.Unmarshal(modifiedJSON, &modified); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	if dataName != "" {
+		modified = map[string]interface{}{dataName: modified}
+	}
+	if err := c.set(collName, positions[0], docs[0], modified); err != nil {
+		return err
+	}
+	return c.save()
+}
+
+func (c *MemoryDBClient) insert(collName string, doc map[string]interface{}) error {
+	if _, ok := doc["_id"]; !ok {
+		withID := make(map[string]interface{}, len(doc)+1)
+		for key, value := range doc {
+			withID[key] = value
+		}
+		withID["_id"] = bson.NewObjectID()
+		doc = withID
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	c.collections[collName] = append(c.collections[collName], raw)
+	c.dirty = true
+	return nil
+}
+
+func (c *MemoryDBClient) store(collName string, position int, doc map[string]interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	c.collections[collName][position] = raw
+	c.dirty = true
+	return nil
+}
+
+// remove drops the documents at the given ascending positions.
+func (c *MemoryDBClient) remove(collName string, positions []int) {
+	if len(positions) == 0 {
+		return
+	}
+	docs := c.collections[collName]
+	kept := docs[:0]
+	next := 0
+	for i, raw := range docs {
+		if next < len(positions) && positions[next] == i {
+			next++
+			continue
+		}
+		kept = append(kept, raw)
+	}
+	clear(docs[len(kept):])
+	c.collections[collName] = kept
+	c.dirty = true
+}
+
+// expire drops the documents of collName past the expiry of its TTL index.
+func (c *MemoryDBClient) expire(collName string) {
+	index, ok := c.ttlIndexes[collName]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	var expired []int
+	for i, raw := range c.collections[collName] {
+		value, err := raw.LookupErr(index.field)
+		if err != nil {
+			continue
+		}
+		if date, ok := value.DateTimeOK(); ok && now.After(time.UnixMilli(date).Add(index.expireAfter)) {
+			expired = append(expired, i)
+		}
+	}
+	c.remove(collName, expired)
+}
+
+// decodeDocument decodes a stored document with the options of the mongoapi
+// client, which returns embedded documents as maps.
+func decodeDocument(raw bson.Raw) (map[string]interface{}, error) {
+	decoder := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(raw)))
+	decoder.DefaultDocumentMap()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// memoryFilter is a query filter in the canonical form documents are matched
+// in: documents as map[string]any, arrays as []any, numbers as float64 and
+// dates as time.Time.
+type memoryFilter map[string]any
+
+// newMemoryFilter converts a query filter to its canonical form. It goes
+// through BSON, so values are compared as MongoDB would store them.
+func newMemoryFilter(filter bson.M) (memoryFilter, error) {
+	if len(filter) == 0 {
+		return memoryFilter{}, nil
+	}
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	var doc map[string]any
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return canonicalValue(doc).(map[string]any), nil
+}
+
+// canonicalValue converts a decoded BSON value to the form it is compared in.
+func canonicalValue(value any) any {
+	switch v := value.(type) {
+	case bson.D:
+		doc := make(map[string]any, len(v))
+		for _, e := range v {
+			doc[e.Key] = canonicalValue(e.Value)
+		}
+		return doc
+	case bson.M:
+		return canonicalValue(map[string]any(v))
+	case map[string]any:
+		doc := make(map[string]any, len(v))
+		for key, value := range v {
+			doc[key] = canonicalValue(value)
+		}
+		return doc
+	case bson.A:
+		return canonicalValue([]any(v))
+	case []any:
+		array := make([]any, len(v))
+		for i, value := range v {
+			array[i] = canonicalValue(value)
+		}
+		return array
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case bson.DateTime:
+		return v.Time().UTC()
+	case time.Time:
+		return v.UTC()
+	}
+	return value
+}
+
+// matches reports whether a canonical document satisfies the filter.
+func (f memoryFilter) matches(doc map[string]any) (bool, error) {
+	for key, condition := range f {
+		matched, err := matchClause(doc, key, condition)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchClause(doc map[string]any, key string, condition any) (bool, error) {
+	switch key {
+	case "$and", "$or", "$nor":
+		clauses, ok := condition.([]any)
+		if !ok || len(clauses) == 0 {
+			return false, fmt.Errorf("%s must be a nonempty array", key)
+		}
+		for _, clause := range clauses {
+			sub, ok := clause.(map[string]any)
+			if !ok {
+				return false, fmt.Errorf("%s entries must be documents", key)
+			}
+			matched, err := memoryFilter(sub).matches(doc)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case key == "$and" && !matched, key == "$nor" && matched:
+				return false, nil
+			case key == "$or" && matched:
+				return true, nil
+			}
+		}
+		return key != "$or", nil
+	case "$not":
+		// Negation of a whole filter, as discovery builds for negated
+		// query parameters
+		sub, ok := condition.(map[string]any)
+		if !ok {
+			return false, fmt.Errorf("$not must be a document")
+		}
+		matched, err := memoryFilter(sub).matches(doc)
+		return !matched, err
+	}
+	if strings.HasPrefix(key, "$") {
+		return false, fmt.Errorf("unsupported query operator %s", key)
+	}
+	return matchField(lookupPath(doc, strings.Split(key, ".")), condition)
+}
+
+// lookupPath returns the values a dotted path leads to, traversing the
+// documents of arrays on the way as MongoDB does.
+func lookupPath(value any, path []string) []any {
+	if len(path) == 0 {
+		return []any{value}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		child, ok := v[path[0]]
+		if !ok {
+			return nil
+		}
+		return lookupPath(child, path[1:])
+	case []any:
+		var values []any
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(v) {
+			values = lookupPath(v[i], path[1:])
+		}
+		for _, element := range v {
+			if doc, ok := element.(map[string]any); ok {
+				values = append(values, lookupPath(doc, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// operatorDocument returns the condition as query operators, if it is a
+// document of them rather than a value to compare with.
+func operatorDocument(condition any) (map[string]any, bool) {
+	doc, ok := condition.(map[string]any)
+	if !ok || len(doc) == 0 {
+		return nil, false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func matchField(values []any, condition any) (bool, error) {
+	operators, ok := operatorDocument(condition)
+	if !ok {
+		return matchEqual(values, condition), nil
+	}
+	for operator, argument := range operators {
+		matched, err := matchOperator(values, operator, argument)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []any, operator string, argument any) (bool, error) {
+	switch operator {
+	case "$eq":
+		return matchEqual(values, argument), nil
+	case "$ne":
+		return !matchEqual(values, argument), nil
+	case "$in", "$nin":
+		candidates, ok := argument.([]any)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array", operator)
+		}
+		in := false
+		for _, candidate := range candidates {
+			if matchEqual(values, candidate) {
+				in = true
+				break
+			}
+		}
+		return in == (operator == "$in"), nil
+	case "$all":
+		candidates, ok := argument.([]any)
+		if !ok {
+			return false, fmt.Errorf("$all needs an array")
+		}
+		for _, candidate := range candidates {
+			if !matchEqual(values, candidate) {
+				return false, nil
+			}
+		}
+		return len(candidates) != 0, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, value := range expandArrays(values) {
+			order, ok := compareValues(value, argument)
+			if !ok {
+				continue
+			}
+			if (operator == "$gt" && order > 0) || (operator == "$gte" && order >= 0) ||
+				(operator == "$lt" && order < 0) || (operator == "$lte" && order <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$exists":
+		return (len(values) != 0) == truthy(argument), nil
+	case "$size":
+		size, ok := argument.(float64)
+		if !ok {
+			return false, fmt.Errorf("$size needs a number")
+		}
+		for _, value := range values {
+			if array, ok := value.([]any); ok && float64(len(array)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$elemMatch":
+		sub, ok := argument.(map[string]any)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch needs a document")
+		}
+		_, onValues := operatorDocument(sub)
+		for _, value := range values {
+			array, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			for _, element := range array {
+				var matched bool
+				var err error
+				if onValues {
+					matched, err = matchField([]any{element}, sub)
+				} else if doc, ok := element.(map[string]any); ok {
+					matched, err = memoryFilter(sub).matches(doc)
+				}
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$not":
+		matched, err := matchField(values, argument)
+		return !matched, err
+	}
+	return false, fmt.Errorf("unsupported query operator %s", operator)
+}
+
+// matchEqual reports whether one of the values, or an element of one that is
+// an array, equals the wanted one. A missing field equals null.
+func matchEqual(values []any, want any) bool {
+	if len(values) == 0 {
+		return want == nil
+	}
+	for _, value := range values {
+		if reflect.DeepEqual(value, want) {
+			return true
+		}
+		if array, ok := value.([]any); ok {
+			for _, element := range array {
+				if reflect.DeepEqual(element, want) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func expandArrays(values []any) []any {
+	var expanded []any
+	for _, value := range values {
+		if array, ok := value.([]any); ok {
+			expanded = append(expanded, array...)
+			continue
+		}
+		expanded = append(expanded, value)
+	}
+	return expanded
+}
+
+// compareValues orders two values of the same type, as range operators only
+// compare those.
+func compareValues(a, b any) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			return compareOrdered(x, y), true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case nil:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func newTestMemoryDBClient(t *testing.T) *MemoryDBClient {
+	t.Helper()
+	db := NewMemoryDBClient()
+	profiles := []map[string]interface{}{
+		{
+			"nfinstanceid": "amf-1",
+			"nftype":       "AMF",
+			"priority":     int32(10),
+			"plmnlist":     []map[string]interface{}{{"mcc": "001", "mnc": "01"}},
+			"amfinfo":      map[string]interface{}{"amfsetid": "3f8", "guamilist": []string{"g1", "g2"}},
+		},
+		{
+			"nfinstanceid": "amf-2",
+			"nftype":       "AMF",
+			"priority":     int32(20),
+			"plmnlist":     []map[string]interface{}{{"mcc": "999", "mnc": "99"}},
+		},
+		{
+			"nfinstanceid": "smf-1",
+			"nftype":       "SMF",
+			"nsilist":      []string{"a", "b"},
+		},
+	}
+	for _, profile := range profiles {
+		if _, err := db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": profile["nfinstanceid"]}, profile); err != nil {
+			t.Fatalf("failed to store profile: %v", err)
+		}
+	}
+	return db
+}
+
+func TestMemoryDBClientFilters(t *testing.T) {
+	db := newTestMemoryDBClient(t)
+	testCases := []struct {
+		name   string
+		filter bson.M
+		want   []string
+	}{
+		{"everything", bson.M{}, []string{"amf-1", "amf-2", "smf-1"}},
+		{"equality", bson.M{"nftype": "AMF"}, []string{"amf-1", "amf-2"}},
+		{"$in", bson.M{"nfinstanceid": bson.M{"$in": []string{"amf-2", "smf-1"}}}, []string{"amf-2", "smf-1"}},
+		{"$nin", bson.M{"nfinstanceid": bson.M{"$nin": bson.A{"amf-2"}}}, []string{"amf-1", "smf-1"}},
+		{"$or", bson.M{"$or": []bson.M{{"nfinstanceid": "amf-1"}, {"nftype": "SMF"}}}, []string{"amf-1", "smf-1"}},
+		{"$and", bson.M{"$and": []bson.M{{"nftype": "AMF"}, {"priority": bson.M{"$gte": 15}}}}, []string{"amf-2"}},
+		{"$nor", bson.M{"$nor": []bson.M{{"nftype": "AMF"}}}, []string{"smf-1"}},
+		{"$not filter", bson.M{"$not": bson.M{"nftype": "AMF"}}, []string{"smf-1"}},
+		{"$elemMatch", bson.M{"plmnlist": bson.M{"$elemMatch": bson.M{"mcc": "001", "mnc": "01"}}}, []string{"amf-1"}},
+		{"dotted path into array", bson.M{"plmnlist.mcc": "999"}, []string{"amf-2"}},
+		{"dotted path into document", bson.M{"amfinfo.amfsetid": "3f8"}, []string{"amf-1"}},
+		{"array contains", bson.M{"amfinfo.guamilist": "g2"}, []string{"amf-1"}},
+		{"$exists", bson.M{"amfinfo": bson.M{"$exists": false}}, []string{"amf-2", "smf-1"}},
+		{"$ne", bson.M{"nftype": bson.M{"$ne": "AMF"}}, []string{"smf-1"}},
+		{"$all", bson.M{"nsilist": bson.M{"$all": bson.A{"b", "a"}}}, []string{"smf-1"}},
+		{"field $not", bson.M{"priority": bson.M{"$not": bson.M{"$lt": 15}}}, []string{"amf-2", "smf-1"}},
+		{"missing equals null", bson.M{"priority": nil}, []string{"smf-1"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := db.RestfulAPIGetMany("NfProfile", tc.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, doc := range docs {
+				if _, ok := doc["_id"]; ok {
+					t.Errorf("expected _id to be stripped from %v", doc)
+				}
+				got = append(got, doc["nfinstanceid"].(string))
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("got %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+
+	if _, err := db.RestfulAPIGetMany("NfProfile", bson.M{"nftype": bson.M{"$regex": "^A"}}); err == nil {
+		t.Error("expected an unsupported operator to be rejected")
+	}
+}
+
+func TestMemoryDBClientWrites(t *testing.T) {
+	db := newTestMemoryDBClient(t)
+	filter := bson.M{"nfinstanceid": "amf-1"}
+
+	existed, err := db.RestfulAPIPutOne("NfProfile", filter, map[string]interface{}{"nfstatus": "REGISTERED"})
+	if err != nil || !existed {
+		t.Fatalf("expected the update of an existing profile, got %v %v", existed, err)
+	}
+	doc, _ := db.RestfulAPIGetOne("NfProfile", filter)
+	if doc["nfstatus"] != "REGISTERED" || doc["nftype"] != "AMF" || doc["priority"] != int32(10) {
+		t.Errorf("expected $set semantics, got %v", doc)
+	}
+	if _, ok := doc["plmnlist"].(bson.A); !ok {
+		t.Errorf("expected arrays decoded as bson.A, got %T", doc["plmnlist"])
+	}
+	if _, ok := doc["amfinfo"].(map[string]interface{}); !ok {
+		t.Errorf("expected documents decoded as maps, got %T", doc["amfinfo"])
+	}
+
+	if existed, _ = db.RestfulAPIPutOneNotUpdate("NfProfile", filter, map[string]interface{}{"nftype": "SMF"}); !existed {
+		t.Error("expected the existing profile not to be replaced")
+	}
+
+	if err := db.RestfulAPIMergePatch("NfProfile", filter, map[string]interface{}{"priority": 5}); err != nil {
+		t.Fatalf("merge patch failed: %v", err)
+	}
+	patch := []byte(`[{"op": "replace", "path": "/nfstatus", "value": "SUSPENDED"}]`)
+	if err := db.RestfulAPIJSONPatch("NfProfile", filter, patch); err != nil {
+		t.Fatalf("JSON patch failed: %v", err)
+	}
+	patch = []byte(`[{"op": "add", "path": "/amfregionid", "value": "ca"}]`)
+	if err := db.RestfulAPIJSONPatchExtend("NfProfile", filter, patch, "amfinfo"); err != nil {
+		t.Fatalf("JSON patch of amfinfo failed: %v", err)
+	}
+	doc, _ = db.RestfulAPIGetOne("NfProfile", filter)
+	if doc["priority"] != float64(5) || doc["nfstatus"] != "SUSPENDED" {
+		t.Errorf("unexpected patched profile %v", doc)
+	}
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{"amfinfo.amfregionid": "ca", "amfinfo.amfsetid": "3f8"}); len(docs) != 1 {
+		t.Errorf("expected amfinfo to be patched, got %v", docs)
+	}
+
+	swapped, err := db.RestfulAPICompareAndSwap("NfProfile", filter, bson.M{"nfstatus": "REGISTERED"}, nil)
+	if err != nil || swapped {
+		t.Errorf("expected no swap on a stale condition, got %v %v", swapped, err)
+	}
+	swapped, _ = db.RestfulAPICompareAndSwap("NfProfile", filter, bson.M{"nfstatus": "SUSPENDED"},
+		map[string]interface{}{"nfinstanceid": "amf-1", "nftype": "AMF"})
+	if doc, _ = db.RestfulAPIGetOne("NfProfile", filter); !swapped || len(doc) != 2 {
+		t.Errorf("expected the profile to be replaced, got %v", doc)
+	}
+	if swapped, _ = db.RestfulAPICompareAndSwap("NfProfile", filter, bson.M{"nftype": "AMF"}, nil); !swapped {
+		t.Error("expected the profile to be deleted")
+	}
+
+	if err := db.RestfulAPIDeleteMany("NfProfile", bson.M{"nftype": "AMF"}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{}); len(docs) != 1 {
+		t.Errorf("expected only the SMF profile to be left, got %v", docs)
+	}
+
+	existed, _ = db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": "1"}, map[string]interface{}{"reqNfType": "SMF"})
+	if doc, _ = db.RestfulAPIGetOne("Subscriptions", bson.M{"subscriptionId": "1"}); existed || doc["reqNfType"] != "SMF" {
+		t.Errorf("expected the upsert to keep the filter fields, got %v", doc)
+	}
+}
+
+func TestCompareAndSwapMany(t *testing.T) {
+	originalDBClient := DBClient
+	defer func() { DBClient = originalDBClient }()
+	db := newTestMemoryDBClient(t)
+	DBClient = db
+
+	swaps := []Swap{
+		{
+			Filter:   bson.M{"nfinstanceid": "amf-1"},
+			Expected: bson.M{"priority": 10},
+			PutData:  map[string]interface{}{"nfinstanceid": "amf-1", "nftype": "AMF", "load": 30},
+		},
+		{
+			Filter:   bson.M{"nfinstanceid": "amf-2"},
+			Expected: bson.M{"priority": 10},
+			PutData:  map[string]interface{}{"nfinstanceid": "amf-2", "nftype": "AMF", "load": 40},
+		},
+		{Filter: bson.M{"nfinstanceid": "smf-1"}, Expected: bson.M{"nftype": "SMF"}},
+	}
+	swapped, err := CompareAndSwapMany(context.Background(), "NfProfile", swaps)
+	if err != nil || swapped != 2 {
+		t.Fatalf("expected 2 swaps, got %d %v", swapped, err)
+	}
+	if doc, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}); doc["load"] != int32(30) || doc["priority"] != nil {
+		t.Errorf("expected amf-1 to be replaced, got %v", doc)
+	}
+	if doc, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-2"}); doc["priority"] != int32(20) {
+		t.Errorf("expected amf-2 to be left on a stale condition, got %v", doc)
+	}
+	if doc, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "smf-1"}); doc != nil {
+		t.Errorf("expected smf-1 to be deleted, got %v", doc)
+	}
+}
+
+func TestMemoryDBClientExpiresDocuments(t *testing.T) {
+	db := NewMemoryDBClient()
+	db.RestfulAPICreateTTLIndex("Subscriptions", 0, "expireAt")
+	for id, expireAt := range map[string]time.Time{"expired": time.Now().Add(-time.Second), "valid": time.Now().Add(time.Hour)} {
+		if _, err := db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": id},
+			map[string]interface{}{"expireAt": expireAt}); err != nil {
+			t.Fatalf("failed to store subscription: %v", err)
+		}
+	}
+	docs, _ := db.RestfulAPIGetMany("Subscriptions", bson.M{})
+	if len(docs) != 1 || docs[0]["subscriptionId"] != "valid" {
+		t.Errorf("expected only the valid subscription, got %v", docs)
+	}
+	if _, ok := docs[0]["expireAt"].(bson.DateTime); !ok {
+		t.Errorf("expected dates decoded as bson.DateTime, got %T", docs[0]["expireAt"])
+	}
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/util/mongoapi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// StorageCollections are the collections the NRF keeps its data in, with
+// the field identifying their documents.
+var StorageCollections = map[string]string{
+	"NfProfile":               "nfinstanceid",
+	"Subscriptions":           "subscriptionId",
+	"SharedData":              "sharedDataId",
+	"NotificationDeadLetters": "id",
+	NfHistoryCollection:       "id",
+}
+
+// StorageMigrationCollection holds the marker of the migration into the
+// storage, telling whether it was started and completed.
+const StorageMigrationCollection = "StorageMigration"
+
+const (
+	storageMigrationKey       = "migration"
+	storageMigrationStarted   = "started"
+	storageMigrationCompleted = "completed"
+)
+
+// MigrateStorage copies the documents of the storage collections from source
+// to destination, and returns the number of documents copied. The migration
+// is marked completed in destination once every collection is copied, so
+// that a migration left configured does not overwrite newer data on the next
+// start, while one which failed halfway is resumed: copying a document again
+// only rewrites it. A destination holding data without a marker is taken as
+// migrated by an older release.
+func MigrateStorage(source, destination DBInterface) (int, error) {
+	marker, err := destination.RestfulAPIGetOne(StorageMigrationCollection, bson.M{"_id": storageMigrationKey})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", StorageMigrationCollection, err)
+	}
+	switch marker["state"] {
+	case storageMigrationCompleted:
+		logger.AppLog.Infoln("storage already migrated, not migrating")
+		return 0, nil
+	case storageMigrationStarted:
+		logger.AppLog.Infoln("resuming the storage migration")
+	default:
+		holdsData, err := holdsStorageData(destination)
+		if err != nil {
+			return 0, err
+		}
+		if holdsData {
+			logger.AppLog.Infoln("storage already holds data, not migrating")
+			return 0, markStorageMigration(destination, storageMigrationCompleted)
+		}
+		if err := markStorageMigration(destination, storageMigrationStarted); err != nil {
+			return 0, err
+		}
+	}
+	copied := 0
+	for collName, keyField := range StorageCollections {
+		docs, err := source.RestfulAPIGetMany(collName, bson.M{})
+		if err != nil {
+			return copied, fmt.Errorf("failed to read %s: %w", collName, err)
+		}
+		for _, doc := range docs {
+			key, ok := doc[keyField]
+			if !ok {
+				logger.AppLog.Warnf("skipping %s document without %s", collName, keyField)
+				continue
+			}
+			if _, err := destination.RestfulAPIPutOne(collName, bson.M{keyField: key}, doc); err != nil {
+				return copied, fmt.Errorf("failed to copy %s %v: %w", collName, key, err)
+			}
+			copied++
+		}
+	}
+	return copied, markStorageMigration(destination, storageMigrationCompleted)
+}
+
+// holdsStorageData reports whether any of the storage collections of db
+// holds a document.
+func holdsStorageData(db DBInterface) (bool, error) {
+	for collName := range StorageCollections {
+		doc, err := db.RestfulAPIGetOne(collName, bson.M{})
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", collName, err)
+		}
+		if doc != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func markStorageMigration(db DBInterface, state string) error {
+	_, err := db.RestfulAPIPutOne(StorageMigrationCollection, bson.M{"_id": storageMigrationKey},
+		map[string]interface{}{"_id": storageMigrationKey, "state": state})
+	if err != nil {
+		return fmt.Errorf("failed to mark the storage migration %s: %w", state, err)
+	}
+	return nil
+}
+
+// MigrateFromMongoDB copies the NRF data of the MongoDB database to
+// destination, as MigrateStorage does.
+func MigrateFromMongoDB(url, dbName string, destination DBInterface) (int, error) {
+	mongoClient, err := mongoapi.NewMongoClient(url, dbName)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := mongoClient.Client.Disconnect(context.TODO()); err != nil {
+			logger.AppLog.Warnf("failed to disconnect from MongoDB: %v", err)
+		}
+	}()
+	return MigrateStorage(NewMongoDBClient(mongoClient), destination)
+}
+
+// MigrateFromFile copies the NRF data of the storage file to destination, as
+// MigrateStorage does.
+func MigrateFromFile(path string, destination DBInterface) (int, error) {
+	source, err := OpenFileDBClient(path)
+	if err != nil {
+		return 0, err
+	}
+	return MigrateStorage(source, destination)
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/omec-project/openapi/v2/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// nullable is implemented by the Nullable types of the models, such as
+// NullableN2InterfaceAmfInfo, which keep their value in unexported fields.
+type nullable interface {
+	IsSet() bool
+}
+
+// nfProfileRegistry encodes the Nullable types as the value they hold, or
+// null, as their MarshalJSON does. The default codecs would store them as
+// empty documents, dropping attributes such as amfInfo.n2InterfaceAmfInfo.
+var nfProfileRegistry = func() *bson.Registry {
+	registry := bson.NewRegistry()
+	registry.RegisterInterfaceEncoder(reflect.TypeOf((*nullable)(nil)).Elem(), bson.ValueEncoderFunc(encodeNullable))
+	return registry
+}()
+
+func encodeNullable(ec bson.EncodeContext, vw bson.ValueWriter, val reflect.Value) error {
+	get := val.MethodByName("Get")
+	if !get.IsValid() || get.Type().NumIn() != 0 || get.Type().NumOut() != 1 || get.Type().Out(0).Kind() != reflect.Pointer {
+		return fmt.Errorf("cannot encode %s: no Get method returning its value", val.Type())
+	}
+	value := get.Call(nil)[0]
+	if value.IsNil() {
+		return vw.WriteNull()
+	}
+	encoder, err := ec.LookupEncoder(value.Type())
+	if err != nil {
+		return err
+	}
+	return encoder.EncodeValue(ec, vw, value)
+}
+
+// EncodeNFProfile converts a profile into the document stored in NfProfile.
+func EncodeNFProfile(nf models.NFProfile) (bson.M, error) {
+	buf := new(bytes.Buffer)
+	encoder := bson.NewEncoder(bson.NewDocumentWriter(buf))
+	encoder.SetRegistry(nfProfileRegistry)
+	if err := encoder.Encode(nf); err != nil {
+		return nil, err
+	}
+	putData := bson.M{}
+	if err := bson.Unmarshal(buf.Bytes(), &putData); err != nil {
+		return nil, err
+	}
+	return putData, nil
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GetManyFields returns the documents of collName matching filter, holding
+// only fields. The MongoDB storage leaves the other fields out of the query
+// result; the others drop them from the documents read.
+func GetManyFields(ctx context.Context, collName string, filter bson.M, fields []string) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	if db, ok := DBClient.(*MongoDBClient); ok {
+		docs, err := db.RestfulAPIGetManyFieldsWithContext(ctx, collName, filter, fields)
+		return docs, classified(err)
+	}
+	docs, err := contextDBClient().RestfulAPIGetManyWithContext(ctx, collName, filter)
+	if err != nil {
+		return nil, classified(err)
+	}
+	projected := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		fieldValues := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if value, ok := doc[field]; ok {
+				fieldValues[field] = value
+			}
+		}
+		projected = append(projected, fieldValues)
+	}
+	return projected, nil
+}
+
+// RestfulAPIGetManyFieldsWithContext returns the documents of collName
+// matching filter, holding only fields.
+func (c *MongoDBClient) RestfulAPIGetManyFieldsWithContext(ctx context.Context, collName string, filter bson.M,
+	fields []string,
+) ([]map[string]interface{}, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	projection := bson.M{"_id": 0}
+	for _, field := range fields {
+		projection[field] = 1
+	}
+	cursor, err := client.GetCollection(collName).Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetManyFieldsWithContext err: %w", err))
+	}
+	var results []map[string]interface{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetManyFieldsWithContext err: %w", err))
+	}
+	return results, nil
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestGetManyFields(t *testing.T) {
+	originalDBClient := DBClient
+	defer func() { DBClient = originalDBClient }()
+	DBClient = NewMemoryDBClient()
+	ctx := context.Background()
+
+	for _, doc := range []bson.M{
+		{"nfinstanceid": "amf-1", "nftype": "AMF", "nfstatus": "REGISTERED"},
+		{"nfinstanceid": "smf-1", "nftype": "SMF", "nfstatus": "REGISTERED"},
+	} {
+		if _, err := PutOne(ctx, "NfProfile", bson.M{"nfinstanceid": doc["nfinstanceid"]}, doc); err != nil {
+			t.Fatalf("failed to store profile: %v", err)
+		}
+	}
+
+	docs, err := GetManyFields(ctx, "NfProfile", bson.M{"nftype": "AMF"}, []string{"nfinstanceid"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []map[string]interface{}{{"nfinstanceid": "amf-1"}}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("expected %v, got %v", want, docs)
+	}
+}
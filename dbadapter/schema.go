@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/openapi/v2/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SchemaVersionField is the field of a stored document telling the version
+// of the schema it was written with. Documents lacking it predate versioning.
+const SchemaVersionField = "schemaVersion"
+
+// Schema versions the NRF writes documents with.
+const (
+	// NfProfileSchemaVersion 1: the profile attributes are stored as
+	// bson.Marshal encodes models.NFProfile, with lowercased keys and
+	// structured values rather than JSON strings.
+	NfProfileSchemaVersion int32 = 1
+	// SubscriptionsSchemaVersion 1: the subscription attributes are stored
+	// as encoding/json encodes models.SubscriptionData, with camelCase keys
+	// and structured values rather than JSON strings.
+	SubscriptionsSchemaVersion int32 = 1
+)
+
+// schemaMigration upgrades a document of a collection to a schema version
+// from the previous one.
+type schemaMigration struct {
+	collName string
+	keyField string
+	version  int32
+	migrate  func(doc map[string]interface{}) (map[string]interface{}, error)
+}
+
+// schemaMigrations are run in order, each on the documents older than its
+// version.
+var schemaMigrations = []schemaMigration{
+	{"NfProfile", "nfinstanceid", 1, normalizeAttributes(reflect.TypeFor[models.NFProfile](), encodeNFProfile)},
+	{"Subscriptions", "subscriptionId", 1, normalizeAttributes(reflect.TypeFor[models.SubscriptionData](), encodeJSON)},
+}
+
+// SchemaChange is a document upgraded, or to be upgraded in a dry run, to
+// the current schema of its collection.
+type SchemaChange struct {
+	Collection string
+	Key        interface{}
+	From, To   int32
+	// Fields lists the top-level fields added, removed or changed.
+	Fields []string
+}
+
+func (c SchemaChange) String() string {
+	return fmt.Sprintf("%s %v from schema %d to %d: %s", c.Collection, c.Key, c.From, c.To, strings.Join(c.Fields, ", "))
+}
+
+// MigrateSchema upgrades the documents stored with an older schema than the
+// current one of their collection, so that they can be read without the
+// compatibility conversions legacy documents needed. With dryRun, nothing is
+// written: the changes are only reported. A document changed concurrently,
+// such as by another NRF migrating it, is left alone; one which cannot be
+// converted is logged and left alone too.
+func MigrateSchema(db DBInterface, dryRun bool) ([]SchemaChange, error) {
+	var changes []SchemaChange
+	for _, collName := range []string{"NfProfile", "Subscriptions"} {
+		migrations, keyField, current := collectionSchema(collName)
+		docs, err := db.RestfulAPIGetMany(collName, bson.M{"$or": []bson.M{
+			{SchemaVersionField: bson.M{"$exists": false}},
+			{SchemaVersionField: bson.M{"$lt": current}},
+		}})
+		if err != nil {
+			return changes, fmt.Errorf("failed to read %s: %w", collName, err)
+		}
+		for _, doc := range docs {
+			key := doc[keyField]
+			if key == nil {
+				// {keyField: nil} would match any other document lacking it
+				logger.AppLog.Warnf("cannot migrate %s document without %s", collName, keyField)
+				continue
+			}
+			from := schemaVersion(doc)
+			migrated, err := migrateDocument(doc, from, migrations)
+			if err != nil {
+				logger.AppLog.Warnf("cannot migrate %s %v to schema %d: %v", collName, key, current, err)
+				continue
+			}
+			delete(migrated, "_id")
+			migrated[SchemaVersionField] = current
+			change := SchemaChange{Collection: collName, Key: key, From: from, To: current, Fields: changedFields(doc, migrated)}
+			if dryRun {
+				logger.AppLog.Infof("schema dry run: would migrate %s", change)
+				changes = append(changes, change)
+				continue
+			}
+			swapped, err := db.RestfulAPICompareAndSwap(collName, bson.M{keyField: key},
+				bson.M{SchemaVersionField: doc[SchemaVersionField]}, migrated)
+			if err != nil {
+				return changes, fmt.Errorf("failed to migrate %s %v: %w", collName, key, err)
+			}
+			if swapped {
+				logger.AppLog.Infof("migrated %s", change)
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// migrateDocument runs on doc the migrations to versions newer than from.
+func migrateDocument(doc map[string]interface{}, from int32, migrations []schemaMigration) (map[string]interface{}, error) {
+	migrated := doc
+	for _, migration := range migrations {
+		if migration.version <= from {
+			continue
+		}
+		var err error
+		if migrated, err = migration.migrate(migrated); err != nil {
+			return nil, err
+		}
+	}
+	return migrated, nil
+}
+
+// collectionSchema returns the migrations of collName, the field identifying
+// its documents and its current schema version.
+func collectionSchema(collName string) (migrations []schemaMigration, keyField string, current int32) {
+	for _, migration := range schemaMigrations {
+		if migration.collName == collName {
+			migrations = append(migrations, migration)
+			keyField = migration.keyField
+			current = max(current, migration.version)
+		}
+	}
+	return migrations, keyField, current
+}
+
+// schemaVersion returns the schema version of doc, 0 if unversioned.
+func schemaVersion(doc map[string]interface{}) int32 {
+	switch version := doc[SchemaVersionField].(type) {
+	case int32:
+		return version
+	case int64:
+		return int32(version)
+	case int:
+		return int32(version)
+	case float64:
+		return int32(version)
+	default:
+		return 0
+	}
+}
+
+// normalizeAttributes returns a migration decoding the attributes of model
+// from a document the way legacy read paths did, matching keys regardless
+// of case and unpacking values stored as JSON strings, and encoding them
+// back with encode. The other fields, kept by the NRF alongside the
+// attributes, are left as they are.
+func normalizeAttributes(model reflect.Type, encode func(value interface{}) (map[string]interface{}, error)) func(doc map[string]interface{}) (map[string]interface{}, error) {
+	attributes := map[string]bool{}
+	for i := range model.NumField() {
+		name, _, _ := strings.Cut(model.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			attributes[strings.ToLower(name)] = true
+		}
+	}
+	return func(doc map[string]interface{}) (map[string]interface{}, error) {
+		attrs := map[string]interface{}{}
+		others := map[string]interface{}{}
+		for key, value := range doc {
+			if attributes[strings.ToLower(key)] {
+				attrs[key] = decodeJSONStrings(value)
+			} else {
+				others[key] = value
+			}
+		}
+		b, err := json.Marshal(attrs)
+		if err != nil {
+			return nil, err
+		}
+		value := reflect.New(model)
+		if err := json.Unmarshal(b, value.Interface()); err != nil {
+			return nil, err
+		}
+		migrated, err := encode(value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range others {
+			migrated[key] = value
+		}
+		return migrated, nil
+	}
+}
+
+// encodeNFProfile stores a profile as the NRF registering it does, the
+// nullable attributes included.
+func encodeNFProfile(value interface{}) (map[string]interface{}, error) {
+	return EncodeNFProfile(*value.(*models.NFProfile))
+}
+
+func encodeJSON(value interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	return doc, json.Unmarshal(b, &doc)
+}
+
+// decodeJSONStrings copies v, replacing the strings holding a JSON array or
+// object, as legacy documents stored structured attributes, by their value.
+func decodeJSONStrings(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for key, elem := range val {
+			out[key] = decodeJSONStrings(elem)
+		}
+		return out
+	case bson.A:
+		return decodeJSONStrings([]interface{}(val))
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, elem := range val {
+			out[i] = decodeJSONStrings(elem)
+		}
+		return out
+	case string:
+		if len(val) > 0 && (val[0] == '[' || val[0] == '{') {
+			var parsed interface{}
+			if json.Unmarshal([]byte(val), &parsed) == nil {
+				return parsed
+			}
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+// changedFields lists the top-level fields differing between doc and
+// migrated, both compared as read back from the database.
+func changedFields(doc, migrated map[string]interface{}) []string {
+	before, errBefore := roundTrip(doc)
+	after, errAfter := roundTrip(migrated)
+	if errBefore != nil || errAfter != nil {
+		return []string{"unknown"}
+	}
+	var fields []string
+	for key, value := range before {
+		if key == "_id" {
+			continue
+		}
+		if newValue, ok := after[key]; !ok {
+			fields = append(fields, "-"+key)
+		} else if !reflect.DeepEqual(value, newValue) {
+			fields = append(fields, "~"+key)
+		}
+	}
+	for key, value := range after {
+		// null attributes are how bson.Marshal stores those a model lacks
+		if _, ok := before[key]; !ok && value != nil {
+			fields = append(fields, "+"+key)
+		}
+	}
+	// a renamed field is listed removed then added
+	slices.SortStableFunc(fields, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a[1:]), strings.ToLower(b[1:]))
+	})
+	return fields
+}
+
+func roundTrip(doc map[string]interface{}) (map[string]interface{}, error) {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(b)
+}
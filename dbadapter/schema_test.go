@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func newLegacyDBClient(t *testing.T) *MemoryDBClient {
+	t.Helper()
+	db := NewMemoryDBClient()
+	legacy := map[string][]map[string]interface{}{
+		"NfProfile": {
+			{
+				"nfinstanceid":   "amf-1",
+				"NfType":         "AMF",
+				"nfstatus":       "REGISTERED",
+				"nsilist":        `["nsi0","nsi1"]`,
+				"allowednssais":  `[{"sst":1,"sd":"010203"}]`,
+				"profileVersion": int64(4),
+				"expireAt":       time.Now().Add(time.Hour),
+			},
+			{
+				"nfinstanceid":  "smf-1",
+				"nftype":        "SMF",
+				"nfstatus":      "REGISTERED",
+				"schemaVersion": NfProfileSchemaVersion,
+			},
+		},
+		"Subscriptions": {
+			{
+				"subscriptionId":          "1",
+				"nfStatusNotificationUri": "http://amf.example.org/notify",
+				"subscrCond":              `{"nfType":"SMF"}`,
+				"expireAt":                time.Now().Add(time.Hour),
+			},
+		},
+	}
+	for collName, docs := range legacy {
+		keyField := StorageCollections[collName]
+		for _, doc := range docs {
+			if _, err := db.RestfulAPIPutOne(collName, bson.M{keyField: doc[keyField]}, doc); err != nil {
+				t.Fatalf("failed to store %s: %v", collName, err)
+			}
+		}
+	}
+	return db
+}
+
+func TestMigrateSchemaDryRun(t *testing.T) {
+	db := newLegacyDBClient(t)
+	before, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"})
+
+	changes, err := MigrateSchema(db, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Key != "amf-1" || changes[1].Key != "1" {
+		t.Fatalf("expected the legacy profile and subscription to be reported, got %v", changes)
+	}
+	want := []string{"~allowednssais", "-NfType", "+nftype", "~nsilist", "+schemaVersion"}
+	if !reflect.DeepEqual(changes[0].Fields, want) {
+		t.Errorf("expected changed fields %v, got %v", want, changes[0].Fields)
+	}
+	if after, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}); !reflect.DeepEqual(before, after) {
+		t.Errorf("expected a dry run to leave the profile alone, got %v", after)
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	db := newLegacyDBClient(t)
+	changes, err := MigrateSchema(db, false)
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("expected 2 documents to be migrated, got %v: %v", changes, err)
+	}
+
+	profile, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"})
+	if profile["nftype"] != "AMF" || profile["NfType"] != nil {
+		t.Errorf("expected the keys to be normalised, got %v", profile)
+	}
+	if nsiList, ok := profile["nsilist"].(bson.A); !ok || len(nsiList) != 2 {
+		t.Errorf("expected nsilist to be unpacked, got %T %v", profile["nsilist"], profile["nsilist"])
+	}
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{"allowednssais.sst": 1}); len(docs) != 1 {
+		t.Error("expected allowednssais to be queryable once unpacked")
+	}
+	if profile["profileVersion"] != int64(4) || profile["expireAt"] == nil || profile[SchemaVersionField] != NfProfileSchemaVersion {
+		t.Errorf("expected the NRF fields to be kept and the schema version set, got %v", profile)
+	}
+	if docs, _ := db.RestfulAPIGetMany("Subscriptions", bson.M{"subscrCond.nfType": "SMF"}); len(docs) != 1 {
+		t.Error("expected subscrCond to be unpacked")
+	}
+
+	if changes, _ = MigrateSchema(db, false); len(changes) != 0 {
+		t.Errorf("expected nothing left to migrate, got %v", changes)
+	}
+}
+
+func TestMigrateSchemaKeepsNullableAttributes(t *testing.T) {
+	db := NewMemoryDBClient()
+	legacy := map[string]interface{}{
+		"nfinstanceid": "amf-1",
+		"nftype":       "AMF",
+		"nfstatus":     "REGISTERED",
+		"amfinfo": `{"amfSetId":"001","amfRegionId":"01","guamiList":[],` +
+			`"n2InterfaceAmfInfo":{"ipv4EndpointAddress":["10.0.0.10"],"amfName":"amf-1"}}`,
+	}
+	if _, err := db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}, legacy); err != nil {
+		t.Fatalf("failed to store the profile: %v", err)
+	}
+
+	if changes, err := MigrateSchema(db, false); err != nil || len(changes) != 1 {
+		t.Fatalf("expected the profile to be migrated, got %v: %v", changes, err)
+	}
+	filter := bson.M{"amfinfo.n2interfaceamfinfo.ipv4endpointaddress": "10.0.0.10"}
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", filter); len(docs) != 1 {
+		profile, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"})
+		t.Errorf("expected n2InterfaceAmfInfo to be kept, got %v", profile["amfinfo"])
+	}
+}
+
+func TestMigrateSchemaSkipsDocumentsWithoutKey(t *testing.T) {
+	db := NewMemoryDBClient()
+	keyless := map[string]interface{}{"nftype": "UDM", "NfStatus": "REGISTERED"}
+	if _, err := db.RestfulAPIPost("NfProfile", bson.M{"nftype": "UDM"}, keyless); err != nil {
+		t.Fatalf("failed to store the profile: %v", err)
+	}
+	before, _ := db.RestfulAPIGetMany("NfProfile", bson.M{})
+
+	if changes, err := MigrateSchema(db, false); err != nil || len(changes) != 0 {
+		t.Fatalf("expected nothing to be migrated, got %v: %v", changes, err)
+	}
+	if after, _ := db.RestfulAPIGetMany("NfProfile", bson.M{}); !reflect.DeepEqual(before, after) {
+		t.Errorf("expected the document without nfinstanceid to be left alone, got %v", after)
+	}
+}
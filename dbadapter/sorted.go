@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GetManyBeyondNewest returns the documents of collName matching filter but
+// the newest count by timeField, newest first. The MongoDB storage sorts and
+// skips them in the query, so that only the documents returned are read; the
+// others sort them in memory.
+func GetManyBeyondNewest(ctx context.Context, collName string, filter bson.M, timeField string,
+	count int,
+) ([]map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, OperationTimeout)
+	defer cancel()
+	if db, ok := DBClient.(*MongoDBClient); ok {
+		docs, err := db.RestfulAPIGetManyBeyondNewestWithContext(ctx, collName, filter, timeField, count)
+		return docs, classified(err)
+	}
+	docs, err := contextDBClient().RestfulAPIGetManyWithContext(ctx, collName, filter)
+	if err != nil {
+		return nil, classified(err)
+	}
+	if len(docs) <= count {
+		return nil, nil
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return documentTime(docs[i], timeField).After(documentTime(docs[j], timeField))
+	})
+	return docs[count:], nil
+}
+
+// RestfulAPIGetManyBeyondNewestWithContext returns the documents of collName
+// matching filter but the newest count by timeField, newest first.
+func (c *MongoDBClient) RestfulAPIGetManyBeyondNewestWithContext(ctx context.Context, collName string, filter bson.M,
+	timeField string, count int,
+) ([]map[string]interface{}, error) {
+	client, err := c.connected()
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: timeField, Value: -1}}).SetSkip(int64(count))
+	cursor, err := client.GetCollection(collName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetManyBeyondNewestWithContext err: %w", err))
+	}
+	var results []map[string]interface{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, c.checked(fmt.Errorf("RestfulAPIGetManyBeyondNewestWithContext err: %w", err))
+	}
+	for _, result := range results {
+		delete(result, "_id")
+	}
+	return results, nil
+}
+
+// documentTime returns the time of field in doc, the zero time if it holds
+// none.
+func documentTime(doc map[string]interface{}, field string) time.Time {
+	t, _ := canonicalValue(doc[field]).(time.Time)
+	return t
+}
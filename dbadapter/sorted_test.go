@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package dbadapter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestGetManyBeyondNewest(t *testing.T) {
+	originalDBClient := DBClient
+	defer func() { DBClient = originalDBClient }()
+	DBClient = NewMemoryDBClient()
+	ctx := context.Background()
+
+	start := time.Now().UTC()
+	// Inserted out of order, and for another NF instance too
+	for _, i := range []int{2, 0, 4, 1, 3} {
+		for _, nfInstanceID := range []string{"amf-1", "amf-2"} {
+			id := fmt.Sprintf("%s-%d", nfInstanceID, i)
+			event := bson.M{"id": id, "nfInstanceId": nfInstanceID, "time": start.Add(time.Duration(i) * time.Second)}
+			if _, err := Post(ctx, NfHistoryCollection, bson.M{"id": id}, event); err != nil {
+				t.Fatalf("failed to store event: %v", err)
+			}
+		}
+	}
+
+	docs, err := GetManyBeyondNewest(ctx, NfHistoryCollection, bson.M{"nfInstanceId": "amf-1"}, "time", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []interface{}
+	for _, doc := range docs {
+		ids = append(ids, doc["id"])
+	}
+	if fmt.Sprint(ids) != "[amf-1-1 amf-1-0]" {
+		t.Errorf("expected the 2 oldest events of amf-1, newest first, got %v", ids)
+	}
+	if docs, err := GetManyBeyondNewest(ctx, NfHistoryCollection, bson.M{"nfInstanceId": "amf-1"}, "time", 5); err != nil || len(docs) != 0 {
+		t.Errorf("expected no event beyond the 5 newest, got %v, %v", docs, err)
+	}
+}
@@ -37,7 +37,7 @@ func HTTPSearchNFInstances(c *gin.Context) {
 	logger.DiscoveryLog.Infoln("Handle Get /nf-instances")
 	req := httpwrapper.NewRequest(c.Request, nil)
 	req.Query = c.Request.URL.Query()
-	httpResponse := producer.HandleNFDiscoveryRequest(req)
+	httpResponse := producer.HandleNFDiscoveryRequest(c.Request.Context(), req)
 
 	responseBody, err := openapi.SetBody(httpResponse.Body, "application/json")
 	if err != nil {
@@ -13,6 +13,8 @@ package factory
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/omec-project/nrf/logger"
 	utilLogger "github.com/omec-project/util/logger"
@@ -23,6 +25,39 @@ const (
 	NRF_DEFAULT_IPV4            = "127.0.0.1"
 	NRF_DEFAULT_PORT            = 29510
 	NRF_DEFAULT_SCHEME          = "https"
+
+	NRF_DEFAULT_NOTIFICATION_WORKERS         = 8
+	NRF_DEFAULT_NOTIFICATION_QUEUE_SIZE      = 1024
+	NRF_DEFAULT_NOTIFICATION_MAX_ATTEMPTS    = 5
+	NRF_DEFAULT_NOTIFICATION_INITIAL_BACKOFF = 500 * time.Millisecond
+	NRF_DEFAULT_NOTIFICATION_MAX_BACKOFF     = 30 * time.Second
+	NRF_DEFAULT_NOTIFICATION_TIMEOUT         = 10 * time.Second
+	NRF_DEFAULT_NOTIFICATION_MAX_IDLE_CONNS  = 100
+	NRF_DEFAULT_NOTIFICATION_IDLE_PER_HOST   = 16
+	NRF_DEFAULT_NOTIFICATION_IDLE_TIMEOUT    = 90 * time.Second
+	NRF_DEFAULT_NOTIFICATION_OAUTH2_SCOPE    = "nnrf-nfm"
+	NRF_DEFAULT_AMF_OAM_URI                  = "http://amf:29518"
+	NRF_DEFAULT_CALLBACK_PROBE_TIMEOUT       = 2 * time.Second
+	NRF_STORAGE_DRIVER_MONGODB               = "mongodb"
+	NRF_STORAGE_DRIVER_MEMORY                = "memory"
+	NRF_STORAGE_DRIVER_FILE                  = "file"
+	NRF_DEFAULT_STORAGE_PATH                 = "/var/lib/nrf/nrf.db"
+	NRF_DEFAULT_STORAGE_CONNECT_TIMEOUT      = 5 * time.Second
+	NRF_DEFAULT_STORAGE_MAX_BACKOFF          = 30 * time.Second
+	NRF_DEFAULT_STORAGE_OPERATION_TIMEOUT    = 5 * time.Second
+	NRF_DEFAULT_HEARTBEAT_BATCH_WINDOW       = 50 * time.Millisecond
+	NRF_DEFAULT_HEARTBEAT_BATCH_MAX_SIZE     = 500
+	NRF_DEFAULT_NF_HISTORY_RETENTION         = 7 * 24 * time.Hour
+	NRF_DEFAULT_NF_HISTORY_MAX_EVENTS        = 100
+	NRF_DEFAULT_OAM_BIND_ADDR                = "127.0.0.1:29511"
+)
+
+var (
+	NRF_DEFAULT_CALLBACK_SCHEMES = []string{"http", "https"}
+	// loopback, link-local (cloud metadata services) and unspecified addresses
+	NRF_DEFAULT_CALLBACK_DENIED_HOSTS = []string{
+		"localhost", "127.0.0.0/8", "::1/128", "169.254.0.0/16", "fe80::/10", "0.0.0.0/32", "::/128",
+	}
 )
 
 type Config struct {
@@ -38,14 +73,115 @@ type Info struct {
 }
 
 type Configuration struct {
-	Sbi                   *Sbi     `yaml:"sbi,omitempty"`
-	MongoDBName           string   `yaml:"MongoDBName"`
-	MongoDBUrl            string   `yaml:"MongoDBUrl"`
-	WebuiUri              string   `yaml:"webuiUri"`
-	ServiceNameList       []string `yaml:"serviceNameList,omitempty"`
-	NfKeepAliveTime       int32    `yaml:"nfKeepAliveTime,omitempty"`
-	MongoDBStreamEnable   bool     `yaml:"mongoDBStreamEnable"`
-	NfProfileExpiryEnable bool     `yaml:"nfProfileExpiryEnable"`
+	Sbi                     *Sbi                  `yaml:"sbi,omitempty"`
+	MongoDBName             string                `yaml:"MongoDBName"`
+	MongoDBUrl              string                `yaml:"MongoDBUrl"`
+	WebuiUri                string                `yaml:"webuiUri"`
+	ServiceNameList         []string              `yaml:"serviceNameList,omitempty"`
+	NfKeepAliveTime         int32                 `yaml:"nfKeepAliveTime,omitempty"`
+	MongoDBStreamEnable     bool                  `yaml:"mongoDBStreamEnable"`
+	NfProfileExpiryEnable   bool                  `yaml:"nfProfileExpiryEnable"`
+	Notification            *Notification         `yaml:"notification,omitempty"`
+	AmfOamNotification      *AmfOamNotification   `yaml:"amfOamNotification,omitempty"`
+	MaxSubscriptionValidity time.Duration         `yaml:"maxSubscriptionValidity,omitempty"`
+	SubscriptionCallback    *SubscriptionCallback `yaml:"subscriptionCallback,omitempty"`
+	Storage                 *Storage              `yaml:"storage,omitempty"`
+	HeartbeatBatching       *HeartbeatBatching    `yaml:"heartbeatBatching,omitempty"`
+	NfHistory               *NfHistory            `yaml:"nfHistory,omitempty"`
+	Oam                     *Oam                  `yaml:"oam,omitempty"`
+}
+
+// Oam serves the operator API, listing subscriptions and the NF history
+// among others, on a listener of its own rather than on the SBI, bound to
+// the loopback interface unless BindAddr says otherwise. Only the readiness
+// probe is answered on the SBI as well.
+type Oam struct {
+	BindAddr string `yaml:"bindAddr,omitempty"`
+}
+
+// NfHistory keeps the lifecycle events of each NF instance, such as its
+// registrations and deregistrations, for Retention and at most MaxEvents of
+// them per NF instance, the oldest being dropped first.
+type NfHistory struct {
+	Enable    bool          `yaml:"enable,omitempty"`
+	Retention time.Duration `yaml:"retention,omitempty"`
+	MaxEvents int           `yaml:"maxEvents,omitempty"`
+}
+
+// HeartbeatBatching coalesces the heartbeats of NF instances, which only
+// refresh their status and load, into bulk storage writes sent every Window
+// or once MaxBatch instances are waiting, whichever comes first.
+type HeartbeatBatching struct {
+	Enable   bool          `yaml:"enable,omitempty"`
+	Window   time.Duration `yaml:"window,omitempty"`
+	MaxBatch int           `yaml:"maxBatch,omitempty"`
+}
+
+// Storage selects where NF profiles, subscriptions and the other NRF data are
+// kept. The memory driver needs no MongoDB but loses everything on restart,
+// which suits labs and tests only. The file driver keeps the data in a local
+// file, for single node deployments.
+type Storage struct {
+	Driver string `yaml:"driver,omitempty"` // mongodb (default), file or memory
+	Path   string `yaml:"path,omitempty"`   // storage file of the file driver
+	// MigrateFrom is the storage, mongodb or file, the data is copied from
+	// at startup until the copy completes, an interrupted one being resumed.
+	MigrateFrom string `yaml:"migrateFrom,omitempty"`
+	// ConnectTimeout bounds each attempt to connect to MongoDB, retried with
+	// a backoff doubled after every failure up to MaxBackoff.
+	ConnectTimeout time.Duration `yaml:"connectTimeout,omitempty"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff,omitempty"`
+	// OperationTimeout bounds each storage operation serving a request,
+	// which fails with 504 Gateway Timeout past it.
+	OperationTimeout time.Duration `yaml:"operationTimeout,omitempty"`
+	// SchemaDryRun only reports the stored documents the schema migration
+	// at startup would upgrade, rather than upgrading them.
+	SchemaDryRun bool `yaml:"schemaDryRun,omitempty"`
+}
+
+// SubscriptionCallback restricts the nfStatusNotificationUri subscriptions
+// may be created with. Hosts are names, "*." prefixed domains, IP addresses
+// or CIDR blocks. Names are matched as written, and also resolved: a callback
+// is denied if any address it resolves to is, or if it cannot be resolved
+// while hosts are denied. Notifications are not sent to denied addresses
+// either, whatever the callback resolves to when they are.
+type SubscriptionCallback struct {
+	AllowedSchemes []string      `yaml:"allowedSchemes,omitempty"`
+	AllowedHosts   []string      `yaml:"allowedHosts,omitempty"` // any host not denied when empty
+	DeniedHosts    []string      `yaml:"deniedHosts,omitempty"`
+	Probe          bool          `yaml:"probe,omitempty"` // check the callback accepts connections
+	ProbeTimeout   time.Duration `yaml:"probeTimeout,omitempty"`
+}
+
+// AmfOamNotification enables telling the AMFs, through their Namf_OAM
+// amfInstanceDown service, when an AMF instance is deregistered.
+type AmfOamNotification struct {
+	Enable bool   `yaml:"enable"`
+	Uri    string `yaml:"uri,omitempty"` // apiRoot of the AMF OAM service
+}
+
+// Notification tunes the delivery of NF status notifications to subscribers.
+type Notification struct {
+	Workers        int                `yaml:"workers,omitempty"`
+	QueueSize      int                `yaml:"queueSize,omitempty"`
+	MaxAttempts    int                `yaml:"maxAttempts,omitempty"`
+	InitialBackoff time.Duration      `yaml:"initialBackoff,omitempty"`
+	MaxBackoff     time.Duration      `yaml:"maxBackoff,omitempty"`
+	Timeout        time.Duration      `yaml:"timeout,omitempty"`
+	Client         NotificationClient `yaml:"client,omitempty"`
+}
+
+// NotificationClient configures the HTTP client notifications are sent with.
+type NotificationClient struct {
+	Http2               bool          `yaml:"http2,omitempty"`  // h2c for http callbacks, HTTP/2 over TLS for https ones
+	TLS                 *TLS          `yaml:"tls,omitempty"`    // client certificate and key for mTLS
+	CaCert              string        `yaml:"caCert,omitempty"` // PEM bundle trusted instead of the system roots
+	MaxIdleConns        int           `yaml:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost int           `yaml:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost     int           `yaml:"maxConnsPerHost,omitempty"` // unlimited when 0
+	IdleConnTimeout     time.Duration `yaml:"idleConnTimeout,omitempty"`
+	OAuth2              bool          `yaml:"oauth2,omitempty"` // send an access token issued by this NRF
+	OAuth2Scope         string        `yaml:"oauth2Scope,omitempty"`
 }
 
 type Sbi struct {
@@ -125,3 +261,163 @@ func (c *Config) GetSbiRegisterAddr() string {
 func (c *Config) GetSbiUri() string {
 	return c.GetSbiScheme() + "://" + c.GetSbiRegisterAddr()
 }
+
+// GetHeartbeatBatchingConfig returns the heartbeat batching settings, with
+// defaults for anything left unset. Batching is disabled unless enabled.
+func (c *Config) GetHeartbeatBatchingConfig() HeartbeatBatching {
+	batching := HeartbeatBatching{}
+	if c.Configuration != nil && c.Configuration.HeartbeatBatching != nil {
+		batching = *c.Configuration.HeartbeatBatching
+	}
+	if batching.Window <= 0 {
+		batching.Window = NRF_DEFAULT_HEARTBEAT_BATCH_WINDOW
+	}
+	if batching.MaxBatch <= 0 {
+		batching.MaxBatch = NRF_DEFAULT_HEARTBEAT_BATCH_MAX_SIZE
+	}
+	return batching
+}
+
+// GetNfHistoryConfig returns the NF history settings, with defaults for
+// anything left unset. The history is not kept unless enabled.
+func (c *Config) GetNfHistoryConfig() NfHistory {
+	history := NfHistory{}
+	if c.Configuration != nil && c.Configuration.NfHistory != nil {
+		history = *c.Configuration.NfHistory
+	}
+	if history.Retention <= 0 {
+		history.Retention = NRF_DEFAULT_NF_HISTORY_RETENTION
+	}
+	if history.MaxEvents <= 0 {
+		history.MaxEvents = NRF_DEFAULT_NF_HISTORY_MAX_EVENTS
+	}
+	return history
+}
+
+// GetOamConfig returns the operator API settings, with defaults for anything
+// left unset.
+func (c *Config) GetOamConfig() Oam {
+	oam := Oam{}
+	if c.Configuration != nil && c.Configuration.Oam != nil {
+		oam = *c.Configuration.Oam
+	}
+	if oam.BindAddr == "" {
+		oam.BindAddr = NRF_DEFAULT_OAM_BIND_ADDR
+	}
+	return oam
+}
+
+// GetNotificationConfig returns the notification settings, with defaults for
+// anything left unset.
+func (c *Config) GetNotificationConfig() Notification {
+	notification := Notification{}
+	if c.Configuration != nil && c.Configuration.Notification != nil {
+		notification = *c.Configuration.Notification
+	}
+	if notification.Workers <= 0 {
+		notification.Workers = NRF_DEFAULT_NOTIFICATION_WORKERS
+	}
+	if notification.QueueSize <= 0 {
+		notification.QueueSize = NRF_DEFAULT_NOTIFICATION_QUEUE_SIZE
+	}
+	if notification.MaxAttempts <= 0 {
+		notification.MaxAttempts = NRF_DEFAULT_NOTIFICATION_MAX_ATTEMPTS
+	}
+	if notification.InitialBackoff <= 0 {
+		notification.InitialBackoff = NRF_DEFAULT_NOTIFICATION_INITIAL_BACKOFF
+	}
+	if notification.MaxBackoff <= 0 {
+		notification.MaxBackoff = NRF_DEFAULT_NOTIFICATION_MAX_BACKOFF
+	}
+	notification.MaxBackoff = max(notification.MaxBackoff, notification.InitialBackoff)
+	if notification.Timeout <= 0 {
+		notification.Timeout = NRF_DEFAULT_NOTIFICATION_TIMEOUT
+	}
+	client := &notification.Client
+	if client.MaxIdleConns <= 0 {
+		client.MaxIdleConns = NRF_DEFAULT_NOTIFICATION_MAX_IDLE_CONNS
+	}
+	if client.MaxIdleConnsPerHost <= 0 {
+		client.MaxIdleConnsPerHost = NRF_DEFAULT_NOTIFICATION_IDLE_PER_HOST
+	}
+	if client.IdleConnTimeout <= 0 {
+		client.IdleConnTimeout = NRF_DEFAULT_NOTIFICATION_IDLE_TIMEOUT
+	}
+	if client.OAuth2Scope == "" {
+		client.OAuth2Scope = NRF_DEFAULT_NOTIFICATION_OAUTH2_SCOPE
+	}
+	return notification
+}
+
+// GetMaxSubscriptionValidity returns how long subscriptions may last before
+// they have to be renewed, 0 when they may last until removed.
+func (c *Config) GetMaxSubscriptionValidity() time.Duration {
+	if c.Configuration != nil && c.Configuration.MaxSubscriptionValidity > 0 {
+		return c.Configuration.MaxSubscriptionValidity
+	}
+	return 0
+}
+
+// GetSubscriptionCallbackConfig returns the rules subscription callbacks are
+// checked against, with defaults for anything left unset.
+func (c *Config) GetSubscriptionCallbackConfig() SubscriptionCallback {
+	callback := SubscriptionCallback{}
+	if c.Configuration != nil && c.Configuration.SubscriptionCallback != nil {
+		callback = *c.Configuration.SubscriptionCallback
+	}
+	if len(callback.AllowedSchemes) == 0 {
+		callback.AllowedSchemes = NRF_DEFAULT_CALLBACK_SCHEMES
+	}
+	if callback.DeniedHosts == nil {
+		callback.DeniedHosts = NRF_DEFAULT_CALLBACK_DENIED_HOSTS
+	}
+	if callback.ProbeTimeout <= 0 {
+		callback.ProbeTimeout = NRF_DEFAULT_CALLBACK_PROBE_TIMEOUT
+	}
+	return callback
+}
+
+// GetStorageDriver returns the storage driver the NRF data is kept with.
+func (c *Config) GetStorageDriver() string {
+	return c.GetStorageConfig().Driver
+}
+
+// GetStorageConfig returns where the NRF data is kept, with defaults for
+// anything left unset.
+func (c *Config) GetStorageConfig() Storage {
+	storage := Storage{}
+	if c.Configuration != nil && c.Configuration.Storage != nil {
+		storage = *c.Configuration.Storage
+	}
+	storage.Driver = strings.ToLower(storage.Driver)
+	if storage.Driver == "" {
+		storage.Driver = NRF_STORAGE_DRIVER_MONGODB
+	}
+	if storage.Path == "" {
+		storage.Path = NRF_DEFAULT_STORAGE_PATH
+	}
+	storage.MigrateFrom = strings.ToLower(storage.MigrateFrom)
+	if storage.ConnectTimeout <= 0 {
+		storage.ConnectTimeout = NRF_DEFAULT_STORAGE_CONNECT_TIMEOUT
+	}
+	if storage.MaxBackoff <= 0 {
+		storage.MaxBackoff = NRF_DEFAULT_STORAGE_MAX_BACKOFF
+	}
+	if storage.OperationTimeout <= 0 {
+		storage.OperationTimeout = NRF_DEFAULT_STORAGE_OPERATION_TIMEOUT
+	}
+	return storage
+}
+
+// GetAmfInstanceDownUri returns the AMF OAM endpoint deregistered AMF instance
+// IDs are appended to, or an empty string when the integration is disabled.
+func (c *Config) GetAmfInstanceDownUri() string {
+	if c.Configuration == nil || c.Configuration.AmfOamNotification == nil || !c.Configuration.AmfOamNotification.Enable {
+		return ""
+	}
+	uri := c.Configuration.AmfOamNotification.Uri
+	if uri == "" {
+		uri = NRF_DEFAULT_AMF_OAM_URI
+	}
+	return strings.TrimSuffix(uri, "/") + "/namf-oam/v1/amfInstanceDown/"
+}
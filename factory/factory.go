@@ -33,6 +33,9 @@ func InitConfigFactory(f string) error {
 	if err = yaml.Unmarshal(content, &NrfConfig); err != nil {
 		return err
 	}
+	if err = validateStorage(NrfConfig.GetStorageConfig()); err != nil {
+		return err
+	}
 	if NrfConfig.Configuration.WebuiUri == "" {
 		NrfConfig.Configuration.WebuiUri = "http://webui:5001"
 		logger.CfgLog.Infof("webuiUri not set in configuration file. Using %v", NrfConfig.Configuration.WebuiUri)
@@ -55,6 +58,24 @@ func CheckConfigVersion() error {
 	return nil
 }
 
+func validateStorage(storage Storage) error {
+	switch storage.Driver {
+	case NRF_STORAGE_DRIVER_MONGODB, NRF_STORAGE_DRIVER_MEMORY, NRF_STORAGE_DRIVER_FILE:
+	default:
+		return fmt.Errorf("unsupported storage driver: %s", storage.Driver)
+	}
+	switch storage.MigrateFrom {
+	case "":
+	case NRF_STORAGE_DRIVER_MONGODB, NRF_STORAGE_DRIVER_FILE:
+		if storage.MigrateFrom == storage.Driver {
+			return fmt.Errorf("cannot migrate the %s storage to itself", storage.Driver)
+		}
+	default:
+		return fmt.Errorf("unsupported storage to migrate from: %s", storage.MigrateFrom)
+	}
+	return nil
+}
+
 func validateWebuiUri(uri string) error {
 	parsedUrl, err := url.ParseRequestURI(uri)
 	if err != nil {
@@ -7,7 +7,11 @@
 package factory
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestWebuiUrl(t *testing.T) {
@@ -95,3 +99,252 @@ func TestValidateWebuiUri(t *testing.T) {
 		})
 	}
 }
+
+func TestGetNotificationConfig(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want := Notification{
+		Workers:        4,
+		QueueSize:      256,
+		MaxAttempts:    3,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        NRF_DEFAULT_NOTIFICATION_TIMEOUT,
+		Client: NotificationClient{
+			MaxIdleConns:        NRF_DEFAULT_NOTIFICATION_MAX_IDLE_CONNS,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     NRF_DEFAULT_NOTIFICATION_IDLE_TIMEOUT,
+			OAuth2Scope:         NRF_DEFAULT_NOTIFICATION_OAUTH2_SCOPE,
+		},
+	}
+	if got := NrfConfig.GetNotificationConfig(); got != want {
+		t.Errorf("notification config = %+v, want %+v", got, want)
+	}
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg_with_custom_webui_url.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want = Notification{
+		Workers:        NRF_DEFAULT_NOTIFICATION_WORKERS,
+		QueueSize:      NRF_DEFAULT_NOTIFICATION_QUEUE_SIZE,
+		MaxAttempts:    NRF_DEFAULT_NOTIFICATION_MAX_ATTEMPTS,
+		InitialBackoff: NRF_DEFAULT_NOTIFICATION_INITIAL_BACKOFF,
+		MaxBackoff:     NRF_DEFAULT_NOTIFICATION_MAX_BACKOFF,
+		Timeout:        NRF_DEFAULT_NOTIFICATION_TIMEOUT,
+		Client: NotificationClient{
+			MaxIdleConns:        NRF_DEFAULT_NOTIFICATION_MAX_IDLE_CONNS,
+			MaxIdleConnsPerHost: NRF_DEFAULT_NOTIFICATION_IDLE_PER_HOST,
+			IdleConnTimeout:     NRF_DEFAULT_NOTIFICATION_IDLE_TIMEOUT,
+			OAuth2Scope:         NRF_DEFAULT_NOTIFICATION_OAUTH2_SCOPE,
+		},
+	}
+	if got := NrfConfig.GetNotificationConfig(); got != want {
+		t.Errorf("default notification config = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetAmfInstanceDownUri(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	if got, want := NrfConfig.GetAmfInstanceDownUri(), "http://amf:29518/namf-oam/v1/amfInstanceDown/"; got != want {
+		t.Errorf("AMF instance down uri = %q, want %q", got, want)
+	}
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg_with_custom_webui_url.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	if got := NrfConfig.GetAmfInstanceDownUri(); got != "" {
+		t.Errorf("expected AMF OAM notification to be disabled by default, got %q", got)
+	}
+}
+
+func TestGetMaxSubscriptionValidity(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	if got := NrfConfig.GetMaxSubscriptionValidity(); got != time.Hour {
+		t.Errorf("max subscription validity = %v, want %v", got, time.Hour)
+	}
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg_with_custom_webui_url.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	if got := NrfConfig.GetMaxSubscriptionValidity(); got != 0 {
+		t.Errorf("max subscription validity = %v, want no maximum", got)
+	}
+}
+
+func TestGetHeartbeatBatchingConfig(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want := HeartbeatBatching{Window: 50 * time.Millisecond, MaxBatch: 500}
+	if got := NrfConfig.GetHeartbeatBatchingConfig(); got != want {
+		t.Errorf("heartbeat batching config = %+v, want %+v", got, want)
+	}
+
+	NrfConfig.Configuration.HeartbeatBatching = &HeartbeatBatching{Enable: true, Window: 10 * time.Millisecond}
+	want = HeartbeatBatching{Enable: true, Window: 10 * time.Millisecond, MaxBatch: NRF_DEFAULT_HEARTBEAT_BATCH_MAX_SIZE}
+	if got := NrfConfig.GetHeartbeatBatchingConfig(); got != want {
+		t.Errorf("heartbeat batching config = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetNfHistoryConfig(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want := NfHistory{Retention: 24 * time.Hour, MaxEvents: 50}
+	if got := NrfConfig.GetNfHistoryConfig(); got != want {
+		t.Errorf("nf history config = %+v, want %+v", got, want)
+	}
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg_with_custom_webui_url.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want = NfHistory{Retention: NRF_DEFAULT_NF_HISTORY_RETENTION, MaxEvents: NRF_DEFAULT_NF_HISTORY_MAX_EVENTS}
+	if got := NrfConfig.GetNfHistoryConfig(); got != want {
+		t.Errorf("default nf history config = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetOamConfig(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	if got := NrfConfig.GetOamConfig(); got.BindAddr != "0.0.0.0:29511" {
+		t.Errorf("oam bind addr = %s, want 0.0.0.0:29511", got.BindAddr)
+	}
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg_with_custom_webui_url.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	if got := NrfConfig.GetOamConfig(); got.BindAddr != NRF_DEFAULT_OAM_BIND_ADDR {
+		t.Errorf("default oam bind addr = %s, want %s", got.BindAddr, NRF_DEFAULT_OAM_BIND_ADDR)
+	}
+}
+
+func TestGetSubscriptionCallbackConfig(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want := SubscriptionCallback{
+		AllowedSchemes: []string{"http", "https"},
+		DeniedHosts:    []string{"169.254.0.0/16", "fe80::/10"},
+		ProbeTimeout:   NRF_DEFAULT_CALLBACK_PROBE_TIMEOUT,
+	}
+	if got := NrfConfig.GetSubscriptionCallbackConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("subscription callback config = %+v, want %+v", got, want)
+	}
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg_with_custom_webui_url.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want = SubscriptionCallback{
+		AllowedSchemes: NRF_DEFAULT_CALLBACK_SCHEMES,
+		DeniedHosts:    NRF_DEFAULT_CALLBACK_DENIED_HOSTS,
+		ProbeTimeout:   NRF_DEFAULT_CALLBACK_PROBE_TIMEOUT,
+	}
+	if got := NrfConfig.GetSubscriptionCallbackConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("default subscription callback config = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetStorageConfig(t *testing.T) {
+	origNrfConfig := NrfConfig
+	defer func() { NrfConfig = origNrfConfig }()
+
+	if err := InitConfigFactory("../nrfTest/nrfcfg.yaml"); err != nil {
+		t.Fatalf("error in InitConfigFactory: %v", err)
+	}
+	want := Storage{
+		Driver:           NRF_STORAGE_DRIVER_MONGODB,
+		Path:             NRF_DEFAULT_STORAGE_PATH,
+		ConnectTimeout:   2 * time.Second,
+		MaxBackoff:       NRF_DEFAULT_STORAGE_MAX_BACKOFF,
+		OperationTimeout: NRF_DEFAULT_STORAGE_OPERATION_TIMEOUT,
+	}
+	if got := NrfConfig.GetStorageConfig(); got != want {
+		t.Errorf("storage config = %+v, want %+v", got, want)
+	}
+
+	NrfConfig.Configuration.Storage = &Storage{Driver: "Memory"}
+	if got := NrfConfig.GetStorageDriver(); got != NRF_STORAGE_DRIVER_MEMORY {
+		t.Errorf("storage driver = %q, want %q", got, NRF_STORAGE_DRIVER_MEMORY)
+	}
+
+	testCases := []struct {
+		name    string
+		storage string
+		want    Storage
+		isValid bool
+	}{
+		{
+			name:    "file migrated from MongoDB",
+			storage: "driver: file\n    path: /data/nrf.db\n    migrateFrom: MongoDB\n    maxBackoff: 1m\n    operationTimeout: 2s",
+			want: Storage{
+				Driver: NRF_STORAGE_DRIVER_FILE, Path: "/data/nrf.db", MigrateFrom: NRF_STORAGE_DRIVER_MONGODB,
+				ConnectTimeout: NRF_DEFAULT_STORAGE_CONNECT_TIMEOUT, MaxBackoff: time.Minute, OperationTimeout: 2 * time.Second,
+			},
+			isValid: true,
+		},
+		{
+			name:    "MongoDB migrated from file",
+			storage: "migrateFrom: file",
+			want: Storage{
+				Driver: NRF_STORAGE_DRIVER_MONGODB, Path: NRF_DEFAULT_STORAGE_PATH, MigrateFrom: NRF_STORAGE_DRIVER_FILE,
+				ConnectTimeout: NRF_DEFAULT_STORAGE_CONNECT_TIMEOUT, MaxBackoff: NRF_DEFAULT_STORAGE_MAX_BACKOFF,
+				OperationTimeout: NRF_DEFAULT_STORAGE_OPERATION_TIMEOUT,
+			},
+			isValid: true,
+		},
+		{name: "unknown driver", storage: "driver: redis"},
+		{name: "migration to itself", storage: "driver: file\n    migrateFrom: file"},
+		{name: "migration from memory", storage: "driver: file\n    migrateFrom: memory"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "nrfcfg.yaml")
+			content := "configuration:\n  storage:\n    " + tc.storage + "\n"
+			if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := InitConfigFactory(configFile)
+			if !tc.isValid {
+				if err == nil {
+					t.Error("expected the storage config to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error in InitConfigFactory: %v", err)
+			}
+			if got := NrfConfig.GetStorageConfig(); got != tc.want {
+				t.Errorf("storage config = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
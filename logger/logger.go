@@ -20,6 +20,7 @@ var (
 	ManagementLog  *zap.SugaredLogger
 	AccessTokenLog *zap.SugaredLogger
 	DiscoveryLog   *zap.SugaredLogger
+	NotifyLog      *zap.SugaredLogger
 	GinLog         *zap.SugaredLogger
 	UtilLog        *zap.SugaredLogger
 	atomicLevel    zap.AtomicLevel
@@ -58,6 +59,7 @@ func init() {
 	ManagementLog = log.Sugar().With("component", "NRF", "category", "MGMT")
 	AccessTokenLog = log.Sugar().With("component", "NRF", "category", "Token")
 	DiscoveryLog = log.Sugar().With("component", "NRF", "category", "DSCV")
+	NotifyLog = log.Sugar().With("component", "NRF", "category", "NOTIF")
 	GinLog = log.Sugar().With("component", "NRF", "category", "GIN")
 	UtilLog = log.Sugar().With("component", "NRF", "category", "Util")
 }
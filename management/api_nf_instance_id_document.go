@@ -38,7 +38,11 @@ func HTTPDeregisterNFInstance(c *gin.Context) {
 	req := httpwrapper.NewRequest(c.Request, nil)
 	req.Params["nfInstanceID"] = c.Params.ByName("nfInstanceID")
 
-	httpResponse := producer.HandleNFDeregisterRequest(req)
+	httpResponse := producer.HandleNFDeregisterRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
 
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
@@ -57,7 +61,11 @@ func HTTPGetNFInstance(c *gin.Context) {
 	req := httpwrapper.NewRequest(c.Request, nil)
 	req.Params["nfInstanceID"] = c.Params.ByName("nfInstanceID")
 
-	httpResponse := producer.HandleGetNFInstanceRequest(req)
+	httpResponse := producer.HandleGetNFInstanceRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
 
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
@@ -99,7 +107,7 @@ func HTTPRegisterNFInstance(c *gin.Context) {
 	req := httpwrapper.NewRequest(c.Request, nfprofile)
 
 	// step 4: call producer
-	httpResponse := producer.HandleNFRegisterRequest(req)
+	httpResponse := producer.HandleNFRegisterRequest(c.Request.Context(), req)
 
 	for key, val := range httpResponse.Header {
 		c.Header(key, val[0])
@@ -132,7 +140,11 @@ func HTTPUpdateNFInstance(c *gin.Context) {
 	req.Params["nfInstanceID"] = c.Params.ByName("nfInstanceID")
 	req.Body = requestBody
 
-	httpResponse := producer.HandleUpdateNFInstanceRequest(req)
+	httpResponse := producer.HandleUpdateNFInstanceRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
 
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
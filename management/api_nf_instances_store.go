@@ -37,7 +37,7 @@ func HTTPGetNFInstances(c *gin.Context) {
 	req := httpwrapper.NewRequest(c.Request, nil)
 	req.Query = c.Request.URL.Query()
 
-	httpResponse := producer.HandleGetNFInstancesRequest(req)
+	httpResponse := producer.HandleGetNFInstancesRequest(c.Request.Context(), req)
 
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
@@ -19,38 +19,122 @@ Generated by: OpenAPI Generator (https://openapi-generator.tech)
 package management
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/producer"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/utils"
+	"github.com/omec-project/util/httpwrapper"
 )
 
 // Delete /shared-data/:sharedDataId
 // Delete Shared Data identified by a given sharedDataId
 func HTTPDeleteSharedData(c *gin.Context) {
-	detail := "Handle Delete /shared-data/:sharedDataId is not implemented"
-	logger.ManagementLog.Warnln(detail)
-	writeNotImplementedProblem(c, detail)
+	logger.ManagementLog.Infoln("Handle Delete /shared-data/:sharedDataId")
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["sharedDataId"] = c.Params.ByName("sharedDataId")
+
+	httpResponse := producer.HandleDeleteSharedDataRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
+
+	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
+	if err != nil {
+		logger.ManagementLog.Warnln(err)
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(httpResponse.Status, contentTypeJSON, responseBody.Bytes())
+	}
 }
 
 // Get /shared-data/:sharedDataId
 // Read the shared data identified by a given NF sharedDataId
 func HTTPGetSharedData(c *gin.Context) {
-	detail := "Handle Get /shared-data/:sharedDataId is not implemented"
-	logger.ManagementLog.Warnln(detail)
-	writeNotImplementedProblem(c, detail)
+	logger.ManagementLog.Infoln("Handle Get /shared-data/:sharedDataId")
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["sharedDataId"] = c.Params.ByName("sharedDataId")
+
+	httpResponse := producer.HandleGetSharedDataRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
+
+	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
+	if err != nil {
+		logger.ManagementLog.Warnln(err)
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(httpResponse.Status, contentTypeJSON, responseBody.Bytes())
+	}
 }
 
 // Put /shared-data/:sharedDataId
 // Register new Shared Data
 func HTTPRegisterSharedData(c *gin.Context) {
-	detail := "Handle Put /shared-data/:sharedDataId is not implemented"
-	logger.ManagementLog.Warnln(detail)
-	writeNotImplementedProblem(c, detail)
+	logger.ManagementLog.Infoln("Handle Put /shared-data/:sharedDataId")
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		logger.ManagementLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetails)
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["sharedDataId"] = c.Params.ByName("sharedDataId")
+	req.Body = requestBody
+
+	httpResponse := producer.HandleRegisterSharedDataRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
+
+	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
+	if err != nil {
+		logger.ManagementLog.Warnln(err)
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(httpResponse.Status, contentTypeJSON, responseBody.Bytes())
+	}
 }
 
 // Patch /shared-data/:sharedDataId
 // Update Shared Data
 func HTTPUpdateSharedData(c *gin.Context) {
-	detail := "Handle Patch /shared-data/:sharedDataId is not implemented"
-	logger.ManagementLog.Warnln(detail)
-	writeNotImplementedProblem(c, detail)
+	logger.ManagementLog.Infoln("Handle Patch /shared-data/:sharedDataId")
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		logger.ManagementLog.Errorf("Get Request Body error: %+v", err)
+		c.JSON(http.StatusInternalServerError, problemDetails)
+		return
+	}
+
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["sharedDataId"] = c.Params.ByName("sharedDataId")
+	req.Body = requestBody
+
+	httpResponse := producer.HandleUpdateSharedDataRequest(c.Request.Context(), req)
+
+	for key, val := range httpResponse.Header {
+		c.Header(key, val[0])
+	}
+
+	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
+	if err != nil {
+		logger.ManagementLog.Warnln(err)
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		c.JSON(http.StatusInternalServerError, problemDetails)
+	} else {
+		c.Data(httpResponse.Status, contentTypeJSON, responseBody.Bytes())
+	}
 }
@@ -37,7 +37,7 @@ func HTTPRemoveSubscription(c *gin.Context) {
 	req := httpwrapper.NewRequest(c.Request, nil)
 	req.Params["subscriptionID"] = c.Params.ByName("subscriptionID")
 
-	httpResponse := producer.HandleRemoveSubscriptionRequest(req)
+	httpResponse := producer.HandleRemoveSubscriptionRequest(c.Request.Context(), req)
 
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
@@ -65,7 +65,7 @@ func HTTPUpdateSubscription(c *gin.Context) {
 	req.Params["subscriptionID"] = c.Params.ByName("subscriptionID")
 	req.Body = requestBody
 
-	httpResponse := producer.HandleUpdateSubscriptionRequest(req)
+	httpResponse := producer.HandleUpdateSubscriptionRequest(c.Request.Context(), req)
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
 		logger.ManagementLog.Warnln(err)
@@ -58,7 +58,7 @@ func HTTPCreateSubscription(c *gin.Context) {
 
 	req := httpwrapper.NewRequest(c.Request, subscription)
 
-	httpResponse := producer.HandleCreateSubscriptionRequest(req)
+	httpResponse := producer.HandleCreateSubscriptionRequest(c.Request.Context(), req)
 	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
 	if err != nil {
 		logger.ManagementLog.Errorln(err)
@@ -20,6 +20,7 @@ type NrfStats struct {
 	nrfRegistrations *prometheus.CounterVec
 	nrfSubscriptions *prometheus.CounterVec
 	nrfNfInstances   *prometheus.CounterVec
+	nrfNotifications *prometheus.CounterVec
 }
 
 var nrfStats *NrfStats
@@ -38,6 +39,10 @@ func initNrfStats() *NrfStats {
 			Name: "nrf_nf_instances",
 			Help: "Counter of total NRF instances queries",
 		}, []string{"request_nf_type", "target_nf_type", "result"}),
+		nrfNotifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nrf_notifications",
+			Help: "Counter of total NRF notification delivery attempts",
+		}, []string{"event", "result"}),
 	}
 }
 
@@ -51,6 +56,9 @@ func (ps *NrfStats) register() error {
 	if err := prometheus.Register(ps.nrfNfInstances); err != nil {
 		return err
 	}
+	if err := prometheus.Register(ps.nrfNotifications); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -84,3 +92,9 @@ func IncrementNrfSubscriptionsStats(queryType, requestNfType, result string) {
 func IncrementNrfNfInstancesStats(requestNfType, targetNfType, result string) {
 	nrfStats.nrfNfInstances.WithLabelValues(requestNfType, targetNfType, result).Inc()
 }
+
+// IncrementNrfNotificationsStats increments number of total NRF notification
+// delivery attempts
+func IncrementNrfNotificationsStats(event, result string) {
+	nrfStats.nrfNotifications.WithLabelValues(event, result).Inc()
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notification
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tokenRefreshMargin is how long before it expires an access token is
+// replaced, so that it does not expire while a notification is in flight.
+const tokenRefreshMargin = 10 * time.Second
+
+// dialTimeout and dialKeepAlive are those of http.DefaultTransport.
+const (
+	dialTimeout   = 30 * time.Second
+	dialKeepAlive = 30 * time.Second
+)
+
+// TokenSource returns an OAuth2 access token and how long it may be used.
+type TokenSource func(ctx context.Context) (token string, expiresIn time.Duration, err error)
+
+// ClientConfig selects how notifications reach the subscribers.
+type ClientConfig struct {
+	// HTTP2 restricts deliveries to HTTP/2: over TLS for https callbacks and
+	// h2c with prior knowledge for http ones.
+	HTTP2 bool
+	// CertFile and KeyFile hold the client identity presented for mTLS.
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM bundle trusted instead of the system roots.
+	CAFile string
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int // unlimited when 0
+	IdleConnTimeout     time.Duration
+
+	// Token, if not nil, provides the bearer token sent with every
+	// notification.
+	Token TokenSource
+
+	// AddressDenied, if not nil, reports the addresses notifications must
+	// not be sent to. Connections to them fail with ErrAddressDenied,
+	// whatever name the callback was resolved from.
+	AddressDenied func(netip.Addr) bool
+}
+
+// ErrAddressDenied is reported for the notifications whose callback resolves
+// to a denied address. They are not retried.
+var ErrAddressDenied = errors.New("notification callback address denied")
+
+// NewClient returns the HTTP client notifications are delivered with.
+func NewClient(cfg ClientConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load notification client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notification CA bundle: %w", err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in notification CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	if cfg.AddressDenied != nil {
+		dialer := &net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: dialKeepAlive,
+			Control:   deniedAddressControl(cfg.AddressDenied),
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if cfg.HTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = protocols
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if cfg.Token != nil {
+		roundTripper = &tokenTransport{base: transport, source: cfg.Token}
+	}
+	return &http.Client{Transport: roundTripper}, nil
+}
+
+// deniedAddressControl refuses the connections to the addresses denied
+// reports, once the callback name is resolved.
+func deniedAddressControl(denied func(netip.Addr) bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: cannot parse %s: %w", ErrAddressDenied, address, err)
+		}
+		if denied(addrPort.Addr().Unmap()) {
+			return fmt.Errorf("%w: %s", ErrAddressDenied, addrPort.Addr())
+		}
+		return nil
+	}
+}
+
+// tokenTransport attaches a bearer token to requests, reusing it until it is
+// about to expire.
+type tokenTransport struct {
+	base   http.RoundTripper
+	source TokenSource
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.currentToken(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification access token: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+func (t *tokenTransport) currentToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	token, expiresIn, err := t.source(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.token, t.expires = token, time.Now().Add(expiresIn-tokenRefreshMargin)
+	return token, nil
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notification
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestClientUsesH2CAndBearerToken(t *testing.T) {
+	type request struct {
+		protoMajor    int
+		authorization string
+	}
+	requests := make(chan request, 2)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- request{r.ProtoMajor, r.Header.Get("Authorization")}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	var issued atomic.Int32
+	client, err := NewClient(ClientConfig{
+		HTTP2: true,
+		Token: func(context.Context) (string, time.Duration, error) {
+			issued.Add(1)
+			return "token-1", time.Hour, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	d := NewDispatcher(testConfig(), client, nil)
+	d.Start()
+	defer d.Stop()
+
+	for range 2 {
+		d.Enqueue(Notification{Destination: server.URL, Event: "NF_REGISTERED", Body: []byte("{}")})
+		select {
+		case r := <-requests:
+			if r.protoMajor != 2 || r.authorization != "Bearer token-1" {
+				t.Errorf("unexpected request %+v", r)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for notification")
+		}
+	}
+	if got := issued.Load(); got != 1 {
+		t.Errorf("expected the access token to be reused, issued %d", got)
+	}
+}
+
+func TestClientPresentsCertificateAndTrustsCABundle(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The server certificate serves as CA bundle and as client identity
+	cert := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, "client.pem", "CERTIFICATE", cert.Certificate[0])
+	keyFile := writePEM(t, "client.key", "PRIVATE KEY", key)
+
+	if _, err := NewClient(ClientConfig{CAFile: keyFile}); err == nil {
+		t.Error("expected a CA bundle without certificate to be rejected")
+	}
+	client, err := NewClient(ClientConfig{HTTP2: true, CertFile: certFile, KeyFile: keyFile, CAFile: certFile})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	d := NewDispatcher(testConfig(), client, nil)
+	d.Start()
+	defer d.Stop()
+
+	d.Enqueue(Notification{Destination: server.URL, Event: "NF_REGISTERED", Body: []byte("{}")})
+	select {
+	case r := <-requests:
+		if r.ProtoMajor != 2 || r.TLS == nil || len(r.TLS.PeerCertificates) != 1 {
+			t.Errorf("expected an HTTP/2 request with a client certificate, got %s %+v", r.Proto, r.TLS)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+}
+
+func TestClientRefusesDeniedAddresses(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(ClientConfig{
+		AddressDenied: func(addr netip.Addr) bool { return addr.IsLoopback() },
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	rsp, err := client.Post(server.URL, "application/json", nil)
+	if err == nil {
+		rsp.Body.Close()
+	}
+	if !errors.Is(err, ErrAddressDenied) {
+		t.Errorf("expected the loopback address to be denied, got %v", err)
+	}
+	if retryable(err) {
+		t.Error("expected a denied address not to be retried")
+	}
+	if got := received.Load(); got != 0 {
+		t.Errorf("expected no request to reach the server, got %d", got)
+	}
+}
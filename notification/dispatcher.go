@@ -0,0 +1,385 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+ * NRF Notification Dispatcher
+ */
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/omec-project/nrf/logger"
+	stats "github.com/omec-project/nrf/metrics"
+)
+
+// ErrQueueFull is reported for notifications rejected because the queue is at
+// capacity. They are dead-lettered instead of blocking the caller.
+var ErrQueueFull = errors.New("notification queue full")
+
+// Config sizes the dispatcher and its retry policy.
+type Config struct {
+	Workers        int
+	QueueSize      int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+}
+
+// Notification is a JSON document to be POSTed to a subscriber callback.
+type Notification struct {
+	Destination string
+	Event       string
+	Body        []byte
+	// Subscription identifies the subscription notified, if any
+	Subscription string
+}
+
+// Attempt reports the outcome of a delivery attempt to the observer.
+type Attempt struct {
+	Notification
+	Attempt int
+	Err     error // nil when delivered
+	Final   bool  // no other attempt follows
+}
+
+// DeadLetter records a notification that could not be delivered.
+type DeadLetter struct {
+	Notification
+	Attempts  int
+	LastError string
+	Time      time.Time
+}
+
+// DeliveryError is a callback answering with an unexpected HTTP status.
+type DeliveryError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *DeliveryError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("notification rejected with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("notification rejected with status %d: %s", e.StatusCode, e.Detail)
+}
+
+// retryable reports whether a failed delivery may succeed later: transport
+// errors, timeouts, throttling and server errors are retried while any other
+// client error means the subscriber will never accept the notification.
+func retryable(err error) bool {
+	if errors.Is(err, ErrAddressDenied) {
+		return false
+	}
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) {
+		return true
+	}
+	switch deliveryErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return deliveryErr.StatusCode >= http.StatusInternalServerError
+}
+
+type job struct {
+	Notification
+	attempts int
+}
+
+// destinationState tracks the notification being delivered to a callback,
+// its consecutive failures, and the notifications waiting for it. It exists
+// as long as a notification to the callback is being delivered.
+type destinationState struct {
+	failures int
+	retryAt  time.Time
+	waiting  []*job
+}
+
+// Dispatcher delivers notifications asynchronously from a bounded in-memory
+// queue with a fixed pool of workers. Failed deliveries are retried with
+// per-destination exponential backoff and dead-lettered after MaxAttempts.
+// Notifications to a destination are delivered one at a time, in the order
+// they were enqueued, so that a retried NF_REGISTERED cannot arrive after the
+// NF_DEREGISTERED following it.
+type Dispatcher struct {
+	cfg        Config
+	client     *http.Client
+	deadLetter func(DeadLetter)
+	observer   func(Attempt)
+
+	queue   chan *job
+	done    chan struct{}
+	workers sync.WaitGroup
+
+	mu           sync.Mutex
+	stopped      bool
+	destinations map[string]*destinationState
+	waiting      int // notifications waiting for their destination
+}
+
+// NewDispatcher creates a dispatcher; deadLetter, if not nil, is called for
+// every notification given up on.
+func NewDispatcher(cfg Config, client *http.Client, deadLetter func(DeadLetter)) *Dispatcher {
+	cfg.Workers = max(cfg.Workers, 1)
+	cfg.QueueSize = max(cfg.QueueSize, 1)
+	cfg.MaxAttempts = max(cfg.MaxAttempts, 1)
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &Dispatcher{
+		cfg:          cfg,
+		client:       client,
+		deadLetter:   deadLetter,
+		queue:        make(chan *job, cfg.QueueSize),
+		done:         make(chan struct{}),
+		destinations: make(map[string]*destinationState),
+	}
+}
+
+// Observe registers f to be called with the outcome of every delivery
+// attempt. It must be called before Start.
+func (d *Dispatcher) Observe(f func(Attempt)) {
+	d.observer = f
+}
+
+func (d *Dispatcher) observe(j *job, err error, final bool) {
+	if d.observer != nil {
+		d.observer(Attempt{Notification: j.Notification, Attempt: j.attempts, Err: err, Final: final})
+	}
+}
+
+// Start launches the worker pool.
+func (d *Dispatcher) Start() {
+	for range d.cfg.Workers {
+		d.workers.Add(1)
+		go d.work()
+	}
+	logger.NotifyLog.Infof("notification dispatcher started with %d workers", d.cfg.Workers)
+}
+
+// Stop terminates the workers. Notifications still queued, waiting for a
+// retry or waiting for their destination are dropped.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	close(d.done)
+	d.mu.Unlock()
+	d.workers.Wait()
+	logger.NotifyLog.Infoln("notification dispatcher stopped")
+}
+
+// Enqueue schedules a notification for delivery without blocking. It reports
+// false when the notification was dead-lettered instead.
+func (d *Dispatcher) Enqueue(n Notification) bool {
+	j := &job{Notification: n}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		logger.NotifyLog.Warnf("dispatcher stopped, dropping %s notification to %s", j.Event, j.Destination)
+		return false
+	}
+	if d.full() {
+		go d.giveUp(j, ErrQueueFull)
+		return false
+	}
+	if state, ok := d.destinations[j.Destination]; ok {
+		// Delivered once the earlier notifications to the destination are done with
+		state.waiting = append(state.waiting, j)
+		d.waiting++
+		return true
+	}
+	d.destinations[j.Destination] = &destinationState{}
+	d.queue <- j
+	return true
+}
+
+// full reports whether the queue is at capacity, counting the notifications
+// waiting for their destination. The queue channel thus always has room for
+// those. It must be called with mu held.
+func (d *Dispatcher) full() bool {
+	return len(d.queue)+d.waiting >= d.cfg.QueueSize
+}
+
+// pushAfter re-queues a job once delay has elapsed.
+func (d *Dispatcher) pushAfter(j *job, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			d.retry(j)
+		case <-d.done:
+		}
+	}()
+}
+
+// retry re-queues a job, dead-lettering it if the queue is full.
+func (d *Dispatcher) retry(j *job) {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	if !d.full() {
+		d.queue <- j
+		d.mu.Unlock()
+		return
+	}
+	d.mu.Unlock()
+	d.giveUp(j, ErrQueueFull)
+	d.release(j.Destination)
+}
+
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case j := <-d.queue:
+			d.process(j)
+		}
+	}
+}
+
+func (d *Dispatcher) process(j *job) {
+	// Wait for the destination's backoff to expire without spending an attempt
+	if wait := d.backoffRemaining(j.Destination); wait > 0 {
+		d.pushAfter(j, wait)
+		return
+	}
+
+	j.attempts++
+	err := d.deliver(j.Notification)
+	if err == nil {
+		d.observe(j, nil, true)
+		stats.IncrementNrfNotificationsStats(j.Event, "SUCCESS")
+		logger.NotifyLog.Debugf("%s notification delivered to %s", j.Event, j.Destination)
+		d.release(j.Destination)
+		return
+	}
+	if !retryable(err) || j.attempts >= d.cfg.MaxAttempts {
+		d.giveUp(j, err)
+		d.release(j.Destination)
+		return
+	}
+	d.observe(j, err, false)
+	delay := d.recordFailure(j.Destination)
+	stats.IncrementNrfNotificationsStats(j.Event, "RETRY")
+	logger.NotifyLog.Warnf("%s notification to %s failed (attempt %d/%d), retrying in %v: %v",
+		j.Event, j.Destination, j.attempts, d.cfg.MaxAttempts, delay, err)
+	d.pushAfter(j, delay)
+}
+
+func (d *Dispatcher) giveUp(j *job, err error) {
+	d.observe(j, err, true)
+	stats.IncrementNrfNotificationsStats(j.Event, "DEAD_LETTER")
+	logger.NotifyLog.Errorf("giving up %s notification to %s after %d attempts: %v",
+		j.Event, j.Destination, j.attempts, err)
+	if d.deadLetter != nil {
+		d.deadLetter(DeadLetter{
+			Notification: j.Notification,
+			Attempts:     j.attempts,
+			LastError:    err.Error(),
+			Time:         time.Now(),
+		})
+	}
+}
+
+func (d *Dispatcher) backoffRemaining(destination string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if state, ok := d.destinations[destination]; ok {
+		return time.Until(state.retryAt)
+	}
+	return 0
+}
+
+// release ends the delivery to destination of a notification, delivered or
+// dead-lettered, and queues the next one waiting for it with a fresh
+// backoff. The destination state is dropped once none is waiting.
+func (d *Dispatcher) release(destination string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.destinations[destination]
+	if !ok {
+		return
+	}
+	if len(state.waiting) == 0 {
+		delete(d.destinations, destination)
+		return
+	}
+	next := state.waiting[0]
+	state.waiting = state.waiting[1:]
+	d.waiting--
+	state.failures, state.retryAt = 0, time.Time{}
+	if !d.stopped {
+		d.queue <- next
+	}
+}
+
+// recordFailure extends the destination backoff, doubling it with every
+// consecutive failure up to MaxBackoff, and returns it.
+func (d *Dispatcher) recordFailure(destination string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.destinations[destination]
+	if !ok {
+		state = &destinationState{}
+		d.destinations[destination] = state
+	}
+	state.failures++
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < state.failures && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, d.cfg.MaxBackoff)
+	state.retryAt = time.Now().Add(delay)
+	return delay
+}
+
+func (d *Dispatcher) deliver(n Notification) error {
+	ctx := context.Background()
+	if d.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Destination, bytes.NewReader(n.Body))
+	if err != nil {
+		return &DeliveryError{StatusCode: http.StatusBadRequest, Detail: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, application/problem+json")
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := res.Body.Close(); closeErr != nil {
+			logger.NotifyLog.Errorf("notification response body cannot close: %+v", closeErr)
+		}
+	}()
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return &DeliveryError{StatusCode: res.StatusCode, Detail: string(body)}
+}
@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package notification
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Workers:        2,
+		QueueSize:      16,
+		MaxAttempts:    3,
+		InitialBackoff: 5 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		Timeout:        time.Second,
+	}
+}
+
+// subscriber answers with the given statuses in turn, then with 204.
+func subscriber(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		if call <= len(statuses) {
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	server, calls := subscriber(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	deadLetters := make(chan DeadLetter, 1)
+	d := NewDispatcher(testConfig(), server.Client(), func(dl DeadLetter) { deadLetters <- dl })
+	d.Start()
+	defer d.Stop()
+
+	if !d.Enqueue(Notification{Destination: server.URL, Event: "NF_REGISTERED", Body: []byte("{}")}) {
+		t.Fatal("expected notification to be queued")
+	}
+	waitFor(t, "delivery", func() bool { return calls.Load() == 3 })
+	waitFor(t, "backoff reset", func() bool { return d.backoffRemaining(server.URL) == 0 })
+	select {
+	case dl := <-deadLetters:
+		t.Fatalf("unexpected dead letter %+v", dl)
+	default:
+	}
+}
+
+func TestDispatcherDeadLettersAfterMaxAttempts(t *testing.T) {
+	server, calls := subscriber(t, http.StatusInternalServerError, http.StatusInternalServerError,
+		http.StatusInternalServerError, http.StatusInternalServerError)
+	deadLetters := make(chan DeadLetter, 1)
+	d := NewDispatcher(testConfig(), server.Client(), func(dl DeadLetter) { deadLetters <- dl })
+	d.Start()
+	defer d.Stop()
+
+	d.Enqueue(Notification{Destination: server.URL, Event: "NF_REGISTERED", Body: []byte("{}")})
+	select {
+	case dl := <-deadLetters:
+		if dl.Attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", dl.Attempts)
+		}
+		if dl.Destination != server.URL || dl.Event != "NF_REGISTERED" {
+			t.Errorf("unexpected dead letter %+v", dl)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for dead letter")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("expected 3 delivery attempts, got %d", got)
+	}
+}
+
+func TestDispatcherDoesNotRetryRejectedNotification(t *testing.T) {
+	server, calls := subscriber(t, http.StatusNotFound)
+	deadLetters := make(chan DeadLetter, 1)
+	d := NewDispatcher(testConfig(), server.Client(), func(dl DeadLetter) { deadLetters <- dl })
+	d.Start()
+	defer d.Stop()
+
+	d.Enqueue(Notification{Destination: server.URL, Event: "NF_DEREGISTERED"})
+	select {
+	case dl := <-deadLetters:
+		if dl.Attempts != 1 {
+			t.Errorf("expected a single attempt, got %d", dl.Attempts)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for dead letter")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 delivery attempt, got %d", got)
+	}
+}
+
+func TestDispatcherEnqueueNeverBlocks(t *testing.T) {
+	cfg := testConfig()
+	cfg.QueueSize = 1
+	deadLetters := make(chan DeadLetter, 1)
+	// Workers are not started, so the queue stays full
+	d := NewDispatcher(cfg, nil, func(dl DeadLetter) { deadLetters <- dl })
+	defer d.Stop()
+
+	if !d.Enqueue(Notification{Destination: "http://subscriber-1"}) {
+		t.Fatal("expected first notification to be queued")
+	}
+	if d.Enqueue(Notification{Destination: "http://subscriber-2"}) {
+		t.Fatal("expected notification to be rejected when the queue is full")
+	}
+	select {
+	case dl := <-deadLetters:
+		if dl.Destination != "http://subscriber-2" || dl.LastError != ErrQueueFull.Error() {
+			t.Errorf("unexpected dead letter %+v", dl)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for dead letter")
+	}
+}
+
+func TestDispatcherReportsEveryAttempt(t *testing.T) {
+	server, _ := subscriber(t, http.StatusServiceUnavailable)
+	attempts := make(chan Attempt, 4)
+	d := NewDispatcher(testConfig(), server.Client(), nil)
+	d.Observe(func(a Attempt) { attempts <- a })
+	d.Start()
+	defer d.Stop()
+
+	d.Enqueue(Notification{Destination: server.URL, Event: "NF_REGISTERED", Subscription: "sub-1"})
+	for i, want := range []struct {
+		failed bool
+		final  bool
+	}{{failed: true}, {final: true}} {
+		select {
+		case a := <-attempts:
+			if a.Subscription != "sub-1" || a.Attempt != i+1 || (a.Err != nil) != want.failed || a.Final != want.final {
+				t.Errorf("unexpected attempt %d: %+v", i+1, a)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for attempt")
+		}
+	}
+}
+
+func TestDispatcherDeliversInOrderPerDestination(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(body))
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	d := NewDispatcher(testConfig(), server.Client(), nil)
+	d.Start()
+	defer d.Stop()
+
+	// The first delivery fails: its retry still precedes the next notification
+	for _, event := range []string{"NF_REGISTERED", "NF_DEREGISTERED"} {
+		if !d.Enqueue(Notification{Destination: server.URL, Event: event, Body: []byte(event)}) {
+			t.Fatalf("expected %s notification to be queued", event)
+		}
+	}
+	waitFor(t, "delivery", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"NF_REGISTERED", "NF_REGISTERED", "NF_DEREGISTERED"}; !slices.Equal(received, want) {
+		t.Errorf("expected deliveries %v, got %v", want, received)
+	}
+}
+
+func TestDispatcherDropsDestinationStateAfterDeadLetter(t *testing.T) {
+	server, calls := subscriber(t, http.StatusInternalServerError, http.StatusInternalServerError,
+		http.StatusInternalServerError, http.StatusNotFound)
+	deadLetters := make(chan DeadLetter, 2)
+	d := NewDispatcher(testConfig(), server.Client(), func(dl DeadLetter) { deadLetters <- dl })
+	d.Start()
+	defer d.Stop()
+
+	d.Enqueue(Notification{Destination: server.URL, Event: "NF_REGISTERED"})
+	d.Enqueue(Notification{Destination: server.URL, Event: "NF_DEREGISTERED"})
+	for _, want := range []struct {
+		event    string
+		attempts int
+	}{{"NF_REGISTERED", 3}, {"NF_DEREGISTERED", 1}} {
+		select {
+		case dl := <-deadLetters:
+			if dl.Event != want.event || dl.Attempts != want.attempts {
+				t.Errorf("expected %s dead-lettered after %d attempts, got %+v", want.event, want.attempts, dl)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for dead letter")
+		}
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("expected 4 delivery attempts, got %d", got)
+	}
+	waitFor(t, "destination state dropped", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(d.destinations) == 0
+	})
+}
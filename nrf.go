@@ -30,6 +30,22 @@ func main() {
 	app.UsageText = "nrf -cfg <nrf_config_file.conf>"
 	app.Action = action
 	app.Flags = NRF.GetCliCmd()
+	app.Commands = []*cli.Command{
+		{
+			Name:      "export",
+			Usage:     "Write the NF profiles, subscriptions and shared data to a file",
+			UsageText: "nrf -cfg <nrf_config_file.conf> export --output <file> [--nf-type <NF type>]...",
+			Flags:     NRF.GetExportCliCmd(),
+			Action:    exportAction,
+		},
+		{
+			Name:      "import",
+			Usage:     "Store the NF profiles, subscriptions and shared data of a file written by export",
+			UsageText: "nrf -cfg <nrf_config_file.conf> import --input <file>",
+			Flags:     NRF.GetImportCliCmd(),
+			Action:    importAction,
+		},
+	}
 
 	if err := app.Run(context.Background(), os.Args); err != nil {
 		logger.AppLog.Fatalf("NRF run error: %v", err)
@@ -46,3 +62,19 @@ func action(ctx context.Context, c *cli.Command) error {
 
 	return nil
 }
+
+func exportAction(ctx context.Context, c *cli.Command) error {
+	if err := NRF.Initialize(c); err != nil {
+		logger.CfgLog.Errorf("%+v", err)
+		return fmt.Errorf("failed to initialize")
+	}
+	return NRF.Export(c)
+}
+
+func importAction(ctx context.Context, c *cli.Command) error {
+	if err := NRF.Initialize(c); err != nil {
+		logger.CfgLog.Errorf("%+v", err)
+		return fmt.Errorf("failed to initialize")
+	}
+	return NRF.Import(c)
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/openapi/v2/utils"
+)
+
+// Get /indexes
+// Reports how often each index of the NRF collections was used, to tell
+// which ones serve the discovery queries
+func HTTPGetIndexUsage(c *gin.Context) {
+	logger.ManagementLog.Infoln("Handle Get /nrf-oam/v1/indexes")
+	reporter, ok := dbadapter.DBClient.(dbadapter.IndexReporter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, utils.ProblemDetails("Not Implemented", http.StatusNotImplemented,
+			"the storage in use keeps no indexes"))
+		return
+	}
+	usage, err := reporter.IndexUsage()
+	if err != nil {
+		logger.ManagementLog.Warnf("failed to read index usage: %v", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, dbadapter.ErrStorageUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, utils.ProblemDetails("Index usage unavailable", status, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/producer"
+	"github.com/omec-project/util/httpwrapper"
+)
+
+// Get /nf-history
+// Lists the lifecycle events of the NF instances, newest first, filtered by
+// nfInstanceId, nfType, event and since
+func HTTPListNfHistory(c *gin.Context) {
+	logger.ManagementLog.Infoln("Handle Get /nrf-oam/v1/nf-history")
+	req := httpwrapper.NewRequest(c.Request, nil)
+
+	httpResponse := producer.HandleListNfHistoryRequest(c.Request.Context(), req)
+	writeResponse(c, httpResponse)
+}
+
+// Get /nf-history/:nfInstanceID
+// Lists the lifecycle events of an NF instance, newest first
+func HTTPGetNfInstanceHistory(c *gin.Context) {
+	logger.ManagementLog.Infoln("Handle Get /nrf-oam/v1/nf-history/:nfInstanceID")
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["nfInstanceID"] = c.Params.ByName("nfInstanceID")
+
+	httpResponse := producer.HandleGetNfInstanceHistoryRequest(c.Request.Context(), req)
+	writeResponse(c, httpResponse)
+}
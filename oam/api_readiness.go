@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/nrf/dbadapter"
+)
+
+// Readiness tells whether the NRF can serve requests.
+type Readiness struct {
+	Ready   bool `json:"ready"`
+	Storage bool `json:"storage"`
+}
+
+// Get /readiness
+// Reports 200 when the NRF is ready to serve requests, 503 otherwise
+func HTTPGetReadiness(c *gin.Context) {
+	readiness := Readiness{Storage: dbadapter.Ready()}
+	readiness.Ready = readiness.Storage
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
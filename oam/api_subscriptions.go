@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/producer"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/utils"
+	"github.com/omec-project/util/httpwrapper"
+)
+
+// Get /subscriptions
+// Lists the subscriptions, filtered by reqNfType, reqNfInstanceId,
+// callbackHost and conditionType
+func HTTPListSubscriptions(c *gin.Context) {
+	logger.ManagementLog.Infoln("Handle Get /nrf-oam/v1/subscriptions")
+	req := httpwrapper.NewRequest(c.Request, nil)
+
+	httpResponse := producer.HandleListSubscriptionsRequest(c.Request.Context(), req)
+	writeResponse(c, httpResponse)
+}
+
+// Get /subscriptions/:subscriptionID
+// Reads a subscription
+func HTTPGetSubscription(c *gin.Context) {
+	logger.ManagementLog.Infoln("Handle Get /nrf-oam/v1/subscriptions/:subscriptionID")
+	req := httpwrapper.NewRequest(c.Request, nil)
+	req.Params["subscriptionID"] = c.Params.ByName("subscriptionID")
+
+	httpResponse := producer.HandleGetSubscriptionRequest(c.Request.Context(), req)
+	writeResponse(c, httpResponse)
+}
+
+func writeResponse(c *gin.Context, httpResponse *httpwrapper.Response) {
+	responseBody, err := openapi.SetBody(httpResponse.Body, contentTypeJSON)
+	if err != nil {
+		logger.ManagementLog.Warnln(err)
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		c.JSON(http.StatusInternalServerError, problemDetails)
+		return
+	}
+	c.Data(httpResponse.Status, contentTypeJSON, responseBody.Bytes())
+}
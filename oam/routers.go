@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package oam serves the read-only operator API of the NRF.
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/nrf/logger"
+	utilLogger "github.com/omec-project/util/logger"
+)
+
+// Route is the information for every URI.
+type Route struct {
+	// Name is the name of this Route.
+	Name string
+	// Method is the string for the HTTP method (e.g., GET, POST, etc.)
+	Method string
+	// Pattern is the pattern of the URI.
+	Pattern string
+	// HandlerFunc is the handler function of this route.
+	HandlerFunc gin.HandlerFunc
+}
+
+const contentTypeJSON = "application/json"
+
+// ReadinessPath is the readiness probe, answered even when the NRF is not
+// ready to serve requests.
+const ReadinessPath = "/nrf-oam/v1/readiness"
+
+// NewRouter returns a new router.
+func NewRouter() *gin.Engine {
+	router := utilLogger.NewGinWithZap(logger.GinLog)
+	AddService(router)
+	return router
+}
+
+// AddService adds routes to an existing gin engine. The operator API is
+// meant for an engine serving operators only, not the SBI.
+func AddService(engine *gin.Engine) *gin.RouterGroup {
+	group := engine.Group("/nrf-oam/v1")
+	for _, route := range getRoutes() {
+		switch route.Method {
+		case http.MethodGet:
+			group.GET(route.Pattern, route.HandlerFunc)
+		}
+	}
+	return group
+}
+
+// AddReadinessService adds only the readiness probe to an existing gin
+// engine, such as the one serving the SBI.
+func AddReadinessService(engine *gin.Engine) {
+	engine.GET(ReadinessPath, HTTPGetReadiness)
+}
+
+func getRoutes() []Route {
+	return []Route{
+		{
+			"ListSubscriptions",
+			http.MethodGet,
+			"/subscriptions",
+			HTTPListSubscriptions,
+		},
+		{
+			"GetSubscription",
+			http.MethodGet,
+			"/subscriptions/:subscriptionID",
+			HTTPGetSubscription,
+		},
+		{
+			"ListNfHistory",
+			http.MethodGet,
+			"/nf-history",
+			HTTPListNfHistory,
+		},
+		{
+			"GetNfInstanceHistory",
+			http.MethodGet,
+			"/nf-history/:nfInstanceID",
+			HTTPGetNfInstanceHistory,
+		},
+		{
+			"GetIndexUsage",
+			http.MethodGet,
+			"/indexes",
+			HTTPGetIndexUsage,
+		},
+		{
+			"GetReadiness",
+			http.MethodGet,
+			"/readiness",
+			HTTPGetReadiness,
+		},
+	}
+}
@@ -7,18 +7,19 @@
 package producer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/big"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-viper/mapstructure/v2"
-	"github.com/omec-project/nrf/context"
+	nrfContext "github.com/omec-project/nrf/context"
 	"github.com/omec-project/nrf/dbadapter"
 	"github.com/omec-project/nrf/factory"
 	"github.com/omec-project/nrf/logger"
@@ -67,6 +68,9 @@ const (
 	queryParamSupportedFeatures       = "supported-features"
 	queryParamRequesterNfInstanceFqdn = "requester-nfinstance-fqdn"
 	queryParamTargetNfInstanceID      = "target-nf-instanceid"
+	queryParamNotificationType        = "default-notification-type"
+	queryParamN1MessageClass          = "n1-message-class"
+	queryParamN2InformationClass      = "n2-information-class"
 )
 
 // rawExpireAtToTime converts an expireAt value from a raw MongoDB document to
@@ -318,11 +322,11 @@ func buildSnssaisElemMatchFilters(raw string) []bson.M {
 	return filters
 }
 
-func HandleNFDiscoveryRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleNFDiscoveryRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	// Get all query parameters
 	logger.DiscoveryLog.Infoln("Handle NFDiscoveryRequest")
 
-	response, problemDetails := NFDiscoveryProcedure(request.Query)
+	response, problemDetails := NFDiscoveryProcedure(ctx, request.Query)
 	requesterNfType, targetNfType := GetRequesterAndTargetNfTypeGivenQueryParameters(request.Query)
 	// Send Response
 	// step 4: process the return value from step 3
@@ -339,7 +343,7 @@ func HandleNFDiscoveryRequest(request *httpwrapper.Request) *httpwrapper.Respons
 	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 }
 
-func NFDiscoveryProcedure(queryParameters url.Values) (response *models.SearchResult,
+func NFDiscoveryProcedure(ctx context.Context, queryParameters url.Values) (response *models.SearchResult,
 	problemDetails *models.ProblemDetails,
 ) {
 	queryParameters = normalizeDiscoveryQueryParameters(queryParameters)
@@ -352,6 +356,9 @@ func NFDiscoveryProcedure(queryParameters url.Values) (response *models.SearchRe
 	if problem := validateComplexQuery(queryParameters); problem != nil {
 		return nil, problem
 	}
+	if _, problem := defaultNotificationQuery(queryParameters); problem != nil {
+		return nil, problem
+	}
 
 	// Check ComplexQuery (FOR REPORT PROBLEM!)
 
@@ -360,16 +367,18 @@ func NFDiscoveryProcedure(queryParameters url.Values) (response *models.SearchRe
 	logger.DiscoveryLog.Debugln("query filter:", filter)
 
 	// Use the filter to find documents
-	nfProfilesRaw, err := dbadapter.DBClient.RestfulAPIGetMany("NfProfile", filter)
+	nfProfilesRaw, err := dbadapter.GetMany(ctx, "NfProfile", filter)
 	if err != nil {
 		logger.DiscoveryLog.Warnln("NF profile query error:", err)
+		return nil, storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
 	}
 	logger.DiscoveryLog.Debugf("primary discovery raw count: %d", len(nfProfilesRaw))
 
 	// sort nfprofiles based on expiry timestamp before decoding so that the
 	// ordering is reflected in the returned SearchResult.
 	// Sort profiles
-	nfProfilesStruct := sortNFProfiles(nfProfilesRaw, queryParameters)
+	nfProfilesStruct := sortNFProfiles(ctx, nfProfilesRaw, queryParameters)
 
 	// Handle IPv4 & IPv6 conversion for BSF profiles
 	handleBSFIpConversion(queryParameters, nfProfilesStruct)
@@ -403,6 +412,7 @@ func validateComplexQuery(queryParameters url.Values) *models.ProblemDetails {
 }
 
 func sortNFProfiles(
+	ctx context.Context,
 	nfProfilesRaw []map[string]interface{},
 	queryParameters url.Values,
 ) []models.NFProfileDiscovery {
@@ -437,7 +447,7 @@ func sortNFProfiles(
 	}
 
 	if len(nfProfilesStruct) == 0 {
-		allProfiles, fallbackErr := loadDiscoveryProfilesFromURIList(queryParameters)
+		allProfiles, fallbackErr := loadDiscoveryProfilesByNfType(ctx, queryParameters)
 		if fallbackErr != nil {
 			logger.DiscoveryLog.Warnln("fallback discovery load error:", fallbackErr)
 		} else {
@@ -465,12 +475,12 @@ func handleBSFIpConversion(
 					if err != nil {
 						logger.DiscoveryLog.Warnln("ipv4IntStart Atoi Error:", err)
 					}
-					(((*nfProfilesStruct[i].BsfInfo).Ipv4AddressRanges)[j]).Start = context.Ipv4IntToIpv4String(int64(ipv4IntStart))
+					(((*nfProfilesStruct[i].BsfInfo).Ipv4AddressRanges)[j]).Start = nrfContext.Ipv4IntToIpv4String(int64(ipv4IntStart))
 					ipv4IntEnd, err := strconv.Atoi(ipv4AddressRange.GetEnd())
 					if err != nil {
 						logger.DiscoveryLog.Warnln("ipv4IntEnd Atoi Error:", err)
 					}
-					(((*nfProfilesStruct[i].BsfInfo).Ipv4AddressRanges)[j]).End = context.Ipv4IntToIpv4String(int64(ipv4IntEnd))
+					(((*nfProfilesStruct[i].BsfInfo).Ipv4AddressRanges)[j]).End = nrfContext.Ipv4IntToIpv4String(int64(ipv4IntEnd))
 				}
 			}
 			ipv6PrefixRanges, ok := nfProfile.BsfInfo.GetIpv6PrefixRangesOk()
@@ -478,59 +488,44 @@ func handleBSFIpConversion(
 				for j, ipv6PrefixRange := range ipv6PrefixRanges {
 					ipv6IntStart := new(big.Int)
 					ipv6IntStart.SetString(ipv6PrefixRange.GetStart(), 10)
-					(((*nfProfilesStruct[i].BsfInfo).Ipv6PrefixRanges)[j]).Start = context.Ipv6IntToIpv6String(ipv6IntStart)
+					(((*nfProfilesStruct[i].BsfInfo).Ipv6PrefixRanges)[j]).Start = nrfContext.Ipv6IntToIpv6String(ipv6IntStart)
 
 					ipv6IntEnd := new(big.Int)
 					ipv6IntEnd.SetString(ipv6PrefixRange.GetEnd(), 10)
-					(((*nfProfilesStruct[i].BsfInfo).Ipv6PrefixRanges)[j]).End = context.Ipv6IntToIpv6String(ipv6IntEnd)
+					(((*nfProfilesStruct[i].BsfInfo).Ipv6PrefixRanges)[j]).End = nrfContext.Ipv6IntToIpv6String(ipv6IntEnd)
 				}
 			}
 		}
 	}
 }
 
-func loadDiscoveryProfilesFromURIList(queryParameters url.Values) ([]models.NFProfileDiscovery, error) {
+// loadDiscoveryProfilesByNfType loads every registered profile of the target
+// NF type so that the discovery query can be evaluated in memory. Only the
+// instance IDs are listed from MongoDB: cached profiles are served from the
+// cache and the others fetched and cached.
+func loadDiscoveryProfilesByNfType(ctx context.Context, queryParameters url.Values) ([]models.NFProfileDiscovery, error) {
 	targetNfType := queryParameters[queryParamTargetNFType][0]
-	uriListRaw, err := dbadapter.DBClient.RestfulAPIGetOne("urilist", bson.M{"nfType": targetNfType})
-	if err != nil {
-		return nil, err
-	}
-	if uriListRaw == nil {
-		return nil, nil
-	}
-
-	uriList := &context.UriList{}
-	err = mapstructure.Decode(uriListRaw, uriList)
+	idsRaw, err := dbadapter.GetManyFields(ctx, "NfProfile", bson.M{"nftype": targetNfType}, []string{"nfinstanceid"})
 	if err != nil {
 		return nil, err
 	}
 
-	logger.DiscoveryLog.Debugf("fallback urilist count: %d", len(uriList.Link.Item))
+	logger.DiscoveryLog.Debugf("fallback profile count: %d", len(idsRaw))
 
-	orderedInstanceIDs := make([]string, 0, len(uriList.Link.Item))
-	uniqueInstanceIDs := make([]string, 0, len(uriList.Link.Item))
-	seenInstanceIDs := make(map[string]struct{}, len(uriList.Link.Item))
-	for _, item := range uriList.Link.Item {
-		nfInstanceID := getNFInstanceIDFromURI(item.GetHref())
-		if nfInstanceID == "" {
-			continue
-		}
-		orderedInstanceIDs = append(orderedInstanceIDs, nfInstanceID)
-		if _, seen := seenInstanceIDs[nfInstanceID]; seen {
-			continue
+	instanceIDs := make([]string, 0, len(idsRaw))
+	for _, idRaw := range idsRaw {
+		if nfInstanceID, ok := idRaw["nfinstanceid"].(string); ok && nfInstanceID != "" {
+			instanceIDs = append(instanceIDs, nfInstanceID)
 		}
-		seenInstanceIDs[nfInstanceID] = struct{}{}
-		uniqueInstanceIDs = append(uniqueInstanceIDs, nfInstanceID)
 	}
-
-	if len(uniqueInstanceIDs) == 0 {
+	if len(instanceIDs) == 0 {
 		return nil, nil
 	}
 
 	// Serve cached profiles; only fetch the remainder from MongoDB.
-	decodedByID := make(map[string]models.NFProfileDiscovery, len(uniqueInstanceIDs))
-	uncachedIDs := make([]string, 0, len(uniqueInstanceIDs))
-	for _, id := range uniqueInstanceIDs {
+	decodedByID := make(map[string]models.NFProfileDiscovery, len(instanceIDs))
+	uncachedIDs := make([]string, 0, len(instanceIDs))
+	for _, id := range instanceIDs {
 		if p, ok := profileCache.get(id); ok {
 			decodedByID[id] = p
 		} else {
@@ -539,74 +534,70 @@ func loadDiscoveryProfilesFromURIList(queryParameters url.Values) ([]models.NFPr
 	}
 
 	if len(uncachedIDs) > 0 {
-		profileListRaw, dbErr := dbadapter.DBClient.RestfulAPIGetMany("NfProfile", bson.M{
+		profileListRaw, dbErr := dbadapter.GetMany(ctx, "NfProfile", bson.M{
 			"nfinstanceid": bson.M{"$in": uncachedIDs},
 		})
 		if dbErr != nil {
 			return nil, dbErr
 		}
-
-		profilesByInstanceID := make(map[string]map[string]interface{}, len(profileListRaw))
+		rawBatch := make([]any, 0, len(profileListRaw))
 		for _, profileRaw := range profileListRaw {
-			if profileRaw == nil {
-				continue
-			}
-			if nfInstanceID, ok := profileRaw["nfinstanceid"].(string); ok && nfInstanceID != "" {
-				profilesByInstanceID[nfInstanceID] = profileRaw
-			}
-		}
-
-		// Batch-decode all uncached profiles in a single util.Decode call.
-		rawBatch := make([]any, 0, len(uncachedIDs))
-		for _, nfInstanceID := range uncachedIDs {
-			if profileRaw := profilesByInstanceID[nfInstanceID]; profileRaw != nil {
+			if profileRaw != nil {
 				rawBatch = append(rawBatch, profileRaw)
 			}
 		}
-
-		if len(rawBatch) > 0 {
-			decoded, decodeErr := util.Decode(rawBatch, time.RFC3339)
-			if decodeErr != nil {
-				// Fall back to per-document decode so one malformed entry doesn't
-				// discard the entire batch (mirrors the original per-profile loop).
-				logger.DiscoveryLog.Warnf("fallback profile batch decode error, retrying per-profile: %v", decodeErr)
-				for _, raw := range rawBatch {
-					rawDoc, _ := raw.(map[string]any)
-					single, sErr := util.Decode([]any{raw}, time.RFC3339)
-					if sErr != nil {
-						logger.DiscoveryLog.Warnf("fallback profile decode error: %v", sErr)
-						continue
-					}
-					if len(single) == 0 || single[0].GetNfInstanceId() == "" {
-						continue
-					}
-					p := single[0]
-					decodedByID[p.GetNfInstanceId()] = p
-					cacheProfileWithExpiry(p, rawDoc)
-				}
-			} else {
-				for i, p := range decoded {
-					if p.GetNfInstanceId() == "" {
-						continue
-					}
-					decodedByID[p.GetNfInstanceId()] = p
-					rawDoc, _ := rawBatch[i].(map[string]any)
-					cacheProfileWithExpiry(p, rawDoc)
-				}
-			}
+		for _, p := range decodeDiscoveryProfiles(rawBatch) {
+			decodedByID[p.GetNfInstanceId()] = p
 		}
 	}
 
-	profiles := make([]models.NFProfileDiscovery, 0, len(orderedInstanceIDs))
-	for _, nfInstanceID := range orderedInstanceIDs {
+	profiles := make([]models.NFProfileDiscovery, 0, len(instanceIDs))
+	for _, nfInstanceID := range instanceIDs {
 		if p, ok := decodedByID[nfInstanceID]; ok {
 			profiles = append(profiles, p)
 		}
 	}
-
 	return profiles, nil
 }
 
+// decodeDiscoveryProfiles decodes and caches the stored profiles rawBatch,
+// leaving out those which cannot be decoded.
+func decodeDiscoveryProfiles(rawBatch []any) []models.NFProfileDiscovery {
+	if len(rawBatch) == 0 {
+		return nil
+	}
+	profiles := make([]models.NFProfileDiscovery, 0, len(rawBatch))
+	decoded, decodeErr := util.Decode(rawBatch, time.RFC3339)
+	if decodeErr != nil {
+		// Fall back to per-document decode so one malformed entry doesn't
+		// discard the entire batch.
+		logger.DiscoveryLog.Warnf("fallback profile batch decode error, retrying per-profile: %v", decodeErr)
+		for _, raw := range rawBatch {
+			rawDoc, _ := raw.(map[string]any)
+			single, sErr := util.Decode([]any{raw}, time.RFC3339)
+			if sErr != nil {
+				logger.DiscoveryLog.Warnf("fallback profile decode error: %v", sErr)
+				continue
+			}
+			if len(single) == 0 || single[0].GetNfInstanceId() == "" {
+				continue
+			}
+			profiles = append(profiles, single[0])
+			cacheProfileWithExpiry(single[0], rawDoc)
+		}
+		return profiles
+	}
+	for i, p := range decoded {
+		if p.GetNfInstanceId() == "" {
+			continue
+		}
+		profiles = append(profiles, p)
+		rawDoc, _ := rawBatch[i].(map[string]any)
+		cacheProfileWithExpiry(p, rawDoc)
+	}
+	return profiles
+}
+
 // cacheProfileWithExpiry stores p in the profile cache, deriving TTL from the
 // raw document's expireAt field or the NRF keep-alive configuration.
 func cacheProfileWithExpiry(p models.NFProfileDiscovery, rawDoc map[string]any) {
@@ -626,14 +617,6 @@ func cacheProfileWithExpiry(p models.NFProfileDiscovery, rawDoc map[string]any)
 	profileCache.set(p, expiresAt)
 }
 
-func getNFInstanceIDFromURI(uri string) string {
-	idx := strings.LastIndex(uri, "/")
-	if idx == -1 || idx == len(uri)-1 {
-		return ""
-	}
-	return uri[idx+1:]
-}
-
 func filterDiscoveryResults(nfProfiles []models.NFProfileDiscovery, queryParameters url.Values) []models.NFProfileDiscovery {
 	filtered := make([]models.NFProfileDiscovery, 0, len(nfProfiles))
 	for _, profile := range nfProfiles {
@@ -695,6 +678,18 @@ func matchesDiscoveryQuery(profile models.NFProfileDiscovery, queryParameters ur
 		}
 	}
 
+	if query, _ := defaultNotificationQuery(queryParameters); query != nil {
+		subscriptions := profile.GetDefaultNotificationSubscriptions()
+		for _, service := range profile.NfServices {
+			subscriptions = append(subscriptions, service.GetDefaultNotificationSubscriptions()...)
+		}
+		if !slices.ContainsFunc(subscriptions, func(subscription models.DefaultNotificationSubscription) bool {
+			return matchesDefaultNotificationQuery(subscription, query)
+		}) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -741,6 +736,7 @@ func buildFilter(queryParameters url.Values) bson.M {
 	handlePreferredLocality(queryParameters, filter)
 	handleAccessType(queryParameters, filter)
 	handleSupportedFeatures(queryParameters, filter)
+	handleDefaultNotificationSubscriptions(queryParameters, filter)
 	handleComplexQuery(queryParameters, filter)
 
 	return filter
@@ -1283,7 +1279,7 @@ func handleUeIpv4(queryParameters url.Values, filter bson.M, targetNfType string
 		var ueIpv4AddressFilter bson.M
 		if targetNfType == "BSF" {
 			ueIpv4Address := queryParameters[queryParamUeIpv4Address][0]
-			ueIpv4AddressNumber := context.Ipv4ToInt(ueIpv4Address)
+			ueIpv4AddressNumber := nrfContext.Ipv4ToInt(ueIpv4Address)
 			ueIpv4AddressFilter = bson.M{
 				"$or": []bson.M{
 					{
@@ -1339,7 +1335,7 @@ func handleUeIpv6Prefix(queryParameters url.Values, filter bson.M, targetNfType
 		var ueIpv6PrefixFilter bson.M
 		if targetNfType == "BSF" {
 			ueIpv6Prefix := queryParameters[queryParamUeIpv6Prefix][0]
-			ueIpv6PrefixNumber := context.Ipv6ToInt(ueIpv6Prefix)
+			ueIpv6PrefixNumber := nrfContext.Ipv6ToInt(ueIpv6Prefix)
 			ueIpv6PrefixFilter = bson.M{
 				"$or": []bson.M{
 					{
@@ -1492,7 +1488,7 @@ func handleExternalGroupIdentity(queryParameters url.Values, filter bson.M, targ
 		var externalGroupIdentityFilter bson.M
 		externalGroupIdentity := queryParameters[queryParamExternalGroupIdentity][0]
 
-		encodedGroupId := context.EncodeGroupId(externalGroupIdentity)
+		encodedGroupId := nrfContext.EncodeGroupId(externalGroupIdentity)
 		switch targetNfType {
 		case "UDM":
 			externalGroupIdentityFilter = bson.M{
@@ -1786,6 +1782,87 @@ func handleSupportedFeatures(queryParameters url.Values, filter bson.M) {
 	}
 }
 
+// defaultNotificationQuery returns the defaultNotificationSubscriptions entry
+// requested by the default-notification-type, n1-message-class and
+// n2-information-class parameters, as stored attributes, or nil when none is
+// given. A message or information class implies its notification type.
+func defaultNotificationQuery(queryParameters url.Values) (bson.M, *models.ProblemDetails) {
+	notificationType := queryParameters.Get(queryParamNotificationType)
+	n1MessageClass := queryParameters.Get(queryParamN1MessageClass)
+	n2InformationClass := queryParameters.Get(queryParamN2InformationClass)
+	invalid := func(param, reason string) (bson.M, *models.ProblemDetails) {
+		problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", http.StatusBadRequest, reason, utils.CauseInvalidRequest)
+		invalidParam := models.InvalidParam{Param: param}
+		invalidParam.SetReason(reason)
+		problemDetails.SetInvalidParams([]models.InvalidParam{invalidParam})
+		return nil, problemDetails
+	}
+
+	query := bson.M{}
+	if n1MessageClass != "" {
+		if !slices.Contains(nrfContext.N1MessageClasses, n1MessageClass) {
+			return invalid(queryParamN1MessageClass, "unknown n1MessageClass "+n1MessageClass)
+		}
+		if notificationType != "" && notificationType != nrfContext.NotificationTypeN1Messages {
+			return invalid(queryParamN1MessageClass, "only applies to "+nrfContext.NotificationTypeN1Messages)
+		}
+		notificationType = nrfContext.NotificationTypeN1Messages
+		query["n1messageclass"] = n1MessageClass
+	}
+	if n2InformationClass != "" {
+		if !slices.Contains(nrfContext.N2InformationClasses, n2InformationClass) {
+			return invalid(queryParamN2InformationClass, "unknown n2InformationClass "+n2InformationClass)
+		}
+		if notificationType != "" && notificationType != nrfContext.NotificationTypeN2Information {
+			return invalid(queryParamN2InformationClass, "only applies to "+nrfContext.NotificationTypeN2Information)
+		}
+		notificationType = nrfContext.NotificationTypeN2Information
+		query["n2informationclass"] = n2InformationClass
+	}
+	if notificationType == "" {
+		return nil, nil
+	}
+	query["notificationtype"] = notificationType
+	return query, nil
+}
+
+func matchesDefaultNotificationQuery(subscription models.DefaultNotificationSubscription, query bson.M) bool {
+	if string(subscription.GetNotificationType()) != query["notificationtype"] {
+		return false
+	}
+	if n1MessageClass, ok := query["n1messageclass"]; ok && string(subscription.GetN1MessageClass()) != n1MessageClass {
+		return false
+	}
+	if n2InformationClass, ok := query["n2informationclass"]; ok && string(subscription.GetN2InformationClass()) != n2InformationClass {
+		return false
+	}
+	return true
+}
+
+func handleDefaultNotificationSubscriptions(queryParameters url.Values, filter bson.M) {
+	// default-notification-type, n1-message-class and n2-information-class:
+	// the NF or one of its services has a matching default callback
+	query, _ := defaultNotificationQuery(queryParameters)
+	if query == nil {
+		return
+	}
+	defaultNotificationFilter := bson.M{
+		"$or": []bson.M{
+			{
+				"defaultnotificationsubscriptions": bson.M{mongoOpElemMatch: query},
+			},
+			{
+				"nfservices": bson.M{
+					mongoOpElemMatch: bson.M{
+						"defaultnotificationsubscriptions": bson.M{mongoOpElemMatch: query},
+					},
+				},
+			},
+		},
+	}
+	filter["$and"] = append(filter["$and"].([]bson.M), defaultNotificationFilter)
+}
+
 func handleComplexQuery(queryParameters url.Values, filter bson.M) {
 	// [Query-35] complexQuery
 	if queryParameters["complexQuery"] != nil {
@@ -2480,7 +2557,7 @@ func addIpv4Filter(queryParameters map[string]*AtomElem, filter bson.M, logicalO
 		var ueIpv4AddressFilter bson.M
 		if targetNfType == "BSF" {
 			ueIpv4Address := queryParameters[queryParamUeIpv4Address].value
-			ueIpv4AddressNumber := context.Ipv4ToInt(ueIpv4Address)
+			ueIpv4AddressNumber := nrfContext.Ipv4ToInt(ueIpv4Address)
 			ueIpv4AddressFilter = bson.M{
 				"bsfinfo": bson.M{
 					mongoOpElemMatch: bson.M{
@@ -2536,7 +2613,7 @@ func addIpv6PrefixFilter(queryParameters map[string]*AtomElem, filter bson.M, lo
 		var ueIpv6PrefixFilter bson.M
 		if targetNfType == "BSF" {
 			ueIpv6Prefix := queryParameters[queryParamUeIpv6Prefix].value
-			ueIpv6PrefixNumber := context.Ipv6ToInt(ueIpv6Prefix)
+			ueIpv6PrefixNumber := nrfContext.Ipv6ToInt(ueIpv6Prefix)
 			ueIpv6PrefixFilter = bson.M{
 				"bsfinfo": bson.M{
 					mongoOpElemMatch: bson.M{
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/util/mongoapi"
+)
+
+// benchmarkProfiles is how many NF profiles the discovery benchmark stores.
+const benchmarkProfiles = 5000
+
+// BenchmarkDiscoveryIndexes runs discovery queries on thousands of profiles
+// stored in MongoDB, first without the indexes of dbadapter.Indexes, then
+// with them. It needs a MongoDB server, at the URL in NRF_TEST_MONGODB_URL:
+//
+//	NRF_TEST_MONGODB_URL=mongodb://127.0.0.1:27017 go test -run '^$' -bench DiscoveryIndexes ./producer
+func BenchmarkDiscoveryIndexes(b *testing.B) {
+	mongoURL := os.Getenv("NRF_TEST_MONGODB_URL")
+	if mongoURL == "" {
+		b.Skip("NRF_TEST_MONGODB_URL is not set")
+	}
+	dbName := "nrf-bench-" + uuid.NewString()[:8]
+	client, err := mongoapi.NewMongoClient(mongoURL, dbName)
+	if err != nil {
+		b.Fatalf("failed to connect to MongoDB: %v", err)
+	}
+	defer func() {
+		if err := client.Client.Database(dbName).Drop(context.TODO()); err != nil {
+			b.Logf("failed to drop database %s: %v", dbName, err)
+		}
+		client.Client.Disconnect(context.TODO())
+	}()
+
+	nfTypes := []string{"AMF", "SMF", "UPF", "AUSF", "UDM"}
+	profiles := make([]interface{}, 0, benchmarkProfiles)
+	for i := range benchmarkProfiles {
+		nfType := nfTypes[i%len(nfTypes)]
+		snssai := map[string]interface{}{"sst": 1, "sd": fmt.Sprintf("%06x", i%64)}
+		profile := map[string]interface{}{
+			"nfinstanceid":               fmt.Sprintf("%s-%d", nfType, i),
+			"nftype":                     nfType,
+			"nfstatus":                   "REGISTERED",
+			"snssais":                    []interface{}{snssai},
+			dbadapter.SchemaVersionField: dbadapter.NfProfileSchemaVersion,
+		}
+		switch nfType {
+		case "SMF":
+			profile["smfinfo"] = map[string]interface{}{
+				"snssaismfinfolist": []interface{}{map[string]interface{}{
+					"snssai":         snssai,
+					"dnnsmfinfolist": []interface{}{map[string]interface{}{"dnn": fmt.Sprintf("dnn%d", i%100)}},
+				}},
+			}
+		case "AMF":
+			profile["amfinfo"] = map[string]interface{}{"amfsetid": fmt.Sprintf("%03x", i%1024), "amfregionid": "ca"}
+		}
+		profiles = append(profiles, profile)
+	}
+	if _, err := client.GetCollection("NfProfile").InsertMany(context.TODO(), profiles); err != nil {
+		b.Fatalf("failed to store profiles: %v", err)
+	}
+
+	db := dbadapter.NewMongoDBClient(client)
+	queries := []url.Values{
+		{queryParamTargetNFType: {"SMF"}, queryParamRequesterNFType: {"AMF"}, "dnn": {"dnn42"}},
+		{queryParamTargetNFType: {"AMF"}, queryParamRequesterNFType: {"SMF"}, "snssais": {`{"sst":1,"sd":"00002a"}`}},
+		{queryParamTargetNFType: {"UDM"}, queryParamRequesterNFType: {"AUSF"}, "target-nf-instance-id": {"UDM-4244"}},
+	}
+	discover := func(b *testing.B) {
+		for b.Loop() {
+			for _, query := range queries {
+				if _, err := db.RestfulAPIGetMany("NfProfile", buildFilter(query)); err != nil {
+					b.Fatalf("discovery failed: %v", err)
+				}
+			}
+		}
+	}
+	b.Run("without indexes", discover)
+	if err := db.EnsureIndexes(); err != nil {
+		b.Fatalf("failed to create indexes: %v", err)
+	}
+	b.Run("with indexes", discover)
+
+	usage, err := db.IndexUsage()
+	if err != nil {
+		b.Fatalf("failed to read index usage: %v", err)
+	}
+	for _, index := range usage {
+		b.Logf("%s %s: %d ops", index.Collection, index.Name, index.Ops)
+	}
+}
@@ -7,7 +7,13 @@
 package producer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
 	"testing"
 	"time"
 
@@ -27,15 +33,6 @@ type mockBSFDiscoveryDBClient struct {
 
 func (db *mockDiscoveryDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
 	switch collName {
-	case "urilist":
-		return map[string]interface{}{
-			"nfType": "UDM",
-			"_link": map[string]interface{}{
-				"item": []map[string]interface{}{{
-					"href": "https://nrf:29510/nnrf-nfm/v1/nf-instances/udm-1",
-				}},
-			},
-		}, nil
 	case "NfProfile":
 		if filter["nfinstanceid"] == "udm-1" {
 			return map[string]interface{}{
@@ -203,7 +200,7 @@ func TestBuildFilterMatchesFullSmfDnn(t *testing.T) {
 	}
 }
 
-func TestLoadDiscoveryProfilesFromURIList(t *testing.T) {
+func TestLoadDiscoveryProfilesByNfType(t *testing.T) {
 	originalDBClient := dbadapter.DBClient
 	dbadapter.DBClient = &mockDiscoveryDBClient{}
 	defer func() {
@@ -214,7 +211,7 @@ func TestLoadDiscoveryProfilesFromURIList(t *testing.T) {
 	query.Set("target-nf-type", "UDM")
 	query.Set("requester-nf-type", "AMF")
 
-	profiles, err := loadDiscoveryProfilesFromURIList(query)
+	profiles, err := loadDiscoveryProfilesByNfType(context.Background(), query)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -241,7 +238,7 @@ func TestNFDiscoveryProcedureHandlesBSFProfileWithoutBsfInfo(t *testing.T) {
 
 	dbadapter.DBClient = &mockBSFDiscoveryDBClient{}
 
-	response, problemDetails := NFDiscoveryProcedure(query)
+	response, problemDetails := NFDiscoveryProcedure(context.Background(), query)
 	if problemDetails != nil {
 		t.Fatalf("unexpected problem details: %+v", problemDetails)
 	}
@@ -623,7 +620,7 @@ func TestNFDiscoveryProcedureSortsProfilesByExpireAt(t *testing.T) {
 	query.Set("target-nf-type", "AMF")
 	query.Set("requester-nf-type", "SMF")
 
-	response, problemDetails := NFDiscoveryProcedure(query)
+	response, problemDetails := NFDiscoveryProcedure(context.Background(), query)
 	if problemDetails != nil {
 		t.Fatalf("unexpected problem details: %+v", problemDetails)
 	}
@@ -675,7 +672,7 @@ func TestNFDiscoveryProcedureSortsMixedExpireAtTypesAndMissing(t *testing.T) {
 	query.Set("target-nf-type", "AMF")
 	query.Set("requester-nf-type", "SMF")
 
-	response, problemDetails := NFDiscoveryProcedure(query)
+	response, problemDetails := NFDiscoveryProcedure(context.Background(), query)
 	if problemDetails != nil {
 		t.Fatalf("unexpected problem details: %+v", problemDetails)
 	}
@@ -736,42 +733,69 @@ func TestProfileCacheGetDeletesExpiredEntryOnRead(t *testing.T) {
 	}
 }
 
-// mockCacheTestDBClient returns no NfProfile results to verify the cache path.
-type mockCacheTestDBClient struct {
-	dbadapter.DBInterface
-	getManyCalled bool
-}
+func TestLoadDiscoveryProfilesByNfTypePopulatesCache(t *testing.T) {
+	const testID = "udm-1"
+	profileCache.evict(testID)
+	defer profileCache.evict(testID)
 
-func (db *mockCacheTestDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
-	if collName == "urilist" {
-		return map[string]interface{}{
-			"nfType": "AMF",
-			"_link": map[string]interface{}{
-				"item": []map[string]interface{}{{
-					"href": "https://nrf:29510/nnrf-nfm/v1/nf-instances/amf-cached",
-				}},
-			},
-		}, nil
+	originalDBClient := dbadapter.DBClient
+	dbadapter.DBClient = &mockDiscoveryDBClient{}
+	defer func() { dbadapter.DBClient = originalDBClient }()
+
+	query := url.Values{}
+	query.Set("target-nf-type", "UDM")
+	query.Set("requester-nf-type", "AMF")
+
+	if _, err := loadDiscoveryProfilesByNfType(context.Background(), query); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p, ok := profileCache.get(testID)
+	if !ok {
+		t.Fatal("expected fallback profile to be cached")
+	}
+	if p.NfType != models.NFTYPE_UDM {
+		t.Fatalf("unexpected cached profile type: %s", p.NfType)
 	}
-	return nil, nil
 }
 
-func (db *mockCacheTestDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
-	db.getManyCalled = true
-	return nil, nil
+// mockCacheTestDBClient lists one cached and one uncached AMF profile, and
+// records the profiles fetched by instance ID.
+type mockCacheTestDBClient struct {
+	dbadapter.DBInterface
+	fetched []string
 }
 
-func TestLoadDiscoveryProfilesFromURIListServesFromCache(t *testing.T) {
-	const testID = "amf-cached"
-	profileCache.evict(testID)
-	defer profileCache.evict(testID)
+func (db *mockCacheTestDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	profiles := []map[string]interface{}{
+		{"nfinstanceid": "amf-cached", "nftype": "AMF", "nfstatus": "REGISTERED"},
+		{"nfinstanceid": "amf-stored", "nftype": "AMF", "nfstatus": "REGISTERED"},
+	}
+	condition, ok := filter["nfinstanceid"].(bson.M)
+	if !ok {
+		return profiles, nil
+	}
+	ids, _ := condition["$in"].([]string)
+	db.fetched = append(db.fetched, ids...)
+	var matching []map[string]interface{}
+	for _, profile := range profiles {
+		if slices.Contains(ids, profile["nfinstanceid"].(string)) {
+			matching = append(matching, profile)
+		}
+	}
+	return matching, nil
+}
 
-	p := models.NFProfileDiscovery{
-		NfInstanceId: testID,
+func TestLoadDiscoveryProfilesByNfTypeServesFromCache(t *testing.T) {
+	for _, id := range []string{"amf-cached", "amf-stored"} {
+		profileCache.evict(id)
+		defer profileCache.evict(id)
+	}
+	profileCache.set(models.NFProfileDiscovery{
+		NfInstanceId: "amf-cached",
 		NfType:       models.NFTYPE_AMF,
 		NfStatus:     models.NFSTATUS_REGISTERED,
-	}
-	profileCache.set(p, time.Now().Add(60*time.Second))
+		Priority:     openapi.PtrInt32(7),
+	}, time.Now().Add(60*time.Second))
 
 	mockDB := &mockCacheTestDBClient{}
 	originalDBClient := dbadapter.DBClient
@@ -782,18 +806,29 @@ func TestLoadDiscoveryProfilesFromURIListServesFromCache(t *testing.T) {
 	query.Set("target-nf-type", "AMF")
 	query.Set("requester-nf-type", "SMF")
 
-	profiles, err := loadDiscoveryProfilesFromURIList(query)
+	profiles, err := loadDiscoveryProfilesByNfType(context.Background(), query)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(profiles) != 1 {
-		t.Fatalf("expected 1 cached profile, got %d", len(profiles))
+	if len(profiles) != 2 || profiles[0].NfInstanceId != "amf-cached" || profiles[1].NfInstanceId != "amf-stored" {
+		t.Fatalf("expected the cached and the stored profiles, got %+v", profiles)
 	}
-	if profiles[0].NfInstanceId != testID {
-		t.Fatalf("unexpected profile id: %s", profiles[0].NfInstanceId)
+	if profiles[0].GetPriority() != 7 {
+		t.Error("expected the cached profile to be served from the cache")
+	}
+	if !slices.Equal(mockDB.fetched, []string{"amf-stored"}) {
+		t.Errorf("expected only the uncached profile to be fetched, got %v", mockDB.fetched)
 	}
-	if mockDB.getManyCalled {
-		t.Fatal("expected DB not to be queried when all profiles are cached")
+	if _, ok := profileCache.get("amf-stored"); !ok {
+		t.Error("expected the fetched profile to be cached")
+	}
+
+	mockDB.fetched = nil
+	if _, err := loadDiscoveryProfilesByNfType(context.Background(), query); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mockDB.fetched) != 0 {
+		t.Errorf("expected no profile to be fetched once all are cached, got %v", mockDB.fetched)
 	}
 }
 
@@ -802,21 +837,6 @@ type mockMalformedBatchDBClient struct {
 	dbadapter.DBInterface
 }
 
-func (db *mockMalformedBatchDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
-	if collName == "urilist" {
-		return map[string]interface{}{
-			"nfType": "AMF",
-			"_link": map[string]interface{}{
-				"item": []map[string]interface{}{
-					{"href": "https://nrf:29510/nnrf-nfm/v1/nf-instances/amf-valid"},
-					{"href": "https://nrf:29510/nnrf-nfm/v1/nf-instances/amf-invalid"},
-				},
-			},
-		}, nil
-	}
-	return nil, nil
-}
-
 func (db *mockMalformedBatchDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
 	return []map[string]any{
 		{
@@ -833,7 +853,7 @@ func (db *mockMalformedBatchDBClient) RestfulAPIGetMany(collName string, filter
 	}, nil
 }
 
-func TestLoadDiscoveryProfilesFromURIListBatchDecodeErrorFallsBackToPerProfile(t *testing.T) {
+func TestLoadDiscoveryProfilesByNfTypeBatchDecodeErrorFallsBackToPerProfile(t *testing.T) {
 	profileCache.evict("amf-valid")
 	profileCache.evict("amf-invalid")
 	defer func() {
@@ -849,7 +869,7 @@ func TestLoadDiscoveryProfilesFromURIListBatchDecodeErrorFallsBackToPerProfile(t
 	query.Set("target-nf-type", "AMF")
 	query.Set("requester-nf-type", "SMF")
 
-	profiles, err := loadDiscoveryProfilesFromURIList(query)
+	profiles, err := loadDiscoveryProfilesByNfType(context.Background(), query)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -860,3 +880,120 @@ func TestLoadDiscoveryProfilesFromURIListBatchDecodeErrorFallsBackToPerProfile(t
 		t.Fatalf("unexpected profile id: %s", profiles[0].NfInstanceId)
 	}
 }
+
+type mockDefaultNotificationDBClient struct {
+	dbadapter.DBInterface
+	filter bson.M
+}
+
+func (db *mockDefaultNotificationDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	db.filter = filter
+	return []map[string]interface{}{{
+		"nfinstanceid": "amf-1",
+		"nftype":       "AMF",
+		"nfstatus":     "REGISTERED",
+		"defaultnotificationsubscriptions": []map[string]interface{}{{
+			"notificationtype": "N1_MESSAGES",
+			"callbackuri":      "http://amf-1.example.org/n1",
+			"n1messageclass":   "5GMM",
+		}},
+	}}, nil
+}
+
+func TestNFDiscoveryProcedureFiltersDefaultNotificationSubscriptions(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	db := &mockDefaultNotificationDBClient{}
+	dbadapter.DBClient = db
+
+	query := url.Values{}
+	query.Set("target-nf-type", "AMF")
+	query.Set("requester-nf-type", "AMF")
+	query.Set("n1-message-class", "5GMM")
+
+	response, problemDetails := NFDiscoveryProcedure(context.Background(), query)
+	if problemDetails != nil {
+		t.Fatalf("unexpected problem details: %+v", problemDetails)
+	}
+	if len(response.NfInstances) != 1 {
+		t.Fatalf("expected one AMF instance, got %d", len(response.NfInstances))
+	}
+	subscriptions := response.NfInstances[0].GetDefaultNotificationSubscriptions()
+	if len(subscriptions) != 1 || subscriptions[0].GetCallbackUri() != "http://amf-1.example.org/n1" ||
+		subscriptions[0].GetN1MessageClass() != "5GMM" {
+		t.Errorf("expected the default notification subscription to be returned, got %+v", subscriptions)
+	}
+
+	andFilters := db.filter["$and"].([]bson.M)
+	orFilters := andFilters[len(andFilters)-1]["$or"].([]bson.M)
+	want := bson.M{"notificationtype": "N1_MESSAGES", "n1messageclass": "5GMM"}
+	if got := orFilters[0]["defaultnotificationsubscriptions"].(bson.M)["$elemMatch"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected profile default notification filter %v, got %v", want, got)
+	}
+
+	query.Set("default-notification-type", "N2_INFORMATION")
+	if _, problemDetails := NFDiscoveryProcedure(context.Background(), query); problemDetails == nil || problemDetails.GetStatus() != 400 {
+		t.Errorf("expected 400 for a message class of another notification type, got %+v", problemDetails)
+	}
+}
+
+func TestFilterDiscoveryResultsMatchesServiceDefaultNotificationSubscriptions(t *testing.T) {
+	query := url.Values{}
+	query.Set("target-nf-type", "AMF")
+	query.Set("requester-nf-type", "AMF")
+	query.Set("n2-information-class", "RAN")
+
+	subscription := models.NewDefaultNotificationSubscription("N2_INFORMATION", "http://amf-1.example.org/n2")
+	subscription.SetN2InformationClass("RAN")
+	service := models.NFService{ServiceName: models.SERVICENAME_NAMF_COMM, NfServiceStatus: models.NFSERVICESTATUS_REGISTERED}
+	service.SetDefaultNotificationSubscriptions([]models.DefaultNotificationSubscription{*subscription})
+	profiles := []models.NFProfileDiscovery{
+		{NfInstanceId: "amf-1", NfType: models.NFTYPE_AMF, NfServices: []models.NFService{service}},
+		{NfInstanceId: "amf-2", NfType: models.NFTYPE_AMF},
+	}
+
+	filtered := filterDiscoveryResults(profiles, query)
+	if len(filtered) != 1 || filtered[0].NfInstanceId != "amf-1" {
+		t.Fatalf("expected only amf-1 to match, got %+v", filtered)
+	}
+}
+
+// mockFailingDBClient fails every query with err.
+type mockFailingDBClient struct {
+	dbadapter.DBInterface
+	err error
+}
+
+func (db *mockFailingDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	return nil, db.err
+}
+
+func TestNFDiscoveryStorageErrors(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() { dbadapter.DBClient = originalDBClient }()
+
+	testCases := []struct {
+		name string
+		err  error
+		want int32
+	}{
+		{"unavailable", fmt.Errorf("%w: connection refused", dbadapter.ErrStorageUnavailable), http.StatusServiceUnavailable},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"other", errors.New("malformed filter"), http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dbadapter.DBClient = &mockFailingDBClient{err: tc.err}
+			query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+			response, problemDetails := NFDiscoveryProcedure(context.Background(), query)
+			if response != nil {
+				t.Fatalf("expected no search result, got %v", response)
+			}
+			if problemDetails == nil || problemDetails.GetStatus() != tc.want {
+				t.Fatalf("expected status %d, got %v", tc.want, problemDetails)
+			}
+		})
+	}
+}
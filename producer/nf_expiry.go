@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/util"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// nfProfileExpiryCheckInterval is how often NF profiles whose heartbeat
+// expired are looked for. It must stay well below the grace period of the
+// NfProfile TTL index.
+const nfProfileExpiryCheckInterval = 5 * time.Second
+
+var (
+	nfProfileExpiryMu   sync.Mutex
+	nfProfileExpiryStop chan struct{}
+	nfProfileExpiryDone chan struct{}
+)
+
+// StartNFProfileExpiry starts deregistering the NF instances that missed
+// their heartbeat.
+func StartNFProfileExpiry() {
+	nfProfileExpiryMu.Lock()
+	defer nfProfileExpiryMu.Unlock()
+	if nfProfileExpiryStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	nfProfileExpiryStop, nfProfileExpiryDone = stop, done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(nfProfileExpiryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				expireNFProfiles(now)
+			}
+		}
+	}()
+	logger.ManagementLog.Infof("nf profile expiry checked every %v", nfProfileExpiryCheckInterval)
+}
+
+// StopNFProfileExpiry stops looking for expired NF profiles.
+func StopNFProfileExpiry() {
+	nfProfileExpiryMu.Lock()
+	defer nfProfileExpiryMu.Unlock()
+	if nfProfileExpiryStop == nil {
+		return
+	}
+	close(nfProfileExpiryStop)
+	<-nfProfileExpiryDone
+	nfProfileExpiryStop, nfProfileExpiryDone = nil, nil
+}
+
+// expireNFProfiles deregisters the NF instances whose profile expired before
+// now and notifies their subscribers. A profile is only removed if it was not
+// refreshed in the meantime, so that a single NRF instance sends the
+// notifications when several share the database.
+func expireNFProfiles(now time.Time) {
+	collName := "NfProfile"
+	// Heartbeats not written yet refresh the profiles they are for
+	flushAllHeartbeats(context.Background())
+	expired, err := dbadapter.DBClient.RestfulAPIGetMany(collName, bson.M{"expireAt": bson.M{"$lt": now}})
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to fetch expired nf profiles: %v", err)
+		return
+	}
+
+	for _, doc := range expired {
+		nfInstanceID, _ := doc["nfinstanceid"].(string)
+		if nfInstanceID == "" {
+			continue
+		}
+		removed, claimed, err := removeNFProfile(context.Background(), nfInstanceID, doc)
+		if err != nil {
+			logger.ManagementLog.Errorf("failed to remove expired nf profile [%s]: %v", nfInstanceID, err)
+			continue
+		}
+		if !removed {
+			// Refreshed by a heartbeat
+			continue
+		}
+		profileCache.evict(nfInstanceID)
+		if !claimed {
+			// Handled by another NRF
+			continue
+		}
+		logger.ManagementLog.Infof("nf instance [%s] deregistered: heartbeat expired", nfInstanceID)
+
+		nfProfile, err := util.DecodeNFProfile(doc)
+		if err != nil {
+			logger.ManagementLog.Warnf("cannot decode expired nf profile [%s]: %v", nfInstanceID, err)
+		} else {
+			notifyNFDeregistered(context.Background(), nfProfile)
+		}
+		recordNFRemoved(context.Background(), NfEventExpired, nfInstanceID, doc)
+		if err := deleteNFInstanceSubscriptions(context.Background(), nfInstanceID); err != nil {
+			logger.ManagementLog.Warnf("failed to delete subscriptions of nf instance [%s]: %v", nfInstanceID, err)
+		}
+	}
+}
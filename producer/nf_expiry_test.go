@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/openapi/v2/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// expiryDBClient stores NF profiles and answers the expiry query. refreshed
+// profiles are renewed by a heartbeat between the query and their removal.
+type expiryDBClient struct {
+	dbadapter.DBInterface
+	mu                   sync.Mutex
+	profiles             map[string]map[string]interface{}
+	refreshed            map[string]bool
+	subscriptions        []map[string]interface{}
+	deletedSubscriptions []string
+}
+
+func (db *expiryDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch collName {
+	case "NfProfile":
+		before := filter["expireAt"].(bson.M)["$lt"].(time.Time)
+		var expired []map[string]interface{}
+		for _, profile := range db.profiles {
+			if profile["expireAt"].(time.Time).Before(before) {
+				expired = append(expired, profile)
+			}
+		}
+		return expired, nil
+	case "Subscriptions":
+		return db.subscriptions, nil
+	}
+	return nil, nil
+}
+
+func (db *expiryDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.profiles[filter["nfinstanceid"].(string)], nil
+}
+
+func (db *expiryDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	nfInstanceID := filter["nfinstanceid"].(string)
+	if db.refreshed[nfInstanceID] {
+		return false, nil
+	}
+	if _, ok := db.profiles[nfInstanceID]; !ok {
+		return false, nil
+	}
+	delete(db.profiles, nfInstanceID)
+	return true, nil
+}
+
+func (db *expiryDBClient) RestfulAPIDeleteMany(collName string, filter bson.M) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if collName == "Subscriptions" {
+		db.deletedSubscriptions = append(db.deletedSubscriptions, filter["subscrCond.nfInstanceId"].(string))
+	}
+	return nil
+}
+
+func TestExpireNFProfilesNotifiesDeregistration(t *testing.T) {
+	requests := make(chan string, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			var notificationData models.NotificationData
+			if err := json.NewDecoder(r.Body).Decode(&notificationData); err != nil {
+				t.Errorf("failed to decode notification: %v", err)
+			}
+			requests <- string(notificationData.Event) + " " + notificationData.NfInstanceUri
+		} else {
+			requests <- r.URL.Path
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	originalDBClient := dbadapter.DBClient
+	originalAmfOam := factory.NrfConfig.Configuration.AmfOamNotification
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.AmfOamNotification = originalAmfOam
+	}()
+	factory.NrfConfig.Configuration.AmfOamNotification = &factory.AmfOamNotification{Enable: true, Uri: server.URL}
+
+	now := time.Now()
+	db := &expiryDBClient{
+		profiles: map[string]map[string]interface{}{
+			"amf-expired":   {"nfinstanceid": "amf-expired", "nftype": "AMF", "nfstatus": "REGISTERED", "expireAt": now.Add(-time.Second)},
+			"amf-refreshed": {"nfinstanceid": "amf-refreshed", "nftype": "AMF", "nfstatus": "REGISTERED", "expireAt": now.Add(-time.Second)},
+			"amf-alive":     {"nfinstanceid": "amf-alive", "nftype": "AMF", "nfstatus": "REGISTERED", "expireAt": now.Add(time.Minute)},
+		},
+		refreshed: map[string]bool{"amf-refreshed": true},
+		subscriptions: []map[string]interface{}{{
+			"nfStatusNotificationUri": server.URL + "/status",
+			"subscrCond":              map[string]interface{}{"nfInstanceId": "amf-expired"},
+		}},
+	}
+	dbadapter.DBClient = db
+
+	expireNFProfiles(now)
+
+	want := map[string]bool{
+		"NF_DEREGISTERED " + nrfContext.GetNfInstanceURI("amf-expired"): true,
+		"/namf-oam/v1/amfInstanceDown/amf-expired":                      true,
+	}
+	for range want {
+		select {
+		case request := <-requests:
+			if !want[request] {
+				t.Errorf("unexpected request %q", request)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notifications")
+		}
+	}
+	select {
+	case request := <-requests:
+		t.Errorf("unexpected request %q", request)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.profiles["amf-expired"]; ok {
+		t.Error("expected expired profile to be removed")
+	}
+	if len(db.profiles) != 2 {
+		t.Errorf("expected refreshed and alive profiles to be kept, got %v", db.profiles)
+	}
+	if len(db.deletedSubscriptions) != 1 || db.deletedSubscriptions[0] != "amf-expired" {
+		t.Errorf("expected subscriptions to amf-expired to be deleted, got %v", db.deletedSubscriptions)
+	}
+}
@@ -0,0 +1,367 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/openapi/v2/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// heartbeatPatchPaths are the NfProfile attributes an NF instance refreshes
+// on each heartbeat, as normalized by normalizeNFInstancePatchJSON.
+var heartbeatPatchPaths = map[string]bool{
+	"/nfstatus":      true,
+	"/load":          true,
+	"/loadTimeStamp": true,
+}
+
+// heartbeatWrite is the latest state of a profile refreshed by heartbeats,
+// still to be written over the stored profile at baseVersion. base is that
+// stored profile and profile the decoded doc, for the flush writing it to
+// notify and record the change.
+type heartbeatWrite struct {
+	doc         map[string]interface{}
+	baseVersion int64
+	base        map[string]interface{}
+	profile     models.NFProfile
+}
+
+// heartbeatBatcher coalesces the heartbeats of NF instances: the profile
+// refreshed by a heartbeat is kept until the next flush, which writes the
+// profiles of all the instances in one bulk write, and overlays the stored
+// one for the heartbeats of the same instance meanwhile. The other reads and
+// writes of an instance flush it first, so that they see its heartbeats.
+type heartbeatBatcher struct {
+	mu sync.Mutex
+	// pending are the writes of the next flush, inflight those of the
+	// flush in progress, by NF instance ID.
+	pending  map[string]heartbeatWrite
+	inflight map[string]heartbeatWrite
+	// flushes counts the flushes done, and written holds the last one that
+	// wrote each profile, over the last heartbeatFlushHistory flushes, so
+	// that a profile read from the storage before it was written is not
+	// taken for the latest.
+	flushes uint64
+	written map[string]uint64
+	closed  bool
+	// flushMu serializes the flushes.
+	flushMu  sync.Mutex
+	maxBatch int
+	full     chan struct{}
+}
+
+// heartbeatFlushHistory is how many flushes a heartbeat built over a profile
+// read from the storage may span.
+const heartbeatFlushHistory = 64
+
+var (
+	heartbeatBatchMu   sync.Mutex
+	heartbeatBatchStop chan struct{}
+	heartbeatBatchDone chan struct{}
+	heartbeats         atomic.Pointer[heartbeatBatcher]
+)
+
+// StartHeartbeatBatching starts coalescing heartbeats into bulk writes sent
+// every window, or as soon as maxBatch NF instances are waiting.
+func StartHeartbeatBatching(window time.Duration, maxBatch int) {
+	heartbeatBatchMu.Lock()
+	defer heartbeatBatchMu.Unlock()
+	if heartbeatBatchStop != nil {
+		return
+	}
+	batcher := &heartbeatBatcher{
+		pending:  make(map[string]heartbeatWrite),
+		written:  make(map[string]uint64),
+		maxBatch: maxBatch,
+		full:     make(chan struct{}, 1),
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	heartbeatBatchStop, heartbeatBatchDone = stop, done
+	heartbeats.Store(batcher)
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-batcher.full:
+			}
+			batcher.flush(context.Background())
+		}
+	}()
+	logger.ManagementLog.Infof("nf heartbeats written every %v, up to %d at once", window, maxBatch)
+}
+
+// StopHeartbeatBatching writes the pending heartbeats and stops coalescing
+// them: later ones are written one by one.
+func StopHeartbeatBatching() {
+	heartbeatBatchMu.Lock()
+	defer heartbeatBatchMu.Unlock()
+	if heartbeatBatchStop == nil {
+		return
+	}
+	batcher := heartbeats.Swap(nil)
+	close(heartbeatBatchStop)
+	<-heartbeatBatchDone
+	heartbeatBatchStop, heartbeatBatchDone = nil, nil
+
+	batcher.mu.Lock()
+	batcher.closed = true
+	batcher.mu.Unlock()
+	batcher.flush(context.Background())
+	batcher.mu.Lock()
+	dropped := len(batcher.pending)
+	batcher.mu.Unlock()
+	if dropped != 0 {
+		logger.ManagementLog.Errorf("dropped %d nf heartbeats the storage failed to write", dropped)
+	}
+}
+
+// heartbeatBatcherFor returns the running heartbeat batcher if patch only
+// refreshes the attributes a heartbeat does, and nil otherwise.
+func heartbeatBatcherFor(patch jsonpatch.Patch) *heartbeatBatcher {
+	batcher := heartbeats.Load()
+	if batcher == nil {
+		return nil
+	}
+	for _, operation := range patch {
+		path, err := operation.Path()
+		if err != nil || !heartbeatPatchPaths[path] {
+			return nil
+		}
+		switch operation.Kind() {
+		case "replace", "add", "remove":
+		default:
+			return nil
+		}
+	}
+	return batcher
+}
+
+// flushHeartbeats writes the pending heartbeats of nfInstanceID, if any, so
+// that reading or writing its profile from the storage sees them.
+func flushHeartbeats(ctx context.Context, nfInstanceID string) {
+	if batcher := heartbeats.Load(); batcher != nil {
+		batcher.flushInstance(ctx, nfInstanceID)
+	}
+}
+
+// flushAllHeartbeats writes all the pending heartbeats.
+func flushAllHeartbeats(ctx context.Context) {
+	if batcher := heartbeats.Load(); batcher != nil {
+		batcher.flush(ctx)
+	}
+}
+
+// latest returns the profile of nfInstanceID refreshed by heartbeats not
+// written yet, or nil if there is none, along with the number of flushes done
+// to be handed to enqueue.
+func (b *heartbeatBatcher) latest(nfInstanceID string) (doc map[string]interface{}, flushes uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if write, ok := b.pending[nfInstanceID]; ok {
+		return write.doc, b.flushes
+	}
+	if write, ok := b.inflight[nfInstanceID]; ok {
+		return write.doc, b.flushes
+	}
+	return nil, b.flushes
+}
+
+// enqueue keeps doc, the profile of nfInstanceID built over original at
+// version and decoded as profile, to be written by the next flush. It reports
+// false, for the heartbeat to be built again, if the profile changed since it
+// was returned by latest, or read from the storage, before flushes flushes,
+// and true if doc is enqueued. ok is false once the batcher is stopped.
+func (b *heartbeatBatcher) enqueue(nfInstanceID string, original, doc map[string]interface{},
+	profile models.NFProfile, version int64, flushes uint64,
+) (enqueued bool, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false, false
+	}
+	// The stored profile doc replaces is the one pending writes replace, or
+	// the one the flush in progress writes, or the one read
+	baseVersion, base := version, original
+	if write, pending := b.pending[nfInstanceID]; pending {
+		if nfProfileVersion(write.doc) != version {
+			return false, true
+		}
+		baseVersion, base = write.baseVersion, write.base
+	} else if write, inflight := b.inflight[nfInstanceID]; inflight {
+		if nfProfileVersion(write.doc) != version {
+			return false, true
+		}
+	} else if b.flushes-flushes > heartbeatFlushHistory || b.written[nfInstanceID] > flushes {
+		return false, true
+	}
+	b.pending[nfInstanceID] = heartbeatWrite{doc: doc, baseVersion: baseVersion, base: base, profile: profile}
+	if len(b.pending) >= b.maxBatch {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return true, true
+}
+
+// flushInstance flushes the batcher if nfInstanceID has heartbeats pending or
+// being written.
+func (b *heartbeatBatcher) flushInstance(ctx context.Context, nfInstanceID string) {
+	b.mu.Lock()
+	_, pending := b.pending[nfInstanceID]
+	_, inflight := b.inflight[nfInstanceID]
+	b.mu.Unlock()
+	if pending || inflight {
+		b.flush(ctx)
+	}
+}
+
+// flush writes the pending heartbeats, at most maxBatch per bulk write, then
+// notifies and records the changes written. A profile changed meanwhile by
+// another NRF instance keeps that change, and the heartbeats coalesced over
+// the former one are dropped. The heartbeats the storage failed to write are
+// written by the next flush.
+func (b *heartbeatBatcher) flush(ctx context.Context) {
+	// A flush serves every waiting request, not only the one running it
+	ctx = context.WithoutCancel(ctx)
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	if len(batch) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.pending = make(map[string]heartbeatWrite, len(batch))
+	b.inflight = batch
+	b.mu.Unlock()
+
+	swaps := make([]dbadapter.Swap, 0, min(len(batch), b.maxBatch))
+	chunk := make([]string, 0, cap(swaps))
+	var written, unconfirmed []string
+	var writeErr error
+	write := func() {
+		swapped, err := dbadapter.CompareAndSwapMany(ctx, "NfProfile", swaps)
+		if err != nil {
+			logger.ManagementLog.Errorf("failed to write %d nf heartbeats: %v", len(swaps)-swapped, err)
+			writeErr = err
+		}
+		if err == nil && swapped == len(swaps) {
+			written = append(written, chunk...)
+		} else {
+			// Which of the heartbeats were written is told by reading
+			// the profiles back
+			unconfirmed = append(unconfirmed, chunk...)
+		}
+		swaps, chunk = swaps[:0], chunk[:0]
+	}
+	for nfInstanceID, pending := range batch {
+		swaps = append(swaps, dbadapter.Swap{
+			Filter:   bson.M{"nfinstanceid": nfInstanceID},
+			Expected: nfProfileVersionCondition(pending.baseVersion),
+			PutData:  pending.doc,
+		})
+		chunk = append(chunk, nfInstanceID)
+		if len(swaps) == b.maxBatch {
+			write()
+		}
+	}
+	if len(swaps) != 0 {
+		write()
+	}
+	confirmed, requeued := b.confirm(ctx, batch, unconfirmed, writeErr)
+	written = append(written, confirmed...)
+	if dropped := len(unconfirmed) - len(confirmed) - len(requeued); dropped != 0 {
+		logger.ManagementLog.Warnf("dropped %d nf heartbeats: profiles modified concurrently", dropped)
+	}
+	logger.ManagementLog.Debugf("wrote %d nf heartbeats", len(written))
+
+	b.mu.Lock()
+	b.inflight = nil
+	b.flushes++
+	for nfInstanceID := range batch {
+		b.written[nfInstanceID] = b.flushes
+	}
+	for nfInstanceID, flushes := range b.written {
+		if b.flushes-flushes >= heartbeatFlushHistory {
+			delete(b.written, nfInstanceID)
+		}
+	}
+	// A heartbeat enqueued meanwhile replaces the requeued one, over the
+	// profile the requeued one was to replace
+	for _, nfInstanceID := range requeued {
+		requeue := batch[nfInstanceID]
+		if pending, ok := b.pending[nfInstanceID]; ok {
+			pending.baseVersion, pending.base = requeue.baseVersion, requeue.base
+			requeue = pending
+		}
+		b.pending[nfInstanceID] = requeue
+	}
+	b.mu.Unlock()
+
+	for _, nfInstanceID := range written {
+		refreshed := batch[nfInstanceID]
+		profileCache.evict(nfInstanceID)
+		notifyNFProfileChanged(ctx, refreshed.base, refreshed.profile)
+		recordNFUpdated(ctx, refreshed.base, refreshed.profile, nfProfileVersion(refreshed.doc))
+	}
+}
+
+// confirm reads back the profiles of the heartbeats of batch whose write was
+// not confirmed, and returns those which were written, and those to write
+// again as the storage failed with writeErr.
+func (b *heartbeatBatcher) confirm(ctx context.Context, batch map[string]heartbeatWrite, unconfirmed []string,
+	writeErr error,
+) (written, requeued []string) {
+	if len(unconfirmed) == 0 {
+		return nil, nil
+	}
+	nfInstanceIDs := make([]interface{}, len(unconfirmed))
+	for i, nfInstanceID := range unconfirmed {
+		nfInstanceIDs[i] = nfInstanceID
+	}
+	docs, err := dbadapter.GetMany(ctx, "NfProfile", bson.M{"nfinstanceid": bson.M{"$in": nfInstanceIDs}})
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to read back %d nf profiles refreshed by heartbeats: %v", len(unconfirmed), err)
+		if writeErr != nil {
+			return nil, unconfirmed
+		}
+		return nil, nil
+	}
+	versions := make(map[string]int64, len(docs))
+	for _, doc := range docs {
+		if nfInstanceID, ok := doc["nfinstanceid"].(string); ok {
+			versions[nfInstanceID] = nfProfileVersion(doc)
+		}
+	}
+	for _, nfInstanceID := range unconfirmed {
+		write := batch[nfInstanceID]
+		version, stored := versions[nfInstanceID]
+		switch {
+		case !stored:
+		case version == nfProfileVersion(write.doc):
+			written = append(written, nfInstanceID)
+		case writeErr != nil && version == write.baseVersion:
+			requeued = append(requeued, nfInstanceID)
+		}
+	}
+	return written, requeued
+}
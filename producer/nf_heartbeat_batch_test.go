@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/util/httpwrapper"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// registerHeartbeatProfiles registers count AMF instances and returns
+// their NF instance IDs.
+func registerHeartbeatProfiles(tb testing.TB, count int) []string {
+	tb.Helper()
+	nfInstanceIDs := make([]string, 0, count)
+	for range count {
+		nf := models.NewNFProfileWithDefaults()
+		nf.SetNfType(models.NFTYPE_AMF)
+		nf.SetNfInstanceId(uuid.NewString())
+		nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+		nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+		if _, _, problemDetails := NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+			tb.Fatalf("failed to register NF: %+v", problemDetails)
+		}
+		nfInstanceIDs = append(nfInstanceIDs, nf.GetNfInstanceId())
+	}
+	return nfInstanceIDs
+}
+
+// heartbeat sends patch as the heartbeat of nfInstanceID.
+func heartbeat(nfInstanceID string, patch string) *httpwrapper.Response {
+	return HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
+		Params: map[string]string{"nfInstanceID": nfInstanceID},
+		Body:   []byte(patch),
+	})
+}
+
+func TestHeartbeatBatching(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable
+	}()
+	db := dbadapter.NewMemoryDBClient()
+	dbadapter.DBClient = db
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	nfInstanceIDs := registerHeartbeatProfiles(t, 2)
+	stored := func(nfInstanceID string) map[string]interface{} {
+		t.Helper()
+		doc, err := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID})
+		if err != nil || doc == nil {
+			t.Fatalf("failed to read profile %s: %v", nfInstanceID, err)
+		}
+		return doc
+	}
+
+	// Flushed on demand only
+	StartHeartbeatBatching(time.Hour, 100)
+	defer StopHeartbeatBatching()
+
+	id := nfInstanceIDs[0]
+	if response := heartbeat(id, `[{"op":"replace","path":"/load","value":10}]`); response.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+	}
+	response := heartbeat(id, `[{"op":"replace","path":"/load","value":20},{"op":"replace","path":"/nfStatus","value":"SUSPENDED"}]`)
+	if response.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+	}
+	if etag := response.Header.Get("ETag"); etag != `"3"` {
+		t.Errorf(`expected ETag "3" after two heartbeats, got %q`, etag)
+	}
+	if version := nfProfileVersion(stored(id)); version != 1 {
+		t.Errorf("expected the heartbeats to be coalesced, stored version is %d", version)
+	}
+
+	// Reading the profile writes its heartbeats first
+	nf := GetNFInstanceProcedure(context.Background(), id)
+	if nf == nil || nf.GetLoad() != 20 || nf.GetNfStatus() != models.NFSTATUS_SUSPENDED {
+		t.Fatalf("expected the heartbeats to be read back, got %+v", nf)
+	}
+	if version := nfProfileVersion(stored(id)); version != 3 {
+		t.Errorf("expected the coalesced heartbeats to be written at version 3, got %d", version)
+	}
+
+	// Other updates see the heartbeats not written yet
+	heartbeat(id, `[{"op":"replace","path":"/load","value":30}]`)
+	response = heartbeat(id, `[{"op":"replace","path":"/priority","value":5}]`)
+	if response.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+	}
+	if doc := stored(id); nfProfileVersion(doc) != 5 || fmt.Sprint(doc["load"]) != "30" || fmt.Sprint(doc["priority"]) != "5" {
+		t.Errorf("expected the heartbeat and the update to be stored, got %+v", doc)
+	}
+
+	// A profile changed meanwhile by another NRF keeps that change
+	other := nfInstanceIDs[1]
+	heartbeat(other, `[{"op":"replace","path":"/load","value":40}]`)
+	changed := stored(other)
+	changed[nfProfileVersionField] = nfProfileVersion(changed) + 1
+	changed["priority"] = 7
+	if _, err := db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": other}, changed); err != nil {
+		t.Fatalf("failed to change profile: %v", err)
+	}
+	flushAllHeartbeats(context.Background())
+	if doc := stored(other); doc["load"] != nil || fmt.Sprint(doc["priority"]) != "7" {
+		t.Errorf("expected the concurrent change to be kept, got %+v", doc)
+	}
+
+	// Stopping writes the pending heartbeats
+	heartbeat(id, `[{"op":"replace","path":"/load","value":50}]`)
+	StopHeartbeatBatching()
+	if doc := stored(id); fmt.Sprint(doc["load"]) != "50" {
+		t.Errorf("expected the pending heartbeat to be written on stop, got load %v", doc["load"])
+	}
+	if response := heartbeat(id, `[{"op":"replace","path":"/load","value":60}]`); response.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+	}
+	if doc := stored(id); fmt.Sprint(doc["load"]) != "60" {
+		t.Errorf("expected heartbeats to be written at once after stop, got load %v", doc["load"])
+	}
+}
+
+// failingBulkDBClient fails the next failures bulk writes, without writing.
+type failingBulkDBClient struct {
+	*dbadapter.MemoryDBClient
+	failures int
+}
+
+func (db *failingBulkDBClient) RestfulAPICompareAndSwapMany(collName string, swaps []dbadapter.Swap) (int, error) {
+	if db.failures > 0 {
+		db.failures--
+		return 0, fmt.Errorf("%w: connection refused", dbadapter.ErrStorageUnavailable)
+	}
+	return db.MemoryDBClient.RestfulAPICompareAndSwapMany(collName, swaps)
+}
+
+func TestHeartbeatBatchingStorageFailure(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalHistory := factory.NrfConfig.Configuration.NfHistory
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.NfHistory = originalHistory
+		factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable
+	}()
+	db := &failingBulkDBClient{MemoryDBClient: dbadapter.NewMemoryDBClient()}
+	dbadapter.DBClient = db
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+	factory.NrfConfig.Configuration.NfHistory = &factory.NfHistory{Enable: true, MaxEvents: 10}
+
+	id := registerHeartbeatProfiles(t, 1)[0]
+	stored := func() map[string]interface{} {
+		t.Helper()
+		doc, err := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": id})
+		if err != nil || doc == nil {
+			t.Fatalf("failed to read profile %s: %v", id, err)
+		}
+		return doc
+	}
+	suspensions := func() int {
+		t.Helper()
+		events, problemDetails := ListNfHistoryProcedure(context.Background(), nfHistoryQuery{nfInstanceID: id, event: NfEventSuspended})
+		if problemDetails != nil {
+			t.Fatalf("failed to list history: %+v", problemDetails)
+		}
+		return len(events)
+	}
+
+	StartHeartbeatBatching(time.Hour, 100)
+	defer StopHeartbeatBatching()
+
+	heartbeat(id, `[{"op":"replace","path":"/nfStatus","value":"SUSPENDED"}]`)
+	if count := suspensions(); count != 0 {
+		t.Errorf("expected the suspension to be recorded once written, got %d events", count)
+	}
+
+	// A heartbeat the storage failed to write is written by the next flush
+	db.failures = 1
+	flushAllHeartbeats(context.Background())
+	if version := nfProfileVersion(stored()); version != 1 {
+		t.Errorf("expected the failed write to leave version 1, got %d", version)
+	}
+	if count := suspensions(); count != 0 {
+		t.Errorf("expected no suspension recorded for a failed write, got %d events", count)
+	}
+	response := heartbeat(id, `[{"op":"replace","path":"/load","value":20}]`)
+	if etag := response.Header.Get("ETag"); etag != `"3"` {
+		t.Errorf(`expected the heartbeat to be coalesced with the requeued one at ETag "3", got %q`, etag)
+	}
+	flushAllHeartbeats(context.Background())
+	doc := stored()
+	if nfProfileVersion(doc) != 3 || doc["nfstatus"] != string(models.NFSTATUS_SUSPENDED) || fmt.Sprint(doc["load"]) != "20" {
+		t.Errorf("expected both heartbeats to be written, got %+v", doc)
+	}
+	if count := suspensions(); count != 1 {
+		t.Errorf("expected the suspension to be recorded once, got %d events", count)
+	}
+}
@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/util/mongoapi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// heartbeatBenchmarkFleet is how many NF instances the heartbeat
+	// benchmark refreshes, and heartbeatBenchmarkClients how many clients
+	// send their heartbeats at once per CPU.
+	heartbeatBenchmarkFleet   = 100
+	heartbeatBenchmarkClients = 32
+	// remoteRoundTrip is how long each operation of remoteDBClient takes, on
+	// one of remoteConnections connections.
+	remoteRoundTrip   = 2 * time.Millisecond
+	remoteConnections = 4
+)
+
+// remoteDBClient keeps NF profiles by NF instance ID and makes each operation,
+// a bulk write included, wait for a round trip on one of a few connections,
+// as a storage server reached over the network does.
+type remoteDBClient struct {
+	dbadapter.DBInterface
+	mu          sync.Mutex
+	profiles    map[string]map[string]interface{}
+	connections chan struct{}
+}
+
+func newRemoteDBClient(profiles []map[string]interface{}) *remoteDBClient {
+	db := &remoteDBClient{
+		profiles:    make(map[string]map[string]interface{}, len(profiles)),
+		connections: make(chan struct{}, remoteConnections),
+	}
+	for _, profile := range profiles {
+		db.profiles[profile["nfinstanceid"].(string)] = profile
+	}
+	return db
+}
+
+func (db *remoteDBClient) roundTrip() {
+	db.connections <- struct{}{}
+	time.Sleep(remoteRoundTrip)
+	<-db.connections
+}
+
+func (db *remoteDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	db.roundTrip()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.profiles[filter["nfinstanceid"].(string)], nil
+}
+
+// RestfulAPIGetMany finds no subscriptions to notify of the heartbeats.
+func (db *remoteDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	db.roundTrip()
+	return nil, nil
+}
+
+func (db *remoteDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	db.roundTrip()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.compareAndSwap(dbadapter.Swap{Filter: filter, Expected: expected, PutData: putData}), nil
+}
+
+func (db *remoteDBClient) RestfulAPICompareAndSwapMany(collName string, swaps []dbadapter.Swap) (int, error) {
+	db.roundTrip()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	swapped := 0
+	for _, swap := range swaps {
+		if db.compareAndSwap(swap) {
+			swapped++
+		}
+	}
+	return swapped, nil
+}
+
+func (db *remoteDBClient) compareAndSwap(swap dbadapter.Swap) bool {
+	nfInstanceID := swap.Filter["nfinstanceid"].(string)
+	doc, ok := db.profiles[nfInstanceID]
+	if !ok || nfProfileVersion(doc) != nfProfileVersion(swap.Expected) {
+		return false
+	}
+	db.profiles[nfInstanceID] = swap.PutData
+	return true
+}
+
+// BenchmarkHeartbeat sends the heartbeats of a fleet of NF instances, first
+// written one by one, then coalesced by the heartbeat batching, and reports
+// the heartbeats handled per second. It runs on the memory and file storages,
+// on remoteDBClient, and on MongoDB if NRF_TEST_MONGODB_URL is set:
+//
+//	NRF_TEST_MONGODB_URL=mongodb://127.0.0.1:27017 go test -run '^$' -bench Heartbeat ./producer
+func BenchmarkHeartbeat(b *testing.B) {
+	originalDBClient := dbadapter.DBClient
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable
+	}()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	memoryDB := dbadapter.NewMemoryDBClient()
+	dbadapter.DBClient = memoryDB
+	nfInstanceIDs := registerHeartbeatProfiles(b, heartbeatBenchmarkFleet)
+	profiles, err := memoryDB.RestfulAPIGetMany("NfProfile", bson.M{})
+	if err != nil {
+		b.Fatalf("failed to read profiles: %v", err)
+	}
+
+	fileDB, err := dbadapter.OpenFileDBClient(filepath.Join(b.TempDir(), "nrf.db"))
+	if err != nil {
+		b.Fatalf("failed to open storage file: %v", err)
+	}
+	storages := []struct {
+		name string
+		db   dbadapter.DBInterface
+	}{
+		{"memory", memoryDB},
+		{"file", fileDB},
+		{"remote", newRemoteDBClient(profiles)},
+	}
+	if mongoURL := os.Getenv("NRF_TEST_MONGODB_URL"); mongoURL != "" {
+		dbName := "nrf-bench-" + uuid.NewString()[:8]
+		client, err := mongoapi.NewMongoClient(mongoURL, dbName)
+		if err != nil {
+			b.Fatalf("failed to connect to MongoDB: %v", err)
+		}
+		defer func() {
+			if err := client.Client.Database(dbName).Drop(context.TODO()); err != nil {
+				b.Logf("failed to drop database %s: %v", dbName, err)
+			}
+			client.Client.Disconnect(context.TODO())
+		}()
+		storages = append(storages, struct {
+			name string
+			db   dbadapter.DBInterface
+		}{"mongodb", dbadapter.NewMongoDBClient(client)})
+	}
+
+	window := factory.NRF_DEFAULT_HEARTBEAT_BATCH_WINDOW
+	maxBatch := factory.NRF_DEFAULT_HEARTBEAT_BATCH_MAX_SIZE
+	for _, storage := range storages {
+		if storage.name == "file" || storage.name == "mongodb" {
+			filters := make([]bson.M, 0, len(profiles))
+			for _, profile := range profiles {
+				delete(profile, "_id")
+				filters = append(filters, bson.M{"nfinstanceid": profile["nfinstanceid"]})
+			}
+			if err := storage.db.RestfulAPIPutMany("NfProfile", filters, profiles); err != nil {
+				b.Fatalf("failed to store profiles in %s: %v", storage.name, err)
+			}
+		}
+		dbadapter.DBClient = storage.db
+		b.Run(storage.name+"/unbatched", func(b *testing.B) {
+			sendHeartbeats(b, nfInstanceIDs)
+		})
+		b.Run(storage.name+"/batched", func(b *testing.B) {
+			StartHeartbeatBatching(window, maxBatch)
+			defer StopHeartbeatBatching()
+			sendHeartbeats(b, nfInstanceIDs)
+		})
+	}
+}
+
+// sendHeartbeats sends b.N heartbeats in parallel. Each client sends those of
+// its own NF instances in turn, as an NF instance sends its heartbeats one
+// after the other.
+func sendHeartbeats(b *testing.B, nfInstanceIDs []string) {
+	var clients atomic.Int64
+	b.SetParallelism(heartbeatBenchmarkClients)
+	start := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		client := int(clients.Add(1) - 1)
+		var owned []string
+		for i := client % len(nfInstanceIDs); i < len(nfInstanceIDs); i += heartbeatBenchmarkClients * runtime.GOMAXPROCS(0) {
+			owned = append(owned, nfInstanceIDs[i])
+		}
+		for i := 0; pb.Next(); i++ {
+			response := heartbeat(owned[i%len(owned)], fmt.Sprintf(`[{"op":"replace","path":"/load","value":%d}]`, i%100))
+			if response.Status != http.StatusOK {
+				b.Errorf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+				return
+			}
+		}
+	})
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+}
@@ -0,0 +1,352 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/util"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+	"github.com/omec-project/util/httpwrapper"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Lifecycle events of the NF history.
+const (
+	NfEventRegistered   = "REGISTERED"
+	NfEventUpdated      = "UPDATED"
+	NfEventSuspended    = "SUSPENDED"
+	NfEventDeregistered = "DEREGISTERED"
+	NfEventExpired      = "EXPIRED"
+)
+
+var nfHistoryEvents = []string{
+	NfEventRegistered, NfEventUpdated, NfEventSuspended, NfEventDeregistered, NfEventExpired,
+}
+
+const (
+	queryParamHistoryNfInstanceID = "nfInstanceId"
+	queryParamHistoryNfType       = "nfType"
+	queryParamHistoryEvent        = "event"
+	queryParamHistorySince        = "since"
+)
+
+// nfHistoryIgnoredPaths are the attributes a heartbeat refreshes, whose
+// changes are not recorded as updates.
+var nfHistoryIgnoredPaths = map[string]bool{
+	"/load":          true,
+	"/loadTimeStamp": true,
+}
+
+// NfHistoryEvent is a lifecycle event of an NF instance as shown to the
+// operator. Changes lists the changes of an update, or those of a
+// registration replacing a profile, and Profile is the registered profile, or
+// the last one of a deregistered or expired NF instance.
+type NfHistoryEvent struct {
+	Id             string              `json:"id"`
+	NfInstanceId   string              `json:"nfInstanceId"`
+	NfType         string              `json:"nfType,omitempty"`
+	Event          string              `json:"event"`
+	Time           time.Time           `json:"time"`
+	ProfileVersion int64               `json:"profileVersion,omitempty"`
+	Changes        []models.ChangeItem `json:"changes,omitempty"`
+	Profile        *models.NFProfile   `json:"profile,omitempty"`
+}
+
+// nfHistoryQuery holds the filters of the operator NF history. Empty values
+// mean "not requested".
+type nfHistoryQuery struct {
+	nfInstanceID string
+	nfType       string
+	event        string
+	since        time.Time
+}
+
+func parseNfHistoryQuery(values url.Values) (nfHistoryQuery, *models.ProblemDetails) {
+	query := nfHistoryQuery{
+		nfInstanceID: values.Get(queryParamHistoryNfInstanceID),
+		nfType:       values.Get(queryParamHistoryNfType),
+		event:        values.Get(queryParamHistoryEvent),
+	}
+	if query.event != "" && !slices.Contains(nfHistoryEvents, query.event) {
+		return query, invalidHistoryParam(queryParamHistoryEvent, "unknown NF history event "+query.event,
+			"must be one of "+strings.Join(nfHistoryEvents, ", "))
+	}
+	if since := values.Get(queryParamHistorySince); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return query, invalidHistoryParam(queryParamHistorySince, err.Error(), "must be an RFC 3339 date-time")
+		}
+		query.since = t
+	}
+	return query, nil
+}
+
+func invalidHistoryParam(param, detail, reason string) *models.ProblemDetails {
+	problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", http.StatusBadRequest, detail, utils.CauseInvalidRequest)
+	invalidParam := models.InvalidParam{Param: param}
+	invalidParam.SetReason(reason)
+	problemDetails.SetInvalidParams([]models.InvalidParam{invalidParam})
+	return problemDetails
+}
+
+// filter selects the stored events by NF instance, NF type and event. The
+// time is checked on the decoded events.
+func (q nfHistoryQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.nfInstanceID != "" {
+		filter["nfInstanceId"] = q.nfInstanceID
+	}
+	if q.nfType != "" {
+		filter["nfType"] = q.nfType
+	}
+	if q.event != "" {
+		filter["event"] = q.event
+	}
+	return filter
+}
+
+func HandleListNfHistoryRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle ListNfHistoryRequest")
+	query, problemDetails := parseNfHistoryQuery(request.Query)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	events, problemDetails := ListNfHistoryProcedure(ctx, query)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, events)
+}
+
+// HandleGetNfInstanceHistoryRequest returns the events of one NF instance,
+// filtered as the whole history is.
+func HandleGetNfInstanceHistoryRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle GetNfInstanceHistoryRequest")
+	query, problemDetails := parseNfHistoryQuery(request.Query)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	query.nfInstanceID = request.Params["nfInstanceID"]
+	events, problemDetails := ListNfHistoryProcedure(ctx, query)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	if len(events) == 0 && query.event == "" && query.since.IsZero() {
+		problemDetails = utils.ProblemDetailsContextNotFound("NF instance history not found")
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, events)
+}
+
+// ListNfHistoryProcedure returns the stored NF lifecycle events matching the
+// query, newest first.
+func ListNfHistoryProcedure(ctx context.Context, query nfHistoryQuery) ([]NfHistoryEvent, *models.ProblemDetails) {
+	docs, err := dbadapter.GetMany(ctx, dbadapter.NfHistoryCollection, query.filter())
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to list nf history: %v", err)
+		return nil, storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+	}
+	events := make([]NfHistoryEvent, 0, len(docs))
+	for _, doc := range docs {
+		event, err := nfHistoryEvent(doc)
+		if err != nil {
+			logger.ManagementLog.Warnf("cannot decode nf history event %v: %v", doc["id"], err)
+			continue
+		}
+		if !query.since.IsZero() && event.Time.Before(query.since) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	return events, nil
+}
+
+// nfHistoryTime returns the time of a stored event, as stored by the
+// storage in use.
+func nfHistoryTime(doc map[string]interface{}) time.Time {
+	switch t := doc["time"].(type) {
+	case time.Time:
+		return t
+	case bson.DateTime:
+		return t.Time()
+	}
+	return time.Time{}
+}
+
+func nfHistoryEvent(doc map[string]interface{}) (NfHistoryEvent, error) {
+	fields := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		switch key {
+		case "_id", "time", "expireAt":
+		default:
+			fields[key] = value
+		}
+	}
+	var event NfHistoryEvent
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return event, err
+	}
+	if err := json.Unmarshal(b, &event); err != nil {
+		return event, err
+	}
+	event.Time = nfHistoryTime(doc).UTC()
+	return event, nil
+}
+
+// recordNFHistory stores event in the NF history, when it is enabled, and
+// drops the oldest events of its NF instance past the configured maximum.
+// Failures are only logged: the history never fails the procedure it records.
+func recordNFHistory(ctx context.Context, event NfHistoryEvent) {
+	config := factory.NrfConfig.GetNfHistoryConfig()
+	if !config.Enable || dbadapter.DBClient == nil || event.NfInstanceId == "" {
+		return
+	}
+	event.Id = uuid.New().String()
+	event.Time = time.Now().UTC()
+	if event.Profile != nil {
+		profile := notificationProfile(*event.Profile)
+		event.Profile = &profile
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		logger.ManagementLog.Errorf("cannot encode %s event of nf instance [%s]: %v", event.Event, event.NfInstanceId, err)
+		return
+	}
+	putData := map[string]interface{}{}
+	if err := json.Unmarshal(b, &putData); err != nil {
+		logger.ManagementLog.Errorf("cannot encode %s event of nf instance [%s]: %v", event.Event, event.NfInstanceId, err)
+		return
+	}
+	putData["time"] = event.Time
+	putData["expireAt"] = event.Time.Add(config.Retention)
+	if _, err := dbadapter.Post(ctx, dbadapter.NfHistoryCollection, bson.M{"id": event.Id}, putData); err != nil {
+		logger.ManagementLog.Errorf("failed to record %s event of nf instance [%s]: %v", event.Event, event.NfInstanceId, err)
+		return
+	}
+	pruneNFHistory(ctx, event.NfInstanceId, config.MaxEvents)
+}
+
+// pruneNFHistory drops the oldest events of nfInstanceID beyond maxEvents,
+// reading only those.
+func pruneNFHistory(ctx context.Context, nfInstanceID string, maxEvents int) {
+	docs, err := dbadapter.GetManyBeyondNewest(ctx, dbadapter.NfHistoryCollection,
+		bson.M{"nfInstanceId": nfInstanceID}, "time", maxEvents)
+	if err != nil {
+		logger.ManagementLog.Warnf("failed to read history of nf instance [%s]: %v", nfInstanceID, err)
+		return
+	}
+	if len(docs) == 0 {
+		return
+	}
+	ids := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc["id"])
+	}
+	if err := dbadapter.DeleteMany(ctx, dbadapter.NfHistoryCollection, bson.M{"id": bson.M{"$in": ids}}); err != nil {
+		logger.ManagementLog.Warnf("failed to drop old history of nf instance [%s]: %v", nfInstanceID, err)
+	}
+}
+
+// recordNFRegistered records the registration of nf, with the changes against
+// the profile previousDoc it replaces, if any.
+func recordNFRegistered(ctx context.Context, previousDoc map[string]interface{}, nf models.NFProfile, version int64) {
+	if !factory.NrfConfig.GetNfHistoryConfig().Enable {
+		return
+	}
+	event := NfHistoryEvent{
+		NfInstanceId:   nf.GetNfInstanceId(),
+		NfType:         string(nf.GetNfType()),
+		Event:          NfEventRegistered,
+		ProfileVersion: version,
+		Profile:        &nf,
+	}
+	if previousDoc != nil {
+		event.Changes = nfHistoryChanges(previousDoc, nf)
+	}
+	recordNFHistory(ctx, event)
+}
+
+// recordNFUpdated records the update of the profile previousDoc into current,
+// as a suspension if it suspended the NF instance. Updates changing only what
+// a heartbeat refreshes are not recorded.
+func recordNFUpdated(ctx context.Context, previousDoc map[string]interface{}, current models.NFProfile, version int64) {
+	if !factory.NrfConfig.GetNfHistoryConfig().Enable {
+		return
+	}
+	changes := nfHistoryChanges(previousDoc, current)
+	if len(changes) == 0 {
+		return
+	}
+	event := NfEventUpdated
+	for _, change := range changes {
+		if change.Path == "/nfStatus" && change.NewValue == string(models.NFSTATUS_SUSPENDED) {
+			event = NfEventSuspended
+		}
+	}
+	recordNFHistory(ctx, NfHistoryEvent{
+		NfInstanceId:   current.GetNfInstanceId(),
+		NfType:         string(current.GetNfType()),
+		Event:          event,
+		ProfileVersion: version,
+		Changes:        changes,
+	})
+}
+
+// recordNFRemoved records event, a deregistration or an expiry, of the NF
+// instance whose last stored profile is doc.
+func recordNFRemoved(ctx context.Context, event string, nfInstanceID string, doc map[string]interface{}) {
+	if !factory.NrfConfig.GetNfHistoryConfig().Enable {
+		return
+	}
+	historyEvent := NfHistoryEvent{
+		NfInstanceId:   nfInstanceID,
+		Event:          event,
+		ProfileVersion: nfProfileVersion(doc),
+	}
+	if nfProfile, err := util.DecodeNFProfile(doc); err == nil {
+		historyEvent.NfType = string(nfProfile.GetNfType())
+		historyEvent.Profile = &nfProfile
+	} else {
+		nfType, _ := doc["nftype"].(string)
+		historyEvent.NfType = nfType
+	}
+	recordNFHistory(ctx, historyEvent)
+}
+
+// nfHistoryChanges returns the changes from the profile previousDoc to
+// current, leaving out those a heartbeat makes.
+func nfHistoryChanges(previousDoc map[string]interface{}, current models.NFProfile) []models.ChangeItem {
+	previous, err := util.DecodeNFProfile(previousDoc)
+	if err != nil {
+		logger.ManagementLog.Warnf("cannot decode previous nf profile [%s]: %v", current.GetNfInstanceId(), err)
+		return nil
+	}
+	changes, err := nfProfileChanges(previous, current)
+	if err != nil {
+		logger.ManagementLog.Warnf("cannot compute changes of nf profile [%s]: %v", current.GetNfInstanceId(), err)
+		return nil
+	}
+	return slices.DeleteFunc(changes, func(change models.ChangeItem) bool {
+		return nfHistoryIgnoredPaths[change.Path]
+	})
+}
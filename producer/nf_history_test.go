@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/util/httpwrapper"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestNfHistory(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalHistory := factory.NrfConfig.Configuration.NfHistory
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.NfHistory = originalHistory
+		factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable
+	}()
+	dbadapter.DBClient = dbadapter.NewMemoryDBClient()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+	factory.NrfConfig.Configuration.NfHistory = &factory.NfHistory{Enable: true, MaxEvents: 4}
+
+	listHistory := func(params map[string]string, query url.Values) *httpwrapper.Response {
+		request := &httpwrapper.Request{Params: params, Query: query}
+		if params != nil {
+			return HandleGetNfInstanceHistoryRequest(context.Background(), request)
+		}
+		return HandleListNfHistoryRequest(context.Background(), request)
+	}
+	events := func(params map[string]string, query url.Values) []NfHistoryEvent {
+		t.Helper()
+		response := listHistory(params, query)
+		if response.Status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+		}
+		return response.Body.([]NfHistoryEvent)
+	}
+	// Events of an NF instance are told apart by their time
+	step := func(patch string, id string) {
+		t.Helper()
+		time.Sleep(2 * time.Millisecond)
+		if response := heartbeat(id, patch); response.Status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+		}
+	}
+
+	nfInstanceIDs := registerHeartbeatProfiles(t, 2)
+	id := nfInstanceIDs[0]
+	step(`[{"op":"replace","path":"/priority","value":5}]`, id)
+	step(`[{"op":"replace","path":"/load","value":10}]`, id)
+	step(`[{"op":"replace","path":"/nfStatus","value":"SUSPENDED"}]`, id)
+	time.Sleep(2 * time.Millisecond)
+	if _, problemDetails := NFDeregisterProcedure(context.Background(), id); problemDetails != nil {
+		t.Fatalf("failed to deregister NF: %+v", problemDetails)
+	}
+
+	history := events(map[string]string{"nfInstanceID": id}, nil)
+	want := []string{NfEventDeregistered, NfEventSuspended, NfEventUpdated, NfEventRegistered}
+	if len(history) != len(want) {
+		t.Fatalf("expected events %v, got %+v", want, history)
+	}
+	for i, event := range history {
+		if event.Event != want[i] || event.NfInstanceId != id || event.NfType != "AMF" {
+			t.Errorf("expected event %d to be %s of AMF %s, got %+v", i, want[i], id, event)
+		}
+	}
+	if changes := history[2].Changes; len(changes) != 1 || changes[0].Path != "/priority" {
+		t.Errorf("expected the update to change /priority only, got %+v", changes)
+	}
+	if history[0].Profile == nil || history[0].Profile.GetNfInstanceId() != id {
+		t.Errorf("expected the deregistration to keep the last profile, got %+v", history[0].Profile)
+	}
+	if history[3].Profile == nil || history[3].ProfileVersion != 1 {
+		t.Errorf("expected the registration to keep the profile at version 1, got %+v", history[3])
+	}
+
+	// Filters
+	if suspended := events(nil, url.Values{"event": {NfEventSuspended}}); len(suspended) != 1 || suspended[0].NfInstanceId != id {
+		t.Errorf("expected the suspension only, got %+v", suspended)
+	}
+	since := url.Values{"since": {history[1].Time.Format(time.RFC3339Nano)}}
+	if recent := events(map[string]string{"nfInstanceID": id}, since); len(recent) != 2 {
+		t.Errorf("expected the events since the suspension, got %+v", recent)
+	}
+	if all := events(nil, url.Values{"nfType": {"AMF"}}); len(all) != 5 {
+		t.Errorf("expected the events of both AMF instances, got %d", len(all))
+	}
+	if response := listHistory(nil, url.Values{"event": {"RESTARTED"}}); response.Status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an unknown event, got %d", http.StatusBadRequest, response.Status)
+	}
+	if response := listHistory(nil, url.Values{"since": {"yesterday"}}); response.Status != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid date, got %d", http.StatusBadRequest, response.Status)
+	}
+	if response := listHistory(map[string]string{"nfInstanceID": "unknown"}, nil); response.Status != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown NF instance, got %d", http.StatusNotFound, response.Status)
+	}
+
+	// Only the latest MaxEvents events are kept
+	other := nfInstanceIDs[1]
+	for _, priority := range []string{"1", "2", "3", "4"} {
+		step(`[{"op":"replace","path":"/priority","value":`+priority+`}]`, other)
+	}
+	history = events(map[string]string{"nfInstanceID": other}, nil)
+	if len(history) != 4 {
+		t.Fatalf("expected 4 events, got %+v", history)
+	}
+	for _, event := range history {
+		if event.Event != NfEventUpdated {
+			t.Errorf("expected the registration to be dropped first, got %+v", event)
+		}
+	}
+}
+
+// changeStreamDBClient hands the removal of an NF profile to
+// HandleNFProfileChange as soon as it happens, before the NRF removing it
+// goes on, as the change stream of another NRF may.
+type changeStreamDBClient struct {
+	*dbadapter.MemoryDBClient
+}
+
+func (db changeStreamDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	previous, _ := db.RestfulAPIGetOne(collName, filter)
+	swapped, err := db.MemoryDBClient.RestfulAPICompareAndSwap(collName, filter, expected, putData)
+	if swapped && putData == nil && collName == "NfProfile" {
+		HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: previous})
+	}
+	return swapped, err
+}
+
+func TestNfHistoryRecordsRemovalOnce(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalHistory := factory.NrfConfig.Configuration.NfHistory
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.NfHistory = originalHistory
+		factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable
+		deregistrationClaims.Store(false)
+	}()
+	db := changeStreamDBClient{dbadapter.NewMemoryDBClient()}
+	dbadapter.DBClient = db
+	factory.NrfConfig.Configuration.NfHistory = &factory.NfHistory{Enable: true}
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+	EnableDeregistrationClaims()
+
+	stored := func(nfInstanceID string) map[string]interface{} {
+		t.Helper()
+		doc, err := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID})
+		if err != nil || doc == nil {
+			t.Fatalf("failed to read profile %s: %v", nfInstanceID, err)
+		}
+		return doc
+	}
+	removals := func(nfInstanceID string) []string {
+		t.Helper()
+		var events []string
+		history, problemDetails := ListNfHistoryProcedure(context.Background(), nfHistoryQuery{nfInstanceID: nfInstanceID})
+		if problemDetails != nil {
+			t.Fatalf("failed to list history of %s: %+v", nfInstanceID, problemDetails)
+		}
+		for _, event := range history {
+			if event.Event != NfEventRegistered {
+				events = append(events, event.Event)
+			}
+		}
+		return events
+	}
+	nfInstanceIDs := registerHeartbeatProfiles(t, 3)
+
+	// Deregistered by this NRF, the deletion being seen in the change stream
+	// during and after the deregistration
+	deregistered := nfInstanceIDs[0]
+	doc := stored(deregistered)
+	if _, problemDetails := NFDeregisterProcedure(context.Background(), deregistered); problemDetails != nil {
+		t.Fatalf("failed to deregister NF: %+v", problemDetails)
+	}
+	HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: doc})
+	if events := removals(deregistered); len(events) != 1 || events[0] != NfEventDeregistered {
+		t.Errorf("expected a single %s event, got %v", NfEventDeregistered, events)
+	}
+
+	// Expired by this NRF, the deletion being seen in the change stream
+	expired := nfInstanceIDs[1]
+	doc = stored(expired)
+	now := time.Now()
+	doc["expireAt"] = now.Add(-time.Second)
+	if _, err := db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": expired}, doc); err != nil {
+		t.Fatalf("failed to expire profile: %v", err)
+	}
+	expireNFProfiles(now)
+	HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: doc})
+	if events := removals(expired); len(events) != 1 || events[0] != NfEventExpired {
+		t.Errorf("expected a single %s event, got %v", NfEventExpired, events)
+	}
+
+	// Removed by the TTL index, the deletion being seen by two NRFs
+	removed := nfInstanceIDs[2]
+	doc = stored(removed)
+	if err := db.RestfulAPIDeleteOne("NfProfile", bson.M{"nfinstanceid": removed}); err != nil {
+		t.Fatalf("failed to remove profile: %v", err)
+	}
+	HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: doc})
+	HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: doc})
+	if events := removals(removed); len(events) != 1 || events[0] != NfEventExpired {
+		t.Errorf("expected a single %s event, got %v", NfEventExpired, events)
+	}
+}
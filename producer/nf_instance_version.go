@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// nfProfileVersionField is stored in every NfProfile document and incremented
+// on each write. It backs the ETag returned by the nf-instances resource.
+const nfProfileVersionField = "profileVersion"
+
+var (
+	errNFInstanceNotFound = errors.New("NF instance not found")
+	errPreconditionFailed = errors.New("If-Match precondition failed")
+	errInvalidPatch       = errors.New("invalid JSON patch")
+)
+
+// nfProfileVersion returns the version of a stored NfProfile document, 0 for
+// documents written before versioning was introduced.
+func nfProfileVersion(doc map[string]interface{}) int64 {
+	switch version := doc[nfProfileVersionField].(type) {
+	case int32:
+		return int64(version)
+	case int64:
+		return version
+	case int:
+		return int64(version)
+	case float64:
+		return int64(version)
+	default:
+		return 0
+	}
+}
+
+// nfProfileVersionCondition matches a document still at the given version.
+// MongoDB matches a null condition against documents lacking the field, so
+// unversioned documents are covered too.
+func nfProfileVersionCondition(version int64) bson.M {
+	if version == 0 {
+		return bson.M{nfProfileVersionField: nil}
+	}
+	return bson.M{nfProfileVersionField: version}
+}
+
+func nfProfileETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+func setNFProfileETag(header http.Header, version int64) http.Header {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("ETag", nfProfileETag(version))
+	return header
+}
+
+// ifMatchSatisfied evaluates If-Match header values (RFC 9110 clause 13.1.1)
+// against the current version. Weak entity tags never match.
+func ifMatchSatisfied(ifMatch []string, version int64) bool {
+	etag := nfProfileETag(version)
+	for _, value := range ifMatch {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func preconditionFailedProblemDetails(detail string) *models.ProblemDetails {
+	return utils.ProblemDetails("Precondition Failed", http.StatusPreconditionFailed, fmt.Sprintf("%s: %s", errPreconditionFailed, detail))
+}
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	queryParamNFType     = "nf-type"
+	queryParamLimit      = "limit"
+	queryParamPageNumber = "page-number"
+	queryParamPageSize   = "page-size"
+
+	// defaultNFInstancesPageSize applies when only page-number is requested.
+	defaultNFInstancesPageSize = 20
+)
+
+// nfInstancesQuery holds the query parameters of GET /nf-instances
+// (3GPP TS 29.510 clause 6.1.3.2.3.1). Zero values mean "not requested".
+type nfInstancesQuery struct {
+	nfType     string
+	limit      int
+	pageNumber int
+	pageSize   int
+}
+
+func (q nfInstancesQuery) paged() bool {
+	return q.pageNumber > 0
+}
+
+// values encodes the query for the _links of the response, replacing the
+// page number with the given one when paging.
+func (q nfInstancesQuery) values(pageNumber int) url.Values {
+	values := url.Values{}
+	if q.nfType != "" {
+		values.Set(queryParamNFType, q.nfType)
+	}
+	if q.limit > 0 {
+		values.Set(queryParamLimit, strconv.Itoa(q.limit))
+	}
+	if q.paged() {
+		values.Set(queryParamPageNumber, strconv.Itoa(pageNumber))
+		values.Set(queryParamPageSize, strconv.Itoa(q.pageSize))
+	}
+	return values
+}
+
+func parseNFInstancesQuery(query url.Values) (nfInstancesQuery, *models.ProblemDetails) {
+	var q nfInstancesQuery
+	var invalidParams []models.InvalidParam
+	positive := func(name string) int {
+		raw := query.Get(name)
+		if raw == "" {
+			return 0
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			invalidParam := models.InvalidParam{Param: name}
+			invalidParam.SetReason(fmt.Sprintf("%s must be a positive integer, got %q", name, raw))
+			invalidParams = append(invalidParams, invalidParam)
+			return 0
+		}
+		return value
+	}
+
+	q.nfType = query.Get(queryParamNFType)
+	q.limit = positive(queryParamLimit)
+	q.pageNumber = positive(queryParamPageNumber)
+	q.pageSize = positive(queryParamPageSize)
+	if len(invalidParams) != 0 {
+		logger.ManagementLog.Errorln("invalid GetNFInstances query:", query.Encode())
+		problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", http.StatusBadRequest,
+			"invalid query parameter", utils.CauseInvalidRequest)
+		problemDetails.SetInvalidParams(invalidParams)
+		return q, problemDetails
+	}
+	if q.pageSize > 0 && q.pageNumber == 0 {
+		q.pageNumber = 1
+	}
+	if q.pageNumber > 0 && q.pageSize == 0 {
+		q.pageSize = defaultNFInstancesPageSize
+	}
+	return q, nil
+}
+
+// GetNFInstancesProcedure lists the URIs of the registered NF instances,
+// ordered by NF instance ID so that pages are stable across requests. limit
+// caps the size of the whole collection before it is split into pages.
+func GetNFInstancesProcedure(ctx context.Context, q nfInstancesQuery) (response *nrfContext.UriList,
+	problemDetail *models.ProblemDetails,
+) {
+	filter := bson.M{}
+	if q.nfType != "" {
+		filter["nftype"] = q.nfType
+	}
+	// Only their IDs are read, not the whole profiles
+	nfProfiles, err := dbadapter.GetManyFields(ctx, "NfProfile", filter, []string{"nfinstanceid"})
+	if err != nil {
+		logger.ManagementLog.Errorln("failed to get NF instances:", err)
+		return nil, storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+	}
+
+	nfInstanceIDs := make([]string, 0, len(nfProfiles))
+	for _, nfProfile := range nfProfiles {
+		if nfInstanceID, ok := nfProfile["nfinstanceid"].(string); ok && nfInstanceID != "" {
+			nfInstanceIDs = append(nfInstanceIDs, nfInstanceID)
+		}
+	}
+	sort.Strings(nfInstanceIDs)
+	if q.limit > 0 && q.limit < len(nfInstanceIDs) {
+		nfInstanceIDs = nfInstanceIDs[:q.limit]
+	}
+	total := int32(len(nfInstanceIDs))
+
+	pageNumber := q.pageNumber
+	page := nfInstanceIDs
+	if q.paged() {
+		start := min((pageNumber-1)*q.pageSize, len(nfInstanceIDs))
+		end := min(start+q.pageSize, len(nfInstanceIDs))
+		page = nfInstanceIDs[start:end]
+	}
+
+	uriList := &nrfContext.UriList{
+		Links: nrfContext.Links{
+			Self: nfInstancesLink(q.values(pageNumber)),
+			Item: make([]models.Link, 0, len(page)),
+		},
+		TotalItemCount: &total,
+	}
+	for _, nfInstanceID := range page {
+		var item models.Link
+		item.SetHref(nrfContext.GetNfInstanceURI(nfInstanceID))
+		uriList.Links.Item = append(uriList.Links.Item, item)
+	}
+	if q.paged() {
+		if pageNumber*q.pageSize < len(nfInstanceIDs) {
+			uriList.Links.Next = nfInstancesLink(q.values(pageNumber + 1))
+		}
+		if pageNumber > 1 {
+			// Point past-the-end pages back at the last existing page
+			lastPage := max((len(nfInstanceIDs)+q.pageSize-1)/q.pageSize, 1)
+			uriList.Links.Prev = nfInstancesLink(q.values(min(pageNumber-1, lastPage)))
+		}
+	}
+	return uriList, nil
+}
+
+func nfInstancesLink(query url.Values) *models.Link {
+	href := factory.NrfConfig.GetSbiUri() + "/nnrf-nfm/v1/nf-instances"
+	if encoded := query.Encode(); encoded != "" {
+		href += "?" + encoded
+	}
+	link := &models.Link{}
+	link.SetHref(href)
+	return link
+}
@@ -6,16 +6,15 @@
 package producer
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"maps"
 	"net/http"
-	"strconv"
 	"time"
 
-	"github.com/go-viper/mapstructure/v2"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	nrfContext "github.com/omec-project/nrf/context"
 	"github.com/omec-project/nrf/dbadapter"
 	"github.com/omec-project/nrf/factory"
@@ -28,9 +27,12 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-const nfStatusNotifyTimeout = 10 * time.Second
-
-var nfStatusNotifyHTTPClient = &http.Client{Timeout: nfStatusNotifyTimeout}
+// nfInstancePatchPaths map the paths of NF profile attributes to their key in
+// the stored NfProfile documents.
+var nfInstancePatchPaths = map[string]string{
+	"/nfStatus":            "/nfstatus",
+	"/sharedProfileDataId": "/sharedprofiledataid",
+}
 
 func normalizeNFInstancePatchJSON(patchJSON []byte) []byte {
 	var patchItems []models.PatchItem
@@ -40,8 +42,8 @@ func normalizeNFInstancePatchJSON(patchJSON []byte) []byte {
 
 	changed := false
 	for index := range patchItems {
-		if patchItems[index].Path == "/nfStatus" {
-			patchItems[index].Path = "/nfstatus"
+		if path, ok := nfInstancePatchPaths[patchItems[index].Path]; ok {
+			patchItems[index].Path = path
 			changed = true
 		}
 	}
@@ -58,11 +60,11 @@ func normalizeNFInstancePatchJSON(patchJSON []byte) []byte {
 	return normalizedPatchJSON
 }
 
-func HandleNFDeregisterRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleNFDeregisterRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle NFDeregisterRequest")
 	nfInstanceId := request.Params["nfInstanceID"]
 
-	nfType, problemDetails := NFDeregisterProcedure(nfInstanceId)
+	nfType, problemDetails := nfDeregister(ctx, nfInstanceId, request.Header.Values("If-Match"))
 
 	if problemDetails != nil {
 		logger.ManagementLog.Debugln("deregister failure")
@@ -75,25 +77,28 @@ func HandleNFDeregisterRequest(request *httpwrapper.Request) *httpwrapper.Respon
 	}
 }
 
-func HandleGetNFInstanceRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleGetNFInstanceRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle GetNFInstanceRequest")
 	nfInstanceId := request.Params["nfInstanceID"]
 
-	response := GetNFInstanceProcedure(nfInstanceId)
-
-	if response != nil {
-		return httpwrapper.NewResponse(http.StatusOK, nil, response)
-	} else {
+	response, version, err := getNFInstance(ctx, nfInstanceId)
+	switch {
+	case errors.Is(err, dbadapter.ErrNotFound):
 		problemDetails := utils.ProblemDetailsContextNotFound("NF instance not found")
 		return httpwrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	case err != nil:
+		logger.ManagementLog.Warnf("failed to get NF instance %s: %v", nfInstanceId, err)
+		problemDetails := storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
 	}
+	return httpwrapper.NewResponse(http.StatusOK, setNFProfileETag(nil, version), response)
 }
 
-func HandleNFRegisterRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleNFRegisterRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle NFRegisterRequest")
 	nfProfile := request.Body.(models.NFProfile)
 
-	header, response, problemDetails := NFRegisterProcedure(nfProfile)
+	header, response, problemDetails := NFRegisterProcedure(ctx, nfProfile)
 
 	if response != nil {
 		logger.ManagementLog.Debugln("register success")
@@ -110,7 +115,7 @@ func HandleNFRegisterRequest(request *httpwrapper.Request) *httpwrapper.Response
 	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 }
 
-func HandleUpdateNFInstanceRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleUpdateNFInstanceRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle UpdateNFInstanceRequest")
 	nfInstanceID := request.Params["nfInstanceID"]
 	if nfInstanceID == "" {
@@ -127,11 +132,28 @@ func HandleUpdateNFInstanceRequest(request *httpwrapper.Request) *httpwrapper.Re
 	}
 	patchJSON = normalizeNFInstancePatchJSON(patchJSON)
 
-	response, err := updateNFInstanceProcedure(nfInstanceID, patchJSON)
-	if err != nil {
+	response, version, err := updateNFInstanceProcedure(ctx, nfInstanceID, patchJSON, request.Header.Values("If-Match"))
+	var validationErr *nrfContext.ProfileValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		logger.ManagementLog.Errorln("updated NfProfile validation failed:", err)
+		problemDetails := profileValidationProblemDetails(err)
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	case errors.Is(err, errInvalidPatch):
 		logger.ManagementLog.Errorln("updateNFInstanceProcedure failed:", err)
-		problemDetails := utils.ProblemDetailsSystemFailure("Update procedure failed")
-		return httpwrapper.NewResponse(http.StatusInternalServerError, nil, problemDetails)
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax(err.Error())
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	case errors.Is(err, errNFInstanceNotFound):
+		problemDetails := utils.ProblemDetailsContextNotFound("NF instance not found")
+		return httpwrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	case errors.Is(err, errPreconditionFailed):
+		logger.ManagementLog.Warnf("update of nf profile [%s] rejected: %v", nfInstanceID, err)
+		problemDetails := preconditionFailedProblemDetails("NF profile was modified")
+		return httpwrapper.NewResponse(http.StatusPreconditionFailed, nil, problemDetails)
+	case err != nil:
+		logger.ManagementLog.Errorln("updateNFInstanceProcedure failed:", err)
+		problemDetails := storageProblemDetails(err, utils.ProblemDetailsSystemFailure("Update procedure failed"))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
 	}
 
 	if response == nil {
@@ -147,22 +169,17 @@ func HandleUpdateNFInstanceRequest(request *httpwrapper.Request) *httpwrapper.Re
 	}
 
 	stats.IncrementNrfRegistrationsStats("update", nfType, "SUCCESS")
-	return httpwrapper.NewResponse(http.StatusOK, nil, response)
+	return httpwrapper.NewResponse(http.StatusOK, setNFProfileETag(nil, version), response)
 }
 
-func HandleGetNFInstancesRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleGetNFInstancesRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("handle GetNFInstancesRequest")
-	nfType := request.Query.Get("nf-type")
-	limitRaw := request.Query.Get("limit")
-	limit, err := strconv.Atoi(limitRaw)
-	if err != nil {
-		logger.ManagementLog.Errorln("error converting limit query parameter:", limitRaw, err)
-		problemDetails := utils.ProblemDetails("Invalid Parameter", http.StatusBadRequest, err.Error())
-
+	query, problemDetails := parseNFInstancesQuery(request.Query)
+	if problemDetails != nil {
 		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
 	}
 
-	response, problemDetails := GetNFInstancesProcedure(nfType, limit)
+	response, problemDetails := GetNFInstancesProcedure(ctx, query)
 	if response != nil {
 		logger.ManagementLog.Debugln("GetNFInstances success")
 		return httpwrapper.NewResponse(http.StatusOK, nil, response)
@@ -175,39 +192,50 @@ func HandleGetNFInstancesRequest(request *httpwrapper.Request) *httpwrapper.Resp
 	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 }
 
-func HandleRemoveSubscriptionRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleRemoveSubscriptionRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle RemoveSubscription")
 	subscriptionID := request.Params["subscriptionID"]
 
-	nfType := GetNfTypeBySubscriptionID(request.Params["subscriptionID"])
-	RemoveSubscriptionProcedure(subscriptionID)
+	nfType := GetNfTypeBySubscriptionID(ctx, subscriptionID)
+	if problemDetails := RemoveSubscriptionProcedure(ctx, subscriptionID); problemDetails != nil {
+		stats.IncrementNrfSubscriptionsStats("unsubscribe", nfType, "FAILURE")
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
 	stats.IncrementNrfSubscriptionsStats("unsubscribe", nfType, "SUCCESS")
 
 	return httpwrapper.NewResponse(http.StatusNoContent, nil, nil)
 }
 
-func HandleUpdateSubscriptionRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleUpdateSubscriptionRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle UpdateSubscription")
 	subscriptionID := request.Params["subscriptionID"]
-	patchJSON := request.Body.([]byte)
 
-	nfType := GetNfTypeBySubscriptionID(subscriptionID)
-	response := UpdateSubscriptionProcedure(subscriptionID, patchJSON)
-
-	if response != nil {
-		stats.IncrementNrfSubscriptionsStats("update", nfType, "SUCCESS")
-		return httpwrapper.NewResponse(http.StatusOK, nil, response)
-	} else {
+	nfType := GetNfTypeBySubscriptionID(ctx, subscriptionID)
+	patchJSON, ok := request.Body.([]byte)
+	if !ok {
 		stats.IncrementNrfSubscriptionsStats("update", nfType, "FAILURE")
-		return httpwrapper.NewResponse(http.StatusNoContent, nil, nil)
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax("subscription update must be a JSON Patch")
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
 	}
+	subscription, problemDetails := UpdateSubscriptionProcedure(ctx, subscriptionID, patchJSON)
+	if problemDetails != nil {
+		stats.IncrementNrfSubscriptionsStats("update", nfType, "FAILURE")
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	stats.IncrementNrfSubscriptionsStats("update", nfType, "SUCCESS")
+	return httpwrapper.NewResponse(http.StatusOK, nil, subscription)
 }
 
-func HandleCreateSubscriptionRequest(request *httpwrapper.Request) *httpwrapper.Response {
+func HandleCreateSubscriptionRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
 	logger.ManagementLog.Infoln("Handle CreateSubscriptionRequest")
-	subscription := request.Body.(models.SubscriptionData)
+	subscription, ok := request.Body.(models.SubscriptionData)
+	if !ok {
+		stats.IncrementNrfSubscriptionsStats("subscribe", "UNKNOWN_NF", "FAILURE")
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax("subscription must be a SubscriptionData")
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
 
-	response, problemDetails := CreateSubscriptionProcedure(subscription)
+	response, problemDetails := CreateSubscriptionProcedure(ctx, subscription)
 	if response != nil {
 		logger.ManagementLog.Debugln("CreateSubscription success")
 		stats.IncrementNrfSubscriptionsStats("subscribe", string(subscription.GetReqNfType()), "SUCCESS")
@@ -223,10 +251,23 @@ func HandleCreateSubscriptionRequest(request *httpwrapper.Request) *httpwrapper.
 	return httpwrapper.NewResponse(http.StatusForbidden, nil, problemDetails)
 }
 
-func CreateSubscriptionProcedure(subscription models.SubscriptionData) (response bson.M,
+func CreateSubscriptionProcedure(ctx context.Context, subscription models.SubscriptionData) (response bson.M,
 	problemDetails *models.ProblemDetails,
 ) {
+	if problemDetails = validateSubscriptionCallback(ctx, subscription.GetNfStatusNotificationUri()); problemDetails != nil {
+		return nil, problemDetails
+	}
+	if problemDetails = authorizeSubscription(ctx, subscription); problemDetails != nil {
+		return nil, problemDetails
+	}
 	subscription.SetSubscriptionId(nrfContext.SetsubscriptionId())
+	validityTime, problemDetails := grantValidityTime(subscription.ValidityTime, time.Now())
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+	if !validityTime.IsZero() {
+		subscription.SetValidityTime(validityTime)
+	}
 
 	tmp, err := json.Marshal(subscription)
 	if err != nil {
@@ -237,10 +278,19 @@ func CreateSubscriptionProcedure(subscription models.SubscriptionData) (response
 	if err != nil {
 		logger.ManagementLog.Errorln("Unmarshal error in CreateSubscriptionProcedure: ", err)
 	}
+	storedData := maps.Clone(putData)
+	if !validityTime.IsZero() {
+		storedData[subscriptionExpiryField] = validityTime
+	}
+	storedData[dbadapter.SchemaVersionField] = dbadapter.SubscriptionsSchemaVersion
 
 	// TODO: need to store Condition !
-	if ok, _ := dbadapter.DBClient.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": subscription.GetSubscriptionId()},
-		putData); !ok { // subscription id not exist before
+	ok, err := dbadapter.Post(ctx, "Subscriptions", bson.M{"subscriptionId": subscription.GetSubscriptionId()}, storedData)
+	if err != nil {
+		logger.ManagementLog.Errorln("failed to store subscription:", err)
+		return nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+	}
+	if !ok { // subscription id not exist before
 		return putData, nil
 	} else {
 		problemDetails = utils.ProblemDetailsWithCause("Create subscription error", http.StatusBadRequest, "", utils.CauseCreateSubscriptionError)
@@ -248,60 +298,101 @@ func CreateSubscriptionProcedure(subscription models.SubscriptionData) (response
 	}
 }
 
-func UpdateSubscriptionProcedure(subscriptionID string, patchJSON []byte) (response map[string]interface{}) {
+// UpdateSubscriptionProcedure renews a subscription with the validityTime
+// requested by patchJSON, within the configured maximum, if any.
+func UpdateSubscriptionProcedure(ctx context.Context, subscriptionID string, patchJSON []byte) (*models.SubscriptionData, *models.ProblemDetails) {
+	requested, problemDetails := subscriptionPatchValidityTime(patchJSON)
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+	validityTime, problemDetails := grantValidityTime(&requested, time.Now())
+	if problemDetails != nil {
+		return nil, problemDetails
+	}
+
 	collName := "Subscriptions"
 	filter := bson.M{"subscriptionId": subscriptionID}
+	for attempt := 1; ; attempt++ {
+		doc, err := dbadapter.GetOne(ctx, collName, filter)
+		if errors.Is(err, dbadapter.ErrNotFound) {
+			return nil, utils.ProblemDetailsContextNotFound("Subscription not found")
+		}
+		if err != nil {
+			logger.ManagementLog.Warnln("Error UpdateSubscriptionProcedure: ", err)
+			return nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+		}
 
-	err := dbadapter.DBClient.RestfulAPIJSONPatch(collName, filter, patchJSON)
-	if err == nil {
-		response, _ = dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
-		return response
-	} else {
-		logger.ManagementLog.Warnln("Error UpdateSubscriptionProcedure: ", err)
-		return nil
+		// Replace the subscription as read rather than merging a patch, which
+		// would store expireAt as a string the TTL index ignores
+		renewed := make(map[string]interface{}, len(doc))
+		for key, value := range doc {
+			if key != "_id" {
+				renewed[key] = value
+			}
+		}
+		renewed["validityTime"] = validityTime.Format(time.RFC3339)
+		renewed[subscriptionExpiryField] = validityTime
+		swapped, err := dbadapter.CompareAndSwap(ctx, collName, filter, bson.M{"validityTime": doc["validityTime"]}, renewed)
+		if err != nil {
+			logger.ManagementLog.Warnln("Error UpdateSubscriptionProcedure: ", err)
+			return nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+		}
+		if !swapped {
+			if attempt < nfInstanceUpdateAttempts {
+				continue
+			}
+			return nil, utils.ProblemDetails("Conflict", http.StatusConflict, "subscription modified concurrently")
+		}
+		subscription, err := decodeSubscription(renewed)
+		if err != nil {
+			logger.ManagementLog.Warnln("Error UpdateSubscriptionProcedure: ", err)
+			return nil, utils.ProblemDetailsSystemFailure(err.Error())
+		}
+		logger.ManagementLog.Infof("subscription %s renewed until %s", subscriptionID, validityTime.Format(time.RFC3339))
+		return &subscription, nil
 	}
 }
 
-func RemoveSubscriptionProcedure(subscriptionID string) {
+// RemoveSubscriptionProcedure removes a subscription, failing with 404 if it
+// does not exist.
+func RemoveSubscriptionProcedure(ctx context.Context, subscriptionID string) *models.ProblemDetails {
 	collName := "Subscriptions"
 	filter := bson.M{"subscriptionId": subscriptionID}
 	logger.ManagementLog.Infoln("removing SubscriptionId:", subscriptionID)
 
-	err := dbadapter.DBClient.RestfulAPIDeleteMany(collName, filter)
+	_, err := dbadapter.GetOne(ctx, collName, filter)
+	if errors.Is(err, dbadapter.ErrNotFound) {
+		return utils.ProblemDetailsContextNotFound("Subscription not found")
+	}
 	if err != nil {
+		logger.ManagementLog.Errorf("failed to get subscription with ID %s: %v", subscriptionID, err)
+		return storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+	}
+	if err := dbadapter.DeleteMany(ctx, collName, filter); err != nil {
 		logger.ManagementLog.Errorf("failed to remove subscription with ID %s: %v", subscriptionID, err)
-		return
+		return storageProblemDetails(err, utils.ProblemDetailsWithCause("Subscription delete error",
+			http.StatusInternalServerError, err.Error(), utils.CauseSubscriptionDeleteError))
 	}
+	forgetSubscriptionDelivery(subscriptionID)
 	logger.ManagementLog.Infof("removed subscription with ID %s", subscriptionID)
+	return nil
 }
 
-func GetNFInstancesProcedure(nfType string, limit int) (response *nrfContext.UriList,
-	problemDetail *models.ProblemDetails,
-) {
-	// nfType := c.Query("nf-type")
-	// limit, err := strconv.Atoi(c.Query("limit"))
-	collName := "urilist"
-	filter := bson.M{"nfType": nfType}
-
-	UL, _ := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
-	logger.ManagementLog.Infoln("UL: ", UL)
-	originalUL := &nrfContext.UriList{}
-	err := mapstructure.Decode(UL, originalUL)
-	if err != nil {
-		logger.ManagementLog.Errorln("Decode error in GetNFInstancesProcedure: ", err)
-		problemDetail := utils.ProblemDetailsSystemFailure(err.Error())
-		return nil, problemDetail
-	}
-	nrfContext.NnrfUriListLimit(originalUL, limit)
-	// c.JSON(http.StatusOK, originalUL)
-	return originalUL, nil
-}
-
-func NFDeleteAll(nfType string) (problemDetails *models.ProblemDetails) {
+// NFDeleteAll removes every profile of nfType, as the legacy registration
+// replacing them does, without deregistering them. When NRF instances share
+// the database, each removal is claimed first, so that none of them takes it
+// for an expiry.
+func NFDeleteAll(ctx context.Context, nfType string) (problemDetails *models.ProblemDetails) {
 	collName := "NfProfile"
 	filter := bson.M{"nftype": nfType}
 
-	err := dbadapter.DBClient.RestfulAPIDeleteMany(collName, filter)
+	var err error
+	if deregistrationClaims.Load() {
+		err = removeNFProfilesClaimed(ctx, filter)
+	} else {
+		err = dbadapter.DeleteMany(ctx, collName, filter)
+	}
 	if err != nil {
 		logger.ManagementLog.Errorf("failed to delete NF profiles of type %s: %v", nfType, err)
 		problemDetails = utils.ProblemDetails("NF Profiles Deletion Failed", http.StatusInternalServerError, err.Error())
@@ -313,57 +404,95 @@ func NFDeleteAll(nfType string) (problemDetails *models.ProblemDetails) {
 	return nil
 }
 
-func NFDeregisterProcedure(nfInstanceID string) (nfType string, problemDetails *models.ProblemDetails) {
-	collName := "NfProfile"
-	filter := bson.M{"nfinstanceid": nfInstanceID}
-	nfType = GetNfTypeByNfInstanceID(nfInstanceID)
-
-	nfProfilesRaw, err := dbadapter.DBClient.RestfulAPIGetMany(collName, filter)
+// removeNFProfilesClaimed removes the profiles matching filter one by one,
+// each once its deregistration is claimed. A profile changed meanwhile is
+// left in place.
+func removeNFProfilesClaimed(ctx context.Context, filter bson.M) error {
+	docs, err := dbadapter.GetMany(ctx, "NfProfile", filter)
 	if err != nil {
-		logger.ManagementLog.Warnln("error fetching NF profiles:", err)
-		problemDetails = utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError)
-		return "", problemDetails
+		return err
 	}
+	for _, doc := range docs {
+		nfInstanceID, _ := doc["nfinstanceid"].(string)
+		if nfInstanceID == "" {
+			continue
+		}
+		if _, _, err := removeNFProfile(ctx, nfInstanceID, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	time.Sleep(time.Duration(1) * time.Second)
+// deleteNFInstanceSubscriptions removes the subscriptions to the status of a
+// deregistered NF instance.
+func deleteNFInstanceSubscriptions(ctx context.Context, nfInstanceID string) error {
+	filter := bson.M{"subscrCond.nfInstanceId": nfInstanceID}
+	return dbadapter.DeleteMany(ctx, "Subscriptions", filter)
+}
 
-	deleteManyErr := dbadapter.DBClient.RestfulAPIDeleteMany(collName, filter)
-	if deleteManyErr != nil {
-		logger.ManagementLog.Warnln("error in deleting NF profiles:", deleteManyErr)
-		problemDetails = utils.ProblemDetailsWithCause("NF delete error", http.StatusInternalServerError, deleteManyErr.Error(), utils.CauseNfDeleteError)
-		return "", problemDetails
-	}
-	profileCache.evict(nfInstanceID)
+func NFDeregisterProcedure(ctx context.Context, nfInstanceID string) (nfType string, problemDetails *models.ProblemDetails) {
+	return nfDeregister(ctx, nfInstanceID, nil)
+}
 
-	// nfProfile data for response
-	nfProfiles, err := util.Decode(nfProfilesRaw, time.RFC3339)
-	if err != nil {
-		logger.ManagementLog.Warnln("Time decode error: ", err)
-		problemDetails = utils.ProblemDetailsWithCause("Notification error", http.StatusInternalServerError, err.Error(), utils.CauseNotificationError)
-		return "", problemDetails
-	}
+// nfDeregister removes an NF instance. When ifMatch is not empty the profile
+// is only removed if it is still at the version named by the entity tag.
+func nfDeregister(ctx context.Context, nfInstanceID string, ifMatch []string) (nfType string, problemDetails *models.ProblemDetails) {
+	collName := "NfProfile"
+	filter := bson.M{"nfinstanceid": nfInstanceID}
+	flushHeartbeats(ctx, nfInstanceID)
+	nfType = GetNfTypeByNfInstanceID(ctx, nfInstanceID)
+
+	for attempt := 1; ; attempt++ {
+		nfProfilesRaw, err := dbadapter.GetMany(ctx, collName, filter)
+		if err != nil {
+			logger.ManagementLog.Warnln("error fetching NF profiles:", err)
+			problemDetails = storageProblemDetails(err,
+				utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+			return "", problemDetails
+		}
+		if len(ifMatch) != 0 && (len(nfProfilesRaw) == 0 || !ifMatchSatisfied(ifMatch, nfProfileVersion(nfProfilesRaw[0]))) {
+			return nfType, preconditionFailedProblemDetails("NF profile was modified or removed")
+		}
+		if len(nfProfilesRaw) == 0 {
+			break
+		}
 
-	// NF Down Notification to other instances of same NfType
-	if len(nfProfiles) != 0 {
-		nfProfile0 := util.ConvertNFProfileDiscoveryToNFProfile(nfProfiles[0])
-		sendNFDownNotification(nfProfile0, nfInstanceID)
-		uriList := nrfContext.GetNotificationUri(nfProfile0)
-		nfInstanceUri := nrfContext.GetNfInstanceURI(nfInstanceID)
-		// set info for NotificationData
-		Notification_event := models.NOTIFICATIONEVENTTYPE_NF_DEREGISTERED
-		for _, uri := range uriList {
-			logger.ManagementLog.Infof("status Notification Uri: %v", uri)
-			problemDetails = SendNFStatusNotify(Notification_event, nfInstanceUri, uri)
-			if problemDetails != nil {
-				logger.ManagementLog.Infoln("error in status notify", problemDetails)
+		removed, claimed, removeErr := removeNFProfile(ctx, nfInstanceID, nfProfilesRaw[0])
+		if removeErr != nil {
+			logger.ManagementLog.Warnln("error in deleting NF profiles:", removeErr)
+			problemDetails = storageProblemDetails(removeErr,
+				utils.ProblemDetailsWithCause("NF delete error", http.StatusInternalServerError, removeErr.Error(), utils.CauseNfDeleteError))
+			return "", problemDetails
+		}
+		if !removed {
+			if len(ifMatch) != 0 {
+				return nfType, preconditionFailedProblemDetails("NF profile was modified or removed")
+			}
+			if attempt < nfInstanceUpdateAttempts {
+				logger.ManagementLog.Infof("nf profile [%s] modified concurrently, retrying deregistration", nfInstanceID)
+				continue
+			}
+			problemDetails = utils.ProblemDetails("Conflict", http.StatusConflict, "NF profile modified concurrently")
+			return "", problemDetails
+		}
+		profileCache.evict(nfInstanceID)
+
+		if claimed {
+			recordNFRemoved(ctx, NfEventDeregistered, nfInstanceID, nfProfilesRaw[0])
+			nfProfile, err := util.DecodeNFProfile(nfProfilesRaw[0])
+			if err != nil {
+				// removed already: only its subscribers go without notification
+				logger.ManagementLog.Warnf("cannot decode removed nf profile [%s]: %v", nfInstanceID, err)
+			} else {
+				notifyNFDeregistered(ctx, nfProfile)
 			}
 		}
+		break
 	}
 
 	// delete subscriptions of deregistered NF instance
-	filter = bson.M{"subscrCond.nfInstanceId": nfInstanceID}
-	deleteErr := dbadapter.DBClient.RestfulAPIDeleteMany("Subscriptions", filter)
-	if deleteErr != nil {
+	if deleteErr := deleteNFInstanceSubscriptions(ctx, nfInstanceID); deleteErr != nil {
 		logger.ManagementLog.Warnln("error in deleting subscriptions:", deleteErr)
 		problemDetails = utils.ProblemDetailsWithCause("Subscription delete error", http.StatusInternalServerError, deleteErr.Error(), utils.CauseSubscriptionDeleteError)
 		return "", problemDetails
@@ -372,109 +501,215 @@ func NFDeregisterProcedure(nfInstanceID string) (nfType string, problemDetails *
 	return nfType, nil
 }
 
-func sendNFDownNotification(nfProfile models.NFProfile, nfInstanceID string) {
-	if nfProfile.GetNfType() == models.NFTYPE_AMF {
-		url := "http://amf:29518" + "/namf-oam/v1/amfInstanceDown/" + nfInstanceID
-		notifyCtx, cancel := context.WithTimeout(context.Background(), nfStatusNotifyTimeout)
-		defer cancel()
-
-		req, err := http.NewRequestWithContext(notifyCtx, http.MethodPost, url, nil)
-		if err != nil {
-			logger.ManagementLog.Infoln("Error in creating request ", err)
-			return
-		}
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := nfStatusNotifyHTTPClient.Do(req)
-		if err != nil {
-			logger.ManagementLog.Infoln("Errored when sending request to the server", err)
-			return
-		}
-		if resp != nil && resp.Body != nil {
-			defer func() {
-				if bodyCloseErr := resp.Body.Close(); bodyCloseErr != nil {
-					logger.ManagementLog.Errorf("NF down notification response body cannot close: %+v", bodyCloseErr)
-				}
-			}()
-		}
+// removeNFProfile removes doc, the stored profile of nfInstanceID, unless it
+// changed since it was read. The deregistration is claimed first, so that
+// the change stream leaves it to the NRF removing the profile: claimed
+// reports whether this NRF is the one to notify and record it. A profile
+// removed meanwhile, such as by the TTL index, counts as removed.
+func removeNFProfile(ctx context.Context, nfInstanceID string, doc map[string]interface{}) (removed, claimed bool, err error) {
+	collName := "NfProfile"
+	filter := bson.M{"nfinstanceid": nfInstanceID}
+	version := nfProfileVersion(doc)
+	claimed = claimDeregistration(nfInstanceID, version)
+	removed, err = dbadapter.CompareAndSwap(ctx, collName, filter, nfProfileVersionCondition(version), nil)
+	if err == nil && !removed {
+		_, getErr := dbadapter.GetOne(ctx, collName, filter)
+		removed = errors.Is(getErr, dbadapter.ErrNotFound)
+	}
+	if !removed && claimed {
+		releaseDeregistration(nfInstanceID, version)
 	}
+	return removed, claimed && removed, err
 }
 
-func updateNFInstanceProcedure(nfInstanceID string, patchJSON []byte) (*models.NFProfile, error) {
+// nfInstanceUpdateAttempts bounds how often an unconditional PATCH is retried
+// when a concurrent write changes the profile between read and swap.
+const nfInstanceUpdateAttempts = 3
+
+func updateNFInstanceProcedure(ctx context.Context, nfInstanceID string, patchJSON []byte, ifMatch []string) (*models.NFProfile, int64, error) {
 	// Validation for NF Instance ID
 	if nfInstanceID == "" {
 		logger.ManagementLog.Errorln("nf Instance ID is required")
-		return nil, fmt.Errorf("NF Instance ID is required")
+		return nil, 0, fmt.Errorf("NF Instance ID is required")
+	}
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errInvalidPatch, err)
 	}
 	collName := "NfProfile"
 	filter := bson.M{"nfinstanceid": nfInstanceID}
+	// Heartbeats are coalesced when batching is enabled, other updates
+	// see the heartbeats not written yet
+	batcher := heartbeatBatcherFor(patch)
+	if batcher == nil {
+		flushHeartbeats(ctx, nfInstanceID)
+	}
+
+	for attempt := 1; ; attempt++ {
+		var original map[string]interface{}
+		var flushes uint64
+		if batcher != nil {
+			original, flushes = batcher.latest(nfInstanceID)
+		}
+		if original == nil {
+			var getErr error
+			original, getErr = dbadapter.GetOne(ctx, collName, filter)
+			if errors.Is(getErr, dbadapter.ErrNotFound) {
+				return nil, 0, errNFInstanceNotFound
+			}
+			if getErr != nil {
+				logger.ManagementLog.Errorln("failed to get NF instance:", getErr)
+				return nil, 0, fmt.Errorf("failed to get NF instance: %w", getErr)
+			}
+		}
+		version := nfProfileVersion(original)
+		if len(ifMatch) != 0 && !ifMatchSatisfied(ifMatch, version) {
+			return nil, 0, errPreconditionFailed
+		}
 
-	// Patch the existing NF Instance
-	patchError := dbadapter.DBClient.RestfulAPIJSONPatch(collName, filter, patchJSON)
-	if patchError != nil {
-		logger.ManagementLog.Errorln("patch error in UpdateNFInstanceProcedure:", patchError)
-		return nil, fmt.Errorf("patch error: %v", patchError)
-	}
-	// Get the updated NF Instance
-	nf, getErr := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
-	if getErr != nil || nf == nil {
-		logger.ManagementLog.Errorln("failed to get NF instance:", getErr)
-		return nil, fmt.Errorf("failed to get NF instance: %v", getErr)
-	}
+		nf, patchErr := applyNFInstancePatch(original, patch)
+		if patchErr != nil {
+			logger.ManagementLog.Errorln("patch error in UpdateNFInstanceProcedure:", patchErr)
+			return nil, 0, patchErr
+		}
 
-	nfProfilesRaw := []map[string]interface{}{nf}
+		// Decode NF instance
+		updatedProfile, decodeErr := util.DecodeNFProfile(nf)
+		if decodeErr != nil {
+			logger.ManagementLog.Errorln("decoding error:", decodeErr)
+			return nil, 0, fmt.Errorf("%w: %v", errInvalidPatch, decodeErr)
+		}
+		nf, err = resolvePatchedSharedData(ctx, original, nf, &updatedProfile)
+		if err != nil {
+			return nil, 0, err
+		}
 
-	// Decode NF instance
-	nfProfiles, decodeErr := util.Decode(nfProfilesRaw, time.RFC3339)
-	if decodeErr != nil {
-		logger.ManagementLog.Errorln("decoding error:", decodeErr)
-		return nil, fmt.Errorf("decoding error: %v", decodeErr)
-	}
+		// Validate and answer the patched profile with the BSF ranges in their
+		// wire format
+		wireProfile := updatedProfile
+		nrfContext.DecodeBsfInfoRanges(&wireProfile)
+		if err := nrfContext.ValidateNFProfile(wireProfile); err != nil {
+			return nil, 0, err
+		}
 
-	if len(nfProfiles) == 0 {
-		// Handle empty decoded profiles case
-		logger.ManagementLog.Errorln("decoded NF profiles are empty")
-		return nil, fmt.Errorf("decoded NF profiles are empty")
+		// Update expiry time if enabled
+		// Currently we are using 3 times the hearbeat timer as the expiry time interval.
+		// We should update it to be configurable : TBD
+		if factory.NrfConfig.Configuration.NfProfileExpiryEnable {
+			timein := time.Now().Local().Add(time.Second * time.Duration(factory.NrfConfig.Configuration.NfKeepAliveTime*3))
+			nf["expireAt"] = timein
+		}
+		nf[nfProfileVersionField] = version + 1
+		nf[dbadapter.SchemaVersionField] = dbadapter.NfProfileSchemaVersion
+
+		var swapped bool
+		if batcher != nil {
+			// Coalesce the heartbeat unless the profile changed since it was
+			// read, the flush writing it notifies and records the change
+			enqueued, ok := batcher.enqueue(nfInstanceID, original, nf, updatedProfile, version, flushes)
+			if !ok {
+				// Batching stopped, the heartbeats enqueued so far are written
+				batcher = nil
+				continue
+			}
+			swapped = enqueued
+		} else {
+			// Put the updated NF instance unless it changed since it was read
+			var casErr error
+			swapped, casErr = dbadapter.CompareAndSwap(ctx, collName, filter, nfProfileVersionCondition(version), nf)
+			if casErr != nil {
+				logger.ManagementLog.Errorf("nf profile [%s] update failed: %v", updatedProfile.NfType, casErr)
+				return nil, 0, fmt.Errorf("NF profile update is failed: %w", casErr)
+			}
+		}
+		if !swapped {
+			if len(ifMatch) != 0 {
+				return nil, 0, errPreconditionFailed
+			}
+			if attempt < nfInstanceUpdateAttempts {
+				logger.ManagementLog.Infof("nf profile [%s] modified concurrently, retrying update", nfInstanceID)
+				continue
+			}
+			return nil, 0, fmt.Errorf("NF profile update is failed: profile modified concurrently")
+		}
+		profileCache.evict(nfInstanceID)
+		if batcher == nil {
+			notifyNFProfileChanged(ctx, original, updatedProfile)
+			recordNFUpdated(ctx, original, updatedProfile, version+1)
+		}
+
+		logger.ManagementLog.Infof("nf profile [%s] update success", updatedProfile.NfType)
+		return &wireProfile, version + 1, nil
 	}
+}
 
-	// Update expiry time if enabled
-	// Currently we are using 3 times the hearbeat timer as the expiry time interval.
-	// We should update it to be configurable : TBD
-	if factory.NrfConfig.Configuration.NfProfileExpiryEnable {
-		timein := time.Now().Local().Add(time.Second * time.Duration(factory.NrfConfig.Configuration.NfKeepAliveTime*3))
-		nf["expireAt"] = timein
+// applyNFInstancePatch applies patch to a stored NfProfile document. The
+// document is patched through its JSON form, so the "_id" and the time fields
+// used by the TTL index are carried over from the original unchanged.
+func applyNFInstancePatch(original map[string]interface{}, patch jsonpatch.Patch) (map[string]interface{}, error) {
+	doc := make(map[string]interface{}, len(original))
+	for key, value := range original {
+		if key != "_id" {
+			doc[key] = value
+		}
 	}
-	// Put the updated NF instance
-	_, putErr := dbadapter.DBClient.RestfulAPIPutOne(collName, filter, nf)
-	if putErr != nil {
-		logger.ManagementLog.Errorf("nf profile [%s] update failed: %v", nfProfiles[0].NfType, putErr)
-		return nil, fmt.Errorf("NF profile update is failed: %v", putErr)
+	originalJSON, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %v", err)
 	}
-	profileCache.evict(nfInstanceID)
+	modified, err := patch.Apply(originalJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	var nf map[string]interface{}
+	if err := json.Unmarshal(modified, &nf); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	for _, key := range []string{"expireAt", "createdAt"} {
+		if value, ok := original[key]; ok {
+			nf[key] = value
+		}
+	}
+	return nf, nil
+}
+
+// profileValidationProblemDetails builds the 400 response for a rejected NF
+// profile, listing the offending attributes as invalidParams when known.
+func profileValidationProblemDetails(err error) *models.ProblemDetails {
+	problemDetails := utils.ProblemDetailsWithCause("NF profile validation failed", http.StatusBadRequest, err.Error(), utils.CauseInvalidRequest)
+	var validationErr *nrfContext.ProfileValidationError
+	if errors.As(err, &validationErr) {
+		problemDetails.SetInvalidParams(validationErr.InvalidParams)
+	}
+	return problemDetails
+}
 
-	logger.ManagementLog.Infof("nf profile [%s] update success", nfProfiles[0].NfType)
-	updatedProfile := util.ConvertNFProfileDiscoveryToNFProfile(nfProfiles[0])
-	return &updatedProfile, nil
+func GetNFInstanceProcedure(ctx context.Context, nfInstanceID string) *models.NFProfile {
+	nfProfile, _, _ := getNFInstance(ctx, nfInstanceID)
+	return nfProfile
 }
 
-func GetNFInstanceProcedure(nfInstanceID string) *models.NFProfile {
+// getNFInstance returns the stored profile of an NF instance together with
+// its version, or dbadapter.ErrNotFound when the instance is unknown.
+func getNFInstance(ctx context.Context, nfInstanceID string) (*models.NFProfile, int64, error) {
 	collName := "NfProfile"
 	filter := bson.M{"nfinstanceid": nfInstanceID}
-	response, err := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
-	if err != nil || response == nil {
-		return nil
+	flushHeartbeats(ctx, nfInstanceID)
+	response, err := dbadapter.GetOne(ctx, collName, filter)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	decodedProfiles, decodeErr := util.Decode([]map[string]any{response}, time.RFC3339)
-	if decodeErr != nil || len(decodedProfiles) == 0 {
+	nfProfile, decodeErr := util.DecodeNFProfile(response)
+	if decodeErr != nil {
 		logger.ManagementLog.Warnf("failed to decode NF profile for %s: %v", nfInstanceID, decodeErr)
-		return nil
+		return nil, 0, fmt.Errorf("failed to decode NF profile: %w", decodeErr)
 	}
-
-	nfProfile := util.ConvertNFProfileDiscoveryToNFProfile(decodedProfiles[0])
-	return &nfProfile
+	nrfContext.DecodeBsfInfoRanges(&nfProfile)
+	return &nfProfile, nfProfileVersion(response), nil
 }
 
-func NFRegisterProcedure(nfProfile models.NFProfile) (header http.Header, response *models.NFProfile,
+func NFRegisterProcedure(ctx context.Context, nfProfile models.NFProfile) (header http.Header, response *models.NFProfile,
 	problemDetails *models.ProblemDetails,
 ) {
 	logger.ManagementLog.Debugln("[NRF] In NFRegisterProcedure")
@@ -482,97 +717,130 @@ func NFRegisterProcedure(nfProfile models.NFProfile) (header http.Header, respon
 	err := nrfContext.NnrfNFManagementDataModel(&nf, nfProfile)
 	if err != nil {
 		logger.ManagementLog.Errorln("NfProfile Validation failed", err)
-		problemDetails = utils.ProblemDetailsWithCause("NF profile validation failed", http.StatusBadRequest, err.Error(), utils.CauseInvalidRequest)
-		return nil, nil, problemDetails
-	}
-
-	// make location header
-	locationHeaderValue := nrfContext.SetLocationHeader(nfProfile)
-	// Marshal nf to bson
-	putData := bson.M{}
-	bsonBytes, err := bson.Marshal(nf)
-	if err != nil {
-		logger.ManagementLog.Errorln("bson marshal error in NFRegisterProcedure:", err)
-		problemDetails = utils.ProblemDetailsSystemFailure(err.Error())
-		return nil, nil, problemDetails
+		return nil, nil, profileValidationProblemDetails(err)
 	}
-	err = bson.Unmarshal(bsonBytes, &putData)
+	sharedAttributes, err := resolveSharedProfileData(ctx, &nf, nil)
 	if err != nil {
-		logger.ManagementLog.Errorln("bson unmarshal error in NFRegisterProcedure:", err)
-		problemDetails = utils.ProblemDetailsSystemFailure(err.Error())
-		return nil, nil, problemDetails
+		var validationErr *nrfContext.ProfileValidationError
+		if errors.As(err, &validationErr) {
+			return nil, nil, profileValidationProblemDetails(err)
+		}
+		logger.ManagementLog.Errorln("failed to resolve shared profile data:", err)
+		return nil, nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
 	}
+
+	// make location header
+	locationHeaderValue := nrfContext.GetNfInstanceURI(nf.GetNfInstanceId())
 	// set db info
 	collName := "NfProfile"
 	nfInstanceId := nf.GetNfInstanceId()
 	filter := bson.M{"nfinstanceid": nfInstanceId}
 	// fallback to older approach
 	if !factory.NrfConfig.Configuration.NfProfileExpiryEnable {
-		NFDeleteAll(string(nf.NfType))
-	} else {
-		timein := time.Now().Local().Add(time.Second * time.Duration(nf.GetHeartBeatTimer()*3))
-		putData["expireAt"] = timein
-		nfs, _ := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
-		if len(nfs) == 0 {
-			putData["createdAt"] = time.Now()
+		NFDeleteAll(ctx, string(nf.NfType))
+	}
+	flushHeartbeats(ctx, nfInstanceId)
+
+	for attempt := 1; ; attempt++ {
+		nfs, err := dbadapter.GetOne(ctx, collName, filter)
+		if err != nil && !errors.Is(err, dbadapter.ErrNotFound) {
+			logger.ManagementLog.Errorln("failed to get NF instance:", err)
+			return nil, nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+		}
+		// Marshal nf to bson
+		putData, err := dbadapter.EncodeNFProfile(nf)
+		if err != nil {
+			logger.ManagementLog.Errorln("bson marshal error in NFRegisterProcedure:", err)
+			problemDetails = utils.ProblemDetailsSystemFailure(err.Error())
+			return nil, nil, problemDetails
+		}
+		version := nfProfileVersion(nfs) + 1
+		putData[nfProfileVersionField] = version
+		putData[sharedAttributesField] = sharedAttributes
+		putData[sharedServiceDataIDsField] = sharedServiceDataIDs(nf)
+		putData[dbadapter.SchemaVersionField] = dbadapter.NfProfileSchemaVersion
+		if factory.NrfConfig.Configuration.NfProfileExpiryEnable {
+			timein := time.Now().Local().Add(time.Second * time.Duration(nf.GetHeartBeatTimer()*3))
+			putData["expireAt"] = timein
+			if len(nfs) == 0 {
+				putData["createdAt"] = time.Now()
+			}
+		}
+		if createdAt, ok := nfs["createdAt"]; ok {
+			putData["createdAt"] = createdAt
+		}
+
+		stored, err := storeNFProfile(ctx, collName, filter, putData, nfs)
+		if err != nil {
+			logger.ManagementLog.Errorln("failed to store NF profile:", err)
+			return nil, nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+		}
+		if !stored {
+			if attempt < nfInstanceUpdateAttempts {
+				logger.ManagementLog.Infof("nf profile [%s] modified concurrently, retrying registration", nfInstanceId)
+				continue
+			}
+			err = fmt.Errorf("%w: NF profile modified concurrently", dbadapter.ErrConflict)
+			return nil, nil, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
 		}
+
+		// Update NF Profile case
+		header, response = handleNFProfileUpdateOrCreate(ctx, nf, nfProfile, locationHeaderValue, nfs, version)
+		// Answer with the BSF ranges in their wire format, not as stored
+		registered := *response
+		nrfContext.DecodeBsfInfoRanges(&registered)
+		return setNFProfileETag(header, version), &registered, nil
+	}
+}
+
+// storeNFProfile inserts putData unless a profile of the NF instance exists,
+// when previous is nil, or replaces the whole profile previous unless it
+// changed since it was read, so that attributes left out of the new profile
+// are dropped. It reports false when another registration or update won.
+func storeNFProfile(ctx context.Context, collName string, filter bson.M, putData bson.M,
+	previous map[string]interface{},
+) (bool, error) {
+	if previous == nil {
+		existed, err := dbadapter.PutOneNotUpdate(ctx, collName, filter, putData)
+		if errors.Is(err, dbadapter.ErrDuplicateKey) {
+			// Inserted concurrently, despite the document not being found
+			return false, nil
+		}
+		return !existed, err
 	}
-	// Update NF Profile case
-	return handleNFProfileUpdateOrCreate(nf, nfProfile, locationHeaderValue, collName, filter, putData)
+	return dbadapter.CompareAndSwap(ctx, collName, filter, nfProfileVersionCondition(nfProfileVersion(previous)), putData)
 }
 
 func handleNFProfileUpdateOrCreate(
+	ctx context.Context,
 	nf models.NFProfile,
 	nfProfile models.NFProfile,
 	locationHeaderValue string,
-	collName string,
-	filter bson.M,
-	putData bson.M,
-) (http.Header, *models.NFProfile, *models.ProblemDetails) {
-	var header http.Header
-	ok, err := dbadapter.DBClient.RestfulAPIPutOne(collName, filter, putData)
-	if err != nil {
-		logger.ManagementLog.Errorln("RestfulAPIPutOne error:", err)
-		return nil, nil, utils.ProblemDetailsSystemFailure(err.Error())
-	}
-	if ok { // update existing document
+	previous map[string]interface{},
+	version int64,
+) (http.Header, *models.NFProfile) {
+	header := make(http.Header)
+	header.Add("Location", locationHeaderValue)
+	if previous != nil { // update existing document
 		profileCache.evict(nf.GetNfInstanceId())
-		logger.ManagementLog.Infoln("RestfulAPIPutOne update")
-		uriList := nrfContext.GetNotificationUri(nf)
-		// set info for NotificationData
-		Notification_event := models.NOTIFICATIONEVENTTYPE_NF_PROFILE_CHANGED
-		nfInstanceUri := locationHeaderValue
-		// receive the rsp from handler
-		for _, uri := range uriList {
-			if pd := SendNFStatusNotify(Notification_event, nfInstanceUri, uri); pd != nil {
-				return nil, nil, pd
-			}
-		}
-		header = make(http.Header)
-		header.Add("Location", locationHeaderValue)
-		return header, &nf, nil
+		logger.ManagementLog.Infoln("NF profile replaced")
+		notifyNFProfileChanged(ctx, previous, nf)
+		recordNFRegistered(ctx, previous, nf, version)
+		return header, &nf
 	} else { // Create NF Profile case
 		logger.ManagementLog.Infoln("create NF Profile", nfProfile.GetNfType())
-		uriList := nrfContext.GetNotificationUri(nf)
-		// set info for NotificationData
-		notification_event := models.NOTIFICATIONEVENTTYPE_NF_REGISTERED
-		nfInstanceUri := locationHeaderValue
-		for _, uri := range uriList {
-			if pd := SendNFStatusNotify(notification_event, nfInstanceUri, uri); pd != nil {
-				return nil, nil, pd
-			}
-		}
-		header = make(http.Header)
-		header.Add("Location", locationHeaderValue)
+		notifyNFStatus(models.NOTIFICATIONEVENTTYPE_NF_REGISTERED, locationHeaderValue,
+			nrfContext.GetNotificationSubscriptions(ctx, nf, models.NOTIFICATIONEVENTTYPE_NF_REGISTERED), &nf, nil)
+		recordNFRegistered(ctx, nil, nf, version)
 		logger.ManagementLog.Infoln("location header:", locationHeaderValue)
-		return header, &nf, nil
+		return header, &nf
 	}
 }
 
-func GetNfTypeBySubscriptionID(subscriptionID string) (nfType string) {
+func GetNfTypeBySubscriptionID(ctx context.Context, subscriptionID string) (nfType string) {
 	collName := "Subscriptions"
 	filter := bson.M{"subscriptionId": subscriptionID}
-	response, err := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
+	response, err := dbadapter.GetOne(ctx, collName, filter)
 	if err != nil {
 		return "UNKNOWN_NF"
 	}
@@ -582,10 +850,10 @@ func GetNfTypeBySubscriptionID(subscriptionID string) (nfType string) {
 	return "UNKNOWN_NF"
 }
 
-func GetNfTypeByNfInstanceID(nfInstanceID string) (nfType string) {
+func GetNfTypeByNfInstanceID(ctx context.Context, nfInstanceID string) (nfType string) {
 	collName := "NfProfile"
 	filter := bson.M{"nfinstanceid": nfInstanceID}
-	response, err := dbadapter.DBClient.RestfulAPIGetOne(collName, filter)
+	response, err := dbadapter.GetOne(ctx, collName, filter)
 	if err != nil {
 		return "UNKNOWN_NF"
 	}
@@ -594,59 +862,3 @@ func GetNfTypeByNfInstanceID(nfInstanceID string) (nfType string) {
 	}
 	return "UNKNOWN_NF"
 }
-
-func SendNFStatusNotify(Notification_event models.NotificationEventType, nfInstanceUri string,
-	url string,
-) *models.ProblemDetails {
-	notificationData := models.NotificationData{
-		Event:         Notification_event,
-		NfInstanceUri: nfInstanceUri,
-	}
-	body, err := json.Marshal(notificationData)
-	if err != nil {
-		logger.ManagementLog.Infof("notify fail: %+v", err)
-		problemDetails := utils.ProblemDetailsWithCause("Notification error", http.StatusInternalServerError, err.Error(), utils.CauseNotificationError)
-		return problemDetails
-	}
-
-	notifyCtx, cancel := context.WithTimeout(context.Background(), nfStatusNotifyTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(notifyCtx, http.MethodPost, url, bytes.NewReader(body))
-	if err != nil {
-		logger.ManagementLog.Infof("notify fail: %+v", err)
-		problemDetails := utils.ProblemDetailsWithCause("Notification error", http.StatusInternalServerError, err.Error(), utils.CauseNotificationError)
-		return problemDetails
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json, application/problem+json")
-
-	res, err := nfStatusNotifyHTTPClient.Do(req)
-	if err != nil {
-		logger.ManagementLog.Infof("notify fail: %+v", err)
-		problemDetails := utils.ProblemDetailsWithCause("Notification error", http.StatusInternalServerError, err.Error(), utils.CauseNotificationError)
-		return problemDetails
-	}
-	if res != nil {
-		defer func() {
-			if resCloseErr := res.Body.Close(); resCloseErr != nil {
-				logger.ManagementLog.Errorf("NotificationApi response body cannot close: %+v", resCloseErr)
-			}
-		}()
-		if status := res.StatusCode; status != http.StatusNoContent && status != http.StatusOK {
-			logger.ManagementLog.Warnln("error status in NotificationPost:", status)
-			responseBody, readErr := io.ReadAll(res.Body)
-			if readErr == nil && len(responseBody) > 0 {
-				var remoteProblem models.ProblemDetails
-				if decodeErr := json.Unmarshal(responseBody, &remoteProblem); decodeErr == nil {
-					return &remoteProblem
-				}
-				problemDetails := utils.ProblemDetailsWithCause("Notification error", status, string(responseBody), utils.CauseNotificationError)
-				return problemDetails
-			}
-			problemDetails := utils.ProblemDetailsWithCause("Notification error", status, "", utils.CauseNotificationError)
-			return problemDetails
-		}
-	}
-	return nil
-}
@@ -6,12 +6,20 @@
 package producer_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	nrfContext "github.com/omec-project/nrf/context"
 	"github.com/omec-project/nrf/dbadapter"
 	"github.com/omec-project/nrf/factory"
 	"github.com/omec-project/nrf/logger"
@@ -52,7 +60,7 @@ func (db *MockMongoDBClient) RestfulAPIPutOne(collName string, filter bson.M, pu
 
 func (db *MockMongoDBClient) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
 	logger.HandlerLog.Infoln("called Mock RestfulAPIPutOneNotUpdate")
-	return true, nil
+	return false, nil
 }
 
 func (db *MockMongoDBClient) RestfulAPIPutMany(collName string, filterArray []bson.M, putDataArray []map[string]interface{}) error {
@@ -89,6 +97,11 @@ func (db *MockMongoDBClient) RestfulAPIPost(collName string, filter bson.M, post
 	return true, nil
 }
 
+func (db *MockMongoDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M, putData map[string]interface{}) (bool, error) {
+	logger.HandlerLog.Infoln("called Mock RestfulAPICompareAndSwap")
+	return true, nil
+}
+
 func (db *MockMongoDBClient) RestfulAPIPostMany(collName string, filter bson.M, postDataArray []interface{}) bool {
 	logger.HandlerLog.Infoln("called Mock RestfulAPIPost")
 	return true
@@ -195,7 +208,7 @@ func TestNFRegisterProcedureSuccess(t *testing.T) {
 			nf.SetNfInstanceId(uuid.New().String())
 			nf.SetNfStatus(models.NFSTATUS_REGISTERED)
 			nf.SetPlmnList(tc.nfPlmnList)
-			_, data, err := producer.NFRegisterProcedure(*nf)
+			_, data, err := producer.NFRegisterProcedure(context.Background(), *nf)
 			if err != nil {
 				t.Fatalf("failed to register NF: %v", err)
 			}
@@ -249,7 +262,7 @@ func TestNFRegisterProcedureFailure(t *testing.T) {
 			nf.SetNfInstanceId(uuid.New().String())
 			nf.SetNfStatus(models.NFSTATUS_REGISTERED)
 			nf.SetPlmnList(tc.nfPlmnList)
-			_, data, err := producer.NFRegisterProcedure(*nf)
+			_, data, err := producer.NFRegisterProcedure(context.Background(), *nf)
 			if err == nil {
 				t.Errorf("Expected error, got: %v", data)
 			}
@@ -275,7 +288,7 @@ func TestNFRegisterProcedureFailureNoProvidedPlmnListAndWebconsoleUnreachable(t
 	nf.SetNfType(models.NFTYPE_AUSF)
 	nf.SetNfInstanceId(uuid.New().String())
 	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
-	_, data, err := producer.NFRegisterProcedure(*nf)
+	_, data, err := producer.NFRegisterProcedure(context.Background(), *nf)
 	if err == nil {
 		t.Errorf("Expected error, got: %v", data)
 	}
@@ -283,24 +296,22 @@ func TestNFRegisterProcedureFailureNoProvidedPlmnListAndWebconsoleUnreachable(t
 
 type PatchCaptureDBClient struct {
 	MockMongoDBClient
-	patchJSON []byte
-}
-
-func (db *PatchCaptureDBClient) RestfulAPIJSONPatch(collName string, filter bson.M, patchJSON []byte) error {
-	db.patchJSON = append([]byte(nil), patchJSON...)
-	return nil
+	swapped map[string]interface{}
 }
 
 func (db *PatchCaptureDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
 	return map[string]interface{}{
-		"nfInstanceId": "instance-1",
-		"nfType":       string(models.NFTYPE_AUSF),
-		"nfStatus":     string(models.NFSTATUS_REGISTERED),
+		"nfinstanceid": "instance-1",
+		"nftype":       string(models.NFTYPE_AUSF),
+		"nfstatus":     string(models.NFSTATUS_SUSPENDED),
 	}, nil
 }
 
-func (db *PatchCaptureDBClient) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
-	return false, nil
+func (db *PatchCaptureDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	db.swapped = putData
+	return true, nil
 }
 
 func TestHandleUpdateNFInstanceRequestNormalizesNfStatusPatchPath(t *testing.T) {
@@ -323,22 +334,1641 @@ func TestHandleUpdateNFInstanceRequestNormalizesNfStatusPatchPath(t *testing.T)
 		t.Fatalf("failed to marshal patch JSON: %v", err)
 	}
 
-	response := producer.HandleUpdateNFInstanceRequest(&httpwrapper.Request{
+	response := producer.HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
 		Params: map[string]string{"nfInstanceID": "instance-1"},
 		Body:   patchJSON,
 	})
 	if response == nil {
 		t.Fatal("expected non-nil response")
 	}
+	if response.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, response.Status, response.Body)
+	}
+
+	if patchCaptureDBClient.swapped == nil {
+		t.Fatal("expected patched profile to be stored")
+	}
+	if _, ok := patchCaptureDBClient.swapped["nfStatus"]; ok {
+		t.Fatal("expected patch path /nfStatus to be normalized, found nfStatus key in stored profile")
+	}
+	if status := patchCaptureDBClient.swapped["nfstatus"]; status != string(models.NFSTATUS_REGISTERED) {
+		t.Fatalf("expected nfstatus %s, got %v", models.NFSTATUS_REGISTERED, status)
+	}
+}
+
+// ProfileStoreDBClient keeps NfProfile documents in memory so that a profile
+// written by NFRegisterProcedure can be read back by GetNFInstanceProcedure.
+type ProfileStoreDBClient struct {
+	MockMongoDBClient
+	profiles   map[string]map[string]interface{}
+	sharedData map[string]map[string]interface{}
+}
+
+func (db *ProfileStoreDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	if collName == "SharedData" {
+		sharedDataID, _ := filter["sharedDataId"].(string)
+		return db.sharedData[sharedDataID], nil
+	}
+	if collName != "NfProfile" {
+		return nil, nil
+	}
+	nfInstanceID, _ := filter["nfinstanceid"].(string)
+	return db.profiles[nfInstanceID], nil
+}
+
+func (db *ProfileStoreDBClient) RestfulAPIPutOne(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	if collName == "SharedData" {
+		if db.sharedData == nil {
+			db.sharedData = map[string]map[string]interface{}{}
+		}
+		sharedDataID, _ := filter["sharedDataId"].(string)
+		_, existed := db.sharedData[sharedDataID]
+		db.sharedData[sharedDataID] = putData
+		return existed, nil
+	}
+	if collName != "NfProfile" {
+		return false, nil
+	}
+	nfInstanceID, _ := filter["nfinstanceid"].(string)
+	_, existed := db.profiles[nfInstanceID]
+	db.profiles[nfInstanceID] = putData
+	return existed, nil
+}
+
+func (db *ProfileStoreDBClient) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	if existing, _ := db.RestfulAPIGetOne(collName, filter); existing != nil {
+		return true, nil
+	}
+	return db.RestfulAPIPutOne(collName, filter, putData)
+}
+
+func TestNFRegisterProcedurePersistsFullProfile(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = &ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}}
+
+	nfInstanceID := uuid.New().String()
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(nfInstanceID)
+	nf.SetNfType(models.NFTYPE_AUSF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	nf.SetNfInstanceName("ausf-1")
+	nf.SetFqdn("ausf.example.org")
+	nf.SetPriority(0)
+	nf.SetCapacity(100)
+	nf.SetNfServiceList(map[string]models.NFService{
+		"ausf-auth-1": *models.NewNFService(
+			"ausf-auth-1",
+			models.SERVICENAME_NAUSF_AUTH,
+			[]models.NFServiceVersion{*models.NewNFServiceVersion("v1", "1.0.0")},
+			models.URISCHEME_HTTP,
+			models.NFSERVICESTATUS_REGISTERED,
+		),
+	})
+	nf.SetNfServices([]models.NFService{*models.NewNFService(
+		"ausf-auth-2",
+		models.SERVICENAME_NAUSF_AUTH,
+		[]models.NFServiceVersion{*models.NewNFServiceVersion("v1", "1.0.0")},
+		models.URISCHEME_HTTPS,
+		models.NFSERVICESTATUS_REGISTERED,
+	)})
+	bsfInfo := models.NewBsfInfo()
+	bsfInfo.SetDnnList([]string{"internet"})
+	bsfInfo.SetIpv4AddressRanges([]models.Ipv4AddressRange{*models.NewIpv4AddressRange("10.0.0.1", "10.0.0.254")})
+	bsfInfo.SetIpv6PrefixRanges([]models.Ipv6PrefixRange{*models.NewIpv6PrefixRange("2001:db8::", "2001:db8::ffff")})
+	nf.SetBsfInfo(*bsfInfo)
+	amfInfo := models.NewAmfInfo("3f8", "ca", []models.Guami{*models.NewGuami(models.PlmnIdNid{Mcc: "001", Mnc: "01"}, "cafe00")})
+	n2InterfaceAmfInfo := models.NewN2InterfaceAmfInfo()
+	n2InterfaceAmfInfo.SetIpv4EndpointAddress([]string{"10.0.0.10"})
+	n2InterfaceAmfInfo.SetAmfName("amf-1")
+	amfInfo.SetN2InterfaceAmfInfo(*n2InterfaceAmfInfo)
+	nf.SetAmfInfo(*amfInfo)
+	nf.SetNwdafInfo(*models.NewNwdafInfoWithDefaults())
+	nf.SetNefInfo(*models.NewNefInfoWithDefaults())
+	nf.SetScpInfo(*models.NewScpInfoWithDefaults())
+	nf.SetSeppInfo(*models.NewSeppInfoWithDefaults())
+	nf.SetSmsfInfo(*models.NewSmsfInfoWithDefaults())
+	nf.SetNsacfInfoList(map[string]models.NsacfInfo{"nsacf-1": *models.NewNsacfInfoWithDefaults()})
+	nf.SetNfSetIdList([]string{"set1.ausfset.5gc.mnc001.mcc001"})
+	nf.SetServingScope([]string{"area-1"})
+	nf.SetVendorId("000001")
+	nf.SetCustomInfo(map[string]interface{}{"site": "lab"})
+	defaultNotificationSubscription := models.NewDefaultNotificationSubscription("N1_MESSAGES", "http://ausf.example.org/notify")
+	defaultNotificationSubscription.SetN1MessageClass("5GMM")
+	nf.SetDefaultNotificationSubscriptions([]models.DefaultNotificationSubscription{*defaultNotificationSubscription})
+
+	_, registered, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf)
+	if problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
+	}
+	stored := producer.GetNFInstanceProcedure(context.Background(), nfInstanceID)
+	if stored == nil {
+		t.Fatal("expected registered NF profile to be returned")
+	}
+
+	toMap := func(profile *models.NFProfile) map[string]interface{} {
+		b, err := json.Marshal(profile)
+		if err != nil {
+			t.Fatalf("failed to marshal NF profile: %v", err)
+		}
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatalf("failed to unmarshal NF profile: %v", err)
+		}
+		return m
+	}
+	expected := toMap(nf)
+	for name, profile := range map[string]*models.NFProfile{"registered": registered, "stored": stored} {
+		got := toMap(profile)
+		for attr, value := range expected {
+			if !reflect.DeepEqual(value, got[attr]) {
+				t.Errorf("%s attribute %s: expected %v, got %v", name, attr, value, got[attr])
+			}
+		}
+		if _, ok := got["heartBeatTimer"]; !ok {
+			t.Errorf("expected heartBeatTimer of the %s profile to be set by the NRF", name)
+		}
+	}
+}
+
+func TestNFRegisterProcedureRejectsInvalidProfile(t *testing.T) {
+	testCases := []struct {
+		name          string
+		modify        func(nf *models.NFProfile)
+		expectedParam string
+	}{
+		{
+			name:          "invalid IPv4 address",
+			modify:        func(nf *models.NFProfile) { nf.SetIpv4Addresses([]string{"10.0.0.256"}) },
+			expectedParam: "ipv4Addresses[0]",
+		},
+		{
+			name:          "IPv4 address in IPv6 list",
+			modify:        func(nf *models.NFProfile) { nf.SetIpv6Addresses([]string{"10.0.0.1"}) },
+			expectedParam: "ipv6Addresses[0]",
+		},
+		{
+			name:          "invalid FQDN",
+			modify:        func(nf *models.NFProfile) { nf.SetFqdn("-ausf..example.org") },
+			expectedParam: "fqdn",
+		},
+		{
+			name: "SD not six hex digits",
+			modify: func(nf *models.NFProfile) {
+				snssai := models.NewSnssai(1)
+				snssai.SetSd("01020")
+				nf.SetSNssais([]models.Snssai{*snssai})
+			},
+			expectedParam: "sNssais[0].sd",
+		},
+		{
+			name:          "priority out of range",
+			modify:        func(nf *models.NFProfile) { nf.SetPriority(70000) },
+			expectedParam: "priority",
+		},
+		{
+			name: "duplicate serviceInstanceId",
+			modify: func(nf *models.NFProfile) {
+				versions := []models.NFServiceVersion{*models.NewNFServiceVersion("v1", "1.0.0")}
+				service := models.NewNFService("1", models.SERVICENAME_NAUSF_AUTH, versions, models.URISCHEME_HTTP, models.NFSERVICESTATUS_REGISTERED)
+				nf.SetNfServices([]models.NFService{*service, *service})
+			},
+			expectedParam: "nfServices[1].serviceInstanceId",
+		},
+		{
+			name: "TAI range with start greater than end",
+			modify: func(nf *models.NFProfile) {
+				tacRange := models.NewTacRange()
+				tacRange.SetStart("00FF")
+				tacRange.SetEnd("0001")
+				amfInfo := models.NewAmfInfoWithDefaults()
+				amfInfo.SetTaiRangeList([]models.TaiRange{
+					*models.NewTaiRange(models.PlmnId{Mcc: "001", Mnc: "01"}, []models.TacRange{*tacRange}),
+				})
+				nf.SetAmfInfo(*amfInfo)
+			},
+			expectedParam: "amfInfo.taiRangeList[0].tacRangeList[0]",
+		},
+		{
+			name: "SUPI range with invalid pattern",
+			modify: func(nf *models.NFProfile) {
+				supiRange := models.NewSupiRange()
+				supiRange.SetPattern("^imsi-001(01")
+				ausfInfo := models.NewAusfInfo()
+				ausfInfo.SetSupiRanges([]models.SupiRange{*supiRange})
+				nf.SetAusfInfo(*ausfInfo)
+			},
+			expectedParam: "ausfInfo.supiRanges[0].pattern",
+		},
+		{
+			name: "default notification without message class",
+			modify: func(nf *models.NFProfile) {
+				nf.SetDefaultNotificationSubscriptions([]models.DefaultNotificationSubscription{
+					*models.NewDefaultNotificationSubscription("N1_MESSAGES", "http://ausf.example.org/n1"),
+				})
+			},
+			expectedParam: "defaultNotificationSubscriptions[0].n1MessageClass",
+		},
+		{
+			name: "default notification with relative callback",
+			modify: func(nf *models.NFProfile) {
+				subscription := models.NewDefaultNotificationSubscription("N2_INFORMATION", "/n2")
+				subscription.SetN2InformationClass("RAN")
+				nf.SetDefaultNotificationSubscriptions([]models.DefaultNotificationSubscription{*subscription})
+			},
+			expectedParam: "defaultNotificationSubscriptions[0].callbackUri",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			originalDBClient := dbadapter.DBClient
+			defer func() {
+				dbadapter.DBClient = originalDBClient
+			}()
+			dbadapter.DBClient = &MockMongoDBClient{}
+			nf := models.NewNFProfileWithDefaults()
+			nf.SetNfType(models.NFTYPE_AUSF)
+			nf.SetNfInstanceId(uuid.New().String())
+			nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+			nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+			tc.modify(nf)
+
+			_, data, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf)
+			if problemDetails == nil {
+				t.Fatalf("expected validation failure, got: %v", data)
+			}
+			if problemDetails.GetStatus() != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, problemDetails.GetStatus())
+			}
+			invalidParams := problemDetails.GetInvalidParams()
+			if len(invalidParams) != 1 || invalidParams[0].Param != tc.expectedParam {
+				t.Errorf("expected invalidParams [%s], got %+v", tc.expectedParam, invalidParams)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateNFInstanceRequestRejectsInvalidProfile(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+
+	patchCaptureDBClient := &PatchCaptureDBClient{}
+	dbadapter.DBClient = patchCaptureDBClient
+
+	response := producer.HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
+		Params: map[string]string{"nfInstanceID": "instance-1"},
+		Body:   []byte(`[{"op":"add","path":"/fqdn","value":"not a fqdn"}]`),
+	})
+	if response.Status != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, response.Status)
+	}
+	problemDetails, ok := response.Body.(*models.ProblemDetails)
+	if !ok {
+		t.Fatalf("expected ProblemDetails body, got %T", response.Body)
+	}
+	if invalidParams := problemDetails.GetInvalidParams(); len(invalidParams) != 1 || invalidParams[0].Param != "fqdn" {
+		t.Errorf("expected invalidParams [fqdn], got %+v", invalidParams)
+	}
+	if patchCaptureDBClient.swapped != nil {
+		t.Errorf("expected invalid profile not to be stored, got %v", patchCaptureDBClient.swapped)
+	}
+}
+
+func (db *ProfileStoreDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	if collName != "NfProfile" {
+		return nil, nil
+	}
+	var profiles []map[string]interface{}
+	for _, profile := range db.profiles {
+		if profileMatches(profile, filter) {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles, nil
+}
+
+// profileMatches compares the top level attributes of a profile with filter,
+// which may hold a $or of such comparisons.
+func profileMatches(profile map[string]interface{}, filter bson.M) bool {
+	for key, value := range filter {
+		if key == "$or" {
+			matched := false
+			for _, clause := range value.([]interface{}) {
+				if profileMatches(profile, clause.(bson.M)) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		} else if !reflect.DeepEqual(profile[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (db *ProfileStoreDBClient) RestfulAPIDeleteOne(collName string, filter bson.M) error {
+	if collName == "SharedData" {
+		sharedDataID, _ := filter["sharedDataId"].(string)
+		delete(db.sharedData, sharedDataID)
+	}
+	return nil
+}
+
+func (db *ProfileStoreDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	current, _ := db.RestfulAPIGetOne(collName, filter)
+	if current == nil {
+		return false, nil
+	}
+	for key, value := range expected {
+		if value == nil {
+			if _, ok := current[key]; ok {
+				return false, nil
+			}
+		} else if !reflect.DeepEqual(current[key], value) {
+			return false, nil
+		}
+	}
+	nfInstanceID, _ := filter["nfinstanceid"].(string)
+	if putData == nil {
+		delete(db.profiles, nfInstanceID)
+	} else {
+		db.profiles[nfInstanceID] = putData
+	}
+	return true, nil
+}
+
+func TestNFInstanceETagAndIfMatch(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = &ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}}
+
+	nfInstanceID := uuid.New().String()
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(nfInstanceID)
+	nf.SetNfType(models.NFTYPE_AUSF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+
+	register := producer.HandleNFRegisterRequest(context.Background(), &httpwrapper.Request{Body: *nf})
+	if register.Status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, register.Status)
+	}
+	if etag := register.Header.Get("ETag"); etag != `"1"` {
+		t.Fatalf(`expected register ETag "1", got %q`, etag)
+	}
+
+	params := map[string]string{"nfInstanceID": nfInstanceID}
+	get := producer.HandleGetNFInstanceRequest(context.Background(), &httpwrapper.Request{Params: params})
+	if etag := get.Header.Get("ETag"); etag != `"1"` {
+		t.Fatalf(`expected GET ETag "1", got %q`, etag)
+	}
+
+	patch := []byte(`[{"op":"replace","path":"/nfStatus","value":"SUSPENDED"}]`)
+	update := producer.HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
+		Params: params,
+		Header: http.Header{"If-Match": []string{`"1"`}},
+		Body:   patch,
+	})
+	if update.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, update.Status, update.Body)
+	}
+	if etag := update.Header.Get("ETag"); etag != `"2"` {
+		t.Fatalf(`expected PATCH ETag "2", got %q`, etag)
+	}
+
+	staleUpdate := producer.HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
+		Params: params,
+		Header: http.Header{"If-Match": []string{`"1"`}},
+		Body:   patch,
+	})
+	if staleUpdate.Status != http.StatusPreconditionFailed {
+		t.Fatalf("expected status %d for stale PATCH, got %d", http.StatusPreconditionFailed, staleUpdate.Status)
+	}
+
+	staleDelete := producer.HandleNFDeregisterRequest(context.Background(), &httpwrapper.Request{
+		Params: params,
+		Header: http.Header{"If-Match": []string{`"1"`}},
+	})
+	if staleDelete.Status != http.StatusPreconditionFailed {
+		t.Fatalf("expected status %d for stale DELETE, got %d", http.StatusPreconditionFailed, staleDelete.Status)
+	}
+	if producer.GetNFInstanceProcedure(context.Background(), nfInstanceID) == nil {
+		t.Fatal("expected NF instance to survive a stale DELETE")
+	}
+}
+
+func TestSharedDataRegistry(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	store := &ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}}
+	dbadapter.DBClient = store
+
+	sharedDataRequest := func(body string) *httpwrapper.Request {
+		req := &httpwrapper.Request{Params: map[string]string{"sharedDataId": "shared-1"}}
+		if body != "" {
+			req.Body = []byte(body)
+		}
+		return req
+	}
+
+	rsp := producer.HandleRegisterSharedDataRequest(context.Background(), sharedDataRequest(`{"sharedDataId": "shared-1", "sharedProfileData": {"fqdn": "bad_fqdn!"}}`))
+	if rsp.Status != http.StatusBadRequest {
+		t.Fatalf("expected status %d for invalid shared data, got %d", http.StatusBadRequest, rsp.Status)
+	}
+	problemDetails, ok := rsp.Body.(*models.ProblemDetails)
+	if !ok || len(problemDetails.GetInvalidParams()) != 1 || problemDetails.GetInvalidParams()[0].Param != "sharedProfileData.fqdn" {
+		t.Fatalf("expected invalid param sharedProfileData.fqdn, got %+v", rsp.Body)
+	}
+
+	rsp = producer.HandleRegisterSharedDataRequest(context.Background(), sharedDataRequest(`{"sharedDataId": "shared-1", "sharedProfileData": {"fqdn": "upf.example.org", "priority": 5}}`))
+	if rsp.Status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rsp.Status)
+	}
+	if rsp.Header.Get("Location") == "" {
+		t.Error("expected Location header on shared data creation")
+	}
+
+	nfInstanceID := uuid.New().String()
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(nfInstanceID)
+	nf.SetNfType(models.NFTYPE_UPF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	nf.SetPriority(1)
+	nf.SetSharedProfileDataId("shared-1")
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
+	}
+	stored := producer.GetNFInstanceProcedure(context.Background(), nfInstanceID)
+	if stored == nil {
+		t.Fatal("expected registered NF profile to be returned")
+	}
+	if stored.GetFqdn() != "upf.example.org" {
+		t.Errorf("expected fqdn inherited from shared data, got %q", stored.GetFqdn())
+	}
+	if stored.GetPriority() != 1 {
+		t.Errorf("expected NF priority to take precedence over shared data, got %d", stored.GetPriority())
+	}
+
+	rsp = producer.HandleUpdateSharedDataRequest(context.Background(), sharedDataRequest(`[{"op": "replace", "path": "/sharedProfileData/fqdn", "value": "upf2.example.org"}]`))
+	if rsp.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rsp.Status)
+	}
+	stored = producer.GetNFInstanceProcedure(context.Background(), nfInstanceID)
+	if stored == nil || stored.GetFqdn() != "upf2.example.org" {
+		t.Errorf("expected NF profile to follow updated shared data, got %+v", stored)
+	}
+
+	rsp = producer.HandleUpdateSharedDataRequest(context.Background(), sharedDataRequest(`[{"op": "replace", "path": "/missing/attr", "value": 1}]`))
+	if rsp.Status != http.StatusBadRequest {
+		t.Errorf("expected status %d for invalid patch, got %d", http.StatusBadRequest, rsp.Status)
+	}
+
+	rsp = producer.HandleDeleteSharedDataRequest(context.Background(), sharedDataRequest(""))
+	if rsp.Status != http.StatusConflict {
+		t.Fatalf("expected status %d while shared data is referenced, got %d", http.StatusConflict, rsp.Status)
+	}
+
+	delete(store.profiles, nfInstanceID)
+	rsp = producer.HandleDeleteSharedDataRequest(context.Background(), sharedDataRequest(""))
+	if rsp.Status != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rsp.Status)
+	}
+	rsp = producer.HandleGetSharedDataRequest(context.Background(), sharedDataRequest(""))
+	if rsp.Status != http.StatusNotFound {
+		t.Errorf("expected status %d after deletion, got %d", http.StatusNotFound, rsp.Status)
+	}
+
+	nf.SetNfInstanceId(uuid.New().String())
+	_, _, problemDetails = producer.NFRegisterProcedure(context.Background(), *nf)
+	if problemDetails == nil || problemDetails.GetStatus() != http.StatusBadRequest {
+		t.Fatalf("expected registration with unknown shared data to be rejected, got %+v", problemDetails)
+	}
+	if len(problemDetails.GetInvalidParams()) != 1 || problemDetails.GetInvalidParams()[0].Param != "sharedProfileDataId" {
+		t.Errorf("expected invalid param sharedProfileDataId, got %+v", problemDetails.GetInvalidParams())
+	}
+}
+
+// sharedDataDeleteRaceDBClient runs race once, just before shared data is
+// deleted, as a registration handled concurrently may.
+type sharedDataDeleteRaceDBClient struct {
+	*dbadapter.MemoryDBClient
+	race func()
+}
+
+func (db *sharedDataDeleteRaceDBClient) RestfulAPIDeleteOne(collName string, filter bson.M) error {
+	if race := db.race; race != nil && collName == "SharedData" {
+		db.race = nil
+		race()
+	}
+	return db.MemoryDBClient.RestfulAPIDeleteOne(collName, filter)
+}
+
+func TestDeleteSharedDataRacingRegistration(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	db := &sharedDataDeleteRaceDBClient{MemoryDBClient: dbadapter.NewMemoryDBClient()}
+	dbadapter.DBClient = db
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() { factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable }()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	sharedDataRequest := func(body string) *httpwrapper.Request {
+		req := &httpwrapper.Request{Params: map[string]string{"sharedDataId": "shared-1"}}
+		if body != "" {
+			req.Body = []byte(body)
+		}
+		return req
+	}
+	rsp := producer.HandleRegisterSharedDataRequest(context.Background(), sharedDataRequest(`{"sharedProfileData": {"fqdn": "upf.example.org"}}`))
+	if rsp.Status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rsp.Status)
+	}
+
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(uuid.New().String())
+	nf.SetNfType(models.NFTYPE_UPF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	nf.SetSharedProfileDataId("shared-1")
+	db.race = func() {
+		if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+			t.Errorf("failed to register NF: %+v", problemDetails)
+		}
+	}
+	rsp = producer.HandleDeleteSharedDataRequest(context.Background(), sharedDataRequest(""))
+	if rsp.Status != http.StatusConflict {
+		t.Errorf("expected status %d once a registration referenced the shared data, got %d", http.StatusConflict, rsp.Status)
+	}
+	rsp = producer.HandleGetSharedDataRequest(context.Background(), sharedDataRequest(""))
+	if rsp.Status != http.StatusOK {
+		t.Errorf("expected the referenced shared data to be kept, got status %d", rsp.Status)
+	}
+}
+
+func TestUpdateNFInstanceResolvesSharedData(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = dbadapter.NewMemoryDBClient()
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() { factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable }()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	for sharedDataID, body := range map[string]string{
+		"shared-1": `{"sharedProfileData": {"fqdn": "upf.example.org", "priority": 5}}`,
+		"shared-2": `{"sharedProfileData": {"fqdn": "upf2.example.org", "locality": "site-2"}}`,
+	} {
+		rsp := producer.HandleRegisterSharedDataRequest(context.Background(),
+			&httpwrapper.Request{Params: map[string]string{"sharedDataId": sharedDataID}, Body: []byte(body)})
+		if rsp.Status != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, rsp.Status)
+		}
+	}
+
+	nfInstanceID := uuid.New().String()
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(nfInstanceID)
+	nf.SetNfType(models.NFTYPE_UPF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	nf.SetSharedProfileDataId("shared-1")
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
+	}
+
+	patch := func(patchJSON string) *models.NFProfile {
+		t.Helper()
+		rsp := producer.HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
+			Params: map[string]string{"nfInstanceID": nfInstanceID},
+			Body:   []byte(patchJSON),
+		})
+		if rsp.Status != http.StatusOK {
+			t.Fatalf("expected status %d for patch %s, got %d: %+v", http.StatusOK, patchJSON, rsp.Status, rsp.Body)
+		}
+		return producer.GetNFInstanceProcedure(context.Background(), nfInstanceID)
+	}
+
+	// An inherited attribute changed by the NF is its own from then on
+	stored := patch(`[{"op": "replace", "path": "/fqdn", "value": "own.example.org"}]`)
+	if stored.GetFqdn() != "own.example.org" || stored.GetPriority() != 5 {
+		t.Errorf("expected own fqdn and inherited priority, got %q and %d", stored.GetFqdn(), stored.GetPriority())
+	}
+	rsp := producer.HandleUpdateSharedDataRequest(context.Background(), &httpwrapper.Request{
+		Params: map[string]string{"sharedDataId": "shared-1"},
+		Body:   []byte(`[{"op": "replace", "path": "/sharedProfileData/fqdn", "value": "upf3.example.org"}]`),
+	})
+	if rsp.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rsp.Status)
+	}
+	if stored = producer.GetNFInstanceProcedure(context.Background(), nfInstanceID); stored.GetFqdn() != "own.example.org" {
+		t.Errorf("expected the own fqdn to be kept when shared data changes, got %q", stored.GetFqdn())
+	}
+
+	stored = patch(`[{"op": "replace", "path": "/sharedProfileDataId", "value": "shared-2"}]`)
+	if stored.HasPriority() || stored.GetLocality() != "site-2" || stored.GetFqdn() != "own.example.org" {
+		t.Errorf("expected the attributes of shared-2 in place of those of shared-1, got priority %v, locality %q and fqdn %q",
+			stored.Priority, stored.GetLocality(), stored.GetFqdn())
+	}
+
+	stored = patch(`[{"op": "remove", "path": "/sharedProfileDataId"}]`)
+	if stored.HasSharedProfileDataId() || stored.HasLocality() {
+		t.Errorf("expected the attributes of shared-2 to be dropped, got %+v", stored)
+	}
+
+	rsp = producer.HandleUpdateNFInstanceRequest(context.Background(), &httpwrapper.Request{
+		Params: map[string]string{"nfInstanceID": nfInstanceID},
+		Body:   []byte(`[{"op": "add", "path": "/sharedProfileDataId", "value": "shared-3"}]`),
+	})
+	if rsp.Status != http.StatusBadRequest {
+		t.Errorf("expected status %d for unknown shared data, got %d", http.StatusBadRequest, rsp.Status)
+	}
+}
+
+func TestSharedServiceData(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = dbadapter.NewMemoryDBClient()
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() { factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable }()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	sharedDataRequest := func(body string) *httpwrapper.Request {
+		req := &httpwrapper.Request{Params: map[string]string{"sharedDataId": "service-1"}}
+		if body != "" {
+			req.Body = []byte(body)
+		}
+		return req
+	}
+	rsp := producer.HandleRegisterSharedDataRequest(context.Background(),
+		sharedDataRequest(`{"sharedServiceData": {"serviceInstanceId": "shared", "fqdn": "smf.example.org"}}`))
+	if rsp.Status != http.StatusBadRequest {
+		t.Errorf("expected status %d for a shared serviceInstanceId, got %d", http.StatusBadRequest, rsp.Status)
+	}
+	rsp = producer.HandleRegisterSharedDataRequest(context.Background(),
+		sharedDataRequest(`{"sharedServiceData": {"fqdn": "smf.example.org", "priority": 5}}`))
+	if rsp.Status != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rsp.Status)
+	}
 
-	var capturedPatchItems []models.PatchItem
-	if err := json.Unmarshal(patchCaptureDBClient.patchJSON, &capturedPatchItems); err != nil {
-		t.Fatalf("failed to unmarshal captured patch JSON: %v", err)
+	newService := func(serviceInstanceID string) models.NFService {
+		service := models.NewNFService(serviceInstanceID, models.SERVICENAME_NSMF_PDUSESSION,
+			[]models.NFServiceVersion{*models.NewNFServiceVersion("v1", "1.0.0")}, models.URISCHEME_HTTP, models.NFSERVICESTATUS_REGISTERED)
+		service.SetSharedServiceDataId("service-1")
+		return *service
+	}
+	nfInstanceID := uuid.New().String()
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(nfInstanceID)
+	nf.SetNfType(models.NFTYPE_SMF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	pduSession := newService("pdu-session-1")
+	pduSession.SetPriority(1)
+	nf.SetNfServices([]models.NFService{pduSession})
+	nf.SetNfServiceList(map[string]models.NFService{"pdu-session-2": newService("pdu-session-2")})
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
 	}
-	if len(capturedPatchItems) != 1 {
-		t.Fatalf("expected 1 patch item, got %d", len(capturedPatchItems))
+
+	checkServices := func(fqdn string) {
+		t.Helper()
+		stored := producer.GetNFInstanceProcedure(context.Background(), nfInstanceID)
+		if stored == nil || len(stored.GetNfServices()) != 1 || len(stored.GetNfServiceList()) != 1 {
+			t.Fatalf("expected the registered NF services, got %+v", stored)
+		}
+		listed := stored.GetNfServiceList()["pdu-session-2"]
+		for _, service := range []models.NFService{stored.GetNfServices()[0], listed} {
+			if service.GetFqdn() != fqdn {
+				t.Errorf("expected service %s to inherit fqdn %s, got %q", service.GetServiceInstanceId(), fqdn, service.GetFqdn())
+			}
+		}
+		if priority := stored.GetNfServices()[0].GetPriority(); priority != 1 {
+			t.Errorf("expected the service priority to take precedence over shared data, got %d", priority)
+		}
+		if priority := listed.GetPriority(); priority != 5 {
+			t.Errorf("expected the service to inherit priority 5, got %d", priority)
+		}
+	}
+	checkServices("smf.example.org")
+
+	rsp = producer.HandleUpdateSharedDataRequest(context.Background(),
+		sharedDataRequest(`[{"op": "replace", "path": "/sharedServiceData/fqdn", "value": "smf2.example.org"}]`))
+	if rsp.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rsp.Status)
+	}
+	checkServices("smf2.example.org")
+
+	rsp = producer.HandleDeleteSharedDataRequest(context.Background(), sharedDataRequest(""))
+	if rsp.Status != http.StatusConflict {
+		t.Errorf("expected status %d while shared data is referenced, got %d", http.StatusConflict, rsp.Status)
+	}
+
+	nf.SetNfInstanceId(uuid.New().String())
+	unknown := newService("pdu-session-1")
+	unknown.SetSharedServiceDataId("service-2")
+	nf.SetNfServices([]models.NFService{unknown})
+	_, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf)
+	if problemDetails == nil || problemDetails.GetStatus() != http.StatusBadRequest {
+		t.Fatalf("expected registration with unknown shared data to be rejected, got %+v", problemDetails)
+	}
+	if len(problemDetails.GetInvalidParams()) != 1 || problemDetails.GetInvalidParams()[0].Param != "nfServices[0].sharedServiceDataId" {
+		t.Errorf("expected invalid param nfServices[0].sharedServiceDataId, got %+v", problemDetails.GetInvalidParams())
+	}
+}
+
+func TestHandleGetNFInstancesRequestPaging(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	store := &ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}}
+	dbadapter.DBClient = store
+	for _, nf := range []struct{ id, nfType string }{
+		{"amf-1", "AMF"}, {"amf-2", "AMF"}, {"amf-3", "AMF"}, {"smf-1", "SMF"},
+	} {
+		store.profiles[nf.id] = map[string]interface{}{"nfinstanceid": nf.id, "nftype": nf.nfType}
+	}
+
+	getNFInstances := func(query url.Values) *httpwrapper.Response {
+		return producer.HandleGetNFInstancesRequest(context.Background(), &httpwrapper.Request{Query: query})
+	}
+	hrefs := func(uriList *nrfContext.UriList) []string {
+		var ids []string
+		for _, item := range uriList.Links.Item {
+			href := item.GetHref()
+			ids = append(ids, href[strings.LastIndex(href, "/")+1:])
+		}
+		return ids
+	}
+
+	rsp := getNFInstances(url.Values{})
+	if rsp.Status != http.StatusOK {
+		t.Fatalf("expected status %d without limit, got %d", http.StatusOK, rsp.Status)
+	}
+	uriList := rsp.Body.(*nrfContext.UriList)
+	if got := hrefs(uriList); !reflect.DeepEqual(got, []string{"amf-1", "amf-2", "amf-3", "smf-1"}) {
+		t.Errorf("unexpected NF instances %v", got)
+	}
+	if uriList.Links.Self == nil || uriList.Links.Next != nil || uriList.Links.Prev != nil {
+		t.Errorf("expected only a self link for an unpaged collection, got %+v", uriList.Links)
+	}
+
+	rsp = getNFInstances(url.Values{"nf-type": {"AMF"}, "limit": {"2"}})
+	uriList = rsp.Body.(*nrfContext.UriList)
+	if got := hrefs(uriList); !reflect.DeepEqual(got, []string{"amf-1", "amf-2"}) {
+		t.Errorf("unexpected NF instances with limit %v", got)
+	}
+
+	rsp = getNFInstances(url.Values{"nf-type": {"AMF"}, "page-number": {"2"}, "page-size": {"2"}})
+	if rsp.Status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rsp.Status)
+	}
+	uriList = rsp.Body.(*nrfContext.UriList)
+	if got := hrefs(uriList); !reflect.DeepEqual(got, []string{"amf-3"}) {
+		t.Errorf("unexpected NF instances on page 2 %v", got)
+	}
+	if uriList.TotalItemCount == nil || *uriList.TotalItemCount != 3 {
+		t.Errorf("expected totalItemCount 3, got %v", uriList.TotalItemCount)
+	}
+	if uriList.Links.Next != nil {
+		t.Errorf("expected no next link on the last page, got %s", uriList.Links.Next.GetHref())
+	}
+	if uriList.Links.Prev == nil || !strings.Contains(uriList.Links.Prev.GetHref(), "page-number=1") {
+		t.Errorf("expected prev link to page 1, got %+v", uriList.Links.Prev)
+	}
+
+	rsp = getNFInstances(url.Values{"page-number": {"1"}, "page-size": {"2"}})
+	uriList = rsp.Body.(*nrfContext.UriList)
+	if uriList.Links.Next == nil || !strings.Contains(uriList.Links.Next.GetHref(), "page-number=2") {
+		t.Errorf("expected next link to page 2, got %+v", uriList.Links.Next)
+	}
+
+	rsp = getNFInstances(url.Values{"limit": {"0"}, "page-size": {"x"}})
+	if rsp.Status != http.StatusBadRequest {
+		t.Fatalf("expected status %d for invalid query, got %d", http.StatusBadRequest, rsp.Status)
+	}
+	if problemDetails := rsp.Body.(*models.ProblemDetails); len(problemDetails.GetInvalidParams()) != 2 {
+		t.Errorf("expected 2 invalid params, got %+v", problemDetails.GetInvalidParams())
+	}
+}
+
+// SubscribedProfileStoreDBClient reports its subscriptions for the NF type
+// condition only, so that each subscriber is notified once.
+type SubscribedProfileStoreDBClient struct {
+	ProfileStoreDBClient
+	subscriptions []map[string]interface{}
+}
+
+func (db *SubscribedProfileStoreDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	if collName == "Subscriptions" {
+		return db.subscriptions, nil
+	}
+	return db.ProfileStoreDBClient.RestfulAPIGetMany(collName, filter)
+}
+
+func TestNFRegisterProcedureDoesNotFailOnSubscriberError(t *testing.T) {
+	notified := make(chan struct{}, 8)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified <- struct{}{}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer subscriber.Close()
+
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = &SubscribedProfileStoreDBClient{
+		ProfileStoreDBClient: ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}},
+		subscriptions:        []map[string]interface{}{{"nfStatusNotificationUri": subscriber.URL}},
+	}
+
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(uuid.New().String())
+	nf.SetNfType(models.NFTYPE_AUSF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+
+	rsp := producer.HandleNFRegisterRequest(context.Background(), &httpwrapper.Request{Body: *nf})
+	if rsp.Status != http.StatusCreated {
+		t.Fatalf("expected status %d despite failing subscriber, got %d: %+v", http.StatusCreated, rsp.Status, rsp.Body)
+	}
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected subscriber to be notified asynchronously")
+	}
+}
+
+func TestNFStatusNotificationsCarryProfileAndChanges(t *testing.T) {
+	notifications := make(chan models.NotificationData, 16)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notificationData models.NotificationData
+		if err := json.NewDecoder(r.Body).Decode(&notificationData); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		// the path tells the subscriptions apart
+		notificationData.NfInstanceUri = r.URL.Path + " " + notificationData.NfInstanceUri
+		notifications <- notificationData
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer subscriber.Close()
+
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = &SubscribedProfileStoreDBClient{
+		ProfileStoreDBClient: ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}},
+		subscriptions: []map[string]interface{}{
+			{"nfStatusNotificationUri": subscriber.URL + "/all"},
+			{
+				"nfStatusNotificationUri": subscriber.URL + "/fqdn",
+				"notifCondition":          map[string]interface{}{"monitoredAttributes": []interface{}{"/fqdn"}},
+			},
+		},
+	}
+	receive := func() map[string]models.NotificationData {
+		received := map[string]models.NotificationData{}
+		for len(received) < 2 {
+			select {
+			case notificationData := <-notifications:
+				received[strings.Fields(notificationData.NfInstanceUri)[0]] = notificationData
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for notifications, got %+v", received)
+			}
+		}
+		return received
+	}
+
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(uuid.New().String())
+	nf.SetNfType(models.NFTYPE_AUSF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	nf.SetFqdn("ausf.example.org")
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
+	}
+	for path, notificationData := range receive() {
+		if notificationData.Event != models.NOTIFICATIONEVENTTYPE_NF_REGISTERED {
+			t.Errorf("%s: expected NF_REGISTERED, got %s", path, notificationData.Event)
+		}
+		if notificationData.NfProfile == nil || notificationData.NfProfile.GetFqdn() != "ausf.example.org" {
+			t.Errorf("%s: expected registered profile, got %+v", path, notificationData.NfProfile)
+		}
+	}
+
+	// A change of an unmonitored attribute only reaches the subscription
+	// without notifCondition
+	nf.SetPriority(10)
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to update NF: %+v", problemDetails)
+	}
+	select {
+	case notificationData := <-notifications:
+		if !strings.HasPrefix(notificationData.NfInstanceUri, "/all ") {
+			t.Errorf("unexpected notification %s", notificationData.NfInstanceUri)
+		}
+		if notificationData.NfProfile == nil || notificationData.NfProfile.GetPriority() != 10 {
+			t.Errorf("expected updated profile, got %+v", notificationData.NfProfile)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for NF_PROFILE_CHANGED")
+	}
+
+	nf.SetFqdn("ausf2.example.org")
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to update NF: %+v", problemDetails)
+	}
+	received := receive()
+	if received["/all"].NfProfile == nil || len(received["/all"].ProfileChanges) != 0 {
+		t.Errorf("expected the whole profile for the subscription without notifCondition, got %+v", received["/all"])
+	}
+	changed := received["/fqdn"]
+	if changed.NfProfile != nil {
+		t.Errorf("expected no profile alongside profileChanges, got %+v", changed.NfProfile)
+	}
+	if len(changed.ProfileChanges) != 1 {
+		t.Fatalf("expected a single change, got %+v", changed.ProfileChanges)
+	}
+	change := changed.ProfileChanges[0]
+	if change.Op != models.CHANGETYPE_REPLACE || change.Path != "/fqdn" ||
+		change.OrigValue != "ausf.example.org" || change.NewValue != "ausf2.example.org" {
+		t.Errorf("unexpected change %+v", change)
+	}
+
+	select {
+	case notificationData := <-notifications:
+		t.Errorf("unexpected notification %+v", notificationData)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type SubscriptionStoreDBClient struct {
+	MockMongoDBClient
+	subscriptions map[string]map[string]interface{}
+	profiles      map[string]map[string]interface{}
+}
+
+func (db *SubscriptionStoreDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	if collName == "NfProfile" {
+		nfInstanceID, _ := filter["nfinstanceid"].(string)
+		return db.profiles[nfInstanceID], nil
+	}
+	subscriptionID, _ := filter["subscriptionId"].(string)
+	return db.subscriptions[subscriptionID], nil
+}
+
+func (db *SubscriptionStoreDBClient) RestfulAPIPost(collName string, filter bson.M, postData map[string]interface{}) (bool, error) {
+	subscriptionID, _ := filter["subscriptionId"].(string)
+	_, existed := db.subscriptions[subscriptionID]
+	db.subscriptions[subscriptionID] = postData
+	return existed, nil
+}
+
+func (db *SubscriptionStoreDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	subscriptionID, _ := filter["subscriptionId"].(string)
+	subscription, ok := db.subscriptions[subscriptionID]
+	if !ok {
+		return false, nil
+	}
+	for key, value := range expected {
+		if subscription[key] != value {
+			return false, nil
+		}
+	}
+	db.subscriptions[subscriptionID] = putData
+	return true, nil
+}
+
+func (db *SubscriptionStoreDBClient) RestfulAPIDeleteMany(collName string, filter bson.M) error {
+	subscriptionID, _ := filter["subscriptionId"].(string)
+	delete(db.subscriptions, subscriptionID)
+	return nil
+}
+
+func TestSubscriptionValidityTime(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	db := &SubscriptionStoreDBClient{subscriptions: map[string]map[string]interface{}{}}
+	dbadapter.DBClient = db
+	maxValidity := factory.NrfConfig.GetMaxSubscriptionValidity()
+
+	subscribe := func(validityTime *time.Time) (time.Time, string, *models.ProblemDetails) {
+		t.Helper()
+		subscription := *models.NewSubscriptionDataWithDefaults()
+		subscription.SetNfStatusNotificationUri("http://192.0.2.10/notify")
+		subscription.ValidityTime = validityTime
+		response, problemDetails := producer.CreateSubscriptionProcedure(context.Background(), subscription)
+		if problemDetails != nil {
+			return time.Time{}, "", problemDetails
+		}
+		granted, err := time.Parse(time.RFC3339, response["validityTime"].(string))
+		if err != nil {
+			t.Fatalf("invalid granted validityTime %v: %v", response["validityTime"], err)
+		}
+		if _, ok := response["expireAt"]; ok {
+			t.Errorf("expected expireAt to stay internal, got %v", response)
+		}
+		subscriptionID := response["subscriptionId"].(string)
+		if expireAt, _ := db.subscriptions[subscriptionID]["expireAt"].(time.Time); !expireAt.Equal(granted) {
+			t.Errorf("stored expireAt = %v, want %v", expireAt, granted)
+		}
+		return granted, subscriptionID, nil
+	}
+
+	now := time.Now()
+	granted, subscriptionID, problemDetails := subscribe(nil)
+	if problemDetails != nil {
+		t.Fatalf("unexpected problem %+v", problemDetails)
+	}
+	if granted.Before(now.Add(maxValidity-time.Minute)) || granted.After(now.Add(maxValidity)) {
+		t.Errorf("expected the maximum validity to be granted, got %v", granted)
+	}
+
+	requested := now.Add(maxValidity / 2).Truncate(time.Second)
+	if granted, _, _ = subscribe(&requested); !granted.Equal(requested) {
+		t.Errorf("granted validityTime = %v, want %v", granted, requested)
+	}
+	requested = now.Add(2 * maxValidity)
+	if granted, _, _ = subscribe(&requested); !granted.Before(requested) {
+		t.Errorf("expected validityTime to be capped, got %v", granted)
+	}
+	requested = now.Add(-time.Minute)
+	if _, _, problemDetails = subscribe(&requested); problemDetails == nil || problemDetails.GetStatus() != http.StatusBadRequest ||
+		len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != "validityTime" {
+		t.Errorf("expected 400 for a past validityTime, got %+v", problemDetails)
+	}
+
+	update := func(subscriptionID, patch string) *httpwrapper.Response {
+		t.Helper()
+		return producer.HandleUpdateSubscriptionRequest(context.Background(), &httpwrapper.Request{
+			Params: map[string]string{"subscriptionID": subscriptionID},
+			Body:   []byte(patch),
+		})
+	}
+	renewal := now.Add(maxValidity / 4).UTC().Truncate(time.Second)
+	response := update(subscriptionID, `[{"op": "replace", "path": "/validityTime", "value": "`+renewal.Format(time.RFC3339)+`"}]`)
+	if response.Status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %+v", response.Status, response.Body)
+	}
+	renewed := response.Body.(*models.SubscriptionData)
+	if !renewed.GetValidityTime().Equal(renewal) || renewed.GetNfStatusNotificationUri() != "http://192.0.2.10/notify" {
+		t.Errorf("unexpected renewed subscription %+v", renewed)
+	}
+	if expireAt, _ := db.subscriptions[subscriptionID]["expireAt"].(time.Time); !expireAt.Equal(renewal) {
+		t.Errorf("stored expireAt = %v, want %v", expireAt, renewal)
+	}
+
+	response = update(subscriptionID, `[{"op": "replace", "path": "/nfStatusNotificationUri", "value": "http://attacker.example.org"}]`)
+	if response.Status != http.StatusBadRequest {
+		t.Errorf("expected 400 when patching another attribute, got %d", response.Status)
+	}
+	response = update("unknown", `[{"op": "replace", "path": "/validityTime", "value": "`+renewal.Format(time.RFC3339)+`"}]`)
+	if response.Status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown subscription, got %d", response.Status)
+	}
+}
+
+func TestSubscriptionValidityTimeUncapped(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalMaxValidity := factory.NrfConfig.Configuration.MaxSubscriptionValidity
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.MaxSubscriptionValidity = originalMaxValidity
+	}()
+	db := &SubscriptionStoreDBClient{subscriptions: map[string]map[string]interface{}{}}
+	dbadapter.DBClient = db
+	factory.NrfConfig.Configuration.MaxSubscriptionValidity = 0
+
+	subscription := *models.NewSubscriptionDataWithDefaults()
+	subscription.SetNfStatusNotificationUri("http://192.0.2.10/notify")
+	response, problemDetails := producer.CreateSubscriptionProcedure(context.Background(), subscription)
+	if problemDetails != nil {
+		t.Fatalf("unexpected problem %+v", problemDetails)
+	}
+	if _, ok := response["validityTime"]; ok {
+		t.Errorf("expected no validityTime to be granted, got %v", response["validityTime"])
+	}
+	if _, ok := db.subscriptions[response["subscriptionId"].(string)]["expireAt"]; ok {
+		t.Error("expected the subscription to be stored without expiry")
+	}
+
+	requested := time.Now().Add(24 * 365 * time.Hour).UTC().Truncate(time.Second)
+	subscription.SetValidityTime(requested)
+	response, problemDetails = producer.CreateSubscriptionProcedure(context.Background(), subscription)
+	if problemDetails != nil {
+		t.Fatalf("unexpected problem %+v", problemDetails)
+	}
+	if granted, _ := time.Parse(time.RFC3339, response["validityTime"].(string)); !granted.Equal(requested) {
+		t.Errorf("granted validityTime = %v, want %v", granted, requested)
+	}
+}
+
+func TestNFStatusNotificationsMatchSubscriptionConditions(t *testing.T) {
+	notified := make(chan string, 32)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified <- r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer subscriber.Close()
+
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId(uuid.New().String())
+	nf.SetNfType(models.NFTYPE_AMF)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	snssai := models.NewSnssai(1)
+	snssai.SetSd("010203")
+	nf.SetSNssais([]models.Snssai{*snssai})
+	nf.SetAllowedNfTypes([]models.NFType{models.NFTYPE_SMF})
+	amfInfo := models.NewAmfInfoWithDefaults()
+	amfInfo.SetAmfSetId("3f8")
+	amfInfo.SetAmfRegionId("ca")
+	amfInfo.SetGuamiList([]models.Guami{{PlmnId: models.PlmnIdNid{Mcc: "001", Mnc: "01"}, AmfId: "cafe00"}})
+	amfInfo.SetTaiList([]models.Tai{{PlmnId: models.PlmnId{Mcc: "001", Mnc: "01"}, Tac: "000001"}})
+	nf.SetAmfInfo(*amfInfo)
+
+	subscription := func(path string, subscrCond map[string]interface{}, extra ...interface{}) map[string]interface{} {
+		doc := map[string]interface{}{"nfStatusNotificationUri": subscriber.URL + path}
+		if subscrCond != nil {
+			doc["subscrCond"] = subscrCond
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			doc[extra[i].(string)] = extra[i+1]
+		}
+		return doc
+	}
+	guami := map[string]interface{}{"plmnId": map[string]interface{}{"mcc": "001", "mnc": "01"}, "amfId": "CAFE00"}
+	tai := map[string]interface{}{"plmnId": map[string]interface{}{"mcc": "001", "mnc": "01"}, "tac": "000001"}
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = &SubscribedProfileStoreDBClient{
+		ProfileStoreDBClient: ProfileStoreDBClient{profiles: map[string]map[string]interface{}{}},
+		subscriptions: []map[string]interface{}{
+			subscription("/all", nil),
+			subscription("/instance", map[string]interface{}{"nfInstanceId": nf.GetNfInstanceId()}),
+			subscription("/other-instance", map[string]interface{}{"nfInstanceId": uuid.New().String()}),
+			subscription("/type", map[string]interface{}{"nfType": "AMF"}),
+			subscription("/other-type", map[string]interface{}{"nfType": "SMF"}),
+			subscription("/amf-set", map[string]interface{}{"amfSetId": "3F8", "amfRegionId": "ca"}),
+			subscription("/other-amf-set", map[string]interface{}{"amfSetId": "3f9"}),
+			subscription("/guami", map[string]interface{}{"guamiList": []interface{}{guami}}),
+			subscription("/slice", map[string]interface{}{"snssaiList": []interface{}{map[string]interface{}{"sst": 1}}}),
+			subscription("/other-slice", map[string]interface{}{"snssaiList": []interface{}{map[string]interface{}{"sst": 2}}}),
+			subscription("/tai", map[string]interface{}{"taiList": []interface{}{tai}}),
+			subscription("/set", map[string]interface{}{"nfSetId": "set1.amfset.5gc.mnc001.mcc001"}),
+			subscription("/deregistered-only", nil, "reqNotifEvents", []interface{}{"NF_DEREGISTERED"}),
+			subscription("/registered-only", nil, "reqNotifEvents", []interface{}{"NF_REGISTERED"}),
+			subscription("/smf", nil, "reqNfType", "SMF"),
+			subscription("/pcf", nil, "reqNfType", "PCF"),
+			subscription("/expired", nil, "validityTime", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)),
+			// the same callback as /type
+			subscription("/type", map[string]interface{}{"nfInstanceId": nf.GetNfInstanceId()}),
+		},
+	}
+
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
+	}
+	want := []string{"/all", "/instance", "/type", "/amf-set", "/guami", "/slice", "/tai", "/registered-only", "/smf"}
+	got := map[string]int{}
+	for range want {
+		select {
+		case path := <-notified:
+			got[path]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for notifications, got %v", got)
+		}
+	}
+	select {
+	case path := <-notified:
+		got[path]++
+	case <-time.After(100 * time.Millisecond):
+	}
+	for _, path := range want {
+		if got[path] != 1 {
+			t.Errorf("expected %s to be notified once, got %d", path, got[path])
+		}
+		delete(got, path)
+	}
+	if len(got) != 0 {
+		t.Errorf("unexpected notifications %v", got)
+	}
+}
+
+func TestCreateSubscriptionValidatesCallbackAndVisibility(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalCallback := factory.NrfConfig.Configuration.SubscriptionCallback
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		factory.NrfConfig.Configuration.SubscriptionCallback = originalCallback
+	}()
+	dbadapter.DBClient = &SubscriptionStoreDBClient{
+		subscriptions: map[string]map[string]interface{}{},
+		profiles: map[string]map[string]interface{}{
+			"amf-1": {"nfinstanceid": "amf-1", "nftype": "AMF", "nfstatus": "REGISTERED", "allowednftypes": []interface{}{"SMF"}},
+		},
+	}
+
+	subscribe := func(callback string, reqNfType models.NFType) *models.ProblemDetails {
+		t.Helper()
+		var subscription models.SubscriptionData
+		if err := json.Unmarshal([]byte(`{"subscrCond": {"nfInstanceId": "amf-1"}}`), &subscription); err != nil {
+			t.Fatalf("failed to decode subscription: %v", err)
+		}
+		subscription.SetNfStatusNotificationUri(callback)
+		subscription.SetReqNfType(reqNfType)
+		_, problemDetails := producer.CreateSubscriptionProcedure(context.Background(), subscription)
+		return problemDetails
+	}
+	expectRejected := func(problemDetails *models.ProblemDetails, status int32, param string) {
+		t.Helper()
+		if problemDetails == nil {
+			t.Fatalf("expected a %d rejection", status)
+		}
+		if problemDetails.GetStatus() != status || len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != param {
+			t.Errorf("expected %d on %s, got %+v", status, param, problemDetails)
+		}
+	}
+
+	expectRejected(subscribe("smf/notify", models.NFTYPE_SMF), http.StatusBadRequest, "nfStatusNotificationUri")
+	expectRejected(subscribe("ftp://192.0.2.10/notify", models.NFTYPE_SMF), http.StatusForbidden, "nfStatusNotificationUri")
+	expectRejected(subscribe("http://169.254.169.254/latest/meta-data", models.NFTYPE_SMF), http.StatusForbidden, "nfStatusNotificationUri")
+	expectRejected(subscribe("http://192.0.2.10/notify", models.NFTYPE_PCF), http.StatusForbidden, "subscrCond")
+	if problemDetails := subscribe("http://192.0.2.10/notify", models.NFTYPE_SMF); problemDetails != nil {
+		t.Errorf("unexpected rejection %+v", problemDetails)
+	}
+
+	factory.NrfConfig.Configuration.SubscriptionCallback = &factory.SubscriptionCallback{
+		AllowedHosts: []string{"*.example.org", "127.0.0.1"},
+		Probe:        true,
+		ProbeTimeout: time.Second,
+	}
+	expectRejected(subscribe("http://10.0.0.1/notify", models.NFTYPE_SMF), http.StatusForbidden, "nfStatusNotificationUri")
+	// loopback is denied by default
+	expectRejected(subscribe("http://localhost/notify", models.NFTYPE_SMF), http.StatusForbidden, "nfStatusNotificationUri")
+
+	factory.NrfConfig.Configuration.SubscriptionCallback.DeniedHosts = []string{}
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	reachable := subscriber.URL
+	subscriber.Close()
+	expectRejected(subscribe(reachable+"/notify", models.NFTYPE_SMF), http.StatusBadRequest, "nfStatusNotificationUri")
+	subscriber = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer subscriber.Close()
+	if problemDetails := subscribe(subscriber.URL+"/notify", models.NFTYPE_SMF); problemDetails != nil {
+		t.Errorf("unexpected rejection of a reachable callback %+v", problemDetails)
+	}
+}
+
+func TestSubscriptionRemovalAndUpdateStatusCodes(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	db := &SubscriptionStoreDBClient{subscriptions: map[string]map[string]interface{}{
+		"sub-1": {"subscriptionId": "sub-1", "nfStatusNotificationUri": "http://192.0.2.10/notify"},
+	}}
+	dbadapter.DBClient = db
+
+	request := func(subscriptionID string, body interface{}) *httpwrapper.Request {
+		return &httpwrapper.Request{Params: map[string]string{"subscriptionID": subscriptionID}, Body: body}
+	}
+	tests := []struct {
+		name   string
+		handle func() *httpwrapper.Response
+		status int
+	}{
+		{"update with a body that is not a patch", func() *httpwrapper.Response {
+			return producer.HandleUpdateSubscriptionRequest(context.Background(), request("sub-1", models.SubscriptionData{}))
+		}, http.StatusBadRequest},
+		{"update with invalid JSON", func() *httpwrapper.Response {
+			return producer.HandleUpdateSubscriptionRequest(context.Background(), request("sub-1", []byte(`{"op": "replace"`)))
+		}, http.StatusBadRequest},
+		{"update with an empty patch", func() *httpwrapper.Response {
+			return producer.HandleUpdateSubscriptionRequest(context.Background(), request("sub-1", []byte(`[]`)))
+		}, http.StatusBadRequest},
+		{"create with a body that is not a subscription", func() *httpwrapper.Response {
+			return producer.HandleCreateSubscriptionRequest(context.Background(), request("", []byte(`{}`)))
+		}, http.StatusBadRequest},
+		{"remove unknown subscription", func() *httpwrapper.Response {
+			return producer.HandleRemoveSubscriptionRequest(context.Background(), request("unknown", nil))
+		}, http.StatusNotFound},
+		{"remove subscription", func() *httpwrapper.Response {
+			return producer.HandleRemoveSubscriptionRequest(context.Background(), request("sub-1", nil))
+		}, http.StatusNoContent},
+		{"remove removed subscription", func() *httpwrapper.Response {
+			return producer.HandleRemoveSubscriptionRequest(context.Background(), request("sub-1", nil))
+		}, http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			response := tc.handle()
+			if response.Status != tc.status {
+				t.Fatalf("expected %d, got %d: %+v", tc.status, response.Status, response.Body)
+			}
+			if tc.status != http.StatusNoContent {
+				if problemDetails, ok := response.Body.(*models.ProblemDetails); !ok || problemDetails.GetDetail() == "" {
+					t.Errorf("expected problem details, got %+v", response.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestNFManagementWithMemoryDBClient(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	originalFetchPlmnConfig := polling.FetchPlmnConfig
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		polling.FetchPlmnConfig = originalFetchPlmnConfig
+	}()
+	polling.FetchPlmnConfig = func() ([]models.PlmnId, error) {
+		return []models.PlmnId{{Mcc: "001", Mnc: "01"}}, nil
+	}
+	dbadapter.DBClient = dbadapter.NewMemoryDBClient()
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() { factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable }()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	nfInstanceIDs := []string{uuid.New().String(), uuid.New().String()}
+	for i, nfInstanceID := range nfInstanceIDs {
+		nf := models.NewNFProfileWithDefaults()
+		nf.SetNfType(models.NFTYPE_AMF)
+		nf.SetNfInstanceId(nfInstanceID)
+		nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+		nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+		nf.SetPriority(int32(10 * (i + 1)))
+		if _, _, err := producer.NFRegisterProcedure(context.Background(), *nf); err != nil {
+			t.Fatalf("failed to register NF: %v", err)
+		}
+	}
+	if nf := producer.GetNFInstanceProcedure(context.Background(), nfInstanceIDs[0]); nf == nil || nf.GetPriority() != 10 {
+		t.Fatalf("expected the registered profile, got %+v", nf)
+	}
+
+	discover := func(query url.Values) []string {
+		t.Helper()
+		result, problemDetails := producer.NFDiscoveryProcedure(context.Background(), query)
+		if problemDetails != nil {
+			t.Fatalf("unexpected problem %+v", problemDetails)
+		}
+		var found []string
+		for _, nf := range result.NfInstances {
+			found = append(found, nf.NfInstanceId)
+		}
+		return found
+	}
+	query := url.Values{"target-nf-type": {"AMF"}, "requester-nf-type": {"SMF"}}
+	if found := discover(query); len(found) != 2 {
+		t.Errorf("expected both AMFs to be discovered, got %v", found)
+	}
+	query.Set("target-nf-instance-id", nfInstanceIDs[1])
+	if found := discover(query); len(found) != 1 || found[0] != nfInstanceIDs[1] {
+		t.Errorf("expected only %s to be discovered, got %v", nfInstanceIDs[1], found)
+	}
+
+	subscription := *models.NewSubscriptionDataWithDefaults()
+	subscription.SetNfStatusNotificationUri("http://192.0.2.10/notify")
+	response, problemDetails := producer.CreateSubscriptionProcedure(context.Background(), subscription)
+	if problemDetails != nil {
+		t.Fatalf("unexpected problem %+v", problemDetails)
+	}
+	subscriptionID := response["subscriptionId"].(string)
+	renewal := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	renewed, problemDetails := producer.UpdateSubscriptionProcedure(context.Background(), subscriptionID,
+		[]byte(`[{"op": "replace", "path": "/validityTime", "value": "`+renewal.Format(time.RFC3339)+`"}]`))
+	if problemDetails != nil || !renewed.GetValidityTime().Equal(renewal) {
+		t.Errorf("expected the subscription to be renewed, got %+v %+v", renewed, problemDetails)
+	}
+	stored, err := dbadapter.DBClient.RestfulAPIGetOne("Subscriptions", bson.M{"subscriptionId": subscriptionID})
+	if err != nil {
+		t.Fatalf("failed to read subscription: %v", err)
+	}
+	switch expireAt := stored["expireAt"].(type) {
+	case bson.DateTime:
+		if !expireAt.Time().Equal(renewal) {
+			t.Errorf("expected the subscription to expire at %v, got %v", renewal, expireAt.Time())
+		}
+	default:
+		t.Errorf("expected expireAt to be stored as a date for the TTL index, got %T %v", expireAt, expireAt)
+	}
+	if problemDetails = producer.RemoveSubscriptionProcedure(context.Background(), subscriptionID); problemDetails != nil {
+		t.Errorf("unexpected problem %+v", problemDetails)
+	}
+	if problemDetails = producer.RemoveSubscriptionProcedure(context.Background(), subscriptionID); problemDetails == nil ||
+		problemDetails.GetStatus() != http.StatusNotFound {
+		t.Errorf("expected 404 for a removed subscription, got %+v", problemDetails)
+	}
+
+	if _, problemDetails = producer.NFDeregisterProcedure(context.Background(), nfInstanceIDs[0]); problemDetails != nil {
+		t.Fatalf("unexpected problem %+v", problemDetails)
+	}
+	query.Del("target-nf-instance-id")
+	if found := discover(query); len(found) != 1 || found[0] != nfInstanceIDs[1] {
+		t.Errorf("expected only %s to be left, got %v", nfInstanceIDs[1], found)
+	}
+}
+
+// racingDBClient runs race once, just before the next write of an NF profile,
+// as a registration handled concurrently by another NRF may.
+type racingDBClient struct {
+	*dbadapter.MemoryDBClient
+	race func()
+}
+
+func (db *racingDBClient) raceOnce() {
+	if race := db.race; race != nil {
+		db.race = nil
+		race()
+	}
+}
+
+func (db *racingDBClient) RestfulAPIPutOneNotUpdate(collName string, filter bson.M, putData map[string]interface{}) (bool, error) {
+	db.raceOnce()
+	return db.MemoryDBClient.RestfulAPIPutOneNotUpdate(collName, filter, putData)
+}
+
+func (db *racingDBClient) RestfulAPICompareAndSwap(collName string, filter bson.M, expected bson.M,
+	putData map[string]interface{},
+) (bool, error) {
+	db.raceOnce()
+	return db.MemoryDBClient.RestfulAPICompareAndSwap(collName, filter, expected, putData)
+}
+
+func TestNFRegisterProcedureConcurrentRegistrations(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	db := &racingDBClient{MemoryDBClient: dbadapter.NewMemoryDBClient()}
+	dbadapter.DBClient = db
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() { factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable }()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	nfInstanceID := uuid.New().String()
+	newProfile := func(locality string) models.NFProfile {
+		nf := models.NewNFProfileWithDefaults()
+		nf.SetNfType(models.NFTYPE_AMF)
+		nf.SetNfInstanceId(nfInstanceID)
+		nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+		nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+		nf.SetLocality(locality)
+		return *nf
+	}
+	register := func(locality string) string {
+		t.Helper()
+		header, _, problemDetails := producer.NFRegisterProcedure(context.Background(), newProfile(locality))
+		if problemDetails != nil {
+			t.Fatalf("failed to register NF from %s: %+v", locality, problemDetails)
+		}
+		return header.Get("ETag")
+	}
+
+	for _, tc := range []struct {
+		name                 string
+		etag, concurrentETag string
+	}{
+		{name: "create", etag: `"2"`, concurrentETag: `"1"`},
+		{name: "replace", etag: `"4"`, concurrentETag: `"3"`},
+	} {
+		var concurrentETag string
+		db.race = func() { concurrentETag = register("site-b") }
+		if etag := register("site-a"); etag != tc.etag || concurrentETag != tc.concurrentETag {
+			t.Errorf("%s: expected ETags %s and %s, got %s and %s", tc.name, tc.etag, tc.concurrentETag, etag, concurrentETag)
+		}
+		stored := producer.GetNFInstanceProcedure(context.Background(), nfInstanceID)
+		if stored == nil || stored.GetLocality() != "site-a" {
+			t.Errorf("%s: expected the last registration to be stored, got %+v", tc.name, stored)
+		}
+	}
+}
+
+func TestNFRegisterProcedureReplacesProfile(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = dbadapter.NewMemoryDBClient()
+	originalExpiryEnable := factory.NrfConfig.Configuration.NfProfileExpiryEnable
+	defer func() { factory.NrfConfig.Configuration.NfProfileExpiryEnable = originalExpiryEnable }()
+	factory.NrfConfig.Configuration.NfProfileExpiryEnable = true
+
+	nfInstanceID := uuid.New().String()
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfType(models.NFTYPE_AMF)
+	nf.SetNfInstanceId(nfInstanceID)
+	nf.SetNfStatus(models.NFSTATUS_REGISTERED)
+	nf.SetPlmnList([]models.PlmnId{{Mcc: "001", Mnc: "01"}})
+	nf.SetFqdn("amf.example.org")
+	nf.SetLocality("site-a")
+	if _, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf); problemDetails != nil {
+		t.Fatalf("failed to register NF: %+v", problemDetails)
+	}
+	stored, err := dbadapter.DBClient.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID})
+	if err != nil || stored == nil {
+		t.Fatalf("expected the profile to be stored, got %v %v", stored, err)
+	}
+	createdAt := stored["createdAt"]
+	// An attribute written by another release, not part of the new profile
+	if _, err := dbadapter.DBClient.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID},
+		map[string]interface{}{"vendorInfo": "legacy"}); err != nil {
+		t.Fatalf("failed to update the stored profile: %v", err)
+	}
+
+	nf.Fqdn = nil
+	nf.SetLocality("site-b")
+	header, _, problemDetails := producer.NFRegisterProcedure(context.Background(), *nf)
+	if problemDetails != nil {
+		t.Fatalf("failed to register NF again: %+v", problemDetails)
+	}
+	if etag := header.Get("ETag"); etag != `"2"` {
+		t.Errorf("expected ETag \"2\", got %q", etag)
+	}
+	stored, err = dbadapter.DBClient.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID})
+	if err != nil || stored == nil {
+		t.Fatalf("expected the profile to be stored, got %v %v", stored, err)
+	}
+	for _, attr := range []string{"fqdn", "vendorInfo"} {
+		if value := stored[attr]; value != nil {
+			t.Errorf("expected %s left out of the new profile to be dropped, got %v", attr, value)
+		}
+	}
+	if locality := stored["locality"]; locality != "site-b" {
+		t.Errorf("expected locality site-b, got %v", locality)
+	}
+	if !reflect.DeepEqual(stored["createdAt"], createdAt) {
+		t.Errorf("expected createdAt %v to be kept, got %v", createdAt, stored["createdAt"])
+	}
+}
+
+func TestGetNotificationSubscriptionsQueriesCandidates(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() { dbadapter.DBClient = originalDBClient }()
+	db := dbadapter.NewMemoryDBClient()
+	dbadapter.DBClient = db
+	subscriptions := map[string]map[string]interface{}{
+		"any":             {},
+		"no-events":       {"reqNotifEvents": []interface{}{}},
+		"registered":      {"reqNotifEvents": []interface{}{"NF_REGISTERED"}},
+		"deregistered":    {"reqNotifEvents": []interface{}{"NF_DEREGISTERED"}},
+		"instance":        {"subscrCond": map[string]interface{}{"nfInstanceId": "amf-1"}},
+		"other-instance":  {"subscrCond": map[string]interface{}{"nfInstanceId": "amf-2"}},
+		"instance-list":   {"subscrCond": map[string]interface{}{"nfInstanceIdList": []interface{}{"amf-2", "amf-1"}}},
+		"nf-type":         {"subscrCond": map[string]interface{}{"nfType": "AMF"}},
+		"other-nf-type":   {"subscrCond": map[string]interface{}{"nfType": "SMF"}},
+		"service-name":    {"subscrCond": map[string]interface{}{"serviceName": "namf-comm"}},
+		"other-service":   {"subscrCond": map[string]interface{}{"serviceName": "nsmf-pdusession"}},
+		"scp-domain-type": {"subscrCond": map[string]interface{}{"scpDomains": []interface{}{"d1"}, "nfType": "SMF"}},
+	}
+	for subscriptionID, doc := range subscriptions {
+		doc["subscriptionId"] = subscriptionID
+		doc["nfStatusNotificationUri"] = "http://192.0.2.10/" + subscriptionID
+		db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": subscriptionID}, doc)
+	}
+	nf := models.NewNFProfileWithDefaults()
+	nf.SetNfInstanceId("amf-1")
+	nf.SetNfType(models.NFTYPE_AMF)
+	nf.SetNfServices([]models.NFService{*models.NewNFServiceWithDefaults()})
+	nf.NfServices[0].SetServiceName("namf-comm")
+	nf.SetScpDomains([]string{"d1"})
+
+	var notified []string
+	for _, subscription := range nrfContext.GetNotificationSubscriptions(context.Background(), *nf,
+		models.NOTIFICATIONEVENTTYPE_NF_REGISTERED) {
+		notified = append(notified, subscription.GetSubscriptionId())
 	}
-	if capturedPatchItems[0].Path != "/nfstatus" {
-		t.Fatalf("expected normalized patch path /nfstatus, got %q", capturedPatchItems[0].Path)
+	want := []string{"any", "instance", "instance-list", "nf-type", "no-events", "registered", "scp-domain-type", "service-name"}
+	slices.Sort(notified)
+	if !reflect.DeepEqual(notified, want) {
+		t.Errorf("expected subscriptions %v to be notified, got %v", want, notified)
 	}
 }
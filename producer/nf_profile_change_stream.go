@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/util"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// deregistrationClaimRetention is how long the claim of an NF_DEREGISTERED
+// notification is kept, long enough for every NRF to see the deletion.
+const deregistrationClaimRetention = time.Hour
+
+// deregistrationClaims is set when NRF instances sharing the database each
+// see every deletion of an NF profile, so that they must agree on which one
+// notifies it.
+var deregistrationClaims atomic.Bool
+
+// EnableDeregistrationClaims has each NF_DEREGISTERED notification sent by
+// the first NRF claiming it among those sharing the database, rather than by
+// every NRF seeing the deletion.
+func EnableDeregistrationClaims() {
+	deregistrationClaims.Store(true)
+}
+
+func deregistrationClaimKey(nfInstanceID string, version int64) string {
+	return fmt.Sprintf("deregistered:%s:%d", nfInstanceID, version)
+}
+
+// claimDeregistration reports whether this NRF is the one to notify and
+// record the deregistration of the given version of an NF instance. An NRF
+// removing a profile claims it before the removal, so that the change stream
+// of every NRF leaves it to that one. Should the claim not be recorded, the
+// notification is sent anyway: a duplicate is better than none.
+func claimDeregistration(nfInstanceID string, version int64) bool {
+	if !deregistrationClaims.Load() {
+		return true
+	}
+	key := deregistrationClaimKey(nfInstanceID, version)
+	existed, err := dbadapter.DBClient.RestfulAPIPutOneNotUpdate(dbadapter.NotificationClaimsCollection,
+		bson.M{"_id": key}, map[string]interface{}{
+			"_id":      key,
+			"expireAt": time.Now().Add(deregistrationClaimRetention),
+		})
+	if errors.Is(err, dbadapter.ErrDuplicateKey) {
+		return false
+	}
+	if err != nil {
+		logger.ManagementLog.Warnf("failed to claim deregistration of nf instance [%s]: %v", nfInstanceID, err)
+		return true
+	}
+	return !existed
+}
+
+// releaseDeregistration gives up the claim of a deregistration which did not
+// happen, the profile having changed before its removal.
+func releaseDeregistration(nfInstanceID string, version int64) {
+	if !deregistrationClaims.Load() {
+		return
+	}
+	key := deregistrationClaimKey(nfInstanceID, version)
+	if err := dbadapter.DBClient.RestfulAPIDeleteOne(dbadapter.NotificationClaimsCollection, bson.M{"_id": key}); err != nil {
+		logger.ManagementLog.Warnf("failed to release deregistration claim of nf instance [%s]: %v", nfInstanceID, err)
+	}
+}
+
+// HandleNFProfileChange keeps this NRF consistent with a change to the
+// NfProfile collection, made by it or by another NRF sharing the database.
+// The changed profile is evicted from the cache, and a profile removed by
+// the database once expired is deregistered as by the NRF itself.
+func HandleNFProfileChange(event dbadapter.ChangeEvent) {
+	switch event.Operation {
+	case dbadapter.ChangeInsert, dbadapter.ChangeUpdate, dbadapter.ChangeReplace:
+		nfInstanceID, _ := event.Document["nfinstanceid"].(string)
+		if nfInstanceID == "" {
+			// removed since, without knowing which profile
+			profileCache.clear()
+			return
+		}
+		profileCache.evict(nfInstanceID)
+	case dbadapter.ChangeDelete:
+		nfInstanceID, _ := event.Previous["nfinstanceid"].(string)
+		if nfInstanceID == "" {
+			// no pre-image to tell which profile was removed
+			profileCache.clear()
+			return
+		}
+		profileCache.evict(nfInstanceID)
+		if !claimDeregistration(nfInstanceID, nfProfileVersion(event.Previous)) {
+			// notified by the NRF which removed it, or by another one
+			return
+		}
+		logger.ManagementLog.Infof("nf instance [%s] deregistered: profile removed", nfInstanceID)
+		recordNFRemoved(context.Background(), NfEventExpired, nfInstanceID, event.Previous)
+		nfProfile, err := util.DecodeNFProfile(event.Previous)
+		if err != nil {
+			logger.ManagementLog.Warnf("cannot decode removed nf profile [%s]: %v", nfInstanceID, err)
+		} else {
+			notifyNFDeregistered(context.Background(), nfProfile)
+		}
+		if err := deleteNFInstanceSubscriptions(context.Background(), nfInstanceID); err != nil {
+			logger.ManagementLog.Warnf("failed to delete subscriptions of nf instance [%s]: %v", nfInstanceID, err)
+		}
+	case dbadapter.ChangeReset:
+		profileCache.clear()
+	}
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/openapi/v2/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestHandleNFProfileChangeEvictsCache(t *testing.T) {
+	defer profileCache.clear()
+	cached := func(nfInstanceID string) bool {
+		_, ok := profileCache.get(nfInstanceID)
+		return ok
+	}
+	for _, nfInstanceID := range []string{"amf-1", "amf-2"} {
+		profile := models.NewNFProfileDiscoveryWithDefaults()
+		profile.SetNfInstanceId(nfInstanceID)
+		profile.SetNfType(models.NFTYPE_AMF)
+		profileCache.set(*profile, time.Now().Add(time.Minute))
+	}
+
+	HandleNFProfileChange(dbadapter.ChangeEvent{
+		Operation: dbadapter.ChangeUpdate,
+		Document:  map[string]interface{}{"nfinstanceid": "amf-1", "nftype": "AMF"},
+	})
+	if cached("amf-1") || !cached("amf-2") {
+		t.Error("expected only the updated profile to be evicted")
+	}
+
+	HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeReset})
+	if cached("amf-2") {
+		t.Error("expected a reset to clear the cache")
+	}
+}
+
+func TestHandleNFProfileChangeNotifiesDeletionOnce(t *testing.T) {
+	notifications := make(chan string, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notificationData models.NotificationData
+		if err := json.NewDecoder(r.Body).Decode(&notificationData); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		notifications <- string(notificationData.Event) + " " + notificationData.NfInstanceUri
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		deregistrationClaims.Store(false)
+	}()
+	db := dbadapter.NewMemoryDBClient()
+	dbadapter.DBClient = db
+	EnableDeregistrationClaims()
+	for _, nfInstanceID := range []string{"amf-removed", "amf-expired"} {
+		db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": nfInstanceID}, map[string]interface{}{
+			"nfStatusNotificationUri": server.URL,
+			"subscrCond":              map[string]interface{}{"nfInstanceId": nfInstanceID},
+		})
+	}
+
+	// A profile removed by MongoDB is seen by every NRF sharing the database
+	removed := dbadapter.ChangeEvent{
+		Operation: dbadapter.ChangeDelete,
+		Previous:  map[string]interface{}{"nfinstanceid": "amf-removed", "nftype": "AMF", "nfstatus": "REGISTERED", "profileVersion": int32(3)},
+	}
+	HandleNFProfileChange(removed)
+	HandleNFProfileChange(removed)
+
+	// A profile expired by an NRF is seen again in the change stream
+	now := time.Now()
+	db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "amf-expired"}, map[string]interface{}{
+		"nfinstanceid": "amf-expired", "nftype": "AMF", "nfstatus": "REGISTERED", "expireAt": now.Add(-time.Second),
+	})
+	expired, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-expired"})
+	expireNFProfiles(now)
+	HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: expired})
+
+	want := map[string]bool{
+		"NF_DEREGISTERED " + nrfContext.GetNfInstanceURI("amf-removed"): true,
+		"NF_DEREGISTERED " + nrfContext.GetNfInstanceURI("amf-expired"): true,
+	}
+	for len(want) != 0 {
+		select {
+		case notification := <-notifications:
+			if !want[notification] {
+				t.Errorf("unexpected notification %q", notification)
+			}
+			delete(want, notification)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notifications")
+		}
+	}
+	select {
+	case notification := <-notifications:
+		t.Errorf("unexpected notification %q", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if docs, _ := db.RestfulAPIGetMany("Subscriptions", bson.M{}); len(docs) != 0 {
+		t.Errorf("expected the subscriptions of the removed profiles to be deleted, got %v", docs)
+	}
+}
+
+func TestHandleNFProfileChangeSkipsLegacyReplacement(t *testing.T) {
+	notifications := make(chan string, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notifications <- r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		deregistrationClaims.Store(false)
+	}()
+	db := dbadapter.NewMemoryDBClient()
+	dbadapter.DBClient = db
+	EnableDeregistrationClaims()
+	db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": "sub-1"}, map[string]interface{}{
+		"nfStatusNotificationUri": server.URL,
+		"subscrCond":              map[string]interface{}{"nfInstanceId": "amf-2"},
+	})
+	var removed []map[string]interface{}
+	for _, nfInstanceID := range []string{"amf-1", "amf-2"} {
+		db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID}, map[string]interface{}{
+			"nfinstanceid": nfInstanceID, "nftype": "AMF", "nfstatus": "REGISTERED", "profileVersion": int64(1),
+		})
+		doc, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": nfInstanceID})
+		removed = append(removed, doc)
+	}
+
+	// The legacy registration removes every AMF profile, which the change
+	// stream of every NRF then sees
+	if problemDetails := NFDeleteAll(context.Background(), "AMF"); problemDetails != nil {
+		t.Fatalf("unexpected failure %+v", problemDetails)
+	}
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{}); len(docs) != 0 {
+		t.Fatalf("expected the AMF profiles to be removed, got %v", docs)
+	}
+	for _, doc := range removed {
+		HandleNFProfileChange(dbadapter.ChangeEvent{Operation: dbadapter.ChangeDelete, Previous: doc})
+	}
+
+	select {
+	case notification := <-notifications:
+		t.Errorf("unexpected notification to %q", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if docs, _ := db.RestfulAPIGetMany("Subscriptions", bson.M{}); len(docs) != 1 {
+		t.Errorf("expected the subscription to be kept, got %v", docs)
+	}
+}
+
+func TestNFDeregisterRemovesUndecodableProfile(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+		deregistrationClaims.Store(false)
+	}()
+	db := dbadapter.NewMemoryDBClient()
+	dbadapter.DBClient = db
+	EnableDeregistrationClaims()
+	db.RestfulAPIPost("Subscriptions", bson.M{"subscriptionId": "sub-1"}, map[string]interface{}{
+		"nfStatusNotificationUri": "http://192.0.2.10/notify",
+		"subscrCond":              map[string]interface{}{"nfInstanceId": "amf-1"},
+	})
+	db.RestfulAPIPutOne("NfProfile", bson.M{"nfinstanceid": "amf-1"}, map[string]interface{}{
+		"nfinstanceid": "amf-1", "nftype": "AMF", "nfstatus": "REGISTERED", "priority": "high",
+		"profileVersion": int64(1),
+	})
+	removed, _ := db.RestfulAPIGetOne("NfProfile", bson.M{"nfinstanceid": "amf-1"})
+
+	if _, problemDetails := NFDeregisterProcedure(context.Background(), "amf-1"); problemDetails != nil {
+		t.Fatalf("unexpected failure %+v", problemDetails)
+	}
+	if docs, _ := db.RestfulAPIGetMany("NfProfile", bson.M{}); len(docs) != 0 {
+		t.Errorf("expected the profile to be removed, got %v", docs)
+	}
+	if docs, _ := db.RestfulAPIGetMany("Subscriptions", bson.M{}); len(docs) != 0 {
+		t.Errorf("expected the subscriptions of the profile to be deleted, got %v", docs)
+	}
+	// The deregistration stays claimed by this NRF
+	if claimDeregistration("amf-1", nfProfileVersion(removed)) {
+		t.Error("expected the deregistration to remain claimed")
+	}
+}
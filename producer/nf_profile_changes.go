@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// notificationProfile returns the profile as sent to subscribers, with the
+// BSF ranges back in their wire format.
+func notificationProfile(nf models.NFProfile) models.NFProfile {
+	nrfContext.DecodeBsfInfoRanges(&nf)
+	return nf
+}
+
+// nfProfileChanges lists the differences between two versions of a profile
+// as the ChangeItems of TS 29.510 clause 6.1.6.3.4, with JSON pointer paths.
+// Objects are compared attribute by attribute while a modified array is
+// reported as a whole.
+func nfProfileChanges(previous, current models.NFProfile) ([]models.ChangeItem, error) {
+	previousDoc, err := profileDocument(notificationProfile(previous))
+	if err != nil {
+		return nil, err
+	}
+	currentDoc, err := profileDocument(notificationProfile(current))
+	if err != nil {
+		return nil, err
+	}
+	return diffDocuments("", previousDoc, currentDoc), nil
+}
+
+func profileDocument(nf models.NFProfile) (map[string]interface{}, error) {
+	b, err := json.Marshal(nf)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func diffDocuments(path string, previous, current map[string]interface{}) []models.ChangeItem {
+	keys := make([]string, 0, len(previous)+len(current))
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []models.ChangeItem{}
+	for _, key := range keys {
+		attrPath := path + "/" + escapeJSONPointer(key)
+		previousValue, inPrevious := previous[key]
+		currentValue, inCurrent := current[key]
+		switch {
+		case !inCurrent:
+			change := models.NewChangeItem(models.CHANGETYPE_REMOVE, attrPath)
+			change.SetOrigValue(previousValue)
+			changes = append(changes, *change)
+		case !inPrevious:
+			change := models.NewChangeItem(models.CHANGETYPE_ADD, attrPath)
+			change.SetNewValue(currentValue)
+			changes = append(changes, *change)
+		default:
+			previousObject, previousIsObject := previousValue.(map[string]interface{})
+			currentObject, currentIsObject := currentValue.(map[string]interface{})
+			if previousIsObject && currentIsObject {
+				changes = append(changes, diffDocuments(attrPath, previousObject, currentObject)...)
+			} else if !reflect.DeepEqual(previousValue, currentValue) {
+				change := models.NewChangeItem(models.CHANGETYPE_REPLACE, attrPath)
+				change.SetOrigValue(previousValue)
+				change.SetNewValue(currentValue)
+				changes = append(changes, *change)
+			}
+		}
+	}
+	return changes
+}
+
+// escapeJSONPointer escapes a reference token as per RFC 6901 clause 3.
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// monitoredChanges keeps the changes a subscriber is interested in according
+// to the monitoredAttributes and unmonitoredAttributes of its notifCondition.
+func monitoredChanges(changes []models.ChangeItem, condition *models.NotifCondition) []models.ChangeItem {
+	if condition == nil {
+		return changes
+	}
+	monitored := condition.GetMonitoredAttributes()
+	unmonitored := condition.GetUnmonitoredAttributes()
+	relevant := make([]models.ChangeItem, 0, len(changes))
+	for _, change := range changes {
+		if len(monitored) != 0 && !matchesAttribute(change.Path, monitored) {
+			continue
+		}
+		if coveredByAttribute(change.Path, unmonitored) {
+			continue
+		}
+		relevant = append(relevant, change)
+	}
+	return relevant
+}
+
+// matchesAttribute reports whether a change at path affects one of the
+// attributes, given as JSON pointers: the attribute itself, one of its
+// children or a parent replaced as a whole.
+func matchesAttribute(path string, attributes []string) bool {
+	for _, attr := range attributes {
+		attr = "/" + strings.Trim(attr, "/")
+		if path == attr || strings.HasPrefix(path, attr+"/") || strings.HasPrefix(attr, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredByAttribute reports whether a change at path only touches one of
+// the attributes or their children.
+func coveredByAttribute(path string, attributes []string) bool {
+	for _, attr := range attributes {
+		attr = "/" + strings.Trim(attr, "/")
+		if path == attr || strings.HasPrefix(path, attr+"/") {
+			return true
+		}
+	}
+	return false
+}
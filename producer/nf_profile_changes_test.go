@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/omec-project/openapi/v2/models"
+)
+
+func TestNFProfileChanges(t *testing.T) {
+	previous := models.NewNFProfileWithDefaults()
+	previous.SetNfInstanceId("ausf-1")
+	previous.SetNfType(models.NFTYPE_AUSF)
+	previous.SetNfStatus(models.NFSTATUS_REGISTERED)
+	previous.SetFqdn("ausf.example.org")
+	previous.SetCustomInfo(map[string]interface{}{"site": "lab", "a/b": "x"})
+
+	current := *previous
+	current.Fqdn = nil
+	current.SetPriority(1)
+	current.SetCustomInfo(map[string]interface{}{"site": "edge", "a/b": "x"})
+
+	changes, err := nfProfileChanges(*previous, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, string(change.Op)+" "+change.Path)
+	}
+	want := []string{"REPLACE /customInfo/site", "REMOVE /fqdn", "ADD /priority"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+
+	condition := models.NotifCondition{UnmonitoredAttributes: []string{"/customInfo"}}
+	relevant := monitoredChanges(changes, &condition)
+	if len(relevant) != 2 || relevant[0].Path != "/fqdn" {
+		t.Errorf("expected unmonitored customInfo to be filtered out, got %+v", relevant)
+	}
+	condition = models.NotifCondition{MonitoredAttributes: []string{"/customInfo/site"}}
+	relevant = monitoredChanges(changes, &condition)
+	if len(relevant) != 1 || relevant[0].Path != "/customInfo/site" {
+		t.Errorf("expected only the monitored attribute, got %+v", relevant)
+	}
+}
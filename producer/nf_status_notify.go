@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/notification"
+	"github.com/omec-project/nrf/util"
+	"github.com/omec-project/openapi/v2/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// notificationDeadLetterCollection keeps the NF status notifications that
+// could not be delivered to their subscriber.
+const notificationDeadLetterCollection = "NotificationDeadLetters"
+
+var (
+	nfStatusNotifierMu sync.Mutex
+	nfStatusNotifier   *notification.Dispatcher
+)
+
+// StartNFStatusNotifier starts delivering NF status notifications with the
+// configured notification settings.
+func StartNFStatusNotifier() {
+	nfStatusNotifierMu.Lock()
+	defer nfStatusNotifierMu.Unlock()
+	if nfStatusNotifier == nil {
+		nfStatusNotifier = newNFStatusNotifier()
+	}
+}
+
+// StopNFStatusNotifier stops the notification workers.
+func StopNFStatusNotifier() {
+	nfStatusNotifierMu.Lock()
+	defer nfStatusNotifierMu.Unlock()
+	if nfStatusNotifier != nil {
+		nfStatusNotifier.Stop()
+		nfStatusNotifier = nil
+	}
+}
+
+func newNFStatusNotifier() *notification.Dispatcher {
+	cfg := factory.NrfConfig.GetNotificationConfig()
+	dispatcher := notification.NewDispatcher(notification.Config{
+		Workers:        cfg.Workers,
+		QueueSize:      cfg.QueueSize,
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Timeout:        cfg.Timeout,
+	}, newNotificationClient(cfg.Client), recordNotificationDeadLetter)
+	dispatcher.Observe(recordSubscriptionDelivery)
+	dispatcher.Start()
+	return dispatcher
+}
+
+// newNotificationClient returns the HTTP client configured for notifications,
+// or a default one if it cannot be set up.
+func newNotificationClient(cfg factory.NotificationClient) *http.Client {
+	clientConfig := notification.ClientConfig{
+		HTTP2:               cfg.Http2,
+		CAFile:              cfg.CaCert,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		AddressDenied:       callbackAddressDenied,
+	}
+	if cfg.TLS != nil {
+		clientConfig.CertFile, clientConfig.KeyFile = cfg.TLS.PEM, cfg.TLS.Key
+	}
+	if cfg.OAuth2 {
+		clientConfig.Token = selfIssuedAccessToken(cfg.OAuth2Scope)
+	}
+	client, err := notification.NewClient(clientConfig)
+	if err != nil {
+		logger.ManagementLog.Errorf("cannot set up the notification client, using defaults: %v", err)
+		return &http.Client{}
+	}
+	return client
+}
+
+// selfIssuedAccessToken gets the access tokens sent with notifications from
+// the token service of this NRF.
+func selfIssuedAccessToken(scope string) notification.TokenSource {
+	return func(context.Context) (string, time.Duration, error) {
+		request := models.NewAccessTokenReq("client_credentials", nrfContext.NrfNfProfile.GetNfInstanceId(), scope)
+		request.SetNfType(models.NFTYPE_NRF)
+		response, errResponse := AccessTokenProcedure(*request)
+		if errResponse != nil {
+			return "", 0, fmt.Errorf("access token request rejected: %s", errResponse.Error)
+		}
+		return response.GetAccessToken(), time.Duration(response.GetExpiresIn()) * time.Second, nil
+	}
+}
+
+// currentNFStatusNotifier returns the running dispatcher, starting one for
+// callers that notify before StartNFStatusNotifier.
+func currentNFStatusNotifier() *notification.Dispatcher {
+	nfStatusNotifierMu.Lock()
+	defer nfStatusNotifierMu.Unlock()
+	if nfStatusNotifier == nil {
+		nfStatusNotifier = newNFStatusNotifier()
+	}
+	return nfStatusNotifier
+}
+
+// notifyNFStatus queues an NF status notification to every subscription.
+// Delivery is asynchronous: a failing subscriber never delays nor fails the
+// procedure that triggered the notification.
+//
+// nfProfile is included for NF_REGISTERED and NF_PROFILE_CHANGED. For the
+// latter, changes lists what was modified, nil when unknown: subscribers
+// monitoring none of the changed attributes are skipped and those that set a
+// notifCondition receive the profileChanges instead of the whole profile.
+func notifyNFStatus(event models.NotificationEventType, nfInstanceUri string,
+	subscriptions []models.SubscriptionData, nfProfile *models.NFProfile, changes []models.ChangeItem,
+) {
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	dispatcher := currentNFStatusNotifier()
+	// A callback shared by several subscriptions is notified once
+	notified := make(map[string]bool, len(subscriptions))
+	for _, subscription := range subscriptions {
+		uri := subscription.GetNfStatusNotificationUri()
+		if notified[uri] {
+			continue
+		}
+		notificationData := models.NotificationData{
+			Event:         event,
+			NfInstanceUri: nfInstanceUri,
+		}
+		switch event {
+		case models.NOTIFICATIONEVENTTYPE_NF_REGISTERED:
+			if nfProfile != nil {
+				notificationData.SetNfProfile(notificationProfile(*nfProfile))
+			}
+		case models.NOTIFICATIONEVENTTYPE_NF_PROFILE_CHANGED:
+			condition, hasCondition := subscription.GetNotifConditionOk()
+			if changes != nil {
+				relevant := monitoredChanges(changes, condition)
+				if len(relevant) == 0 {
+					continue
+				}
+				if hasCondition {
+					notificationData.SetProfileChanges(relevant)
+					break
+				}
+			}
+			if nfProfile != nil {
+				notificationData.SetNfProfile(notificationProfile(*nfProfile))
+			}
+		}
+		body, err := json.Marshal(notificationData)
+		if err != nil {
+			logger.ManagementLog.Errorf("failed to encode %s notification: %+v", event, err)
+			continue
+		}
+
+		notified[uri] = true
+		logger.ManagementLog.Infof("status Notification Uri: %v", uri)
+		dispatcher.Enqueue(notification.Notification{
+			Destination:  uri,
+			Event:        string(event),
+			Body:         body,
+			Subscription: subscription.GetSubscriptionId(),
+		})
+	}
+}
+
+// notifyNFProfileChanged notifies NF_PROFILE_CHANGED when the stored profile
+// previousDoc differs from current. Without previousDoc the changes are unknown
+// and every subscriber receives the whole profile.
+func notifyNFProfileChanged(ctx context.Context, previousDoc map[string]interface{}, current models.NFProfile) {
+	var changes []models.ChangeItem
+	if previousDoc != nil {
+		previous, err := util.DecodeNFProfile(previousDoc)
+		if err == nil {
+			changes, err = nfProfileChanges(previous, current)
+		}
+		if err != nil {
+			logger.ManagementLog.Warnf("cannot compute changes of nf profile [%s]: %v", current.GetNfInstanceId(), err)
+			changes = nil
+		} else if len(changes) == 0 {
+			return
+		}
+	}
+	notifyNFStatus(models.NOTIFICATIONEVENTTYPE_NF_PROFILE_CHANGED, nrfContext.GetNfInstanceURI(current.GetNfInstanceId()),
+		nrfContext.GetNotificationSubscriptions(ctx, current, models.NOTIFICATIONEVENTTYPE_NF_PROFILE_CHANGED), &current, changes)
+}
+
+// notifyNFDeregistered tells the subscribers that an NF instance was
+// deregistered, explicitly or because its heartbeat expired.
+func notifyNFDeregistered(ctx context.Context, nfProfile models.NFProfile) {
+	sendNFDownNotification(nfProfile)
+	notifyNFStatus(models.NOTIFICATIONEVENTTYPE_NF_DEREGISTERED, nrfContext.GetNfInstanceURI(nfProfile.GetNfInstanceId()),
+		nrfContext.GetNotificationSubscriptions(ctx, nfProfile, models.NOTIFICATIONEVENTTYPE_NF_DEREGISTERED), nil, nil)
+}
+
+// sendNFDownNotification reports a deregistered AMF instance to the AMF OAM
+// service, when that integration is enabled.
+func sendNFDownNotification(nfProfile models.NFProfile) {
+	if nfProfile.GetNfType() != models.NFTYPE_AMF {
+		return
+	}
+	uri := factory.NrfConfig.GetAmfInstanceDownUri()
+	if uri == "" {
+		return
+	}
+	currentNFStatusNotifier().Enqueue(notification.Notification{
+		Destination: uri + nfProfile.GetNfInstanceId(),
+		Event:       "AMF_INSTANCE_DOWN",
+	})
+}
+
+func recordNotificationDeadLetter(deadLetter notification.DeadLetter) {
+	if dbadapter.DBClient == nil {
+		return
+	}
+	id := uuid.New().String()
+	putData := bson.M{
+		"id":          id,
+		"destination": deadLetter.Destination,
+		"event":       deadLetter.Event,
+		"body":        string(deadLetter.Body),
+		"attempts":    deadLetter.Attempts,
+		"lastError":   deadLetter.LastError,
+		"createdAt":   deadLetter.Time,
+	}
+	if _, err := dbadapter.DBClient.RestfulAPIPost(notificationDeadLetterCollection, bson.M{"id": id}, putData); err != nil {
+		logger.ManagementLog.Errorf("failed to record undelivered %s notification to %s: %v",
+			deadLetter.Event, deadLetter.Destination, err)
+	}
+}
@@ -70,3 +70,9 @@ func (c *nfProfileCache) evictByNfType(nfType string) {
 	}
 	c.mu.Unlock()
 }
+
+func (c *nfProfileCache) clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.mu.Unlock()
+}
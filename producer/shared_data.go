@@ -0,0 +1,694 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/util"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+	"github.com/omec-project/util/httpwrapper"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	sharedDataCollection = "SharedData"
+	// sharedAttributesField lists, in each NfProfile document, the profile
+	// attributes that were copied from the referenced shared profile data so
+	// that they can be replaced when the shared data changes.
+	sharedAttributesField = "sharedAttributes"
+	// sharedServiceDataIDsField lists, in each NfProfile document, the
+	// shared service data referenced by the NF services of the profile.
+	sharedServiceDataIDsField = "sharedServiceDataIds"
+)
+
+var errSharedDataNotFound = errors.New("shared data not found")
+
+// sharedProfileDataForbiddenAttributes identify an NF instance and cannot be
+// inherited from shared data.
+var sharedProfileDataForbiddenAttributes = []string{"nfInstanceId", "sharedProfileDataId", "heartBeatTimer"}
+
+// sharedServiceDataForbiddenAttributes identify an NF service and cannot be
+// inherited from shared data.
+var sharedServiceDataForbiddenAttributes = []string{"serviceInstanceId", "sharedServiceDataId"}
+
+func HandleGetSharedDataRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle GetSharedDataRequest")
+	sharedDataID := request.Params["sharedDataId"]
+
+	sharedData, err := getSharedData(ctx, sharedDataID)
+	if errors.Is(err, errSharedDataNotFound) {
+		problemDetails := utils.ProblemDetailsContextNotFound("Shared data not found")
+		return httpwrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	}
+	if err != nil {
+		problemDetails := storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, sharedData)
+}
+
+func HandleRegisterSharedDataRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle RegisterSharedDataRequest")
+	sharedDataID := request.Params["sharedDataId"]
+	body, ok := request.Body.([]byte)
+	if !ok {
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax("Invalid body format")
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	var sharedData map[string]interface{}
+	if err := json.Unmarshal(body, &sharedData); err != nil {
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax("[Request Body] " + err.Error())
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+
+	existed, problemDetails := storeSharedData(ctx, sharedDataID, sharedData)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	if existed {
+		return httpwrapper.NewResponse(http.StatusOK, nil, sharedData)
+	}
+	header := make(http.Header)
+	header.Set("Location", factory.NrfConfig.GetSbiUri()+"/nnrf-nfm/v1/shared-data/"+sharedDataID)
+	return httpwrapper.NewResponse(http.StatusCreated, header, sharedData)
+}
+
+func HandleUpdateSharedDataRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle UpdateSharedDataRequest")
+	sharedDataID := request.Params["sharedDataId"]
+	patchJSON, ok := request.Body.([]byte)
+	if !ok {
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax("Invalid body format")
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax(fmt.Sprintf("%s: %v", errInvalidPatch, err))
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+
+	sharedData, err := getSharedData(ctx, sharedDataID)
+	if errors.Is(err, errSharedDataNotFound) {
+		problemDetails := utils.ProblemDetailsContextNotFound("Shared data not found")
+		return httpwrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	}
+	if err != nil {
+		problemDetails := storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	original, err := json.Marshal(sharedData)
+	if err != nil {
+		problemDetails := utils.ProblemDetailsSystemFailure(err.Error())
+		return httpwrapper.NewResponse(http.StatusInternalServerError, nil, problemDetails)
+	}
+	modified, err := patch.Apply(original)
+	if err != nil {
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax(fmt.Sprintf("%s: %v", errInvalidPatch, err))
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	var updated map[string]interface{}
+	if err := json.Unmarshal(modified, &updated); err != nil {
+		problemDetails := utils.ProblemDetailsMalformedRequestSyntax(fmt.Sprintf("%s: %v", errInvalidPatch, err))
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+
+	if _, problemDetails := storeSharedData(ctx, sharedDataID, updated); problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, updated)
+}
+
+func HandleDeleteSharedDataRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle DeleteSharedDataRequest")
+	sharedDataID := request.Params["sharedDataId"]
+
+	sharedData, err := getSharedData(ctx, sharedDataID)
+	if errors.Is(err, errSharedDataNotFound) {
+		problemDetails := utils.ProblemDetailsContextNotFound("Shared data not found")
+		return httpwrapper.NewResponse(http.StatusNotFound, nil, problemDetails)
+	} else if err != nil {
+		problemDetails := storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+
+	// Shared data cannot be removed while NF profiles still inherit from it
+	nfInstanceIDs, err := referencingNFInstances(ctx, sharedDataID)
+	if err != nil {
+		problemDetails := storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	if len(nfInstanceIDs) != 0 {
+		problemDetails := sharedDataInUseProblemDetails(sharedDataID, nfInstanceIDs)
+		return httpwrapper.NewResponse(http.StatusConflict, nil, problemDetails)
+	}
+
+	filter := bson.M{"sharedDataId": sharedDataID}
+	if err := dbadapter.DeleteOne(ctx, sharedDataCollection, filter); err != nil {
+		problemDetails := storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	// An NF profile may have been registered with the shared data while it
+	// was being deleted: restore the shared data then
+	nfInstanceIDs, err = referencingNFInstances(ctx, sharedDataID)
+	if err == nil && len(nfInstanceIDs) == 0 {
+		return httpwrapper.NewResponse(http.StatusNoContent, nil, nil)
+	}
+	if _, restoreErr := dbadapter.PutOneNotUpdate(ctx, sharedDataCollection, filter, sharedData); restoreErr != nil {
+		logger.ManagementLog.Errorf("failed to restore shared data %s: %v", sharedDataID, restoreErr)
+	}
+	if err != nil {
+		problemDetails := storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	problemDetails := sharedDataInUseProblemDetails(sharedDataID, nfInstanceIDs)
+	return httpwrapper.NewResponse(http.StatusConflict, nil, problemDetails)
+}
+
+// referencingNFInstances returns the NF instances whose profile inherits from
+// the shared data, sorted.
+func referencingNFInstances(ctx context.Context, sharedDataID string) ([]string, error) {
+	referencing, err := dbadapter.GetMany(ctx, "NfProfile", sharedDataReferencesFilter(sharedDataID))
+	if err != nil {
+		return nil, err
+	}
+	nfInstanceIDs := make([]string, 0, len(referencing))
+	for _, doc := range referencing {
+		if nfInstanceID, ok := doc["nfinstanceid"].(string); ok {
+			nfInstanceIDs = append(nfInstanceIDs, nfInstanceID)
+		}
+	}
+	sort.Strings(nfInstanceIDs)
+	return nfInstanceIDs, nil
+}
+
+func sharedDataInUseProblemDetails(sharedDataID string, nfInstanceIDs []string) *models.ProblemDetails {
+	detail := fmt.Sprintf("shared data %s is referenced by NF instances %s", sharedDataID, strings.Join(nfInstanceIDs, ", "))
+	logger.ManagementLog.Warnln(detail)
+	return utils.ProblemDetails("Shared data in use", http.StatusConflict, detail)
+}
+
+// getSharedData returns the stored shared data, normalized to plain JSON
+// values, or errSharedDataNotFound.
+func getSharedData(ctx context.Context, sharedDataID string) (map[string]interface{}, error) {
+	doc, err := dbadapter.GetOne(ctx, sharedDataCollection, bson.M{"sharedDataId": sharedDataID})
+	if errors.Is(err, dbadapter.ErrNotFound) {
+		return nil, errSharedDataNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, "_id")
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var sharedData map[string]interface{}
+	if err := json.Unmarshal(b, &sharedData); err != nil {
+		return nil, err
+	}
+	return sharedData, nil
+}
+
+// storeSharedData validates and stores shared data, then refreshes every NF
+// profile inheriting from it.
+func storeSharedData(ctx context.Context, sharedDataID string, sharedData map[string]interface{}) (existed bool, problemDetails *models.ProblemDetails) {
+	if err := validateSharedData(sharedDataID, sharedData); err != nil {
+		logger.ManagementLog.Errorln("shared data validation failed:", err)
+		return false, profileValidationProblemDetails(err)
+	}
+	sharedData["sharedDataId"] = sharedDataID
+
+	existed, err := dbadapter.PutOne(ctx, sharedDataCollection, bson.M{"sharedDataId": sharedDataID}, sharedData)
+	if err != nil {
+		logger.ManagementLog.Errorln("RestfulAPIPutOne error:", err)
+		return false, storageProblemDetails(err, utils.ProblemDetailsSystemFailure(err.Error()))
+	}
+	if existed {
+		refreshSharedDataReferences(ctx, sharedDataID)
+	}
+	return existed, nil
+}
+
+// validateSharedData checks the SharedData of TS 29.510 clause 6.1.6.2.x: the
+// identifier must match the resource, exactly one of sharedProfileData and
+// sharedServiceData is present, and the fragment must be a valid part of an
+// NF profile or NF service.
+func validateSharedData(sharedDataID string, sharedData map[string]interface{}) error {
+	invalid := func(param, reason string) error {
+		invalidParam := models.InvalidParam{Param: param}
+		invalidParam.SetReason(reason)
+		return &nrfContext.ProfileValidationError{InvalidParams: []models.InvalidParam{invalidParam}}
+	}
+
+	if sharedDataID == "" {
+		return invalid("sharedDataId", "sharedDataId is required")
+	}
+	if id, ok := sharedData["sharedDataId"]; ok && id != sharedDataID {
+		return invalid("sharedDataId", fmt.Sprintf("sharedDataId %v does not match resource %s", id, sharedDataID))
+	}
+	profileData, hasProfileData := sharedData["sharedProfileData"]
+	serviceData, hasServiceData := sharedData["sharedServiceData"]
+	if hasProfileData == hasServiceData {
+		return invalid("sharedProfileData", "exactly one of sharedProfileData and sharedServiceData is required")
+	}
+
+	if hasServiceData {
+		serviceFragment, ok := serviceData.(map[string]interface{})
+		if !ok {
+			return invalid("sharedServiceData", "sharedServiceData must be an object")
+		}
+		for _, attr := range sharedServiceDataForbiddenAttributes {
+			if _, ok := serviceFragment[attr]; ok {
+				return invalid("sharedServiceData."+attr, attr+" cannot be shared")
+			}
+		}
+		b, err := json.Marshal(serviceFragment)
+		if err == nil {
+			err = json.Unmarshal(b, &models.NFService{})
+		}
+		if err != nil {
+			return invalid("sharedServiceData", err.Error())
+		}
+		return nil
+	}
+
+	profileFragment, ok := profileData.(map[string]interface{})
+	if !ok {
+		return invalid("sharedProfileData", "sharedProfileData must be an object")
+	}
+	for _, attr := range sharedProfileDataForbiddenAttributes {
+		if _, ok := profileFragment[attr]; ok {
+			return invalid("sharedProfileData."+attr, attr+" cannot be shared")
+		}
+	}
+
+	// Validate the fragment as part of a profile carrying placeholder
+	// values for the attributes every NF provides itself.
+	probe := map[string]interface{}{
+		"nfInstanceId": sharedDataID,
+		"nfType":       string(models.NFTYPE_UPF),
+		"nfStatus":     string(models.NFSTATUS_REGISTERED),
+	}
+	for key, value := range profileFragment {
+		probe[key] = value
+	}
+	b, err := json.Marshal(probe)
+	if err != nil {
+		return invalid("sharedProfileData", err.Error())
+	}
+	var probeProfile models.NFProfile
+	if err := json.Unmarshal(b, &probeProfile); err != nil {
+		return invalid("sharedProfileData", err.Error())
+	}
+	if err := nrfContext.ValidateNFProfile(probeProfile); err != nil {
+		var validationErr *nrfContext.ProfileValidationError
+		if errors.As(err, &validationErr) {
+			for i := range validationErr.InvalidParams {
+				validationErr.InvalidParams[i].Param = "sharedProfileData." + validationErr.InvalidParams[i].Param
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func sharedProfileData(sharedData map[string]interface{}) map[string]interface{} {
+	profileData, _ := sharedData["sharedProfileData"].(map[string]interface{})
+	return profileData
+}
+
+func sharedServiceData(sharedData map[string]interface{}) map[string]interface{} {
+	serviceData, _ := sharedData["sharedServiceData"].(map[string]interface{})
+	return serviceData
+}
+
+// resolveSharedProfileData merges the shared profile data referenced by the
+// sharedProfileDataId of nf, and the shared service data referenced by the
+// sharedServiceDataId of its NF services, in place of the attributes
+// previously taken from shared data. It returns the attributes taken from
+// shared data.
+func resolveSharedProfileData(ctx context.Context, nf *models.NFProfile, previous []string) ([]string, error) {
+	notRegistered := func(param, sharedDataID string) error {
+		invalidParam := models.InvalidParam{Param: param}
+		invalidParam.SetReason(fmt.Sprintf("shared data %s is not registered", sharedDataID))
+		return &nrfContext.ProfileValidationError{InvalidParams: []models.InvalidParam{invalidParam}}
+	}
+
+	var profileData map[string]interface{}
+	if sharedDataID, ok := nf.GetSharedProfileDataIdOk(); ok {
+		sharedData, err := getSharedData(ctx, *sharedDataID)
+		if errors.Is(err, errSharedDataNotFound) {
+			return nil, notRegistered("sharedProfileDataId", *sharedDataID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		profileData = sharedProfileData(sharedData)
+	}
+
+	serviceData := map[string]map[string]interface{}{}
+	resolveService := func(param string, service models.NFService) error {
+		sharedDataID, ok := service.GetSharedServiceDataIdOk()
+		if !ok {
+			return nil
+		}
+		if _, ok := serviceData[*sharedDataID]; ok {
+			return nil
+		}
+		sharedData, err := getSharedData(ctx, *sharedDataID)
+		if errors.Is(err, errSharedDataNotFound) {
+			return notRegistered(param+".sharedServiceDataId", *sharedDataID)
+		}
+		if err != nil {
+			return err
+		}
+		serviceData[*sharedDataID] = sharedServiceData(sharedData)
+		return nil
+	}
+	for i, service := range nf.GetNfServices() {
+		if err := resolveService(fmt.Sprintf("nfServices[%d]", i), service); err != nil {
+			return nil, err
+		}
+	}
+	for key, service := range nf.GetNfServiceList() {
+		if err := resolveService(fmt.Sprintf("nfServiceList.%s", key), service); err != nil {
+			return nil, err
+		}
+	}
+
+	merged, sharedAttributes, err := mergeSharedProfileData(*nf, profileData, serviceData, previous)
+	if err != nil {
+		return nil, err
+	}
+	*nf = merged
+	return sharedAttributes, nil
+}
+
+// mergeSharedProfileData drops the previously inherited attributes from nf
+// and copies every shared attribute the NF does not provide itself, since
+// attributes of the NF profile and NF services take precedence over shared
+// data. Attributes inherited by an NF service are listed as
+// "nfServices/<serviceInstanceId>/<attribute>" or
+// "nfServiceList/<key>/<attribute>".
+func mergeSharedProfileData(nf models.NFProfile, profileData map[string]interface{},
+	serviceData map[string]map[string]interface{}, previous []string,
+) (models.NFProfile, []string, error) {
+	profile, err := profileJSON(nf)
+	if err != nil {
+		return nf, nil, err
+	}
+	services := profileServices(profile)
+	for _, attr := range previous {
+		if i := strings.LastIndex(attr, "/"); i >= 0 {
+			if service, ok := services[attr[:i]]; ok {
+				delete(service, attr[i+1:])
+			}
+			continue
+		}
+		delete(profile, attr)
+	}
+	sharedAttributes := []string{}
+	for attr, value := range profileData {
+		if _, ok := profile[attr]; !ok {
+			profile[attr] = value
+			sharedAttributes = append(sharedAttributes, attr)
+		}
+	}
+	// Services inherited from shared profile data may reference shared
+	// service data as well
+	for path, service := range profileServices(profile) {
+		sharedDataID, _ := service["sharedServiceDataId"].(string)
+		for attr, value := range serviceData[sharedDataID] {
+			if _, ok := service[attr]; !ok {
+				service[attr] = value
+				sharedAttributes = append(sharedAttributes, path+"/"+attr)
+			}
+		}
+	}
+	sort.Strings(sharedAttributes)
+
+	b, err := json.Marshal(profile)
+	if err != nil {
+		return nf, nil, err
+	}
+	var merged models.NFProfile
+	if err := json.Unmarshal(b, &merged); err != nil {
+		return nf, nil, err
+	}
+	// Ranges inherited from shared data are still in their wire format
+	for _, attr := range sharedAttributes {
+		if attr == "bsfInfo" {
+			nrfContext.EncodeBsfInfoRanges(&merged)
+		}
+	}
+	return merged, sharedAttributes, nil
+}
+
+// profileServices returns the NF services of the JSON form of a profile by
+// their path in the shared attributes list.
+func profileServices(profile map[string]interface{}) map[string]map[string]interface{} {
+	services := map[string]map[string]interface{}{}
+	nfServices, _ := profile["nfServices"].([]interface{})
+	for _, entry := range nfServices {
+		if service, ok := entry.(map[string]interface{}); ok {
+			serviceInstanceID, _ := service["serviceInstanceId"].(string)
+			services["nfServices/"+serviceInstanceID] = service
+		}
+	}
+	nfServiceList, _ := profile["nfServiceList"].(map[string]interface{})
+	for key, entry := range nfServiceList {
+		if service, ok := entry.(map[string]interface{}); ok {
+			services["nfServiceList/"+key] = service
+		}
+	}
+	return services
+}
+
+// resolvePatchedSharedData resolves the shared data of the patched profile nf
+// again if the patch changed its references to shared data or the attributes
+// inherited from it, and returns the document to store. Inherited attributes
+// the patch changed are the NF's own from then on, and those it removed are
+// inherited again.
+func resolvePatchedSharedData(ctx context.Context, original, patched map[string]interface{},
+	nf *models.NFProfile,
+) (map[string]interface{}, error) {
+	previous := storedSharedAttributes(original)
+	if len(previous) == 0 && !nf.HasSharedProfileDataId() && len(sharedServiceDataIDs(*nf)) == 0 {
+		return patched, nil
+	}
+	originalProfile, err := util.DecodeNFProfile(original)
+	if err != nil {
+		return nil, err
+	}
+	before, err := profileJSON(originalProfile)
+	if err != nil {
+		return nil, err
+	}
+	after, err := profileJSON(*nf)
+	if err != nil {
+		return nil, err
+	}
+	inherited := []string{}
+	for _, attr := range previous {
+		value, ok := sharedAttributeValue(before, attr)
+		patchedValue, patchedOk := sharedAttributeValue(after, attr)
+		if ok && patchedOk && reflect.DeepEqual(value, patchedValue) {
+			inherited = append(inherited, attr)
+		}
+	}
+	if len(inherited) == len(previous) && reflect.DeepEqual(sharedDataReferences(before), sharedDataReferences(after)) {
+		return patched, nil
+	}
+
+	sharedAttributes, err := resolveSharedProfileData(ctx, nf, inherited)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := dbadapter.EncodeNFProfile(*nf)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"expireAt", "createdAt"} {
+		if value, ok := patched[key]; ok {
+			doc[key] = value
+		}
+	}
+	doc[sharedAttributesField] = sharedAttributes
+	doc[sharedServiceDataIDsField] = sharedServiceDataIDs(*nf)
+	return doc, nil
+}
+
+// profileJSON returns the JSON form of a profile.
+func profileJSON(nf models.NFProfile) (map[string]interface{}, error) {
+	b, err := json.Marshal(nf)
+	if err != nil {
+		return nil, err
+	}
+	profile := map[string]interface{}{}
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// sharedAttributeValue returns the value of an attribute of the shared
+// attributes list in the JSON form of a profile.
+func sharedAttributeValue(profile map[string]interface{}, attr string) (interface{}, bool) {
+	if i := strings.LastIndex(attr, "/"); i >= 0 {
+		service, ok := profileServices(profile)[attr[:i]]
+		if !ok {
+			return nil, false
+		}
+		value, ok := service[attr[i+1:]]
+		return value, ok
+	}
+	value, ok := profile[attr]
+	return value, ok
+}
+
+// sharedDataReferences returns the shared data referenced by the JSON form of
+// a profile, by the path of the NF service referencing it, or "" for the
+// profile itself.
+func sharedDataReferences(profile map[string]interface{}) map[string]interface{} {
+	references := map[string]interface{}{"": profile["sharedProfileDataId"]}
+	for path, service := range profileServices(profile) {
+		references[path] = service["sharedServiceDataId"]
+	}
+	return references
+}
+
+// sharedServiceDataIDs returns the shared service data the NF services of nf
+// reference, stored along the profile for the NF profiles referencing a
+// shared data to be found.
+func sharedServiceDataIDs(nf models.NFProfile) []string {
+	referenced := map[string]bool{}
+	for _, service := range nf.GetNfServices() {
+		if sharedDataID, ok := service.GetSharedServiceDataIdOk(); ok {
+			referenced[*sharedDataID] = true
+		}
+	}
+	for _, service := range nf.GetNfServiceList() {
+		if sharedDataID, ok := service.GetSharedServiceDataIdOk(); ok {
+			referenced[*sharedDataID] = true
+		}
+	}
+	sharedDataIDs := make([]string, 0, len(referenced))
+	for sharedDataID := range referenced {
+		sharedDataIDs = append(sharedDataIDs, sharedDataID)
+	}
+	sort.Strings(sharedDataIDs)
+	return sharedDataIDs
+}
+
+// sharedDataReferencesFilter matches the NF profiles referencing a shared
+// data, for their profile or one of their NF services.
+func sharedDataReferencesFilter(sharedDataID string) bson.M {
+	return bson.M{"$or": []interface{}{
+		bson.M{"sharedprofiledataid": sharedDataID},
+		bson.M{sharedServiceDataIDsField: sharedDataID},
+	}}
+}
+
+// refreshSharedDataReferences re-applies updated shared data to the NF
+// profiles inheriting from it.
+func refreshSharedDataReferences(ctx context.Context, sharedDataID string) {
+	collName := "NfProfile"
+	docs, err := dbadapter.GetMany(ctx, collName, sharedDataReferencesFilter(sharedDataID))
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to fetch NF profiles referencing shared data %s: %v", sharedDataID, err)
+		return
+	}
+	for _, doc := range docs {
+		nfInstanceID, _ := doc["nfinstanceid"].(string)
+		for attempt := 1; ; attempt++ {
+			swapped, err := refreshSharedProfile(ctx, collName, doc)
+			if err != nil {
+				logger.ManagementLog.Errorf("failed to refresh nf profile [%s] from shared data %s: %v", nfInstanceID, sharedDataID, err)
+				break
+			}
+			if swapped || attempt == nfInstanceUpdateAttempts {
+				break
+			}
+			// Modified concurrently: reload and retry
+			doc, err = dbadapter.GetOne(ctx, collName, bson.M{"nfinstanceid": nfInstanceID})
+			if err != nil || doc == nil {
+				break
+			}
+		}
+		profileCache.evict(nfInstanceID)
+	}
+}
+
+func refreshSharedProfile(ctx context.Context, collName string, doc map[string]interface{}) (bool, error) {
+	nf, err := util.DecodeNFProfile(doc)
+	if err != nil {
+		return false, err
+	}
+	merged := nf
+	sharedAttributes, err := resolveSharedProfileData(ctx, &merged, storedSharedAttributes(doc))
+	if err != nil {
+		return false, err
+	}
+	putData, err := dbadapter.EncodeNFProfile(merged)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range []string{"expireAt", "createdAt"} {
+		if value, ok := doc[key]; ok {
+			putData[key] = value
+		}
+	}
+	version := nfProfileVersion(doc)
+	putData[nfProfileVersionField] = version + 1
+	putData[sharedAttributesField] = sharedAttributes
+	putData[sharedServiceDataIDsField] = sharedServiceDataIDs(merged)
+	putData[dbadapter.SchemaVersionField] = dbadapter.NfProfileSchemaVersion
+	filter := bson.M{"nfinstanceid": merged.GetNfInstanceId()}
+	swapped, err := dbadapter.CompareAndSwap(ctx, collName, filter, nfProfileVersionCondition(version), putData)
+	if swapped {
+		notifyNFProfileChanged(ctx, doc, merged)
+	}
+	return swapped, err
+}
+
+func storedSharedAttributes(doc map[string]interface{}) []string {
+	var attrs []string
+	switch stored := doc[sharedAttributesField].(type) {
+	case []string:
+		attrs = stored
+	case []interface{}:
+		for _, attr := range stored {
+			if s, ok := attr.(string); ok {
+				attrs = append(attrs, s)
+			}
+		}
+	case bson.A:
+		for _, attr := range stored {
+			if s, ok := attr.(string); ok {
+				attrs = append(attrs, s)
+			}
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+)
+
+// storageProblemDetails describes a failed storage operation: 404, 409, 503
+// or 504 when err tells why it failed, otherwise problemDetails.
+func storageProblemDetails(err error, problemDetails *models.ProblemDetails) *models.ProblemDetails {
+	switch {
+	case errors.Is(err, dbadapter.ErrNotFound):
+		return utils.ProblemDetailsContextNotFound(err.Error())
+	case errors.Is(err, dbadapter.ErrConflict):
+		return utils.ProblemDetails("Conflict", http.StatusConflict, err.Error())
+	case errors.Is(err, dbadapter.ErrStorageUnavailable):
+		return utils.ProblemDetails("Service Unavailable", http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, dbadapter.ErrTimeout):
+		return utils.ProblemDetails("Gateway Timeout", http.StatusGatewayTimeout, err.Error())
+	default:
+		return problemDetails
+	}
+}
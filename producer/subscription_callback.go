@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/nrf/util"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// lookupCallbackHost resolves the host of a subscription callback, replaced
+// in tests.
+var lookupCallbackHost = net.DefaultResolver.LookupNetIP
+
+// validateSubscriptionCallback checks the nfStatusNotificationUri of a new
+// subscription against the configured callback rules.
+func validateSubscriptionCallback(ctx context.Context, callbackURI string) *models.ProblemDetails {
+	cfg := factory.NrfConfig.GetSubscriptionCallbackConfig()
+	uri, err := url.Parse(callbackURI)
+	if err != nil || !uri.IsAbs() || uri.Hostname() == "" {
+		return subscriptionProblemDetails(http.StatusBadRequest, "nfStatusNotificationUri",
+			"nfStatusNotificationUri must be an absolute URI")
+	}
+	if !slices.Contains(cfg.AllowedSchemes, strings.ToLower(uri.Scheme)) {
+		return subscriptionProblemDetails(http.StatusForbidden, "nfStatusNotificationUri",
+			"scheme "+uri.Scheme+" is not allowed for notifications")
+	}
+	host := uri.Hostname()
+	addrs, err := resolveCallbackHost(ctx, host, cfg.ProbeTimeout)
+	if err != nil && len(cfg.DeniedHosts) != 0 {
+		// Its addresses could not be checked against the denied hosts
+		logger.ManagementLog.Warnf("cannot resolve subscription callback host %s: %v", host, err)
+		return subscriptionProblemDetails(http.StatusBadRequest, "nfStatusNotificationUri",
+			"host "+host+" cannot be resolved")
+	}
+	if !callbackHostAllowed(host, addrs, cfg) {
+		return subscriptionProblemDetails(http.StatusForbidden, "nfStatusNotificationUri",
+			"host "+host+" is not allowed for notifications")
+	}
+	if cfg.Probe {
+		port := uri.Port()
+		if port == "" {
+			port = "80"
+			if strings.EqualFold(uri.Scheme, "https") {
+				port = "443"
+			}
+		}
+		// Probe the address checked, not whatever the name resolves to now
+		target := host
+		if len(addrs) != 0 {
+			target = addrs[0].String()
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(target, port), cfg.ProbeTimeout)
+		if err != nil {
+			logger.ManagementLog.Warnf("subscription callback %s is unreachable: %v", callbackURI, err)
+			return subscriptionProblemDetails(http.StatusBadRequest, "nfStatusNotificationUri",
+				"nfStatusNotificationUri is unreachable")
+		}
+		if err := conn.Close(); err != nil {
+			logger.ManagementLog.Debugf("failed to close callback probe connection: %v", err)
+		}
+	}
+	return nil
+}
+
+// resolveCallbackHost returns the addresses host resolves to, or host itself
+// when it is an IP address.
+func resolveCallbackHost(ctx context.Context, host string, timeout time.Duration) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addrs, err := lookupCallbackHost(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, nil
+}
+
+// callbackAddressDenied reports whether addr is one of the denied callback
+// hosts. The notification client checks every address it connects to, so
+// that a callback name resolving to a denied address after the subscription
+// was created is not reached either.
+func callbackAddressDenied(addr netip.Addr) bool {
+	return matchesHost(addr.Unmap().String(), factory.NrfConfig.GetSubscriptionCallbackConfig().DeniedHosts)
+}
+
+// callbackHostAllowed applies the callback host rules to host and the
+// addresses it resolves to. It is denied if its name or any of its addresses
+// is, so that a name cannot hide a denied address. When hosts are allowed
+// explicitly, its name or else every address must be.
+func callbackHostAllowed(host string, addrs []netip.Addr, cfg factory.SubscriptionCallback) bool {
+	if matchesHost(host, cfg.DeniedHosts) {
+		return false
+	}
+	for _, addr := range addrs {
+		if matchesHost(addr.String(), cfg.DeniedHosts) {
+			return false
+		}
+	}
+	if len(cfg.AllowedHosts) == 0 || matchesHost(host, cfg.AllowedHosts) {
+		return true
+	}
+	if len(addrs) == 0 {
+		return false
+	}
+	for _, addr := range addrs {
+		if !matchesHost(addr.String(), cfg.AllowedHosts) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesHost reports whether host is one of the rules: a name, a "*."
+// prefixed domain, an IP address or a CIDR block.
+func matchesHost(host string, rules []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	addr, addrErr := netip.ParseAddr(host)
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if prefix, err := netip.ParsePrefix(rule); err == nil {
+			if addrErr == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			continue
+		}
+		if ruleAddr, err := netip.ParseAddr(rule); err == nil {
+			if addrErr == nil && ruleAddr == addr.Unmap() {
+				return true
+			}
+			continue
+		}
+		if domain, ok := strings.CutPrefix(rule, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+			continue
+		}
+		if host == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeSubscription checks that the subscriber may monitor the NF
+// instances its condition names, under the allowedNfTypes, allowedPlmns and
+// allowedNssais rules applied by discovery. Conditions on other attributes
+// are checked against each profile when notifying.
+func authorizeSubscription(ctx context.Context, subscription models.SubscriptionData) *models.ProblemDetails {
+	if subscription.SubscrCond == nil {
+		return nil
+	}
+	nfInstanceIDs, err := nrfContext.SubscriptionNfInstanceIds(subscription)
+	if err != nil {
+		return subscriptionProblemDetails(http.StatusBadRequest, "subscrCond", err.Error())
+	}
+	for _, nfInstanceID := range nfInstanceIDs {
+		doc, err := dbadapter.GetOne(ctx, "NfProfile", bson.M{"nfinstanceid": nfInstanceID})
+		if errors.Is(err, dbadapter.ErrNotFound) {
+			// Not registered yet: checked when it is
+			continue
+		}
+		if err != nil {
+			logger.ManagementLog.Errorf("failed to fetch nf profile [%s]: %v", nfInstanceID, err)
+			return storageProblemDetails(err,
+				utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+		}
+		nfProfile, err := util.DecodeNFProfile(doc)
+		if err != nil {
+			logger.ManagementLog.Warnf("cannot decode nf profile [%s]: %v", nfInstanceID, err)
+			continue
+		}
+		if !nrfContext.SubscriberAllowed(subscription, nfProfile) {
+			return subscriptionProblemDetails(http.StatusForbidden, "subscrCond",
+				"not allowed to monitor NF instance "+nfInstanceID)
+		}
+	}
+	return nil
+}
+
+func subscriptionProblemDetails(status int, param, reason string) *models.ProblemDetails {
+	problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", status, reason, utils.CauseInvalidRequest)
+	if status == http.StatusForbidden {
+		problemDetails = utils.ProblemDetails("Forbidden", status, reason)
+	}
+	invalidParam := models.InvalidParam{Param: param}
+	invalidParam.SetReason(reason)
+	problemDetails.SetInvalidParams([]models.InvalidParam{invalidParam})
+	return problemDetails
+}
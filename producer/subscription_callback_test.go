@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/omec-project/nrf/factory"
+)
+
+func TestValidateSubscriptionCallbackResolvesHost(t *testing.T) {
+	originalLookup := lookupCallbackHost
+	originalCallback := factory.NrfConfig.Configuration.SubscriptionCallback
+	defer func() {
+		lookupCallbackHost = originalLookup
+		factory.NrfConfig.Configuration.SubscriptionCallback = originalCallback
+	}()
+	resolved := map[string][]string{
+		"smf.example.org":      {"10.0.0.5"},
+		"rebind.example.org":   {"10.0.0.6", "127.0.0.1"},
+		"metadata.example.org": {"::ffff:169.254.169.254"},
+	}
+	lookupCallbackHost = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		var addrs []netip.Addr
+		for _, addr := range resolved[host] {
+			addrs = append(addrs, netip.MustParseAddr(addr))
+		}
+		if len(addrs) == 0 {
+			return nil, errors.New("no such host")
+		}
+		return addrs, nil
+	}
+
+	testCases := []struct {
+		name         string
+		allowedHosts []string
+		deniedHosts  []string
+		callback     string
+		status       int32
+	}{
+		{"resolving to allowed addresses", nil, nil, "http://smf.example.org/notify", 0},
+		{"resolving to a loopback address", nil, nil, "http://rebind.example.org/notify", http.StatusForbidden},
+		{"resolving to a mapped link-local address", nil, nil, "http://metadata.example.org/notify", http.StatusForbidden},
+		{"unresolved", nil, nil, "http://unknown.example.org/notify", http.StatusBadRequest},
+		{"unresolved without denied hosts", nil, []string{}, "http://unknown.example.org/notify", 0},
+		{"allowed by address", []string{"10.0.0.0/24"}, nil, "http://smf.example.org/notify", 0},
+		{"not every address allowed", []string{"10.0.0.0/24", "127.0.0.1"}, nil, "http://rebind.example.org/notify", http.StatusForbidden},
+		{"unresolved and not allowed by name", []string{"10.0.0.0/24"}, []string{}, "http://unknown.example.org/notify", http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory.NrfConfig.Configuration.SubscriptionCallback = &factory.SubscriptionCallback{
+				AllowedHosts: tc.allowedHosts,
+				DeniedHosts:  tc.deniedHosts,
+			}
+			problemDetails := validateSubscriptionCallback(context.Background(), tc.callback)
+			if tc.status == 0 {
+				if problemDetails != nil {
+					t.Errorf("unexpected rejection %+v", problemDetails)
+				}
+				return
+			}
+			if problemDetails == nil || problemDetails.GetStatus() != tc.status {
+				t.Errorf("expected a %d rejection, got %+v", tc.status, problemDetails)
+			}
+		})
+	}
+}
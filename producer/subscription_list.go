@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	nrfContext "github.com/omec-project/nrf/context"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+	"github.com/omec-project/util/httpwrapper"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	queryParamReqNfType       = "reqNfType"
+	queryParamReqNfInstanceID = "reqNfInstanceId"
+	queryParamCallbackHost    = "callbackHost"
+	queryParamConditionType   = "conditionType"
+)
+
+// SubscriptionInfo is a stored subscription as shown to the operator, with
+// the delivery statistics of its notifications.
+type SubscriptionInfo struct {
+	Subscription  models.SubscriptionData `json:"subscription"`
+	ConditionType string                  `json:"conditionType,omitempty"`
+	Delivery      SubscriptionDelivery    `json:"delivery"`
+}
+
+// subscriptionsQuery holds the filters of the operator subscription list.
+// Empty values mean "not requested".
+type subscriptionsQuery struct {
+	reqNfType       string
+	reqNfInstanceID string
+	callbackHost    string
+	conditionType   string
+}
+
+func parseSubscriptionsQuery(values url.Values) (subscriptionsQuery, *models.ProblemDetails) {
+	query := subscriptionsQuery{
+		reqNfType:       values.Get(queryParamReqNfType),
+		reqNfInstanceID: values.Get(queryParamReqNfInstanceID),
+		callbackHost:    values.Get(queryParamCallbackHost),
+		conditionType:   values.Get(queryParamConditionType),
+	}
+	if query.conditionType != "" && !slices.Contains(nrfContext.SubscriptionConditionTypes, query.conditionType) {
+		problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", http.StatusBadRequest,
+			"unknown subscription condition type "+query.conditionType, utils.CauseInvalidRequest)
+		invalidParam := models.InvalidParam{Param: queryParamConditionType}
+		invalidParam.SetReason("must be one of " + strings.Join(nrfContext.SubscriptionConditionTypes, ", "))
+		problemDetails.SetInvalidParams([]models.InvalidParam{invalidParam})
+		return query, problemDetails
+	}
+	return query, nil
+}
+
+// filter selects the stored subscriptions by requester. The callback host and
+// the condition type are checked on the decoded subscriptions.
+func (q subscriptionsQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.reqNfType != "" {
+		filter["reqNfType"] = q.reqNfType
+	}
+	if q.reqNfInstanceID != "" {
+		filter["reqNfInstanceId"] = q.reqNfInstanceID
+	}
+	return filter
+}
+
+func (q subscriptionsQuery) matches(info SubscriptionInfo) bool {
+	if q.conditionType != "" && info.ConditionType != q.conditionType {
+		return false
+	}
+	if q.callbackHost != "" {
+		uri, err := url.Parse(info.Subscription.GetNfStatusNotificationUri())
+		if err != nil || !strings.EqualFold(uri.Hostname(), q.callbackHost) {
+			return false
+		}
+	}
+	return true
+}
+
+func HandleListSubscriptionsRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle ListSubscriptionsRequest")
+	query, problemDetails := parseSubscriptionsQuery(request.Query)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(http.StatusBadRequest, nil, problemDetails)
+	}
+	subscriptions, problemDetails := ListSubscriptionsProcedure(ctx, query)
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, subscriptions)
+}
+
+func HandleGetSubscriptionRequest(ctx context.Context, request *httpwrapper.Request) *httpwrapper.Response {
+	logger.ManagementLog.Infoln("Handle GetSubscriptionRequest")
+	subscription, problemDetails := GetSubscriptionProcedure(ctx, request.Params["subscriptionID"])
+	if problemDetails != nil {
+		return httpwrapper.NewResponse(int(problemDetails.GetStatus()), nil, problemDetails)
+	}
+	return httpwrapper.NewResponse(http.StatusOK, nil, subscription)
+}
+
+// ListSubscriptionsProcedure returns the stored subscriptions matching the
+// query, ordered by subscriptionId.
+func ListSubscriptionsProcedure(ctx context.Context, query subscriptionsQuery) ([]SubscriptionInfo, *models.ProblemDetails) {
+	docs, err := dbadapter.GetMany(ctx, "Subscriptions", query.filter())
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to list subscriptions: %v", err)
+		return nil, storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+	}
+	subscriptions := make([]SubscriptionInfo, 0, len(docs))
+	for _, doc := range docs {
+		info, err := subscriptionInfo(doc)
+		if err != nil {
+			logger.ManagementLog.Warnf("cannot decode subscription %v: %v", doc["subscriptionId"], err)
+			continue
+		}
+		if query.matches(info) {
+			subscriptions = append(subscriptions, info)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Subscription.GetSubscriptionId() < subscriptions[j].Subscription.GetSubscriptionId()
+	})
+	return subscriptions, nil
+}
+
+func GetSubscriptionProcedure(ctx context.Context, subscriptionID string) (*SubscriptionInfo, *models.ProblemDetails) {
+	doc, err := dbadapter.GetOne(ctx, "Subscriptions", bson.M{"subscriptionId": subscriptionID})
+	if errors.Is(err, dbadapter.ErrNotFound) {
+		return nil, utils.ProblemDetailsContextNotFound("Subscription not found")
+	}
+	if err != nil {
+		logger.ManagementLog.Errorf("failed to get subscription with ID %s: %v", subscriptionID, err)
+		return nil, storageProblemDetails(err,
+			utils.ProblemDetailsWithCause("Fetch error", http.StatusInternalServerError, err.Error(), utils.CauseFetchError))
+	}
+	info, err := subscriptionInfo(doc)
+	if err != nil {
+		logger.ManagementLog.Errorf("cannot decode subscription with ID %s: %v", subscriptionID, err)
+		return nil, utils.ProblemDetailsSystemFailure(err.Error())
+	}
+	return &info, nil
+}
+
+func subscriptionInfo(doc map[string]interface{}) (SubscriptionInfo, error) {
+	subscription, err := decodeSubscription(doc)
+	if err != nil {
+		return SubscriptionInfo{}, err
+	}
+	return SubscriptionInfo{
+		Subscription:  subscription,
+		ConditionType: nrfContext.SubscriptionConditionType(subscription),
+		Delivery:      subscriptionDelivery(subscription.GetSubscriptionId()),
+	}, nil
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/notification"
+	"github.com/omec-project/util/httpwrapper"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// subscriptionListDBClient answers queries on the requester attributes of the
+// stored subscriptions.
+type subscriptionListDBClient struct {
+	dbadapter.DBInterface
+	subscriptions []map[string]interface{}
+}
+
+func (db *subscriptionListDBClient) RestfulAPIGetMany(collName string, filter bson.M) ([]map[string]interface{}, error) {
+	var docs []map[string]interface{}
+	for _, doc := range db.subscriptions {
+		matches := true
+		for key, value := range filter {
+			matches = matches && doc[key] == value
+		}
+		if matches {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (db *subscriptionListDBClient) RestfulAPIGetOne(collName string, filter bson.M) (map[string]interface{}, error) {
+	for _, doc := range db.subscriptions {
+		if doc["subscriptionId"] == filter["subscriptionId"] {
+			return doc, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestListSubscriptionsFiltersAndReportsDelivery(t *testing.T) {
+	originalDBClient := dbadapter.DBClient
+	defer func() {
+		dbadapter.DBClient = originalDBClient
+	}()
+	dbadapter.DBClient = &subscriptionListDBClient{subscriptions: []map[string]interface{}{
+		{
+			"subscriptionId":          "sub-2",
+			"nfStatusNotificationUri": "http://smf-1.example.org/notify",
+			"reqNfType":               "SMF",
+			"reqNfInstanceId":         "smf-1",
+			"subscrCond":              bson.M{"nfType": "AMF"},
+			"expireAt":                time.Now(),
+		},
+		{
+			"subscriptionId":          "sub-1",
+			"nfStatusNotificationUri": "http://SMF-1.example.org:8080/other",
+			"reqNfType":               "SMF",
+			"reqNfInstanceId":         "smf-1",
+			"subscrCond":              bson.M{"nfInstanceId": "amf-1"},
+		},
+		{
+			"subscriptionId":          "sub-3",
+			"nfStatusNotificationUri": "http://ausf.example.org/notify",
+			"reqNfType":               "AUSF",
+		},
+	}}
+	defer forgetSubscriptionDelivery("sub-1")
+
+	recordSubscriptionDelivery(notification.Attempt{
+		Notification: notification.Notification{Event: "NF_REGISTERED", Subscription: "sub-1"},
+		Attempt:      1,
+		Err:          errors.New("503 Service Unavailable"),
+	})
+	recordSubscriptionDelivery(notification.Attempt{
+		Notification: notification.Notification{Event: "NF_REGISTERED", Subscription: "sub-1"},
+		Attempt:      2,
+		Final:        true,
+	})
+
+	list := func(query string) []SubscriptionInfo {
+		t.Helper()
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := HandleListSubscriptionsRequest(context.Background(), &httpwrapper.Request{Query: values})
+		if response.Status != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d: %+v", query, response.Status, response.Body)
+		}
+		return response.Body.([]SubscriptionInfo)
+	}
+	ids := func(subscriptions []SubscriptionInfo) []string {
+		var ids []string
+		for _, subscription := range subscriptions {
+			ids = append(ids, subscription.Subscription.GetSubscriptionId())
+		}
+		return ids
+	}
+
+	for query, want := range map[string][]string{
+		"":                               {"sub-1", "sub-2", "sub-3"},
+		"reqNfType=SMF":                  {"sub-1", "sub-2"},
+		"reqNfInstanceId=smf-1":          {"sub-1", "sub-2"},
+		"callbackHost=smf-1.example.org": {"sub-1", "sub-2"},
+		"conditionType=NfTypeCond":       {"sub-2"},
+		"reqNfType=AUSF&callbackHost=ausf.example.org": {"sub-3"},
+		"reqNfType=SMF&conditionType=NfInstanceIdCond": {"sub-1"},
+	} {
+		if got := ids(list(query)); !slices.Equal(got, want) {
+			t.Errorf("%q: got %v, want %v", query, got, want)
+		}
+	}
+
+	response := HandleListSubscriptionsRequest(context.Background(), &httpwrapper.Request{Query: url.Values{"conditionType": {"Unknown"}}})
+	if response.Status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown condition type, got %d", response.Status)
+	}
+
+	response = HandleGetSubscriptionRequest(context.Background(), &httpwrapper.Request{Params: map[string]string{"subscriptionID": "sub-1"}})
+	if response.Status != http.StatusOK {
+		t.Fatalf("unexpected status %d: %+v", response.Status, response.Body)
+	}
+	info := response.Body.(*SubscriptionInfo)
+	delivery := info.Delivery
+	if info.ConditionType != "NfInstanceIdCond" || delivery.Attempts != 2 || delivery.Delivered != 1 ||
+		delivery.Failed != 0 || delivery.LastDelivered == nil || delivery.LastEvent != "NF_REGISTERED" ||
+		delivery.LastError != "503 Service Unavailable" {
+		t.Errorf("unexpected subscription %+v", info)
+	}
+
+	response = HandleGetSubscriptionRequest(context.Background(), &httpwrapper.Request{Params: map[string]string{"subscriptionID": "unknown"}})
+	if response.Status != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown subscription, got %d", response.Status)
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/nrf/notification"
+)
+
+// SubscriptionDelivery counts the NF status notifications sent for a
+// subscription by this NRF instance since it started.
+type SubscriptionDelivery struct {
+	Attempts      uint64     `json:"attempts"`
+	Delivered     uint64     `json:"delivered"`
+	Failed        uint64     `json:"failed"`
+	LastEvent     string     `json:"lastEvent,omitempty"`
+	LastAttempt   *time.Time `json:"lastAttempt,omitempty"`
+	LastDelivered *time.Time `json:"lastDelivered,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+var subscriptionDeliveries = struct {
+	sync.Mutex
+	stats map[string]*SubscriptionDelivery
+}{stats: map[string]*SubscriptionDelivery{}}
+
+// recordSubscriptionDelivery observes the notification dispatcher. Failed
+// counts the notifications given up, not the attempts that are retried.
+func recordSubscriptionDelivery(attempt notification.Attempt) {
+	if attempt.Subscription == "" {
+		return
+	}
+	now := time.Now()
+	subscriptionDeliveries.Lock()
+	defer subscriptionDeliveries.Unlock()
+	delivery, ok := subscriptionDeliveries.stats[attempt.Subscription]
+	if !ok {
+		delivery = &SubscriptionDelivery{}
+		subscriptionDeliveries.stats[attempt.Subscription] = delivery
+	}
+	if attempt.Attempt > 0 {
+		delivery.Attempts++
+		delivery.LastAttempt = &now
+	}
+	delivery.LastEvent = attempt.Event
+	switch {
+	case attempt.Err == nil:
+		delivery.Delivered++
+		delivery.LastDelivered = &now
+	case attempt.Final:
+		delivery.Failed++
+		delivery.LastError = attempt.Err.Error()
+	default:
+		delivery.LastError = attempt.Err.Error()
+	}
+}
+
+func subscriptionDelivery(subscriptionID string) SubscriptionDelivery {
+	subscriptionDeliveries.Lock()
+	defer subscriptionDeliveries.Unlock()
+	if delivery, ok := subscriptionDeliveries.stats[subscriptionID]; ok {
+		return *delivery
+	}
+	return SubscriptionDelivery{}
+}
+
+func forgetSubscriptionDelivery(subscriptionID string) {
+	subscriptionDeliveries.Lock()
+	defer subscriptionDeliveries.Unlock()
+	delete(subscriptionDeliveries.stats, subscriptionID)
+}
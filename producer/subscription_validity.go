@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
+)
+
+// subscriptionExpiryField keeps the granted validityTime of a subscription
+// as a date, which the TTL index of the Subscriptions collection removes it
+// by. It is not part of the SubscriptionData returned to the subscriber.
+const subscriptionExpiryField = "expireAt"
+
+// grantValidityTime returns the validityTime granted for the requested one:
+// as asked, unless a maximum is configured and none or a later one is
+// requested. The zero time is returned when none is requested nor configured:
+// the subscription then lasts until removed.
+func grantValidityTime(requested *time.Time, now time.Time) (time.Time, *models.ProblemDetails) {
+	maxValidity := factory.NrfConfig.GetMaxSubscriptionValidity()
+	if requested == nil {
+		if maxValidity == 0 {
+			return time.Time{}, nil
+		}
+		return now.Add(maxValidity).UTC().Truncate(time.Second), nil
+	}
+	if !requested.After(now) {
+		return time.Time{}, validityTimeProblemDetails("validityTime must be in the future")
+	}
+	if latest := now.Add(maxValidity).UTC().Truncate(time.Second); maxValidity != 0 && requested.After(latest) {
+		return latest, nil
+	}
+	return requested.UTC(), nil
+}
+
+// subscriptionPatchValidityTime extracts the validityTime requested by a
+// subscription update. As per TS 29.510, the patch may only replace the
+// validityTime.
+func subscriptionPatchValidityTime(patchJSON []byte) (time.Time, *models.ProblemDetails) {
+	var patchItems []models.PatchItem
+	if err := json.Unmarshal(patchJSON, &patchItems); err != nil {
+		return time.Time{}, utils.ProblemDetailsMalformedRequestSyntax("invalid JSON Patch: " + err.Error())
+	}
+	if len(patchItems) == 0 {
+		return time.Time{}, utils.ProblemDetailsMalformedRequestSyntax("JSON Patch must not be empty")
+	}
+
+	var requested time.Time
+	for _, patchItem := range patchItems {
+		if patchItem.Path != "/validityTime" ||
+			(patchItem.Op != models.PATCHOPERATION_REPLACE && patchItem.Op != models.PATCHOPERATION_ADD) {
+			problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", http.StatusBadRequest,
+				"only the validityTime of a subscription can be updated", utils.CauseInvalidRequest)
+			invalidParam := models.InvalidParam{Param: patchItem.Path}
+			invalidParam.SetReason(fmt.Sprintf("%s of %s is not allowed", patchItem.Op, patchItem.Path))
+			problemDetails.SetInvalidParams([]models.InvalidParam{invalidParam})
+			return time.Time{}, problemDetails
+		}
+		value, ok := patchItem.Value.(string)
+		if !ok {
+			return time.Time{}, validityTimeProblemDetails("validityTime must be a date-time")
+		}
+		var err error
+		if requested, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, validityTimeProblemDetails("validityTime must be a date-time")
+		}
+	}
+	return requested, nil
+}
+
+func validityTimeProblemDetails(reason string) *models.ProblemDetails {
+	problemDetails := utils.ProblemDetailsWithCause("Invalid Parameter", http.StatusBadRequest, reason, utils.CauseInvalidRequest)
+	invalidParam := models.InvalidParam{Param: "validityTime"}
+	invalidParam.SetReason(reason)
+	problemDetails.SetInvalidParams([]models.InvalidParam{invalidParam})
+	return problemDetails
+}
+
+// decodeSubscription converts a stored subscription to the SubscriptionData
+// returned to the subscriber.
+func decodeSubscription(doc map[string]interface{}) (models.SubscriptionData, error) {
+	var subscription models.SubscriptionData
+	data := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		if key != subscriptionExpiryField && key != dbadapter.SchemaVersionField && key != "_id" {
+			data[key] = value
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return subscription, err
+	}
+	err = json.Unmarshal(b, &subscription)
+	return subscription, err
+}
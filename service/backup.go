@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/factory"
+	"github.com/omec-project/nrf/logger"
+	"github.com/omec-project/util/mongoapi"
+	"github.com/urfave/cli/v3"
+)
+
+var nrfExportCli = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "output",
+		Usage:    "file the registry state is written to",
+		Required: true,
+	},
+	&cli.StringSliceFlag{
+		Name:  "nf-type",
+		Usage: "only export the NF profiles, and the subscriptions, of this NF type (repeatable)",
+	},
+}
+
+var nrfImportCli = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "input",
+		Usage:    "file the registry state is read from, as written by export",
+		Required: true,
+	},
+}
+
+func (*NRF) GetExportCliCmd() (flags []cli.Flag) {
+	return nrfExportCli
+}
+
+func (*NRF) GetImportCliCmd() (flags []cli.Flag) {
+	return nrfImportCli
+}
+
+// Export writes the NF profiles, subscriptions and shared data kept in the
+// configured storage to the file given by the output flag.
+func (nrf *NRF) Export(c *cli.Command) error {
+	db, closeStorage, err := openStorage(factory.NrfConfig.GetStorageConfig())
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	var nfTypes []string
+	for _, nfType := range c.StringSlice("nf-type") {
+		nfTypes = append(nfTypes, strings.ToUpper(nfType))
+	}
+	export, err := dbadapter.ExportData(db, nfTypes)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode export: %w", err)
+	}
+	output := c.String("output")
+	if err := os.WriteFile(output, append(content, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	for _, collName := range dbadapter.ExportedCollections {
+		logger.InitLog.Infof("exported %d %s documents to %s", len(export.Collections[collName]), collName, output)
+	}
+	return nil
+}
+
+// Import stores in the configured storage the NF profiles, subscriptions and
+// shared data of the file given by the input flag.
+func (nrf *NRF) Import(c *cli.Command) error {
+	input := c.String("input")
+	content, err := os.ReadFile(input)
+	if err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+	var export dbadapter.Export
+	if err := json.Unmarshal(content, &export); err != nil {
+		return fmt.Errorf("invalid export %s: %w", input, err)
+	}
+
+	db, closeStorage, err := openStorage(factory.NrfConfig.GetStorageConfig())
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	imported, err := dbadapter.ImportData(db, &export)
+	if err != nil {
+		return err
+	}
+	logger.InitLog.Infof("imported %d documents from %s, exported at %s", imported, input, export.ExportedAt)
+	return nil
+}
+
+// openStorage connects to the configured storage, outside of a running NRF,
+// and returns it with the function closing it.
+func openStorage(storage factory.Storage) (dbadapter.DBInterface, func(), error) {
+	switch storage.Driver {
+	case factory.NRF_STORAGE_DRIVER_MEMORY:
+		return nil, nil, fmt.Errorf("the memory storage keeps no data outside of a running NRF")
+	case factory.NRF_STORAGE_DRIVER_FILE:
+		// a running NRF would overwrite the file with the data it holds
+		db, err := dbadapter.OpenFileDBClient(storage.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() {}, nil
+	default:
+		config := factory.NrfConfig.Configuration
+		client, err := mongoapi.NewMongoClient(config.MongoDBUrl, config.MongoDBName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+		}
+		closeStorage := func() {
+			if err := client.Client.Disconnect(context.TODO()); err != nil {
+				logger.InitLog.Warnf("failed to disconnect from MongoDB: %v", err)
+			}
+		}
+		return dbadapter.NewMongoDBClient(client), closeStorage, nil
+	}
+}
@@ -7,6 +7,9 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -14,13 +17,15 @@ import (
 	"time"
 
 	"github.com/omec-project/nrf/accesstoken"
-	"github.com/omec-project/nrf/context"
+	nrfContext "github.com/omec-project/nrf/context"
 	"github.com/omec-project/nrf/dbadapter"
 	"github.com/omec-project/nrf/discovery"
 	"github.com/omec-project/nrf/factory"
 	"github.com/omec-project/nrf/logger"
 	"github.com/omec-project/nrf/management"
 	"github.com/omec-project/nrf/metrics"
+	"github.com/omec-project/nrf/oam"
+	"github.com/omec-project/nrf/producer"
 	openapiLogger "github.com/omec-project/openapi/v2/logger"
 	"github.com/omec-project/util/http2_util"
 	utilLogger "github.com/omec-project/util/logger"
@@ -73,7 +78,7 @@ func (nrf *NRF) Initialize(c *cli.Command) error {
 
 	factory.NrfConfig.CfgLocation = absPath
 
-	context.InitNrfContext()
+	nrfContext.InitNrfContext()
 
 	return nil
 }
@@ -90,16 +95,94 @@ func (nrf *NRF) setLogLevel() {
 	utilLogger.ApplyLogSetting("Util", cfgLogger.Util, utilLogger.UtilLog, utilLogger.SetLogLevel)
 }
 
+// migrateStorage copies the NRF data from the storage configured to migrate
+// from, as long as the one in use holds none, then upgrades the stored
+// documents to the current schema.
+func (nrf *NRF) migrateStorage(storage factory.Storage) error {
+	var copied int
+	var err error
+	switch storage.MigrateFrom {
+	case factory.NRF_STORAGE_DRIVER_MONGODB:
+		config := factory.NrfConfig.Configuration
+		copied, err = dbadapter.MigrateFromMongoDB(config.MongoDBUrl, config.MongoDBName, dbadapter.DBClient)
+	case factory.NRF_STORAGE_DRIVER_FILE:
+		copied, err = dbadapter.MigrateFromFile(storage.Path, dbadapter.DBClient)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate storage from %s: %w", storage.MigrateFrom, err)
+	}
+	if storage.MigrateFrom != "" {
+		logger.InitLog.Infof("migrated %d documents from %s storage", copied, storage.MigrateFrom)
+	}
+
+	changes, err := dbadapter.MigrateSchema(dbadapter.DBClient, storage.SchemaDryRun)
+	if err != nil {
+		return fmt.Errorf("failed to migrate stored documents to the current schema: %w", err)
+	}
+	if storage.SchemaDryRun {
+		logger.InitLog.Infof("schema dry run: %d documents would be migrated to the current schema", len(changes))
+	} else if len(changes) != 0 {
+		logger.InitLog.Infof("migrated %d documents to the current schema", len(changes))
+	}
+	return nil
+}
+
 func (nrf *NRF) Start() {
 	logger.InitLog.Infoln("server started")
 	config := factory.NrfConfig.Configuration
-	dbadapter.ConnectToDBClient(config.MongoDBName, config.MongoDBUrl, config.MongoDBStreamEnable, config.NfProfileExpiryEnable)
+	ctx, cancel := context.WithCancel(context.Background())
+	storage := factory.NrfConfig.GetStorageConfig()
+	dbadapter.OperationTimeout = storage.OperationTimeout
+	switch storage.Driver {
+	case factory.NRF_STORAGE_DRIVER_MEMORY:
+		dbadapter.ConnectToMemoryDBClient(config.NfProfileExpiryEnable)
+		if err := nrf.migrateStorage(storage); err != nil {
+			logger.InitLog.Fatalf("%+v", err)
+		}
+	case factory.NRF_STORAGE_DRIVER_FILE:
+		if _, err := dbadapter.ConnectToFileDBClient(storage.Path, config.NfProfileExpiryEnable); err != nil {
+			logger.InitLog.Fatalf("failed to open storage: %+v", err)
+		}
+		if err := nrf.migrateStorage(storage); err != nil {
+			logger.InitLog.Fatalf("%+v", err)
+		}
+	default:
+		if config.MongoDBStreamEnable {
+			// Every NRF sharing the database sees each profile deletion
+			producer.EnableDeregistrationClaims()
+		}
+		// Not ready until connected: requests are refused meanwhile
+		dbadapter.ConnectToDBClient(ctx, dbadapter.MongoDBConfig{
+			Name:                  config.MongoDBName,
+			Url:                   config.MongoDBUrl,
+			StreamEnable:          config.MongoDBStreamEnable,
+			NfProfileExpiryEnable: config.NfProfileExpiryEnable,
+			ConnectTimeout:        storage.ConnectTimeout,
+			MaxBackoff:            storage.MaxBackoff,
+			// A failed migration is retried, the NRF staying not ready.
+			OnConnected: func(dbadapter.DBInterface) error {
+				return nrf.migrateStorage(storage)
+			},
+			OnChange: producer.HandleNFProfileChange,
+		})
+	}
+	producer.StartNFStatusNotifier()
+	if batching := factory.NrfConfig.GetHeartbeatBatchingConfig(); batching.Enable {
+		producer.StartHeartbeatBatching(batching.Window, batching.MaxBatch)
+	}
+	if config.NfProfileExpiryEnable {
+		producer.StartNFProfileExpiry()
+	}
 
 	router := utilLogger.NewGinWithZap(logger.GinLog)
+	router.Use(requireStorage)
 
 	accesstoken.AddService(router)
 	discovery.AddService(router)
 	management.AddService(router)
+	oam.AddReadinessService(router)
+
+	go serveOam(factory.NrfConfig.GetOamConfig())
 
 	go metrics.InitMetrics()
 
@@ -107,6 +190,7 @@ func (nrf *NRF) Start() {
 	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-signalChannel
+		cancel()
 		// Waiting for other NFs to deregister
 		time.Sleep(2 * time.Second)
 		nrf.Terminate()
@@ -143,7 +227,30 @@ func (nrf *NRF) Start() {
 	}
 }
 
+// oamReadHeaderTimeout bounds reading the headers of an operator API request.
+const oamReadHeaderTimeout = 10 * time.Second
+
+// serveOam serves the operator API on its own listener, so that it is not
+// open to the NFs reaching the SBI.
+func serveOam(config factory.Oam) {
+	router := utilLogger.NewGinWithZap(logger.GinLog)
+	router.Use(requireStorage)
+	oam.AddService(router)
+	logger.InitLog.Infof("operator API binding addr: [%s]", config.BindAddr)
+	server := &http.Server{
+		Addr:              config.BindAddr,
+		Handler:           router,
+		ReadHeaderTimeout: oamReadHeaderTimeout,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		logger.InitLog.Errorf("could not serve the operator API: %v", err)
+	}
+}
+
 func (nrf *NRF) Terminate() {
 	logger.InitLog.Infoln("terminating NRF")
+	producer.StopHeartbeatBatching()
+	producer.StopNFProfileExpiry()
+	producer.StopNFStatusNotifier()
 	logger.InitLog.Infoln("NRF terminated")
 }
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2025 Canonical Ltd
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/nrf/dbadapter"
+	"github.com/omec-project/nrf/oam"
+	"github.com/omec-project/openapi/v2/utils"
+)
+
+// storageRetryAfter is the Retry-After, in seconds, of the requests refused
+// while the storage cannot be reached.
+const storageRetryAfter = "5"
+
+// requireStorage refuses the requests with 503 while the storage cannot be
+// reached, rather than letting them fail or hang on it. The readiness probe
+// is always served.
+func requireStorage(c *gin.Context) {
+	if dbadapter.Ready() || strings.HasPrefix(c.Request.URL.Path, oam.ReadinessPath) {
+		c.Next()
+		return
+	}
+	c.Header("Retry-After", storageRetryAfter)
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable,
+		utils.ProblemDetails("Service Unavailable", http.StatusServiceUnavailable, "storage is not reachable"))
+}
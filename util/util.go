@@ -19,8 +19,7 @@ import (
 // format is retained for API compatibility but is no longer used.
 func Decode(source any, _ string) ([]models.NFProfileDiscovery, error) {
 	// json.Unmarshal uses pre-compiled field offsets (faster than mapstructure reflection).
-	// Pre-process first to decode any JSON-string-encoded arrays/objects in the source.
-	b, err := json.Marshal(preprocessJSONStrings(source))
+	b, err := json.Marshal(jsonValues(source))
 	if err != nil {
 		return nil, fmt.Errorf("marshal failed: %w", err)
 	}
@@ -36,47 +35,54 @@ func Decode(source any, _ string) ([]models.NFProfileDiscovery, error) {
 	return target, nil
 }
 
-// preprocessJSONStrings recursively copies v, decoding string values that contain
-// a JSON array or object into their native Go types. This preserves backward
-// compatibility with documents that stored structured fields as JSON strings.
-// For Go struct/pointer/slice values (e.g. from unit tests), it converts them
-// through a JSON round-trip and strips empty-string fields to avoid enum
-// validation errors on the outer unmarshal (MongoDB data never stores empty
-// strings for validated enum fields).
-func preprocessJSONStrings(v any) any {
+// DecodeNFProfile converts a stored NfProfile document into models.NFProfile.
+// Unlike Decode it targets the NF management schema, so attributes that
+// NFProfileDiscovery does not carry (e.g. heartBeatTimer, nrfInfo) are kept.
+func DecodeNFProfile(source map[string]any) (models.NFProfile, error) {
+	var target models.NFProfile
+	b, err := json.Marshal(jsonValues(source))
+	if err != nil {
+		return target, fmt.Errorf("marshal failed: %w", err)
+	}
+	if err := json.Unmarshal(b, &target); err != nil {
+		return target, fmt.Errorf("unmarshal failed: %w", err)
+	}
+	return target, nil
+}
+
+// jsonValues recursively copies v for encoding to JSON. Stored documents are
+// taken as they are: those of older releases, which kept structured fields as
+// JSON strings, are converted by the schema migration at startup (see
+// dbadapter.MigrateSchema). For Go struct/pointer/slice values (e.g. from unit
+// tests), it converts them through a JSON round-trip and strips empty-string
+// fields to avoid enum validation errors on the outer unmarshal (MongoDB data
+// never stores empty strings for validated enum fields).
+func jsonValues(v any) any {
 	switch val := v.(type) {
 	case nil:
 		return nil
 	case map[string]any:
 		out := make(map[string]any, len(val))
 		for k, elem := range val {
-			out[k] = preprocessJSONStrings(elem)
+			out[k] = jsonValues(elem)
 		}
 		return out
 	case []map[string]any:
 		out := make([]any, len(val))
 		for i, elem := range val {
-			out[i] = preprocessJSONStrings(elem)
+			out[i] = jsonValues(elem)
 		}
 		return out
 	case []any:
 		out := make([]any, len(val))
 		for i, elem := range val {
-			out[i] = preprocessJSONStrings(elem)
+			out[i] = jsonValues(elem)
 		}
 		return out
-	case string:
-		if len(val) > 0 && (val[0] == '[' || val[0] == '{') {
-			var parsed any
-			if json.Unmarshal([]byte(val), &parsed) == nil {
-				return parsed
-			}
-		}
-		return val
 	default:
 		// Pass primitive types through without a JSON round-trip to avoid recursion.
 		switch val.(type) {
-		case bool,
+		case string, bool,
 			int, int8, int16, int32, int64,
 			uint, uint8, uint16, uint32, uint64,
 			float32, float64:
@@ -92,7 +98,7 @@ func preprocessJSONStrings(v any) any {
 		if json.Unmarshal(b, &intermediate) != nil {
 			return val
 		}
-		return removeEmptyStrings(preprocessJSONStrings(intermediate))
+		return removeEmptyStrings(jsonValues(intermediate))
 	}
 }
 
@@ -240,63 +240,6 @@ func TestDecodeRangeValidation(t *testing.T) {
 	}
 }
 
-// TestDecodeJSONStringHook verifies that the JSON-string decode hook correctly
-// unmarshals JSON-encoded strings into their destination slice and map types.
-// This covers the DB-retrieval use case where values are stored as JSON strings
-// rather than their native Go types.
-func TestDecodeJSONStringHook(t *testing.T) {
-	cases := []struct {
-		name        string
-		field       string
-		jsonValue   string
-		checkResult func(t *testing.T, p models.NFProfileDiscovery)
-	}{
-		{
-			// Direct slice target: NsiList []string
-			name:      "NsiList from JSON string",
-			field:     "NsiList",
-			jsonValue: `["nsi0","nsi1"]`,
-			checkResult: func(t *testing.T, p models.NFProfileDiscovery) {
-				got, ok := p.GetNsiListOk()
-				if !ok || len(got) != 2 || got[0] != "nsi0" || got[1] != "nsi1" {
-					t.Fatalf("unexpected NsiList: %v", got)
-				}
-			},
-		},
-		{
-			// Pointer-to-slice target: AllowedNssais *[]models.Snssai
-			name:      "AllowedNssais from JSON string",
-			field:     "AllowedNssais",
-			jsonValue: `[{"sst":1,"sd":"010203"}]`,
-			checkResult: func(t *testing.T, p models.NFProfileDiscovery) {
-				got, ok := p.GetAllowedNssaisOk()
-				if !ok || len(got) != 1 || got[0].GetSst() != 1 {
-					t.Fatalf("unexpected AllowedNssais: %v", got)
-				}
-			},
-		},
-	}
-
-	for _, tc := range cases {
-		t.Run(tc.name, func(t *testing.T) {
-			profile := map[string]any{
-				"NfInstanceId": "json-hook-test",
-				"NfType":       models.NFTYPE_NRF,
-				"NfStatus":     models.NFSTATUS_REGISTERED,
-				tc.field:       tc.jsonValue,
-			}
-			result, err := Decode([]map[string]any{profile}, time.RFC3339)
-			if err != nil {
-				t.Fatalf("Decode returned error: %v", err)
-			}
-			if len(result) != 1 {
-				t.Fatalf("expected 1 profile, got %d", len(result))
-			}
-			tc.checkResult(t, result[0])
-		})
-	}
-}
-
 func TestConvertNFProfileDiscoveryToNFProfile(t *testing.T) {
 	recoveryTime := time.Now().UTC().Truncate(time.Second)
 	discovery := models.NFProfileDiscovery{